@@ -18,6 +18,7 @@ import { toast } from "sonner";
 import { motion } from "framer-motion";
 import { useRouter } from "next/navigation";
 import { SERVER_URL } from "@/lib/constants";
+import { authFetch } from "@/lib/auth";
 import { Badge } from "@/components/ui/badge";
 import { Leaf, AlertCircle } from "lucide-react";
 
@@ -132,23 +133,14 @@ export default function Dashboard() {
     },
   };
 
-  // Get auth token from localStorage
-  const getAuthToken = () => {
-    return (
-      localStorage.getItem("authToken") || sessionStorage.getItem("authToken")
-    );
-  };
-
   // Generate todos for the week
   const generateWeeklyTodos = async () => {
     setGeneratingTodos(true);
     try {
-      const token = getAuthToken();
-      const response = await fetch(`${SERVER_URL}/api/weekly-todos/generate`, {
+      const response = await authFetch(`${SERVER_URL}/api/weekly-todos/generate`, {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
-          Authorization: `Bearer ${token}`,
         },
         body: JSON.stringify({ generate_new_week: false }),
       });
@@ -173,12 +165,8 @@ export default function Dashboard() {
   const fetchCurrentWeekTodos = useCallback(async () => {
     setLoading(true);
     try {
-      const token = getAuthToken();
-      const response = await fetch(`${SERVER_URL}/api/weekly-todos/current`, {
+      const response = await authFetch(`${SERVER_URL}/api/weekly-todos/current`, {
         method: "GET",
-        headers: {
-          Authorization: `Bearer ${token}`,
-        },
       });
 
       const data = await response.json();
@@ -213,16 +201,14 @@ export default function Dashboard() {
   // Toggle completion status of a todo item
   const toggleTodoCompletion = async (todoId: string, isCompleted: boolean) => {
     try {
-      const token = getAuthToken();
       if (!weeklyData) return;
 
-      const response = await fetch(
+      const response = await authFetch(
         `${SERVER_URL}/api/weekly-todos/${weeklyData.id}/items/${todoId}`,
         {
           method: "PUT",
           headers: {
             "Content-Type": "application/json",
-            Authorization: `Bearer ${token}`,
           },
           body: JSON.stringify({
             is_completed: isCompleted,
@@ -267,11 +253,9 @@ export default function Dashboard() {
   const fetchNutritionDetails = useCallback(async () => {
     setLoadingNutrition(true);
     try {
-      const token = getAuthToken();
-      const response = await fetch(`${SERVER_URL}/api/user/nutrition-details`, {
+      const response = await authFetch(`${SERVER_URL}/api/user/nutrition-details`, {
         method: "GET",
         headers: {
-          Authorization: `Bearer ${token}`,
           "Content-Type": "application/json",
         },
       });
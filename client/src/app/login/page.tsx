@@ -19,6 +19,7 @@ import {
 } from '@/components/ui/card';
 import { Input } from '@/components/ui/input';
 import { Label } from '@/components/ui/label';
+import { storeAuthTokens } from '@/lib/auth';
 import { SERVER_URL } from '@/lib/constants';
 
 export default function LoginPage() {
@@ -54,14 +55,11 @@ export default function LoginPage() {
 
                 // Store token in localStorage
                 if (data.data?.token) {
-                    localStorage.setItem("authToken", data.data.token);
+                    storeAuthTokens(data.data);
                     localStorage.setItem("userName", data.data.fullName);
                     localStorage.setItem("userData", JSON.stringify(data.data));
 
                     // Direct cookie setting as fallback
-                    document.cookie = `authToken=${data.data.token}; max-age=${
-                        60 * 60 * 24 * 7
-                    }; path=/`;
                     document.cookie = `userName=${
                         data.data.fullName
                     }; max-age=${60 * 60 * 24 * 7}; path=/`;
@@ -10,15 +10,13 @@ import { motion } from "framer-motion";
 const dietaryPreferencesOptions = [
   { id: "vegetarian", label: "Vegetarian" },
   { id: "vegan", label: "Vegan" },
-  { id: "keto", label: "Keto" },
-  { id: "paleo", label: "Paleo" },
   { id: "pescatarian", label: "Pescatarian" },
-  { id: "low_carb", label: "Low Carb" },
-  { id: "low_sugar", label: "Low Sugar" },
+  { id: "keto", label: "Keto" },
+  { id: "ayurvedic", label: "Ayurvedic" },
+  { id: "jain", label: "Jain" },
   { id: "low_sodium", label: "Low Sodium" },
-  { id: "high_protein", label: "High Protein" },
-  { id: "gluten_free", label: "Gluten Free" },
-  { id: "dairy_free", label: "Dairy Free" },
+  { id: "low_sugar", label: "Low Sugar" },
+  { id: "gluten_lactose_free", label: "Gluten & Lactose Free" },
   { id: "no_specific_diet", label: "No Specific Diet" },
 ];
 
@@ -11,9 +11,12 @@ const healthGoalsOptions = [
   { id: "weight_loss", label: "Weight Loss" },
   { id: "muscle_gain", label: "Muscle Gain" },
   { id: "heart_health", label: "Heart Health" },
-  { id: "diabetes_management", label: "Diabetes Management" },
+  { id: "diabetes", label: "Diabetes Management" },
+  { id: "sugar_control", label: "Sugar Control" },
+  { id: "low_sodium_diet", label: "Low Sodium Diet" },
+  { id: "plant_based", label: "Plant Based" },
+  { id: "clean_eating", label: "Clean Eating" },
   { id: "general_wellness", label: "General Wellness" },
-  { id: "energy_boost", label: "Energy Boost" },
 ];
 
 export default function HealthGoalsPage() {
@@ -7,18 +7,17 @@ import { Button } from "@/components/ui/button";
 import StepIndicator from "@/components/features/onboarding_flow/components/StepIndicator";
 import { motion } from "framer-motion";
 import { SERVER_URL } from "@/lib/constants";
+import { storeAuthTokens } from "@/lib/auth";
 
 const prioritiesOptions = [
-  { id: "low_sugar", label: "Low Sugar" },
-  { id: "low_sodium", label: "Low Sodium" },
+  { id: "low_sugar_priority", label: "Low Sugar" },
+  { id: "low_sodium_priority", label: "Low Sodium" },
   { id: "low_fat", label: "Low Fat" },
   { id: "high_protein", label: "High Protein" },
   { id: "high_fiber", label: "High Fiber" },
-  { id: "low_calories", label: "Low Calories" },
-  { id: "no_artificial_ingredients", label: "No Artificial Ingredients" },
-  { id: "organic", label: "Organic" },
-  { id: "sustainable", label: "Sustainable" },
-  { id: "balanced", label: "Balanced Nutrition" },
+  { id: "no_additives", label: "No Additives" },
+  { id: "natural_ingredients", label: "Natural Ingredients" },
+  { id: "fssai_verified", label: "FSSAI Verified" },
 ];
 
 export default function NutritionPrioritiesPage() {
@@ -76,14 +75,12 @@ export default function NutritionPrioritiesPage() {
       password: userDetails.password || "",
       healthStatus: "Healthy", // Default value
       healthGoals: finalUserData.healthGoals || [],
-      dietaryPreferences: finalUserData.dietaryPreferences || [],
+      // "No Specific Diet" only clears the other choices
+      dietaryPreferences: (finalUserData.dietaryPreferences || []).filter(
+        (preference: string) => preference !== "no_specific_diet"
+      ),
       foodAllergies: foodAllergies,
-      nutritionPriorities: selectedPriorities.map((priority) => {
-        const label =
-          prioritiesOptions.find((option) => option.id === priority)?.label ||
-          "";
-        return label;
-      }),
+      nutritionPriorities: selectedPriorities,
       workOutsPerWeek: finalUserData.workoutFrequency || "",
       age: finalUserData.userInfo?.age || "",
       height: finalUserData.userInfo?.height || "",
@@ -121,17 +118,14 @@ export default function NutritionPrioritiesPage() {
       const data = await response.json();
       console.log("User created successfully", data);
 
-      // Store user ID and authentication token from response
-      if (data) {
-        if (data.id) {
-          sessionStorage.setItem("userId", data.id);
+      // Store user ID and authentication tokens from response
+      if (data?.data) {
+        if (data.data._id) {
+          sessionStorage.setItem("userId", data.data._id);
         }
 
-        // Store the token - important for authentication
-        if (data.token) {
-          localStorage.setItem("authToken", data.token);
-          sessionStorage.setItem("authToken", data.token);
-        }
+        // Store the tokens - important for authentication
+        storeAuthTokens(data.data);
       }
 
       // Redirect to congratulations page
@@ -1,5 +1,7 @@
 import { useState } from 'react';
 
+import { authFetch, getAuthToken } from '@/lib/auth';
+
 interface EatFoodButtonProps {
     barcode?: string;
     nutritionalElements?: string[];
@@ -26,20 +28,19 @@ export default function EatFoodButton({
 
         setIsLoading(true);
         try {
-            const token = localStorage.getItem("authToken");
-            if (!token) {
+            if (!getAuthToken()) {
                 console.error("No auth token found");
                 return;
             }
 
-            const response = await fetch("/api/user/nutritional-status", {
+            const response = await authFetch("/api/user/nutritional-status", {
                 method: "PUT",
                 headers: {
                     "Content-Type": "application/json",
-                    Authorization: `Bearer ${token}`,
                 },
                 body: JSON.stringify({
                     nutritionalElements: nutritionalElements,
+                    barcode: barcode,
                 }),
             });
 
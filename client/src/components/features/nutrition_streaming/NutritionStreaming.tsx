@@ -1,6 +1,7 @@
 import React, { useEffect, useRef, useState } from "react";
 
 import { Card, CardContent } from "@/components/ui/card";
+import { getFreshAuthToken } from "@/lib/auth";
 import { WS_URL } from "@/lib/constants";
 
 interface StreamMessage {
@@ -46,9 +47,10 @@ export function NutritionStreaming({
     }
   }, [initialBarcode, isConnected]);
 
-  const connectWebSocket = () => {
-    const token =
-      localStorage.getItem("authToken") || sessionStorage.getItem("authToken");
+  const connectWebSocket = async (isActive: () => boolean = () => true) => {
+    // The token is only checked when connecting, so make sure it's current
+    const token = await getFreshAuthToken();
+    if (!isActive()) return;
 
     if (!token) {
       console.error("No authentication token found");
@@ -127,8 +129,12 @@ export function NutritionStreaming({
   };
 
   useEffect(() => {
-    connectWebSocket();
-    return () => disconnectWebSocket();
+    let active = true;
+    connectWebSocket(() => active);
+    return () => {
+      active = false;
+      disconnectWebSocket();
+    };
   }, []);
 
   return (
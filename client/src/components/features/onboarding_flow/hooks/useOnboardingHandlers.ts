@@ -4,6 +4,7 @@ import { useCallback } from 'react';
 
 import { useRouter } from 'next/navigation';
 
+import { storeAuthTokens } from '@/lib/auth';
 import { SERVER_URL } from '@/lib/constants';
 
 interface OnboardingHandlersProps {
@@ -192,12 +193,10 @@ export const useOnboardingHandlers = ({
 
                 if (data.success) {
                     if (data.data?.token) {
-                        // Store token in localStorage
+                        // Store the access and refresh tokens
+                        storeAuthTokens(data.data);
 
                         // Set direct cookies as fallback
-                        document.cookie = `authToken=${
-                            data.data.token
-                        }; max-age=${60 * 60 * 24 * 7}; path=/`;
                         document.cookie = `userName=${
                             userDetails.name
                         }; max-age=${60 * 60 * 24 * 7}; path=/`;
@@ -287,7 +286,7 @@ export const useOnboardingHandlers = ({
                 if (data.success) {
                     // Store token in localStorage
                     if (data.data?.token) {
-                        localStorage.setItem("authToken", data.data.token);
+                        storeAuthTokens(data.data);
 
                         // Store preferences locally for client-side use
                         localStorage.setItem(
@@ -296,9 +295,6 @@ export const useOnboardingHandlers = ({
                         );
 
                         // Direct cookie setting as fallback
-                        document.cookie = `authToken=${
-                            data.data.token
-                        }; max-age=${60 * 60 * 24 * 7}; path=/`;
                         document.cookie = `userName=${
                             userDetails.name
                         }; max-age=${60 * 60 * 24 * 7}; path=/`;
@@ -0,0 +1,129 @@
+import { SERVER_URL } from "@/lib/constants";
+
+// Sign-in returns a short-lived access token (15 minutes by default) and a
+// refresh token that is exchanged at /api/user/refresh for a new pair. The
+// refresh token rotates on every use and replaying an old one signs the
+// device out, so concurrent refreshes share one request.
+
+const ACCESS_TOKEN_KEY = "authToken";
+const REFRESH_TOKEN_KEY = "refreshToken";
+const COOKIE_MAX_AGE = 60 * 60 * 24 * 7;
+
+// Refresh this many seconds before the access token expires
+const EXPIRY_MARGIN_SECONDS = 30;
+
+export interface AuthTokens {
+  token?: string;
+  refreshToken?: string;
+}
+
+export function storeAuthTokens(tokens: AuthTokens | undefined) {
+  if (!tokens?.token) return;
+
+  localStorage.setItem(ACCESS_TOKEN_KEY, tokens.token);
+  sessionStorage.setItem(ACCESS_TOKEN_KEY, tokens.token);
+  if (tokens.refreshToken) {
+    localStorage.setItem(REFRESH_TOKEN_KEY, tokens.refreshToken);
+  }
+
+  // Direct cookie setting as fallback
+  document.cookie = `authToken=${tokens.token}; max-age=${COOKIE_MAX_AGE}; path=/`;
+}
+
+export function clearAuthTokens() {
+  localStorage.removeItem(ACCESS_TOKEN_KEY);
+  sessionStorage.removeItem(ACCESS_TOKEN_KEY);
+  localStorage.removeItem(REFRESH_TOKEN_KEY);
+  document.cookie = "authToken=; max-age=0; path=/";
+}
+
+export function getAuthToken(): string | null {
+  return (
+    localStorage.getItem(ACCESS_TOKEN_KEY) ||
+    sessionStorage.getItem(ACCESS_TOKEN_KEY)
+  );
+}
+
+let refreshing: Promise<string | null> | null = null;
+
+// refreshAuthToken exchanges the stored refresh token for a new pair and
+// returns the new access token, or null when the user has to sign in again
+export function refreshAuthToken(): Promise<string | null> {
+  if (!refreshing) {
+    refreshing = requestRefresh().finally(() => {
+      refreshing = null;
+    });
+  }
+  return refreshing;
+}
+
+async function requestRefresh(): Promise<string | null> {
+  const refreshToken = localStorage.getItem(REFRESH_TOKEN_KEY);
+  if (!refreshToken) return null;
+
+  try {
+    const response = await fetch(`${SERVER_URL}/api/user/refresh`, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify({ refreshToken }),
+    });
+
+    if (response.status === 401) {
+      clearAuthTokens();
+      return null;
+    }
+
+    const data = await response.json();
+    if (!response.ok || !data.success || !data.data?.token) {
+      console.error("Failed to refresh token:", data.message);
+      return null;
+    }
+
+    storeAuthTokens(data.data);
+    return data.data.token;
+  } catch (error) {
+    console.error("Error refreshing token:", error);
+    return null;
+  }
+}
+
+function tokenExpiresSoon(token: string): boolean {
+  try {
+    const payload = JSON.parse(
+      atob(token.split(".")[1].replace(/-/g, "+").replace(/_/g, "/"))
+    );
+    if (typeof payload.exp !== "number") return false;
+    return payload.exp - EXPIRY_MARGIN_SECONDS <= Date.now() / 1000;
+  } catch {
+    return false;
+  }
+}
+
+// getFreshAuthToken returns an access token that isn't about to expire, for
+// connections that can't retry, like the WebSocket
+export async function getFreshAuthToken(): Promise<string | null> {
+  const token = getAuthToken();
+  if (token && !tokenExpiresSoon(token)) return token;
+  return (await refreshAuthToken()) || token;
+}
+
+// authFetch sends the access token and, when the API answers 401, refreshes
+// it once and retries
+export async function authFetch(
+  input: string,
+  init: RequestInit = {}
+): Promise<Response> {
+  const send = (token: string | null) => {
+    const headers = new Headers(init.headers);
+    if (token) headers.set("Authorization", `Bearer ${token}`);
+    return fetch(input, { ...init, headers });
+  };
+
+  const response = await send(await getFreshAuthToken());
+  if (response.status !== 401) return response;
+
+  const token = await refreshAuthToken();
+  return token ? send(token) : response;
+}
@@ -27,6 +27,7 @@ export interface UserCreationResponse {
     phoneNo: string;
     role: string;
     token: string;
+    refreshToken?: string;
   };
   timestamp: string;
 }
@@ -0,0 +1,187 @@
+// Package barcode validates retail barcodes and normalizes them to the GTIN
+// form product databases are keyed by.
+package barcode
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Format is the symbology a barcode was entered in
+type Format string
+
+const (
+	EAN8   Format = "EAN-8"
+	EAN13  Format = "EAN-13"
+	UPCA   Format = "UPC-A"
+	UPCE   Format = "UPC-E"
+	GTIN14 Format = "GTIN-14"
+)
+
+var (
+	// ErrInvalid is wrapped by every validation error
+	ErrInvalid = errors.New("invalid barcode")
+
+	ErrEmpty             = fmt.Errorf("%w: barcode is empty", ErrInvalid)
+	ErrInvalidCharacters = fmt.Errorf("%w: only digits are allowed", ErrInvalid)
+	ErrInvalidLength     = fmt.Errorf("%w: expected 6, 8, 12, 13 or 14 digits", ErrInvalid)
+	ErrCheckDigit        = fmt.Errorf("%w: check digit does not match", ErrInvalid)
+	ErrCaseCode          = fmt.Errorf("%w: GTIN-14 case codes identify packaging, not a product", ErrInvalid)
+)
+
+// Barcode is a validated barcode
+type Barcode struct {
+	// Input is what was entered, without spaces and dashes
+	Input  string `json:"input"`
+	Format Format `json:"format"`
+	// GTIN is the normalized code: EAN-13, or EAN-8 for 8 digit codes
+	GTIN string `json:"gtin"`
+	// Prefix is the GS1 prefix the code starts with
+	Prefix string `json:"gs1_prefix"`
+	// Country is the GS1 member organisation that issued the prefix. It says
+	// where the company registered, not where the product was made.
+	Country string `json:"gs1_country,omitempty"`
+	Usage   Usage  `json:"usage"`
+	// VariableMeasure codes embed a weight or price, so each label differs
+	VariableMeasure bool `json:"variable_measure"`
+}
+
+func (b *Barcode) String() string {
+	return b.GTIN
+}
+
+// InStore reports whether the code is only meaningful inside one shop or
+// company, e.g. loose produce weighed at the counter
+func (b *Barcode) InStore() bool {
+	return b.Usage == UsageInStore
+}
+
+// Lookupable reports whether product databases can know this code
+func (b *Barcode) Lookupable() bool {
+	return b.Usage == UsageTrade || b.Usage == UsagePublication
+}
+
+// Parse validates a barcode and normalizes it. UPC-E and UPC-A become
+// EAN-13 by expansion and zero padding, GTIN-14 with a zero indicator drops it.
+func Parse(input string) (*Barcode, error) {
+	code := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(input))
+	if code == "" {
+		return nil, ErrEmpty
+	}
+	if !isDigits(code) {
+		return nil, ErrInvalidCharacters
+	}
+
+	b := &Barcode{Input: code}
+	switch len(code) {
+	case 6:
+		// UPC-E without number system and check digit
+		upca := ExpandUPCE("0" + code)
+		b.Format = UPCE
+		b.GTIN = "0" + upca + CheckDigit("0"+upca)
+	case 8:
+		// A leading 0 or 1 is a UPC-E number system; EAN-8 codes there are
+		// in-store velocity codes, so UPC-E wins when its check digit fits
+		if code[0] <= '1' {
+			upca := ExpandUPCE(code[:7])
+			if CheckDigit(upca) == code[7:] {
+				b.Format = UPCE
+				b.GTIN = "0" + upca + code[7:]
+				break
+			}
+		}
+		if !ValidCheckDigit(code) {
+			return nil, ErrCheckDigit
+		}
+		b.Format = EAN8
+		b.GTIN = code
+	case 12:
+		if !ValidCheckDigit(code) {
+			return nil, ErrCheckDigit
+		}
+		b.Format = UPCA
+		b.GTIN = "0" + code
+	case 13:
+		if !ValidCheckDigit(code) {
+			return nil, ErrCheckDigit
+		}
+		b.Format = EAN13
+		b.GTIN = code
+	case 14:
+		if !ValidCheckDigit(code) {
+			return nil, ErrCheckDigit
+		}
+		if code[0] != '0' {
+			return nil, ErrCaseCode
+		}
+		b.Format = GTIN14
+		b.GTIN = code[1:]
+	default:
+		return nil, ErrInvalidLength
+	}
+
+	classify(b)
+	return b, nil
+}
+
+// Normalize returns the GTIN of a valid barcode
+func Normalize(input string) (string, error) {
+	b, err := Parse(input)
+	if err != nil {
+		return "", err
+	}
+	return b.GTIN, nil
+}
+
+// CheckDigit computes the GS1 check digit of a code without one
+func CheckDigit(payload string) string {
+	sum := 0
+	for i := len(payload) - 1; i >= 0; i-- {
+		digit := int(payload[i] - '0')
+		// Weights alternate 3, 1, 3, ... starting from the rightmost digit
+		if (len(payload)-1-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return string(rune('0' + (10-sum%10)%10))
+}
+
+// ValidCheckDigit reports whether the last digit of code is its check digit
+func ValidCheckDigit(code string) bool {
+	if len(code) < 2 || !isDigits(code) {
+		return false
+	}
+	return CheckDigit(code[:len(code)-1]) == code[len(code)-1:]
+}
+
+// ExpandUPCE turns a number system digit and six UPC-E digits into the eleven
+// digits of the UPC-A code before its check digit
+func ExpandUPCE(upce string) string {
+	ns, d := upce[:1], upce[1:7]
+	switch d[5] {
+	case '0', '1', '2':
+		return ns + d[0:2] + d[5:6] + "0000" + d[2:5]
+	case '3':
+		return ns + d[0:3] + "00000" + d[3:5]
+	case '4':
+		return ns + d[0:4] + "00000" + d[4:5]
+	default:
+		return ns + d[0:5] + "0000" + d[5:6]
+	}
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,138 @@
+package barcode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    string
+	}{
+		{"400638133393", "1"},
+		{"590123412345", "7"},
+		{"03600029145", "2"},
+		{"9638507", "4"},
+		{"01234500006", "5"},
+		{"04210000526", "4"},
+		{"0001234567890", "5"},
+		{"978030640615", "7"},
+	}
+	for _, tt := range tests {
+		if got := CheckDigit(tt.payload); got != tt.want {
+			t.Errorf("CheckDigit(%q) = %s, want %s", tt.payload, got, tt.want)
+		}
+		if !ValidCheckDigit(tt.payload + tt.want) {
+			t.Errorf("ValidCheckDigit(%q) = false", tt.payload+tt.want)
+		}
+	}
+
+	for _, code := range []string{"4006381333932", "", "7", "40063813339a1"} {
+		if ValidCheckDigit(code) {
+			t.Errorf("ValidCheckDigit(%q) = true", code)
+		}
+	}
+}
+
+func TestExpandUPCE(t *testing.T) {
+	// One case per last digit rule
+	tests := []struct {
+		upce string
+		want string
+	}{
+		{"0123450", "01200000345"},
+		{"0425261", "04210000526"},
+		{"0123452", "01220000345"},
+		{"0123453", "01230000045"},
+		{"0123454", "01234000005"},
+		{"0123456", "01234500006"},
+		{"1123459", "11234500009"},
+	}
+	for _, tt := range tests {
+		if got := ExpandUPCE(tt.upce); got != tt.want {
+			t.Errorf("ExpandUPCE(%q) = %s, want %s", tt.upce, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input  string
+		format Format
+		gtin   string
+		usage  Usage
+	}{
+		{"01234565", UPCE, "0012345000065", UsageReserved},
+		{"04252614", UPCE, "0042100005264", UsageReserved},
+		{"123456", UPCE, "0012345000065", UsageReserved},
+		{"96385074", EAN8, "96385074", UsageReserved},
+		{"036000291452", UPCA, "0036000291452", UsageReserved},
+		{"0360-0029 1452", UPCA, "0036000291452", UsageReserved},
+		{"4006381333931", EAN13, "4006381333931", UsageReserved},
+		{"9780306406157", EAN13, "9780306406157", UsagePublication},
+		{"00012345678905", GTIN14, "0012345678905", UsageReserved},
+	}
+	for _, tt := range tests {
+		b, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.input, err)
+			continue
+		}
+		if b.Format != tt.format || b.GTIN != tt.gtin {
+			t.Errorf("Parse(%q) = %s %s, want %s %s", tt.input, b.Format, b.GTIN, tt.format, tt.gtin)
+		}
+		if tt.usage != UsageReserved && b.Usage != tt.usage {
+			t.Errorf("Parse(%q) usage = %s, want %s", tt.input, b.Usage, tt.usage)
+		}
+		if !ValidCheckDigit(b.GTIN) {
+			t.Errorf("Parse(%q) GTIN %s has a wrong check digit", tt.input, b.GTIN)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		want  error
+	}{
+		{"", ErrEmpty},
+		{" - ", ErrEmpty},
+		{"40063813339a1", ErrInvalidCharacters},
+		{"12345", ErrInvalidLength},
+		{"123456789", ErrInvalidLength},
+		{"4006381333932", ErrCheckDigit},
+		{"036000291453", ErrCheckDigit},
+		{"96385075", ErrCheckDigit},
+		{"10012345678902", ErrCaseCode},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Parse(%q) error = %v, want %v", tt.input, err, tt.want)
+		}
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) error %v doesn't wrap ErrInvalid", tt.input, err)
+		}
+	}
+}
+
+func TestClassify(t *testing.T) {
+	inStore := "2012345" + CheckDigit("2012345")
+	b, err := Parse(inStore)
+	if err != nil {
+		t.Fatalf("Parse(%q) error: %v", inStore, err)
+	}
+	if !b.InStore() || b.Lookupable() {
+		t.Errorf("Parse(%q) usage = %s, want in-store", inStore, b.Usage)
+	}
+
+	weighed := "211234567890" + CheckDigit("211234567890")
+	b, err = Parse(weighed)
+	if err != nil {
+		t.Fatalf("Parse(%q) error: %v", weighed, err)
+	}
+	if !b.VariableMeasure {
+		t.Errorf("Parse(%q) isn't a variable measure code", weighed)
+	}
+}
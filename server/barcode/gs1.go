@@ -0,0 +1,184 @@
+package barcode
+
+import "strconv"
+
+// Usage says what a GS1 prefix range is reserved for
+type Usage string
+
+const (
+	UsageTrade       Usage = "trade"
+	UsageInStore     Usage = "in_store"
+	UsageCoupon      Usage = "coupon"
+	UsageRefund      Usage = "refund_receipt"
+	UsagePublication Usage = "publication"
+	UsageReserved    Usage = "reserved"
+)
+
+type prefixRange struct {
+	from, to int
+	country  string
+	usage    Usage
+}
+
+// gs1Prefixes are the three digit EAN-13 prefix ranges allocated by GS1
+var gs1Prefixes = []prefixRange{
+	{0, 19, "United States and Canada", UsageTrade},
+	{20, 29, "", UsageInStore},
+	{30, 39, "United States", UsageTrade},
+	{40, 49, "", UsageInStore},
+	{50, 59, "", UsageCoupon},
+	{60, 139, "United States and Canada", UsageTrade},
+	{200, 299, "", UsageInStore},
+	{300, 379, "France and Monaco", UsageTrade},
+	{380, 380, "Bulgaria", UsageTrade},
+	{383, 383, "Slovenia", UsageTrade},
+	{385, 385, "Croatia", UsageTrade},
+	{387, 387, "Bosnia and Herzegovina", UsageTrade},
+	{389, 389, "Montenegro", UsageTrade},
+	{390, 390, "Kosovo", UsageTrade},
+	{400, 440, "Germany", UsageTrade},
+	{450, 459, "Japan", UsageTrade},
+	{460, 469, "Russia", UsageTrade},
+	{470, 470, "Kyrgyzstan", UsageTrade},
+	{471, 471, "Taiwan", UsageTrade},
+	{474, 474, "Estonia", UsageTrade},
+	{475, 475, "Latvia", UsageTrade},
+	{476, 476, "Azerbaijan", UsageTrade},
+	{477, 477, "Lithuania", UsageTrade},
+	{478, 478, "Uzbekistan", UsageTrade},
+	{479, 479, "Sri Lanka", UsageTrade},
+	{480, 480, "Philippines", UsageTrade},
+	{481, 481, "Belarus", UsageTrade},
+	{482, 482, "Ukraine", UsageTrade},
+	{483, 483, "Turkmenistan", UsageTrade},
+	{484, 484, "Moldova", UsageTrade},
+	{485, 485, "Armenia", UsageTrade},
+	{486, 486, "Georgia", UsageTrade},
+	{487, 487, "Kazakhstan", UsageTrade},
+	{488, 488, "Tajikistan", UsageTrade},
+	{489, 489, "Hong Kong", UsageTrade},
+	{490, 499, "Japan", UsageTrade},
+	{500, 509, "United Kingdom", UsageTrade},
+	{520, 521, "Greece", UsageTrade},
+	{528, 528, "Lebanon", UsageTrade},
+	{529, 529, "Cyprus", UsageTrade},
+	{530, 530, "Albania", UsageTrade},
+	{531, 531, "North Macedonia", UsageTrade},
+	{535, 535, "Malta", UsageTrade},
+	{539, 539, "Ireland", UsageTrade},
+	{540, 549, "Belgium and Luxembourg", UsageTrade},
+	{560, 560, "Portugal", UsageTrade},
+	{569, 569, "Iceland", UsageTrade},
+	{570, 579, "Denmark", UsageTrade},
+	{590, 590, "Poland", UsageTrade},
+	{594, 594, "Romania", UsageTrade},
+	{599, 599, "Hungary", UsageTrade},
+	{600, 601, "South Africa", UsageTrade},
+	{603, 603, "Ghana", UsageTrade},
+	{604, 604, "Senegal", UsageTrade},
+	{608, 608, "Bahrain", UsageTrade},
+	{609, 609, "Mauritius", UsageTrade},
+	{611, 611, "Morocco", UsageTrade},
+	{613, 613, "Algeria", UsageTrade},
+	{615, 615, "Nigeria", UsageTrade},
+	{616, 616, "Kenya", UsageTrade},
+	{618, 618, "Côte d'Ivoire", UsageTrade},
+	{619, 619, "Tunisia", UsageTrade},
+	{620, 620, "Tanzania", UsageTrade},
+	{621, 621, "Syria", UsageTrade},
+	{622, 622, "Egypt", UsageTrade},
+	{623, 623, "Brunei", UsageTrade},
+	{624, 624, "Libya", UsageTrade},
+	{625, 625, "Jordan", UsageTrade},
+	{626, 626, "Iran", UsageTrade},
+	{627, 627, "Kuwait", UsageTrade},
+	{628, 628, "Saudi Arabia", UsageTrade},
+	{629, 629, "United Arab Emirates", UsageTrade},
+	{630, 630, "Qatar", UsageTrade},
+	{640, 649, "Finland", UsageTrade},
+	{690, 699, "China", UsageTrade},
+	{700, 709, "Norway", UsageTrade},
+	{729, 729, "Israel", UsageTrade},
+	{730, 739, "Sweden", UsageTrade},
+	{740, 740, "Guatemala", UsageTrade},
+	{741, 741, "El Salvador", UsageTrade},
+	{742, 742, "Honduras", UsageTrade},
+	{743, 743, "Nicaragua", UsageTrade},
+	{744, 744, "Costa Rica", UsageTrade},
+	{745, 745, "Panama", UsageTrade},
+	{746, 746, "Dominican Republic", UsageTrade},
+	{750, 750, "Mexico", UsageTrade},
+	{754, 755, "Canada", UsageTrade},
+	{759, 759, "Venezuela", UsageTrade},
+	{760, 769, "Switzerland and Liechtenstein", UsageTrade},
+	{770, 771, "Colombia", UsageTrade},
+	{773, 773, "Uruguay", UsageTrade},
+	{775, 775, "Peru", UsageTrade},
+	{777, 777, "Bolivia", UsageTrade},
+	{778, 779, "Argentina", UsageTrade},
+	{780, 780, "Chile", UsageTrade},
+	{784, 784, "Paraguay", UsageTrade},
+	{786, 786, "Ecuador", UsageTrade},
+	{789, 790, "Brazil", UsageTrade},
+	{800, 839, "Italy, San Marino and Vatican City", UsageTrade},
+	{840, 849, "Spain and Andorra", UsageTrade},
+	{850, 850, "Cuba", UsageTrade},
+	{858, 858, "Slovakia", UsageTrade},
+	{859, 859, "Czech Republic", UsageTrade},
+	{860, 860, "Serbia", UsageTrade},
+	{865, 865, "Mongolia", UsageTrade},
+	{867, 867, "North Korea", UsageTrade},
+	{868, 869, "Turkey", UsageTrade},
+	{870, 879, "Netherlands", UsageTrade},
+	{880, 880, "South Korea", UsageTrade},
+	{883, 883, "Myanmar", UsageTrade},
+	{884, 884, "Cambodia", UsageTrade},
+	{885, 885, "Thailand", UsageTrade},
+	{888, 888, "Singapore", UsageTrade},
+	{890, 890, "India", UsageTrade},
+	{893, 893, "Vietnam", UsageTrade},
+	{896, 896, "Pakistan", UsageTrade},
+	{899, 899, "Indonesia", UsageTrade},
+	{900, 919, "Austria", UsageTrade},
+	{930, 939, "Australia", UsageTrade},
+	{940, 949, "New Zealand", UsageTrade},
+	{950, 950, "GS1 Global Office", UsageTrade},
+	{955, 955, "Malaysia", UsageTrade},
+	{958, 958, "Macau", UsageTrade},
+	{960, 969, "United Kingdom", UsageTrade},
+	{977, 977, "", UsagePublication},
+	{978, 979, "", UsagePublication},
+	{980, 980, "", UsageRefund},
+	{981, 984, "", UsageCoupon},
+	{990, 999, "", UsageCoupon},
+}
+
+// classify fills in the prefix, issuing country and usage of a normalized code
+func classify(b *Barcode) {
+	prefix := b.GTIN[:3]
+	if len(b.GTIN) == 8 {
+		// EAN-8 codes starting with 0 or 2 are reserved for in-store use
+		if b.GTIN[0] == '0' || b.GTIN[0] == '2' {
+			b.Prefix = b.GTIN[:1]
+			b.Usage = UsageInStore
+			return
+		}
+	}
+	b.Prefix = prefix
+
+	n, _ := strconv.Atoi(prefix)
+	b.Usage = UsageReserved
+	for _, r := range gs1Prefixes {
+		if n >= r.from && n <= r.to {
+			b.Country = r.country
+			b.Usage = r.usage
+			break
+		}
+	}
+
+	// By national convention UPC number system 2 (EAN 020-029) and EAN
+	// 21-29 carry a weight or price in the code
+	if len(b.GTIN) == 13 && (prefix[:2] == "02" || (prefix[0] == '2' && prefix[1] != '0')) {
+		b.VariableMeasure = true
+	}
+}
@@ -3,6 +3,9 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -13,6 +16,60 @@ type Config struct {
 	MongoURI     string
 	JWT_SECRET   string
 	GeminiAPIKey string
+
+	// Lifetime of access tokens and of the refresh tokens that renew them
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+
+	// Comma separated product providers tried in order, e.g. "local,openfoodfacts"
+	ProductProviders string
+	LocalCatalogDir  string
+
+	ProductCacheEnabled     bool
+	ProductCacheSize        int
+	ProductCacheTTL         time.Duration
+	ProductCacheStaleTTL    time.Duration
+	ProductCacheNegativeTTL time.Duration
+
+	// Catalog of seen products used for grounded alternatives
+	ProductCatalogEnabled bool
+	AlternativesLimit     int
+
+	// LLM backend ("gemini" or "fake") and per-feature model overrides
+	LLMProvider       string
+	LLMFixturesDir    string
+	LLMModelOverrides map[string]string
+
+	// Per-feature deadlines ("diet_plan=90s,..."), retries and circuit breaker
+	LLMTimeouts         map[string]string
+	LLMMaxAttempts      int
+	LLMBreakerThreshold int
+	LLMBreakerCooldown  time.Duration
+
+	// One-time codes: lifetime, wrong guesses allowed, resend cooldown and
+	// codes per phone and hour
+	OTPTTL             time.Duration
+	OTPMaxAttempts     int
+	OTPResendInterval  time.Duration
+	OTPMaxSendsPerHour int
+	// Sign-up needs a verified phone number when enabled; off until the app
+	// asks for a code during onboarding
+	RequirePhoneVerification bool
+
+	// SMS sender ("console" or "file", none when empty) and the file the file
+	// sender writes to
+	SMSProvider   string
+	SMSOutboxFile string
+
+	// Time before a deleted account is purged, and how often due accounts are looked for
+	AccountDeletionGrace time.Duration
+	AccountPurgeInterval time.Duration
+
+	// Comma separated phone numbers given the admin role at startup
+	AdminPhoneNumbers string
+
+	// BMR equation for energy targets: "mifflin_st_jeor" or "harris_benedict"
+	EnergyFormula string
 }
 
 func LoadConfig() *Config {
@@ -26,7 +83,46 @@ func LoadConfig() *Config {
 		MongoURI:     getEnv("MONGO_URI", ""),
 		JWT_SECRET:   getEnv("JWT_SECRET", ""),
 		GeminiAPIKey: getEnv("GEMINI_API_KEY", ""),
-		
+
+		AccessTokenTTL:  getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL: getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+
+		ProductProviders: getEnv("PRODUCT_PROVIDERS", "openfoodfacts"),
+		LocalCatalogDir:  getEnv("LOCAL_CATALOG_DIR", "product_catalog"),
+
+		ProductCacheEnabled:     getEnvBool("PRODUCT_CACHE_ENABLED", true),
+		ProductCacheSize:        getEnvInt("PRODUCT_CACHE_SIZE", 1000),
+		ProductCacheTTL:         getEnvDuration("PRODUCT_CACHE_TTL", 24*time.Hour),
+		ProductCacheStaleTTL:    getEnvDuration("PRODUCT_CACHE_STALE_TTL", 7*24*time.Hour),
+		ProductCacheNegativeTTL: getEnvDuration("PRODUCT_CACHE_NEGATIVE_TTL", time.Hour),
+
+		ProductCatalogEnabled: getEnvBool("PRODUCT_CATALOG_ENABLED", true),
+		AlternativesLimit:     getEnvInt("ALTERNATIVES_LIMIT", 3),
+
+		LLMProvider:       getEnv("LLM_PROVIDER", "gemini"),
+		LLMFixturesDir:    getEnv("LLM_FIXTURES_DIR", "testdata/llm_fixtures"),
+		LLMModelOverrides: getEnvMap("LLM_MODEL_OVERRIDES"),
+
+		LLMTimeouts:         getEnvMap("LLM_TIMEOUTS"),
+		LLMMaxAttempts:      getEnvInt("LLM_MAX_ATTEMPTS", 3),
+		LLMBreakerThreshold: getEnvInt("LLM_BREAKER_THRESHOLD", 5),
+		LLMBreakerCooldown:  getEnvDuration("LLM_BREAKER_COOLDOWN", 30*time.Second),
+
+		OTPTTL:                   getEnvDuration("OTP_TTL", 5*time.Minute),
+		OTPMaxAttempts:           getEnvInt("OTP_MAX_ATTEMPTS", 5),
+		OTPResendInterval:        getEnvDuration("OTP_RESEND_INTERVAL", time.Minute),
+		OTPMaxSendsPerHour:       getEnvInt("OTP_MAX_SENDS_PER_HOUR", 5),
+		RequirePhoneVerification: getEnvBool("REQUIRE_PHONE_VERIFICATION", false),
+
+		SMSProvider:   getEnv("SMS_PROVIDER", ""),
+		SMSOutboxFile: getEnv("SMS_OUTBOX_FILE", "sms_outbox.log"),
+
+		AccountDeletionGrace: getEnvDuration("ACCOUNT_DELETION_GRACE", 30*24*time.Hour),
+		AccountPurgeInterval: getEnvDuration("ACCOUNT_PURGE_INTERVAL", time.Hour),
+
+		AdminPhoneNumbers: getEnv("ADMIN_PHONE_NUMBERS", ""),
+
+		EnergyFormula: getEnv("ENERGY_FORMULA", "mifflin_st_jeor"),
 	}
 
 	return config
@@ -37,4 +133,47 @@ func getEnv(key, defaultValue string) string {
 		return value
 	}
 	return defaultValue
-} 
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid integer for %s, using default %d", key, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseBool(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid boolean for %s, using default %t", key, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := time.ParseDuration(value); err == nil {
+			return parsed
+		}
+		log.Printf("Invalid duration for %s, using default %s", key, defaultValue)
+	}
+	return defaultValue
+}
+
+// getEnvMap parses "key=value,key=value" pairs
+func getEnvMap(key string) map[string]string {
+	result := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv(key), ",") {
+		name, value, found := strings.Cut(pair, "=")
+		if !found {
+			continue
+		}
+		result[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return result
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"amobagan/barcode"
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/services"
+	"amobagan/utils"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminController struct {
+	productCache *lib.CachedProductProvider
+	sessions     *services.SessionService
+}
+
+func NewAdminController() *AdminController {
+	return &AdminController{
+		productCache: lib.GetProductCache(),
+		sessions:     services.GetSessionService(),
+	}
+}
+
+// PurgeProductCache removes a barcode from the product cache so the next lookup refetches it
+func (a *AdminController) PurgeProductCache(c *gin.Context) {
+	code, err := barcode.Normalize(c.Param("barcode"))
+	if err != nil {
+		utils.BadRequest(c, "Invalid barcode", err.Error())
+		return
+	}
+
+	if a.productCache == nil {
+		utils.BadRequest(c, "Product cache is disabled", nil)
+		return
+	}
+
+	if err := a.productCache.Purge(c.Request.Context(), code); err != nil {
+		utils.InternalServerError(c, "Failed to purge product cache", err.Error())
+		return
+	}
+
+	utils.OK(c, "Product cache purged successfully", gin.H{"barcode": code})
+}
+
+// GetUser shows support staff a user's account and signed-in devices
+func (a *AdminController) GetUser(c *gin.Context) {
+	user, err := services.FindUser(c.Request.Context(), c.Param("userId"))
+	if err != nil {
+		respondAdminUserError(c, "Failed to fetch user", err)
+		return
+	}
+
+	sessions, err := a.sessions.List(c.Request.Context(), user.ID.Hex(), "")
+	if err != nil {
+		utils.InternalServerError(c, "Failed to fetch sessions", err.Error())
+		return
+	}
+
+	utils.OK(c, "User retrieved successfully", gin.H{
+		"user":     supportUserView(user),
+		"sessions": sessions,
+	})
+}
+
+// UpdateUserRole grants or removes the dietitian and admin roles
+func (a *AdminController) UpdateUserRole(c *gin.Context) {
+	var request models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	user, err := services.SetUserRole(c.Request.Context(), c.GetString("userID"), c.Param("userId"), request.Role)
+	if err != nil {
+		respondAdminUserError(c, "Failed to update role", err)
+		return
+	}
+
+	utils.OK(c, "Role updated successfully", supportUserView(user))
+}
+
+// RevokeUserSessions signs a user out on every device, e.g. after a lost phone
+func (a *AdminController) RevokeUserSessions(c *gin.Context) {
+	user, err := services.FindUser(c.Request.Context(), c.Param("userId"))
+	if err != nil {
+		respondAdminUserError(c, "Failed to fetch user", err)
+		return
+	}
+
+	revoked, err := a.sessions.RevokeAll(c.Request.Context(), user.ID.Hex(), models.SessionRevokedBySupport)
+	if err != nil {
+		utils.InternalServerError(c, "Failed to revoke sessions", err.Error())
+		return
+	}
+
+	utils.OK(c, "Sessions revoked successfully", gin.H{"revokedSessions": revoked})
+}
+
+// ListPrompts lists the LLM prompt templates with their versions
+func (a *AdminController) ListPrompts(c *gin.Context) {
+	templates, err := services.ListPromptTemplates()
+	if err != nil {
+		utils.InternalServerError(c, "Failed to list prompt templates", err.Error())
+		return
+	}
+
+	utils.OK(c, "Prompt templates retrieved successfully", gin.H{"templates": templates})
+}
+
+// GetPrompt shows one prompt template with its content
+func (a *AdminController) GetPrompt(c *gin.Context) {
+	template, err := services.GetPromptTemplate(c.Param("name"))
+	if err != nil {
+		if errors.Is(err, services.ErrPromptNotFound) {
+			utils.NotFound(c, "Prompt template not found")
+			return
+		}
+		utils.InternalServerError(c, "Failed to read prompt template", err.Error())
+		return
+	}
+
+	utils.OK(c, "Prompt template retrieved successfully", template)
+}
+
+// supportUserView is the account data support may see, without the password hash
+func supportUserView(user *models.User) gin.H {
+	return gin.H{
+		"id":              user.ID.Hex(),
+		"fullName":        user.FullName,
+		"phoneNo":         user.PhoneNo,
+		"role":            models.NormalizeRole(user.Role),
+		"healthStatus":    user.HealthStatus,
+		"healthGoals":     user.HealthGoals,
+		"foodAllergies":   user.FoodAllergies,
+		"workOutsPerWeek": user.WorkOutsPerWeek,
+	}
+}
+
+func respondAdminUserError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.NotFound(c, "User not found")
+	case errors.Is(err, services.ErrOwnRole):
+		utils.Forbidden(c, err.Error())
+	default:
+		utils.InternalServerError(c, message, err.Error())
+	}
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"amobagan/models"
+	"amobagan/services"
+	"amobagan/utils"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CustomProductController struct {
+	service *services.CustomProductService
+}
+
+func NewCustomProductController() *CustomProductController {
+	return &CustomProductController{
+		service: services.NewCustomProductService(),
+	}
+}
+
+// CreateProduct stores a product entered from its label, privately or shared for moderation
+func (h *CustomProductController) CreateProduct(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var request models.CustomProductRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	product, err := h.service.Create(c.Request.Context(), userID, &request)
+	if err != nil {
+		respondCustomProductError(c, "Failed to save product", err)
+		return
+	}
+
+	utils.Created(c, "Product submitted successfully", product)
+}
+
+// ListProducts returns the user's submitted products
+func (h *CustomProductController) ListProducts(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	products, err := h.service.ListMine(c.Request.Context(), userID)
+	if err != nil {
+		utils.InternalServerError(c, "Failed to retrieve products", err.Error())
+		return
+	}
+
+	utils.OK(c, "Products retrieved successfully", products)
+}
+
+// GetProduct returns one of the user's submitted products
+func (h *CustomProductController) GetProduct(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	product, err := h.service.Get(c.Request.Context(), userID, c.Param("productId"))
+	if err != nil {
+		respondCustomProductError(c, "Failed to retrieve product", err)
+		return
+	}
+
+	utils.OK(c, "Product retrieved successfully", product)
+}
+
+// UpdateProduct replaces the label data; shared products are moderated again
+func (h *CustomProductController) UpdateProduct(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var request models.CustomProductRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	product, err := h.service.Update(c.Request.Context(), userID, c.Param("productId"), &request)
+	if err != nil {
+		respondCustomProductError(c, "Failed to update product", err)
+		return
+	}
+
+	utils.OK(c, "Product updated successfully", product)
+}
+
+// DeleteProduct removes one of the user's submitted products
+func (h *CustomProductController) DeleteProduct(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), userID, c.Param("productId")); err != nil {
+		respondCustomProductError(c, "Failed to delete product", err)
+		return
+	}
+
+	utils.OK(c, "Product deleted successfully", nil)
+}
+
+// ListPendingProducts returns shared submissions waiting for moderation
+func (h *CustomProductController) ListPendingProducts(c *gin.Context) {
+	products, err := h.service.ListPending(c.Request.Context())
+	if err != nil {
+		utils.InternalServerError(c, "Failed to retrieve pending products", err.Error())
+		return
+	}
+
+	utils.OK(c, "Pending products retrieved successfully", products)
+}
+
+// ModerateProduct approves or rejects a shared submission
+func (h *CustomProductController) ModerateProduct(c *gin.Context) {
+	var request models.ModerateCustomProductRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	product, err := h.service.Moderate(c.Request.Context(), c.Param("productId"), c.GetString("userID"), &request)
+	if err != nil {
+		respondCustomProductError(c, "Failed to moderate product", err)
+		return
+	}
+
+	utils.OK(c, "Product moderated successfully", product)
+}
+
+func respondCustomProductError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrCustomProductNotFound):
+		utils.NotFound(c, "Product not found")
+	case errors.Is(err, services.ErrCustomProductExists):
+		utils.ConflictError(c, err.Error(), nil)
+	case errors.Is(err, services.ErrInvalidCustomProduct):
+		utils.BadRequest(c, err.Error(), nil)
+	default:
+		utils.InternalServerError(c, message, err.Error())
+	}
+}
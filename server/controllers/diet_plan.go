@@ -34,9 +34,9 @@ func (c *DietPlanController) GenerateDietPlan(ctx *gin.Context) {
 	}
 
 	// Generate the diet plan using user data from database (no request body needed)
-	dietPlan, err := c.dietPlanService.GenerateDietPlan(userID)
+	dietPlan, err := c.dietPlanService.GenerateDietPlan(ctx.Request.Context(), userID)
 	if err != nil {
-		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to generate diet plan", err.Error())
+		respondGenerationError(ctx, "Failed to generate diet plan", err)
 		return
 	}
 
@@ -238,11 +238,11 @@ func (c *DietPlanController) GetDietPlanSummary(ctx *gin.Context) {
 	})
 }
 
-// TestUserExists is a temporary endpoint to debug user authentication
+// TestUserExists is an admin debug endpoint showing a user's stored profile
 func (c *DietPlanController) TestUserExists(ctx *gin.Context) {
-	userID := ctx.GetString("userID")
+	userID := ctx.Param("userId")
 	if userID == "" {
-		utils.SendErrorResponse(ctx, http.StatusUnauthorized, "User not authenticated", "")
+		utils.SendErrorResponse(ctx, http.StatusBadRequest, "User ID is required", "")
 		return
 	}
 
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/services"
+	"amobagan/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxDiaryRange bounds how many days one diary query may span
+const maxDiaryRange = 92 * 24 * time.Hour
+
+type FoodLogController struct {
+	foodLogService *services.FoodLogService
+}
+
+func NewFoodLogController() *FoodLogController {
+	return &FoodLogController{
+		foodLogService: services.NewFoodLogService(),
+	}
+}
+
+// CreateEntry logs a scanned product, a diet-plan meal or a custom food
+func (c *FoodLogController) CreateEntry(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if userID == "" {
+		utils.SendErrorResponse(ctx, http.StatusUnauthorized, "User not authenticated", "")
+		return
+	}
+
+	var request models.CreateFoodLogRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		utils.SendErrorResponse(ctx, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	entry, err := c.foodLogService.CreateEntry(ctx.Request.Context(), userID, &request)
+	if err != nil {
+		respondFoodLogError(ctx, "Failed to log food", err)
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Food logged successfully",
+		"data":    entry,
+	})
+}
+
+// ListEntries returns the diary between ?from= and ?to= (defaults to today)
+func (c *FoodLogController) ListEntries(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if userID == "" {
+		utils.SendErrorResponse(ctx, http.StatusUnauthorized, "User not authenticated", "")
+		return
+	}
+
+	from, to, err := parseDiaryRange(ctx)
+	if err != nil {
+		utils.SendErrorResponse(ctx, http.StatusBadRequest, "Invalid date range", err.Error())
+		return
+	}
+
+	entries, err := c.foodLogService.ListEntries(ctx.Request.Context(), userID, from, to)
+	if err != nil {
+		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to retrieve food diary", err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Food diary retrieved successfully",
+		"data": gin.H{
+			"from":    from,
+			"to":      to,
+			"entries": entries,
+			"count":   len(entries),
+		},
+	})
+}
+
+// GetSummary totals the diary per day and week between ?from= and ?to= and
+// compares it with the user's daily targets
+func (c *FoodLogController) GetSummary(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if userID == "" {
+		utils.SendErrorResponse(ctx, http.StatusUnauthorized, "User not authenticated", "")
+		return
+	}
+
+	from, to, err := parseDiaryRange(ctx)
+	if err != nil {
+		utils.SendErrorResponse(ctx, http.StatusBadRequest, "Invalid date range", err.Error())
+		return
+	}
+
+	summary, err := c.foodLogService.Summarize(ctx.Request.Context(), userID, from, to)
+	if err != nil {
+		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to summarize food diary", err.Error())
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Food diary summary retrieved successfully",
+		"data":    summary,
+	})
+}
+
+// GetEntry returns a single diary entry
+func (c *FoodLogController) GetEntry(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if userID == "" {
+		utils.SendErrorResponse(ctx, http.StatusUnauthorized, "User not authenticated", "")
+		return
+	}
+
+	entry, err := c.foodLogService.GetEntry(ctx.Request.Context(), userID, ctx.Param("entryId"))
+	if err != nil {
+		respondFoodLogError(ctx, "Failed to retrieve diary entry", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Diary entry retrieved successfully",
+		"data":    entry,
+	})
+}
+
+// UpdateEntry changes the portion, meal type, time or notes of an entry
+func (c *FoodLogController) UpdateEntry(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if userID == "" {
+		utils.SendErrorResponse(ctx, http.StatusUnauthorized, "User not authenticated", "")
+		return
+	}
+
+	var request models.UpdateFoodLogRequest
+	if err := ctx.ShouldBindJSON(&request); err != nil {
+		utils.SendErrorResponse(ctx, http.StatusBadRequest, "Invalid request body", err.Error())
+		return
+	}
+
+	entry, err := c.foodLogService.UpdateEntry(ctx.Request.Context(), userID, ctx.Param("entryId"), &request)
+	if err != nil {
+		respondFoodLogError(ctx, "Failed to update diary entry", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Diary entry updated successfully",
+		"data":    entry,
+	})
+}
+
+// DeleteEntry removes an entry from the diary
+func (c *FoodLogController) DeleteEntry(ctx *gin.Context) {
+	userID := ctx.GetString("userID")
+	if userID == "" {
+		utils.SendErrorResponse(ctx, http.StatusUnauthorized, "User not authenticated", "")
+		return
+	}
+
+	if err := c.foodLogService.DeleteEntry(ctx.Request.Context(), userID, ctx.Param("entryId")); err != nil {
+		respondFoodLogError(ctx, "Failed to delete diary entry", err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Diary entry deleted successfully",
+	})
+}
+
+func respondFoodLogError(ctx *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrFoodLogNotFound):
+		utils.SendErrorResponse(ctx, http.StatusNotFound, "Diary entry not found", "")
+	case errors.Is(err, lib.ErrProductNotFound):
+		utils.SendErrorResponse(ctx, http.StatusNotFound, "Product not found", err.Error())
+	case errors.Is(err, services.ErrInvalidFoodLog):
+		utils.SendErrorResponse(ctx, http.StatusBadRequest, message, err.Error())
+	default:
+		utils.SendErrorResponse(ctx, http.StatusInternalServerError, message, err.Error())
+	}
+}
+
+// parseDiaryRange reads ?from= and ?to= as dates (2006-01-02, to inclusive) or
+// RFC 3339 timestamps. Dates are whole days in the ?tz= IANA zone, UTC by default.
+func parseDiaryRange(ctx *gin.Context) (time.Time, time.Time, error) {
+	loc := time.UTC
+	if tz := ctx.Query("tz"); tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(tz); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("unknown time zone %q", tz)
+		}
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	from, to := today, today.AddDate(0, 0, 1)
+
+	if value := ctx.Query("from"); value != "" {
+		parsed, _, err := parseDiaryTime(value, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid from: %v", err)
+		}
+		from = parsed
+		if ctx.Query("to") == "" {
+			to = from.AddDate(0, 0, 1)
+		}
+	}
+	if value := ctx.Query("to"); value != "" {
+		parsed, isDate, err := parseDiaryTime(value, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid to: %v", err)
+		}
+		to = parsed
+		if isDate {
+			to = to.AddDate(0, 0, 1)
+		}
+	}
+
+	if !to.After(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("to must be after from")
+	}
+	if to.Sub(from) > maxDiaryRange {
+		return time.Time{}, time.Time{}, fmt.Errorf("range may span at most %d days", int(maxDiaryRange.Hours()/24))
+	}
+	return from, to, nil
+}
+
+func parseDiaryTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("expected YYYY-MM-DD or RFC 3339, got %q", value)
+	}
+	return t.In(loc), false, nil
+}
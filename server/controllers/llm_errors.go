@@ -0,0 +1,29 @@
+package controllers
+
+import (
+	"amobagan/lib"
+	"amobagan/services"
+	"amobagan/utils"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondGenerationError maps LLM failures onto 503/504 so clients can tell a
+// busy model apart from a bug, plans that kept containing the user's allergens
+// onto 422, and falls back to a 500 for everything else
+func respondGenerationError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, lib.ErrLLMTimeout):
+		utils.GatewayTimeout(c, message+": the AI model took too long to respond", err.Error())
+	case errors.Is(err, services.ErrIncompleteProfile):
+		utils.ValidationErrorResponse(c, message+": complete your profile first", err.Error())
+	case errors.Is(err, services.ErrAllergenConflict):
+		utils.ValidationErrorResponse(c, message+": could not produce a plan free of your food allergens", err.Error())
+	case errors.Is(err, lib.ErrLLMUnavailable):
+		c.Header("Retry-After", "30")
+		utils.ServiceUnavailable(c, message+": the AI model is temporarily unavailable", err.Error())
+	default:
+		utils.InternalServerError(c, message, err.Error())
+	}
+}
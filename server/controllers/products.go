@@ -1,26 +1,115 @@
 package controllers
 
 import (
+	"amobagan/barcode"
 	"amobagan/lib"
 	"amobagan/models"
 	"amobagan/services"
 	"amobagan/utils"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ProductController struct {
 	nutritionService *services.NutritionAnalysisService
+	productProvider  lib.ProductProvider
+	history          *services.ScanHistoryService
 }
 
 func NewProductController() *ProductController {
 	nutritionService, err := services.NewNutritionAnalysisService()
 	if err != nil {
-		nutritionService = nil
+		// Keep serving rule-based analyses when the LLM can't be set up
+		log.Printf("LLM unavailable, nutrition analysis limited to rules: %v", err)
+		nutritionService = services.NewNutritionAnalysisServiceWithLLM(nil)
 	}
-	
+
 	return &ProductController{
 		nutritionService: nutritionService,
+		productProvider:  lib.GetProductProvider(),
+		history:          services.NewScanHistoryService(),
+	}
+}
+
+// parseBarcode validates and normalizes a barcode, answering 400 for codes
+// that are malformed or can't identify a product
+func parseBarcode(c *gin.Context, raw string) (*barcode.Barcode, bool) {
+	code, err := barcode.Parse(raw)
+	if err != nil {
+		utils.BadRequest(c, "Invalid barcode", err.Error())
+		return nil, false
+	}
+	if !code.Lookupable() {
+		message := "This barcode doesn't identify a product"
+		if code.InStore() {
+			message = "This is an in-store barcode, e.g. for loose items weighed at the counter, and can't be looked up"
+		}
+		utils.BadRequest(c, message, code)
+		return nil, false
+	}
+	return code, true
+}
+
+// fetchProduct resolves the barcode through the provider chain and writes the
+// error response itself when the barcode is invalid or the lookup fails
+func (h *ProductController) fetchProduct(c *gin.Context, raw string) (*utils.ExtractedNutritionData, bool) {
+	code, ok := parseBarcode(c, raw)
+	if !ok {
+		return nil, false
+	}
+	barcode := code.GTIN
+
+	ctx := lib.WithProductUser(c.Request.Context(), c.GetString("userID"))
+	product, err := h.productProvider.GetProduct(ctx, barcode)
+	if err != nil {
+		if errors.Is(err, lib.ErrProductNotFound) {
+			// Point the client at the label form instead of a dead end
+			utils.ErrorResponse(c, http.StatusNotFound, "NOT_FOUND", "Product not found", gin.H{
+				"barcode":    barcode,
+				"submit_url": "/api/custom-products",
+			})
+			return nil, false
+		}
+		utils.InternalServerError(c, "Failed to retrieve product", err.Error())
+		return nil, false
+	}
+	return product, true
+}
+
+// withStoredAllergies adds the allergies saved on the user's account so they
+// are enforced even when the client doesn't send them. Without them no verdict
+// is safe, so a failed lookup answers 500 and returns false.
+func withStoredAllergies(c *gin.Context, userPrefs *models.UserPreferences) bool {
+	user, err := services.GetUserByID(c.GetString("userID"))
+	if err != nil {
+		utils.InternalServerError(c, "Failed to load stored allergies", err.Error())
+		return false
+	}
+	userPrefs.FoodAllergies = append(userPrefs.FoodAllergies, user.FoodAllergies...)
+	return true
+}
+
+// analyze runs the engine picked with ?engine=: "llm" (default, falls back to
+// rules on failure) or "rules"
+func (h *ProductController) analyze(c *gin.Context, product *utils.ExtractedNutritionData, userPrefs *models.UserPreferences) (*models.NutritionAnalysis, bool) {
+	switch engine := c.DefaultQuery("engine", services.AnalysisEngineLLM); engine {
+	case services.AnalysisEngineRules:
+		return h.nutritionService.AnalyzeWithRules(c.Request.Context(), product, userPrefs), true
+	case services.AnalysisEngineLLM:
+		analysis, err := h.nutritionService.AnalyzeNutritionWithPreferences(c.Request.Context(), product, userPrefs)
+		if err != nil {
+			respondGenerationError(c, "Failed to analyze nutrition", err)
+			return nil, false
+		}
+		return analysis, true
+	default:
+		utils.BadRequest(c, "Invalid engine, expected 'llm' or 'rules'", engine)
+		return nil, false
 	}
 }
 
@@ -30,13 +119,12 @@ func (h *ProductController) GetProductDetailsByBarcode(c *gin.Context) {
 		utils.BadRequest(c, "Barcode is required", nil)
 		return
 	}
-	product, err := lib.RetrieveProductDetailsByBarcode(barcode)
-	
-	if err != nil {
-		utils.NotFound(c, "Product not found")
+	product, ok := h.fetchProduct(c, barcode)
+	if !ok {
 		return
 	}
-	
+
+	h.history.RecordAsync(c.GetString("userID"), product, nil, nil, models.ScanSourceProduct, "")
 	utils.OK(c, "Product details retrieved successfully", product)
 }
 
@@ -47,9 +135,8 @@ func (h *ProductController) AnalyzeNutritionWithPreferences(c *gin.Context) {
 		return
 	}
 
-	product, err := lib.RetrieveProductDetailsByBarcode(barcode)
-	if err != nil {
-		utils.NotFound(c, "Product not found")
+	product, ok := h.fetchProduct(c, barcode)
+	if !ok {
 		return
 	}
 
@@ -66,18 +153,15 @@ func (h *ProductController) AnalyzeNutritionWithPreferences(c *gin.Context) {
 		return
 	}
 
-	// Check if nutrition service is available
-	if h.nutritionService == nil {
-		utils.InternalServerError(c, "Nutrition analysis service not available", nil)
+	// Perform personalized nutrition analysis
+	if !withStoredAllergies(c, &userPrefs) {
 		return
 	}
-
-	// Perform personalized nutrition analysis
-	analysis, err := h.nutritionService.AnalyzeNutritionWithPreferences(product, &userPrefs)
-	if err != nil {
-		utils.InternalServerError(c, "Failed to analyze nutrition", err.Error())
+	analysis, ok := h.analyze(c, product, &userPrefs)
+	if !ok {
 		return
 	}
+	h.history.RecordAsync(c.GetString("userID"), product, analysis, &userPrefs, models.ScanSourcePersonalized, "")
 
 	// Format the analysis for display
 	formattedAnalysis := h.nutritionService.FormatAnalysisForDisplay(analysis)
@@ -93,9 +177,8 @@ func (h *ProductController) GetNutritionAnalysis(c *gin.Context) {
 	}
 
 	// Get product data
-	product, err := lib.RetrieveProductDetailsByBarcode(barcode)
-	if err != nil {
-		utils.NotFound(c, "Product not found")
+	product, ok := h.fetchProduct(c, barcode)
+	if !ok {
 		return
 	}
 
@@ -107,21 +190,109 @@ func (h *ProductController) GetNutritionAnalysis(c *gin.Context) {
 		UserName:           "User",
 	}
 
-	// Check if nutrition service is available
-	if h.nutritionService == nil {
-		utils.InternalServerError(c, "Nutrition analysis service not available", nil)
+	// Perform nutrition analysis
+	if !withStoredAllergies(c, defaultPrefs) {
 		return
 	}
-
-	// Perform nutrition analysis
-	analysis, err := h.nutritionService.AnalyzeNutritionWithPreferences(product, defaultPrefs)
-	if err != nil {
-		utils.InternalServerError(c, "Failed to analyze nutrition", err.Error())
+	analysis, ok := h.analyze(c, product, defaultPrefs)
+	if !ok {
 		return
 	}
+	h.history.RecordAsync(c.GetString("userID"), product, analysis, defaultPrefs, models.ScanSourceNutrition, "")
 
 	// Format the analysis for display
 	formattedAnalysis := h.nutritionService.FormatAnalysisForDisplay(analysis)
 
 	utils.OK(c, "Nutrition analysis completed successfully", formattedAnalysis)
-}
\ No newline at end of file
+}
+// CompareProducts lines up several products side by side and ranks them by the
+// user's nutrition priorities, optionally with a short personalized verdict
+func (h *ProductController) CompareProducts(c *gin.Context) {
+	var request models.CompareProductsRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	var barcodes []string
+	seen := map[string]bool{}
+	for _, raw := range request.Barcodes {
+		code, ok := parseBarcode(c, raw)
+		if !ok {
+			return
+		}
+		if !seen[code.GTIN] {
+			seen[code.GTIN] = true
+			barcodes = append(barcodes, code.GTIN)
+		}
+	}
+	if len(barcodes) < models.MinComparedProducts || len(barcodes) > models.MaxComparedProducts {
+		utils.BadRequest(c, fmt.Sprintf("Between %d and %d different barcodes are required", models.MinComparedProducts, models.MaxComparedProducts), nil)
+		return
+	}
+
+	user, err := services.GetUserByID(c.GetString("userID"))
+	if err != nil {
+		utils.InternalServerError(c, "Failed to get user preferences", err.Error())
+		return
+	}
+	userPrefs := services.PreferencesFromUser(user)
+
+	// Look the products up concurrently; the shopper is waiting in the aisle
+	ctx := lib.WithProductUser(c.Request.Context(), user.ID.Hex())
+	products := make([]*utils.ExtractedNutritionData, len(barcodes))
+	errs := make([]error, len(barcodes))
+	var wg sync.WaitGroup
+	for i, barcode := range barcodes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			products[i], errs[i] = h.productProvider.GetProduct(ctx, barcode)
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, lib.ErrProductNotFound) {
+			utils.NotFound(c, fmt.Sprintf("Product %s not found", barcodes[i]))
+			return
+		}
+		utils.InternalServerError(c, "Failed to retrieve product", err.Error())
+		return
+	}
+
+	comparison := services.CompareProducts(products, userPrefs)
+	if request.Verdict {
+		comparison.Verdict = h.nutritionService.CompareVerdict(c.Request.Context(), comparison, userPrefs)
+	}
+
+	utils.OK(c, "Products compared successfully", comparison)
+}
+
+// GetAlternatives lists real products from the catalog in the same category
+// that score better on the user's nutrition priorities
+func (h *ProductController) GetAlternatives(c *gin.Context) {
+	product, ok := h.fetchProduct(c, c.Param("barcode"))
+	if !ok {
+		return
+	}
+
+	user, err := services.GetUserByID(c.GetString("userID"))
+	if err != nil {
+		utils.InternalServerError(c, "Failed to get user preferences", err.Error())
+		return
+	}
+
+	alternatives, err := h.nutritionService.Alternatives(c.Request.Context(), product, services.PreferencesFromUser(user))
+	if err != nil {
+		utils.InternalServerError(c, "Failed to find alternatives", err.Error())
+		return
+	}
+	if alternatives == nil {
+		alternatives = []models.Alternative{}
+	}
+
+	utils.OK(c, "Alternatives retrieved successfully", alternatives)
+}
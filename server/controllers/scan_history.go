@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"amobagan/models"
+	"amobagan/services"
+	"amobagan/utils"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ScanHistoryController struct {
+	history  *services.ScanHistoryService
+	products *ProductController
+}
+
+func NewScanHistoryController() *ScanHistoryController {
+	products := NewProductController()
+	return &ScanHistoryController{
+		history:  products.history,
+		products: products,
+	}
+}
+
+// ListScans returns the user's scanned products, most recent first.
+// Supports ?page=, ?limit=, ?grade=A,B and ?favorite=true.
+func (h *ScanHistoryController) ListScans(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	filter := models.ScanHistoryFilter{
+		Page:  queryInt(c, "page", 1),
+		Limit: queryInt(c, "limit", 0),
+	}
+	if grades := c.Query("grade"); grades != "" {
+		for _, grade := range strings.Split(grades, ",") {
+			grade = strings.ToUpper(strings.TrimSpace(grade))
+			if len(grade) != 1 || grade < "A" || grade > "E" {
+				utils.BadRequest(c, "Invalid grade, expected A-E", grade)
+				return
+			}
+			filter.Grades = append(filter.Grades, grade)
+		}
+	}
+	if favorite := c.Query("favorite"); favorite != "" {
+		value, err := strconv.ParseBool(favorite)
+		if err != nil {
+			utils.BadRequest(c, "Invalid favorite flag", favorite)
+			return
+		}
+		filter.FavoriteOnly = value
+	}
+
+	page, err := h.history.List(c.Request.Context(), userID, filter)
+	if err != nil {
+		utils.InternalServerError(c, "Failed to retrieve scan history", err.Error())
+		return
+	}
+
+	utils.OK(c, "Scan history retrieved successfully", page)
+}
+
+// GetScan returns one history entry with its analysis snapshot
+func (h *ScanHistoryController) GetScan(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	entry, err := h.history.Get(c.Request.Context(), userID, c.Param("scanId"))
+	if err != nil {
+		respondScanHistoryError(c, "Failed to retrieve scan", err)
+		return
+	}
+
+	utils.OK(c, "Scan retrieved successfully", entry)
+}
+
+// UpdateFavorite stars or unstars a scanned product
+func (h *ScanHistoryController) UpdateFavorite(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	var request models.UpdateFavoriteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	entry, err := h.history.SetFavorite(c.Request.Context(), userID, c.Param("scanId"), *request.Favorite)
+	if err != nil {
+		respondScanHistoryError(c, "Failed to update favourite", err)
+		return
+	}
+
+	utils.OK(c, "Favourite updated successfully", entry)
+}
+
+// DeleteScan removes a product from the history
+func (h *ScanHistoryController) DeleteScan(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	if err := h.history.Delete(c.Request.Context(), userID, c.Param("scanId")); err != nil {
+		respondScanHistoryError(c, "Failed to delete scan", err)
+		return
+	}
+
+	utils.OK(c, "Scan deleted successfully", nil)
+}
+
+// Reanalyze re-runs the analysis with the user's current preferences and the
+// latest product data, and reports how the verdict changed. Honours ?engine=.
+func (h *ScanHistoryController) Reanalyze(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.Unauthorized(c, "User not authenticated")
+		return
+	}
+
+	previous, err := h.history.Get(c.Request.Context(), userID, c.Param("scanId"))
+	if err != nil {
+		respondScanHistoryError(c, "Failed to retrieve scan", err)
+		return
+	}
+
+	user, err := services.GetUserByID(userID)
+	if err != nil {
+		utils.InternalServerError(c, "Failed to get user preferences", err.Error())
+		return
+	}
+
+	product, ok := h.products.fetchProduct(c, previous.Barcode)
+	if !ok {
+		return
+	}
+
+	userPrefs := services.PreferencesFromUser(user)
+	analysis, ok := h.products.analyze(c, product, userPrefs)
+	if !ok {
+		return
+	}
+
+	result := services.CompareAnalyses(previous, analysis)
+	entry, err := h.history.Record(c.Request.Context(), userID, product, analysis, userPrefs, models.ScanSourceReanalysis, "")
+	if err != nil {
+		utils.InternalServerError(c, "Failed to save analysis", err.Error())
+		return
+	}
+	result.Entry = entry
+
+	utils.OK(c, "Scan re-analyzed successfully", result)
+}
+
+func respondScanHistoryError(c *gin.Context, message string, err error) {
+	if errors.Is(err, services.ErrScanNotFound) {
+		utils.NotFound(c, "Scan not found")
+		return
+	}
+	utils.InternalServerError(c, message, err.Error())
+}
+
+// queryInt reads a positive integer query parameter, falling back to def
+func queryInt(c *gin.Context, key string, def int) int {
+	value, err := strconv.Atoi(c.Query(key))
+	if err != nil || value < 1 {
+		return def
+	}
+	return value
+}
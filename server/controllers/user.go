@@ -1,13 +1,19 @@
 package controllers
 
 import (
+	"amobagan/config"
 	"amobagan/lib"
 	"amobagan/models"
 	"amobagan/services"
 	"amobagan/utils"
+	"bytes"
 	"context"
 	"errors"
 	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
 	"unicode"
 
 	"github.com/gin-gonic/gin"
@@ -16,7 +22,11 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
-type UserController struct{}
+type UserController struct {
+	sessions *services.SessionService
+	otp      *services.OTPService
+	accounts *services.AccountService
+}
 
 type LoginRequest struct {
 	PhoneNo  string `json:"phoneNo" binding:"required,min=10,max=10"`
@@ -24,7 +34,11 @@ type LoginRequest struct {
 }
 
 func NewUserController() *UserController {
-	return &UserController{}
+	return &UserController{
+		sessions: services.GetSessionService(),
+		otp:      services.NewOTPService(),
+		accounts: services.NewAccountService(),
+	}
 }
 
 func validateUser(user models.User) error {
@@ -50,17 +64,23 @@ func validateUser(user models.User) error {
 }
 
 func (u *UserController) CreateUser(c *gin.Context) {
-	var user models.User
+	var request models.SignupRequest
 	
-	if err := c.ShouldBindJSON(&user); err != nil {
+	if err := c.ShouldBindJSON(&request); err != nil {
 		utils.BadRequest(c, err.Error(), nil)
 		return
 	}
+	user := request.User
 
 	if err := validateUser(user); err != nil {
 		utils.BadRequest(c, err.Error(), nil)
 		return
 	}
+	// Sign-up accepts the same profile values as PATCH /profile
+	if err := services.ValidateSignupProfile(&user); err != nil {
+		respondProfileError(c, "Failed to create user", err)
+		return
+	}
 	collection := lib.DB.Database("amobagan").Collection("users")
 	filter := bson.M{"phoneNo": user.PhoneNo}
 
@@ -77,7 +97,19 @@ func (u *UserController) CreateUser(c *gin.Context) {
 		utils.InternalServerError(c, existingUser.Err().Error(), nil)
 		return
 	}
-	
+
+	// The phone number is verified with a code before the account exists
+	user.PhoneVerified = false
+	if request.VerificationToken != "" {
+		if err := u.otp.ConsumeVerification(c.Request.Context(), user.PhoneNo, models.OTPPurposeVerifyPhone, request.VerificationToken); err != nil {
+			respondOTPError(c, "Failed to verify phone number", err)
+			return
+		}
+		user.PhoneVerified = true
+	} else if config.LoadConfig().RequirePhoneVerification {
+		utils.BadRequest(c, "Phone number must be verified, request a code first", nil)
+		return
+	}
 
 	hashedPassword, err := utils.HashPassword(user.Password)
 	if err != nil {
@@ -86,6 +118,8 @@ func (u *UserController) CreateUser(c *gin.Context) {
 	}
 
 	user.Password = hashedPassword
+	// Roles are granted by admins, never chosen at sign-up
+	user.Role = models.RoleUser
 
 
 	result, err := collection.InsertOne(context.Background(), user)
@@ -96,7 +130,7 @@ func (u *UserController) CreateUser(c *gin.Context) {
 
 	user.ID = result.InsertedID.(primitive.ObjectID)
 
-	token, err := utils.GenerateJWT(user)
+	tokens, err := u.sessions.Start(c.Request.Context(), user, sessionDevice(c))
 	if err != nil {
 		utils.InternalServerError(c, err.Error(), nil)
 		return
@@ -104,7 +138,10 @@ func (u *UserController) CreateUser(c *gin.Context) {
 
 	userData := map[string]interface{}{
 		"_id": result.InsertedID.(primitive.ObjectID).Hex(),
-		"token": token,
+		"token": tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn": tokens.ExpiresIn,
+		"sessionId": tokens.SessionID,
 		"fullName": user.FullName,
 		"phoneNo": user.PhoneNo,
 		"workOutsPerWeek": user.WorkOutsPerWeek,
@@ -112,6 +149,8 @@ func (u *UserController) CreateUser(c *gin.Context) {
 		"height": user.Height,
 		"weight": user.Weight,
 		"healthStatus": user.HealthStatus,
+		"role": user.Role,
+		"phoneVerified": user.PhoneVerified,
 	}
 
 	utils.OK(c, "User created successfully", userData)
@@ -150,7 +189,18 @@ func (u *UserController) LoginUser(c *gin.Context) {
 
 	log.Println(user)
 
-	token, err := utils.GenerateJWT(user)
+	// Signing in during the grace period keeps the account
+	deletionCancelled := false
+	if user.DeletionScheduledFor != nil {
+		cancelled, err := u.accounts.CancelDeletion(c.Request.Context(), user.ID)
+		if err != nil {
+			utils.InternalServerError(c, err.Error(), nil)
+			return
+		}
+		deletionCancelled = cancelled
+	}
+
+	tokens, err := u.sessions.Start(c.Request.Context(), user, sessionDevice(c))
 	if err != nil {
 		utils.InternalServerError(c, err.Error(), nil)
 		return
@@ -158,7 +208,10 @@ func (u *UserController) LoginUser(c *gin.Context) {
 
 	userData := map[string]interface{}{
 		"_id": user.ID,
-		"token": token,
+		"token": tokens.Token,
+		"refreshToken": tokens.RefreshToken,
+		"expiresIn": tokens.ExpiresIn,
+		"sessionId": tokens.SessionID,
 		"fullName": user.FullName,
 		"phoneNo": user.PhoneNo,
 		"workOutsPerWeek": user.WorkOutsPerWeek,
@@ -166,11 +219,289 @@ func (u *UserController) LoginUser(c *gin.Context) {
 		"height": user.Height,
 		"weight": user.Weight,
 		"healthStatus": user.HealthStatus,
+		"role": models.NormalizeRole(user.Role),
+		"phoneVerified": user.PhoneVerified,
+		"deletionCancelled": deletionCancelled,
 	}
 
 	utils.OK(c, "User logged in successfully", userData)
 }
 
+// RefreshToken exchanges a refresh token for a new access and refresh token.
+// The refresh token that was sent stops working.
+func (u *UserController) RefreshToken(c *gin.Context) {
+	var request models.RefreshTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	tokens, err := u.sessions.Refresh(c.Request.Context(), request.RefreshToken, sessionDevice(c))
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidRefreshToken) || errors.Is(err, services.ErrRefreshTokenReused) {
+			utils.Unauthorized(c, err.Error())
+			return
+		}
+		utils.InternalServerError(c, "Failed to refresh token", err.Error())
+		return
+	}
+
+	utils.OK(c, "Token refreshed successfully", tokens)
+}
+
+// Logout revokes the current session, or all of the user's sessions
+func (u *UserController) Logout(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	// The body is optional
+	var request models.LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			utils.BadRequest(c, "Invalid request body", err.Error())
+			return
+		}
+	}
+
+	if request.AllDevices {
+		revoked, err := u.sessions.RevokeAll(c.Request.Context(), userID, models.SessionRevokedAllDevices)
+		if err != nil {
+			utils.InternalServerError(c, "Failed to log out", err.Error())
+			return
+		}
+		utils.OK(c, "Logged out on all devices", gin.H{"revokedSessions": revoked})
+		return
+	}
+
+	err := u.sessions.Revoke(c.Request.Context(), userID, c.GetString("sessionID"), models.SessionRevokedLogout)
+	if err != nil && !errors.Is(err, services.ErrSessionNotFound) {
+		utils.InternalServerError(c, "Failed to log out", err.Error())
+		return
+	}
+
+	utils.OK(c, "Logged out successfully", nil)
+}
+
+// ListSessions returns the devices the user is signed in on
+func (u *UserController) ListSessions(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	sessions, err := u.sessions.List(c.Request.Context(), userID, c.GetString("sessionID"))
+	if err != nil {
+		utils.InternalServerError(c, "Failed to fetch sessions", err.Error())
+		return
+	}
+
+	utils.OK(c, "Sessions retrieved successfully", gin.H{"sessions": sessions})
+}
+
+// RevokeSession signs one of the user's devices out
+func (u *UserController) RevokeSession(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	if err := u.sessions.Revoke(c.Request.Context(), userID, c.Param("sessionId"), models.SessionRevokedByUser); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			utils.NotFound(c, "Session not found")
+			return
+		}
+		utils.InternalServerError(c, "Failed to revoke session", err.Error())
+		return
+	}
+
+	utils.OK(c, "Session revoked successfully", gin.H{"sessionId": c.Param("sessionId")})
+}
+
+// RequestOTP sends a one-time code by SMS for phone verification or a
+// password reset
+func (u *UserController) RequestOTP(c *gin.Context) {
+	var request models.OTPRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	sent, err := u.otp.Request(c.Request.Context(), request.PhoneNo, request.Purpose)
+	if err != nil {
+		respondOTPError(c, "Failed to send code", err)
+		return
+	}
+
+	utils.OK(c, "Code sent successfully", sent)
+}
+
+// VerifyOTP checks a code and returns the token that completes sign-up, phone
+// verification or the password reset
+func (u *UserController) VerifyOTP(c *gin.Context) {
+	var request models.OTPVerifyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	verified, err := u.otp.Verify(c.Request.Context(), request.PhoneNo, request.Purpose, request.Code)
+	if err != nil {
+		respondOTPError(c, "Failed to verify code", err)
+		return
+	}
+
+	utils.OK(c, "Code verified successfully", verified)
+}
+
+// ResetPassword sets a new password after the phone number was verified and
+// signs the user out on every device
+func (u *UserController) ResetPassword(c *gin.Context) {
+	var request models.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	if err := u.otp.ResetPassword(c.Request.Context(), &request); err != nil {
+		respondOTPError(c, "Failed to reset password", err)
+		return
+	}
+
+	utils.OK(c, "Password reset successfully, please log in again", nil)
+}
+
+// VerifyPhone marks the signed-in user's phone number verified, for accounts
+// created before verification was required
+func (u *UserController) VerifyPhone(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	var request models.VerifyPhoneRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	if err := u.otp.VerifyPhone(c.Request.Context(), userID, request.VerificationToken); err != nil {
+		respondOTPError(c, "Failed to verify phone number", err)
+		return
+	}
+
+	utils.OK(c, "Phone number verified successfully", gin.H{"phoneVerified": true})
+}
+
+func respondOTPError(c *gin.Context, message string, err error) {
+	var rateLimited *services.OTPRateLimitError
+	switch {
+	case errors.As(err, &rateLimited):
+		retryAfter := int(math.Ceil(rateLimited.RetryAfter.Seconds()))
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		utils.TooManyRequests(c, err.Error(), gin.H{"retryAfter": retryAfter})
+	case errors.Is(err, services.ErrOTPTooManyAttempts):
+		utils.TooManyRequests(c, err.Error(), nil)
+	case errors.Is(err, services.ErrOTPInvalid),
+		errors.Is(err, services.ErrOTPExpired),
+		errors.Is(err, services.ErrInvalidVerification):
+		utils.BadRequest(c, err.Error(), nil)
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.NotFound(c, "User not found")
+	case errors.Is(err, services.ErrSMSUnavailable):
+		utils.ServiceUnavailable(c, err.Error(), nil)
+	default:
+		utils.InternalServerError(c, message, err.Error())
+	}
+}
+
+// ExportData downloads everything stored about the user, as one JSON document
+// or with ?format=zip as a ZIP of one file per collection
+func (u *UserController) ExportData(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	format := c.DefaultQuery("format", models.ExportFormatJSON)
+	if format != models.ExportFormatJSON && format != models.ExportFormatZIP {
+		utils.BadRequest(c, "Invalid format", "format must be json or zip")
+		return
+	}
+
+	export, err := u.accounts.Export(c.Request.Context(), userID)
+	if err != nil {
+		if errors.Is(err, services.ErrUserNotFound) {
+			utils.NotFound(c, "User not found")
+			return
+		}
+		utils.InternalServerError(c, "Failed to export data", err.Error())
+		return
+	}
+
+	filename := "amobagan-export-" + export.ExportedAt.Format("2006-01-02")
+	if format == models.ExportFormatZIP {
+		var buf bytes.Buffer
+		if err := services.WriteExportZip(&buf, export); err != nil {
+			utils.InternalServerError(c, "Failed to export data", err.Error())
+			return
+		}
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`.zip"`)
+		c.Data(http.StatusOK, "application/zip", buf.Bytes())
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`.json"`)
+	c.IndentedJSON(http.StatusOK, export)
+}
+
+// DeleteAccount schedules the account for deletion and signs the user out.
+// Signing in again before the scheduled time cancels it.
+func (u *UserController) DeleteAccount(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	var request models.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	deletion, err := u.accounts.RequestDeletion(c.Request.Context(), userID, request.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrWrongPassword):
+			utils.Forbidden(c, err.Error())
+		case errors.Is(err, services.ErrUserNotFound):
+			utils.NotFound(c, "User not found")
+		default:
+			utils.InternalServerError(c, "Failed to delete account", err.Error())
+		}
+		return
+	}
+
+	utils.OK(c, "Account scheduled for deletion, sign in before then to keep it", deletion)
+}
+
+// sessionDevice describes the client from the request. Apps can name the
+// device in the X-Device-Name header.
+func sessionDevice(c *gin.Context) models.SessionDevice {
+	return models.SessionDevice{
+		Name:      c.GetHeader("X-Device-Name"),
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: c.ClientIP(),
+	}
+}
+
 func (u *UserController) UpdateNutritionalStatus(c *gin.Context) {
 	userID := c.GetString("userID")
 	if userID == "" {
@@ -190,29 +521,133 @@ func (u *UserController) UpdateNutritionalStatus(c *gin.Context) {
 		return
 	}
 	
-	// Update the nutritional status
-	err := services.UpdateNutritionalStatus(userID, request.NutritionalElements)
-	if err != nil {
-		utils.InternalServerError(c, "Failed to update nutritional status", err.Error())
+	loc, ok := nutritionLocation(c)
+	if !ok {
 		return
 	}
 	
-	// Get updated user data
-	user, err := services.GetUserByID(userID)
+	// Record the nutritional status events
+	todayStatus, err := services.UpdateNutritionalStatus(c.Request.Context(), userID, request.NutritionalElements, request.Barcode, time.Now().In(loc))
 	if err != nil {
-		utils.InternalServerError(c, "Failed to get updated user data", err.Error())
+		utils.InternalServerError(c, "Failed to update nutritional status", err.Error())
 		return
 	}
 	
 	response := map[string]interface{}{
 		"message": "Nutritional status updated successfully",
 		"nutritionalElements": request.NutritionalElements,
-		"updatedNutritionalStatus": user.NutritionalStatus,
+		"updatedNutritionalStatus": todayStatus,
+		"window": models.NutritionWindowToday,
 	}
 	
 	utils.OK(c, "Nutritional status updated successfully", response)
 }
 
+func (u *UserController) UpdateFoodAllergies(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	var request models.UpdateAllergiesRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	allergies, err := services.UpdateFoodAllergies(userID, request.FoodAllergies)
+	if err != nil {
+		utils.InternalServerError(c, "Failed to update food allergies", err.Error())
+		return
+	}
+
+	utils.OK(c, "Food allergies updated successfully", gin.H{"foodAllergies": allergies})
+}
+
+// GetProfile returns the user's profile with typed measurements
+func (u *UserController) GetProfile(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	profile, err := services.GetProfile(c.Request.Context(), userID)
+	if err != nil {
+		respondProfileError(c, "Failed to fetch profile", err)
+		return
+	}
+
+	utils.OK(c, "Profile retrieved successfully", profile)
+}
+
+// UpdateProfile changes the profile fields present in the body
+func (u *UserController) UpdateProfile(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	var request models.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		utils.BadRequest(c, "Invalid request body", err.Error())
+		return
+	}
+
+	profile, err := services.UpdateProfile(c.Request.Context(), userID, &request)
+	if err != nil {
+		respondProfileError(c, "Failed to update profile", err)
+		return
+	}
+
+	utils.OK(c, "Profile updated successfully", profile)
+}
+
+func respondProfileError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.NotFound(c, "User not found")
+	case errors.Is(err, services.ErrInvalidProfile):
+		utils.ValidationErrorResponse(c, err.Error(), nil)
+	default:
+		utils.InternalServerError(c, message, err.Error())
+	}
+}
+
+// GetTargets returns the user's daily energy, macro and limit targets
+func (u *UserController) GetTargets(c *gin.Context) {
+	userID := c.GetString("userID")
+	if userID == "" {
+		utils.BadRequest(c, "User not authenticated", nil)
+		return
+	}
+
+	targets, err := services.GetUserTargets(userID)
+	if err != nil {
+		utils.InternalServerError(c, "Failed to calculate nutrient targets", err.Error())
+		return
+	}
+
+	utils.OK(c, "Nutrient targets calculated successfully", targets)
+}
+
+// nutritionLocation reads the ?tz= query (IANA name) that nutrition day
+// boundaries follow, UTC by default. It answers 400 for unknown zones.
+func nutritionLocation(c *gin.Context) (*time.Location, bool) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return time.UTC, true
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		utils.BadRequest(c, "Invalid time zone", err.Error())
+		return nil, false
+	}
+	return loc, true
+}
+
 func (u *UserController) GetNutritionDetails(c *gin.Context) {
 	userID := c.GetString("userID")
 	if userID == "" {
@@ -220,8 +655,19 @@ func (u *UserController) GetNutritionDetails(c *gin.Context) {
 		return
 	}
 	
+	window := c.DefaultQuery("window", models.NutritionWindowToday)
+	if _, err := services.NutritionWindowStart(window, time.Now()); err != nil {
+		utils.BadRequest(c, "Invalid window", err.Error())
+		return
+	}
+	
+	loc, ok := nutritionLocation(c)
+	if !ok {
+		return
+	}
+	
 	// Get user nutrition details with feedback
-	nutritionDetails, err := services.GetUserNutritionDetails(userID)
+	nutritionDetails, err := services.GetUserNutritionDetails(c.Request.Context(), userID, window, time.Now().In(loc))
 	if err != nil {
 		utils.InternalServerError(c, "Failed to get nutrition details", err.Error())
 		return
@@ -1,11 +1,14 @@
 package controllers
 
 import (
+	"amobagan/barcode"
 	"amobagan/lib"
 	"amobagan/models"
 	"amobagan/services"
 	"amobagan/utils"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -16,17 +19,23 @@ import (
 
 type WebSocketController struct {
 	nutritionService *services.NutritionAnalysisService
+	productProvider  lib.ProductProvider
+	history          *services.ScanHistoryService
 	upgrader         websocket.Upgrader
 }
 
 func NewWebSocketController() *WebSocketController {
 	nutritionService, err := services.NewNutritionAnalysisService()
 	if err != nil {
-		nutritionService = nil
+		// Keep streaming rule-based analyses when the LLM can't be set up
+		log.Printf("LLM unavailable, nutrition analysis limited to rules: %v", err)
+		nutritionService = services.NewNutritionAnalysisServiceWithLLM(nil)
 	}
 
 	return &WebSocketController{
 		nutritionService: nutritionService,
+		productProvider:  lib.GetProductProvider(),
+		history:          services.NewScanHistoryService(),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true // Allow all origins for development
@@ -53,21 +62,18 @@ func (w *WebSocketController) GetUserPreferences(c *gin.Context) (*models.UserPr
 		return nil, err
 	}
 
+	c.Set("userID", userID)
+
 	user, err := services.GetUserByID(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user preferences"})
 		return nil, err
 	}
 
-	userPrefs := models.UserPreferences{
-		HealthGoals:        user.HealthGoals,
-		DietaryPreferences: user.DietaryPreferences,
-		NutritionPriorities: user.NutritionPriorities,
-		UserName:           user.FullName,
-	}
+	userPrefs := services.PreferencesFromUser(user)
 
 	log.Println("User Preferences in getUserPreferences:", userPrefs)
-	return &userPrefs, nil
+	return userPrefs, nil
 }
 
 func (w *WebSocketController) StreamNutritionAnalysis(c *gin.Context) {
@@ -118,22 +124,15 @@ func (w *WebSocketController) StreamNutritionAnalysis(c *gin.Context) {
 			continue
 		}
 
-		if w.nutritionService == nil {
-			errorMsg := StreamMessage{
-				Type:    "error",
-				Content: "Nutrition analysis service not available",
-			}
-			conn.WriteJSON(errorMsg)
-			continue
-		}
-
-		w.streamNutritionAnalysis(conn, request.Barcode, &request.UserPreferences, userPrefs)
+		w.streamNutritionAnalysis(c.Request.Context(), conn, c.GetString("userID"), request.Barcode, &request.UserPreferences, userPrefs)
 	}
 }
 
 func (w *WebSocketController) streamNutritionAnalysis(
+	ctx context.Context,
 	conn *websocket.Conn,
-	barcode string,
+	userID string,
+	rawBarcode string,
 	requestUserPrefs *models.UserPreferences,
 	userPrefs *models.UserPreferences,
 ) {
@@ -141,7 +140,7 @@ func (w *WebSocketController) streamNutritionAnalysis(
 		Type:    "analysis_start",
 		Content: "Starting nutrition analysis...",
 		Data: gin.H{
-			"barcode": barcode,
+			"barcode": rawBarcode,
 		},
 	}
 	if err := conn.WriteJSON(startMsg); err != nil {
@@ -149,11 +148,27 @@ func (w *WebSocketController) streamNutritionAnalysis(
 		return
 	}
 
-	product, err := lib.RetrieveProductDetailsByBarcode(barcode)
+	code, err := barcode.Parse(rawBarcode)
+	if err == nil && !code.Lookupable() {
+		err = fmt.Errorf("%w: not a product barcode", barcode.ErrInvalid)
+	}
 	if err != nil {
+		conn.WriteJSON(StreamMessage{
+			Type:    "error",
+			Content: fmt.Sprintf("Invalid barcode: %v", err),
+		})
+		return
+	}
+
+	product, err := w.productProvider.GetProduct(lib.WithProductUser(ctx, userID), code.GTIN)
+	if err != nil {
+		content := "Product not found"
+		if !errors.Is(err, lib.ErrProductNotFound) {
+			content = "Failed to retrieve product"
+		}
 		errorMsg := StreamMessage{
 			Type:    "error",
-			Content: "Product not found",
+			Content: content,
 		}
 		conn.WriteJSON(errorMsg)
 		return
@@ -169,7 +184,8 @@ func (w *WebSocketController) streamNutritionAnalysis(
 		return
 	}
 
-	err = w.nutritionService.StreamNutritionAnalysisWithPreferences(
+	streamedText, err := w.nutritionService.StreamNutritionAnalysisWithPreferences(
+		ctx,
 		conn,
 		product,
 		userPrefs,
@@ -180,9 +196,21 @@ func (w *WebSocketController) streamNutritionAnalysis(
 			Content: fmt.Sprintf("Analysis failed: %v", err),
 		}
 		conn.WriteJSON(errorMsg)
+
+		fallback := w.nutritionService.AnalyzeWithRules(ctx, product, userPrefs)
+		fallbackMsg := StreamMessage{
+			Type:    "analysis_fallback",
+			Content: "AI analysis unavailable, showing rule-based analysis",
+			Data:    w.nutritionService.FormatAnalysisForDisplay(fallback),
+		}
+		conn.WriteJSON(fallbackMsg)
+		w.history.RecordAsync(userID, product, fallback, userPrefs, models.ScanSourceStream, "")
 		return
 	}
 
+	// The stream is free-form markdown, so history keeps it with the grade it gave
+	w.history.RecordAsync(userID, product, nil, userPrefs, models.ScanSourceStream, streamedText)
+
 	completeMsg := StreamMessage{
 		Type:    "analysis_complete",
 		Content: "Nutrition analysis completed successfully",
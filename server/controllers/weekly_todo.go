@@ -36,9 +36,9 @@ func (c *WeeklyTodoController) GenerateWeeklyTodo(ctx *gin.Context) {
 		return
 	}
 
-	weeklyTodo, err := c.weeklyTodoService.GenerateWeeklyTodo(userID, request.GenerateNewWeek)
+	weeklyTodo, err := c.weeklyTodoService.GenerateWeeklyTodo(ctx.Request.Context(), userID, request.GenerateNewWeek)
 	if err != nil {
-		utils.SendErrorResponse(ctx, http.StatusInternalServerError, "Failed to generate weekly todo", err.Error())
+		respondGenerationError(ctx, "Failed to generate weekly todo", err)
 		return
 	}
 
@@ -215,10 +215,11 @@ func (c *WeeklyTodoController) GenerateWeeklyAnalysis(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, response)
 }
 
+// TestUserExists is an admin debug endpoint showing a user's stored profile
 func (c *WeeklyTodoController) TestUserExists(ctx *gin.Context) {
-	userID := ctx.GetString("userID")
+	userID := ctx.Param("userId")
 	if userID == "" {
-		utils.SendErrorResponse(ctx, http.StatusUnauthorized, "User not authenticated", "")
+		utils.SendErrorResponse(ctx, http.StatusBadRequest, "User ID is required", "")
 		return
 	}
 
@@ -0,0 +1,53 @@
+package lib
+
+import (
+	"amobagan/utils"
+	"context"
+	"errors"
+	"log"
+)
+
+// ChainedProvider asks each provider in order and returns the first hit
+type ChainedProvider struct {
+	providers []ProductProvider
+}
+
+func NewChainedProvider(providers ...ProductProvider) *ChainedProvider {
+	return &ChainedProvider{providers: providers}
+}
+
+func (p *ChainedProvider) Name() string {
+	name := "chain"
+	for i, provider := range p.providers {
+		if i == 0 {
+			name += ":"
+		} else {
+			name += ","
+		}
+		name += provider.Name()
+	}
+	return name
+}
+
+func (p *ChainedProvider) GetProduct(ctx context.Context, barcode string) (*utils.ExtractedNutritionData, error) {
+	var lastErr error
+	for _, provider := range p.providers {
+		product, err := provider.GetProduct(ctx, barcode)
+		if err == nil {
+			return product, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if !errors.Is(err, ErrProductNotFound) {
+			log.Printf("Product provider %s failed for %s: %v", provider.Name(), barcode, err)
+			lastErr = err
+		}
+	}
+
+	// Only surface a provider failure when nobody could answer definitively
+	if lastErr != nil {
+		return nil, lastErr
+	}
+	return nil, ErrProductNotFound
+}
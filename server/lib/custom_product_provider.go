@@ -0,0 +1,122 @@
+package lib
+
+import (
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DataSource values of products users entered themselves
+const (
+	DataSourceUserSubmitted = "UserSubmitted"
+	DataSourceCommunity     = "Community"
+)
+
+type productUserKey struct{}
+
+// WithProductUser tells user-aware providers whose private products to include
+func WithProductUser(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, productUserKey{}, userID)
+}
+
+func productUser(ctx context.Context) string {
+	userID, _ := ctx.Value(productUserKey{}).(string)
+	return userID
+}
+
+// CustomProductProvider resolves products users entered from the label. A
+// user sees their own submissions and everyone sees approved shared ones.
+type CustomProductProvider struct {
+	collection *mongo.Collection
+}
+
+func NewCustomProductProvider() *CustomProductProvider {
+	return &CustomProductProvider{collection: DB.Database("amobagan").Collection("custom_products")}
+}
+
+func (p *CustomProductProvider) Name() string {
+	return "custom"
+}
+
+func (p *CustomProductProvider) GetProduct(ctx context.Context, barcode string) (*utils.ExtractedNutritionData, error) {
+	visible := []bson.M{{"status": models.CustomProductStatusApproved}}
+	if userID, err := primitive.ObjectIDFromHex(productUser(ctx)); err == nil {
+		visible = append(visible, bson.M{"submitted_by": userID})
+	}
+
+	cursor, err := p.collection.Find(ctx, bson.M{"barcode": barcode, "$or": visible},
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up custom product: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var products []models.CustomProduct
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, fmt.Errorf("failed to decode custom product: %v", err)
+	}
+	if len(products) == 0 {
+		return nil, ErrProductNotFound
+	}
+
+	// The user's own entry wins over what others shared
+	chosen := products[0]
+	for _, product := range products {
+		if product.SubmittedBy.Hex() == productUser(ctx) {
+			chosen = product
+			break
+		}
+	}
+	return CustomProductData(&chosen)
+}
+
+// CustomProductData runs a custom product through the same extraction as
+// upstream data so scores, NOVA, additives and allergens are derived alike
+func CustomProductData(product *models.CustomProduct) (*utils.ExtractedNutritionData, error) {
+	n := product.Per100g
+	nutriments := map[string]interface{}{
+		"energy-kcal_100g":   n.EnergyKcal,
+		"energy-kj_100g":     n.EnergyKcal * 4.184,
+		"proteins_100g":      n.Proteins,
+		"carbohydrates_100g": n.Carbohydrates,
+		"sugars_100g":        n.Sugars,
+		"fat_100g":           n.FatTotal,
+		"saturated-fat_100g": n.SaturatedFat,
+		"salt_100g":          n.Salt,
+		"sodium_100g":        n.Salt / 2.5,
+	}
+	if n.Fiber != nil {
+		nutriments["fiber_100g"] = *n.Fiber
+	}
+
+	extracted, err := utils.ExtractNutritionData(map[string]interface{}{
+		"status": 1,
+		"product": map[string]interface{}{
+			"code":             product.Barcode,
+			"product_name":     product.Name,
+			"brands":           product.Brand,
+			"quantity":         product.Quantity,
+			"ingredients_text": product.Ingredients,
+			"nutriments":       nutriments,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	extracted.ProductIdentification.FSSAILicense = product.FSSAILicense
+	extracted.ProductIdentification.LastUpdated = product.UpdatedAt.Format("2006-01-02")
+	extracted.ExtractionMetadata.DataSource = DataSourceUserSubmitted
+	extracted.ExtractionMetadata.ConfidenceScore.NutritionData = "user_submitted"
+	if product.Status == models.CustomProductStatusApproved {
+		extracted.ExtractionMetadata.DataSource = DataSourceCommunity
+		extracted.ExtractionMetadata.ConfidenceScore.NutritionData = "moderated"
+	}
+	return extracted, nil
+}
@@ -0,0 +1,85 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FakeLLM replays recorded responses instead of calling a model. Structured
+// calls return <feature>.json and streaming calls replay <feature>.stream.txt
+// line by line from the fixtures directory.
+type FakeLLM struct {
+	dir     string
+	feature string
+	model   string
+
+	mu      sync.Mutex
+	prompts []string
+}
+
+func NewFakeLLMFromDir(dir, feature, model string) *FakeLLM {
+	return &FakeLLM{dir: dir, feature: feature, model: model}
+}
+
+func (f *FakeLLM) Model() string {
+	return f.model
+}
+
+func (f *FakeLLM) Generate(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	f.record(prompt)
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return f.readFixture(f.feature + ".json")
+}
+
+func (f *FakeLLM) GenerateStream(ctx context.Context, prompt string, onChunk func(text string) error) error {
+	f.record(prompt)
+
+	content, err := f.readFixture(f.feature + ".stream.txt")
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.SplitAfter(content, "\n") {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if line == "" {
+			continue
+		}
+		if err := onChunk(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Prompts returns every prompt the fake has received, oldest first
+func (f *FakeLLM) Prompts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.prompts...)
+}
+
+func (f *FakeLLM) record(prompt string) {
+	f.mu.Lock()
+	f.prompts = append(f.prompts, prompt)
+	f.mu.Unlock()
+}
+
+func (f *FakeLLM) readFixture(name string) (string, error) {
+	content, err := os.ReadFile(filepath.Join(f.dir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("no LLM fixture %s in %s", name, f.dir)
+		}
+		return "", fmt.Errorf("failed to read LLM fixture: %v", err)
+	}
+	return string(content), nil
+}
@@ -21,4 +21,52 @@ func GetGeminiClient() (*genai.Client, error) {
 	return client, nil
 }
 
-const GEMINI_MODEL = "gemini-2.5-flash-lite-preview-06-17"
\ No newline at end of file
+const GEMINI_MODEL = "gemini-2.5-flash-lite-preview-06-17"
+
+// GeminiLLM adapts a genai client to the LLM interface
+type GeminiLLM struct {
+	client *genai.Client
+	model  string
+}
+
+func NewGeminiLLM(client *genai.Client, model string) *GeminiLLM {
+	return &GeminiLLM{client: client, model: model}
+}
+
+func (g *GeminiLLM) Model() string {
+	return g.model
+}
+
+func (g *GeminiLLM) Generate(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	var generateConfig *genai.GenerateContentConfig
+	if opts != nil {
+		generateConfig = &genai.GenerateContentConfig{
+			ResponseMIMEType: opts.ResponseMIMEType,
+			ResponseSchema:   opts.ResponseSchema,
+		}
+	}
+
+	response, err := g.client.Models.GenerateContent(ctx, g.model, genai.Text(prompt), generateConfig)
+	if err != nil {
+		return "", err
+	}
+	return response.Text(), nil
+}
+
+func (g *GeminiLLM) GenerateStream(ctx context.Context, prompt string, onChunk func(text string) error) error {
+	stream := g.client.Models.GenerateContentStream(ctx, g.model, genai.Text(prompt), nil)
+
+	for chunk, err := range stream {
+		if err != nil {
+			return err
+		}
+		text := chunk.Text()
+		if text == "" {
+			continue
+		}
+		if err := onChunk(text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package lib
+
+import (
+	"amobagan/config"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// Features that talk to an LLM. Each one can be pointed at its own model and
+// has its own fixtures when the fake provider is used.
+const (
+	LLMFeatureNutritionAnalysis = "nutrition_analysis"
+	LLMFeatureDietPlan          = "diet_plan"
+	LLMFeatureWeeklyTodo        = "weekly_todo"
+	LLMFeatureNutritionFeedback = "nutrition_feedback"
+)
+
+const (
+	LLMProviderGemini = "gemini"
+	LLMProviderFake   = "fake"
+)
+
+// GenerateOptions configures a structured generation call
+type GenerateOptions struct {
+	ResponseMIMEType string
+	ResponseSchema   *genai.Schema
+}
+
+// LLM is the text generation surface the services depend on
+type LLM interface {
+	Model() string
+	Generate(ctx context.Context, prompt string, opts *GenerateOptions) (string, error)
+	GenerateStream(ctx context.Context, prompt string, onChunk func(text string) error) error
+}
+
+// NewLLM builds the LLM for a feature from config.Config, wrapped with the
+// feature's timeout, retry and circuit breaker settings
+func NewLLM(feature string) (LLM, error) {
+	cfg := config.LoadConfig()
+	model := ModelForFeature(cfg, feature)
+
+	var llm LLM
+	switch strings.ToLower(cfg.LLMProvider) {
+	case LLMProviderGemini, "":
+		client, err := GetGeminiClient()
+		if err != nil {
+			return nil, err
+		}
+		llm = NewGeminiLLM(client, model)
+	case LLMProviderFake:
+		llm = NewFakeLLMFromDir(cfg.LLMFixturesDir, feature, model)
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q", cfg.LLMProvider)
+	}
+
+	return NewResilientLLM(llm, feature, ResilienceConfigForFeature(cfg, feature)), nil
+}
+
+// ResilienceConfigForFeature resolves the timeout and retry settings for a feature
+func ResilienceConfigForFeature(cfg *config.Config, feature string) ResilienceConfig {
+	timeout, ok := defaultLLMTimeouts[feature]
+	if !ok {
+		timeout = 30 * time.Second
+	}
+	if override, err := time.ParseDuration(cfg.LLMTimeouts[feature]); err == nil && override > 0 {
+		timeout = override
+	}
+
+	return ResilienceConfig{
+		Timeout:          timeout,
+		MaxAttempts:      cfg.LLMMaxAttempts,
+		InitialBackoff:   500 * time.Millisecond,
+		MaxBackoff:       8 * time.Second,
+		FailureThreshold: cfg.LLMBreakerThreshold,
+		OpenDuration:     cfg.LLMBreakerCooldown,
+	}
+}
+
+// ModelForFeature returns the model configured for a feature, defaulting to GEMINI_MODEL
+func ModelForFeature(cfg *config.Config, feature string) string {
+	if model, ok := cfg.LLMModelOverrides[feature]; ok && model != "" {
+		return model
+	}
+	return GEMINI_MODEL
+}
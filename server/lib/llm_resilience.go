@@ -0,0 +1,253 @@
+package lib
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+var (
+	// ErrLLMUnavailable means the model failed repeatedly or the circuit is open
+	ErrLLMUnavailable = errors.New("language model unavailable")
+	// ErrLLMTimeout means the model did not answer within the feature deadline
+	ErrLLMTimeout = errors.New("language model timed out")
+)
+
+// defaultLLMTimeouts are the per-feature deadlines used unless LLM_TIMEOUTS overrides them
+var defaultLLMTimeouts = map[string]time.Duration{
+	LLMFeatureNutritionAnalysis: 30 * time.Second,
+	LLMFeatureDietPlan:          90 * time.Second,
+	LLMFeatureWeeklyTodo:        90 * time.Second,
+	LLMFeatureNutritionFeedback: 15 * time.Second,
+}
+
+// ResilienceConfig tunes retries and the circuit breaker for one feature
+type ResilienceConfig struct {
+	Timeout          time.Duration
+	MaxAttempts      int
+	InitialBackoff   time.Duration
+	MaxBackoff       time.Duration
+	FailureThreshold int
+	OpenDuration     time.Duration
+}
+
+// ResilientLLM adds deadlines, retries with exponential backoff and a circuit
+// breaker around another LLM
+type ResilientLLM struct {
+	next    LLM
+	feature string
+	config  ResilienceConfig
+	breaker *CircuitBreaker
+}
+
+func NewResilientLLM(next LLM, feature string, config ResilienceConfig) *ResilientLLM {
+	if config.MaxAttempts < 1 {
+		config.MaxAttempts = 1
+	}
+	return &ResilientLLM{
+		next:    next,
+		feature: feature,
+		config:  config,
+		breaker: NewCircuitBreaker(config.FailureThreshold, config.OpenDuration),
+	}
+}
+
+func (r *ResilientLLM) Model() string {
+	return r.next.Model()
+}
+
+func (r *ResilientLLM) Generate(ctx context.Context, prompt string, opts *GenerateOptions) (string, error) {
+	var response string
+	err := r.do(ctx, func(ctx context.Context) (bool, error) {
+		var err error
+		response, err = r.next.Generate(ctx, prompt, opts)
+		return false, err
+	})
+	return response, err
+}
+
+func (r *ResilientLLM) GenerateStream(ctx context.Context, prompt string, onChunk func(text string) error) error {
+	return r.do(ctx, func(ctx context.Context) (bool, error) {
+		// Once text reached the caller a retry would duplicate it
+		delivered := false
+		err := r.next.GenerateStream(ctx, prompt, func(text string) error {
+			delivered = true
+			return onChunk(text)
+		})
+		return delivered, err
+	})
+}
+
+// do runs attempt until it succeeds, fails permanently, runs out of attempts
+// or hits the feature deadline. attempt reports whether it already produced
+// output, which makes the failure final.
+func (r *ResilientLLM) do(ctx context.Context, attempt func(ctx context.Context) (bool, error)) error {
+	if err := r.breaker.Allow(); err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	backoff := r.config.InitialBackoff
+	var lastErr error
+	for i := 1; i <= r.config.MaxAttempts; i++ {
+		delivered, err := attempt(ctx)
+		if err == nil {
+			r.breaker.RecordSuccess()
+			return nil
+		}
+		lastErr = err
+
+		if ctx.Err() != nil || delivered || !isRetryableLLMError(err) || i == r.config.MaxAttempts {
+			break
+		}
+
+		log.Printf("LLM %s attempt %d/%d failed, retrying in %s: %v", r.feature, i, r.config.MaxAttempts, backoff, err)
+		if !sleepWithContext(ctx, withJitter(backoff)) {
+			break
+		}
+		backoff = min(backoff*2, r.config.MaxBackoff)
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		r.breaker.RecordFailure()
+		return fmt.Errorf("%w: %s after %s: %v", ErrLLMTimeout, r.feature, r.config.Timeout, lastErr)
+	case ctx.Err() != nil:
+		// The caller went away, that says nothing about the model's health
+		r.breaker.Abandon()
+		return ctx.Err()
+	case isRetryableLLMError(lastErr):
+		r.breaker.RecordFailure()
+		return fmt.Errorf("%w: %s: %v", ErrLLMUnavailable, r.feature, lastErr)
+	default:
+		// The model answered, it just rejected this request
+		r.breaker.RecordSuccess()
+		return lastErr
+	}
+}
+
+// isRetryableLLMError reports whether an error is worth another attempt
+func isRetryableLLMError(err error) bool {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+			http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	return errors.Is(err, context.DeadlineExceeded)
+}
+
+func withJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+func sleepWithContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+type circuitState int
+
+const (
+	circuitClosed circuitState = iota
+	circuitOpen
+	circuitHalfOpen
+)
+
+// CircuitBreaker stops calling a failing dependency for a cool-down period
+// after threshold consecutive failures, then lets a single trial call through
+type CircuitBreaker struct {
+	mu           sync.Mutex
+	state        circuitState
+	failures     int
+	openedAt     time.Time
+	threshold    int
+	openDuration time.Duration
+}
+
+func NewCircuitBreaker(threshold int, openDuration time.Duration) *CircuitBreaker {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &CircuitBreaker{threshold: threshold, openDuration: openDuration}
+}
+
+// Allow returns ErrLLMUnavailable while the circuit is open
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case circuitOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return fmt.Errorf("%w: circuit open", ErrLLMUnavailable)
+		}
+		b.state = circuitHalfOpen
+		return nil
+	case circuitHalfOpen:
+		return fmt.Errorf("%w: circuit half-open, trial in progress", ErrLLMUnavailable)
+	default:
+		return nil
+	}
+}
+
+func (b *CircuitBreaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = circuitClosed
+	b.failures = 0
+}
+
+// Abandon returns a half-open circuit to open when its trial call ended
+// without telling us anything, so the next caller can try again
+func (b *CircuitBreaker) Abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == circuitHalfOpen {
+		b.state = circuitOpen
+	}
+}
+
+func (b *CircuitBreaker) RecordFailure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == circuitHalfOpen || b.failures >= b.threshold {
+		if b.state != circuitOpen {
+			log.Printf("Circuit breaker opened after %d consecutive failures", b.failures)
+		}
+		b.state = circuitOpen
+		b.openedAt = time.Now()
+	}
+}
@@ -1,20 +1,46 @@
 package lib
 
 import (
-	"amobagan/config"
+	"amobagan/barcode"
 	"amobagan/utils"
-	"errors"
+	"context"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"time"
 )
 
+// OpenFoodFactsProvider fetches products from the OpenFoodFacts v3 API
+type OpenFoodFactsProvider struct {
+	baseURL    string
+	httpClient *http.Client
+}
 
+func NewOpenFoodFactsProvider(baseURL string) *OpenFoodFactsProvider {
+	return &OpenFoodFactsProvider{
+		baseURL:    baseURL,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+	}
+}
 
-func RetrieveProductDetailsByBarcode(barcode string) (*utils.ExtractedNutritionData, error) {
-	url := config.OPEN_FOOD_FACTS_BASE_URL + barcode + ".json"
+func (p *OpenFoodFactsProvider) Name() string {
+	return ProviderOpenFoodFacts
+}
+
+func (p *OpenFoodFactsProvider) GetProduct(ctx context.Context, code string) (*utils.ExtractedNutritionData, error) {
+	// The barcode becomes part of the URL, only ever send valid codes upstream
+	if !barcode.ValidCheckDigit(code) {
+		return nil, ErrProductNotFound
+	}
+	url := p.baseURL + code + ".json"
 
-	response, err := http.Get(url)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := p.httpClient.Do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -26,20 +52,28 @@ func RetrieveProductDetailsByBarcode(barcode string) (*utils.ExtractedNutritionD
 	}
 
 	if response.StatusCode == http.StatusNotFound {
-		return nil,errors.New("product not found")
+		return nil, ErrProductNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("openfoodfacts returned status %d", response.StatusCode)
 	}
 
 	jsonData, err := utils.ParseJSONResponse(body)
 	if err != nil {
 		log.Println("Error parsing JSON response:", err)
-		return nil,err
+		return nil, err
 	}
 
 	extractedNutritionData, err := utils.ExtractNutritionData(jsonData)
 	if err != nil {
 		log.Println("Error extracting nutrition data:", err)
-		return nil,err
+		return nil, err
 	}
 
-	return extractedNutritionData,nil
-}
\ No newline at end of file
+	return extractedNutritionData, nil
+}
+
+// RetrieveProductDetailsByBarcode looks a barcode up through the configured provider chain
+func RetrieveProductDetailsByBarcode(barcode string) (*utils.ExtractedNutritionData, error) {
+	return GetProductProvider().GetProduct(context.Background(), barcode)
+}
@@ -0,0 +1,201 @@
+package lib
+
+import (
+	"amobagan/config"
+	"amobagan/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// productCacheEntry is the cached result of a barcode lookup. Negative entries
+// remember that no provider knew the barcode.
+type productCacheEntry struct {
+	Barcode   string                        `bson:"_id"`
+	Product   *utils.ExtractedNutritionData `bson:"product,omitempty"`
+	NotFound  bool                          `bson:"not_found"`
+	FetchedAt time.Time                     `bson:"fetched_at"`
+	PurgeAt   time.Time                     `bson:"purge_at"`
+}
+
+// CachedProductProvider fronts another provider with an in-memory LRU backed
+// by the product_cache collection. Entries older than ttl are still served for
+// staleTTL while a background refresh runs.
+type CachedProductProvider struct {
+	next        ProductProvider
+	collection  *mongo.Collection
+	memory      *lruCache[*productCacheEntry]
+	ttl         time.Duration
+	staleTTL    time.Duration
+	negativeTTL time.Duration
+
+	refreshMu  sync.Mutex
+	refreshing map[string]bool
+}
+
+func NewCachedProductProvider(next ProductProvider, cfg *config.Config) *CachedProductProvider {
+	cache := &CachedProductProvider{
+		next:        next,
+		memory:      newLRUCache[*productCacheEntry](cfg.ProductCacheSize),
+		ttl:         cfg.ProductCacheTTL,
+		staleTTL:    cfg.ProductCacheStaleTTL,
+		negativeTTL: cfg.ProductCacheNegativeTTL,
+		refreshing:  make(map[string]bool),
+	}
+
+	if DB != nil {
+		cache.collection = DB.Database("amobagan").Collection("product_cache")
+		cache.ensureIndexes()
+	}
+
+	return cache
+}
+
+func (p *CachedProductProvider) Name() string {
+	return "cache:" + p.next.Name()
+}
+
+func (p *CachedProductProvider) GetProduct(ctx context.Context, barcode string) (*utils.ExtractedNutritionData, error) {
+	entry := p.lookup(ctx, barcode)
+	if entry != nil {
+		age := time.Since(entry.FetchedAt)
+
+		if entry.NotFound {
+			if age < p.negativeTTL {
+				return nil, ErrProductNotFound
+			}
+		} else if age < p.ttl {
+			return entry.Product, nil
+		} else if age < p.ttl+p.staleTTL {
+			p.refreshInBackground(barcode)
+			return entry.Product, nil
+		}
+	}
+
+	product, err := p.fetch(ctx, barcode)
+	if err != nil && entry != nil && entry.Product != nil && !errors.Is(err, ErrProductNotFound) {
+		// Upstream is having trouble, an expired answer beats no answer
+		log.Printf("Serving expired cache entry for %s after refresh failure: %v", barcode, err)
+		return entry.Product, nil
+	}
+	return product, err
+}
+
+// Purge drops a barcode from both cache tiers
+func (p *CachedProductProvider) Purge(ctx context.Context, barcode string) error {
+	p.memory.Delete(barcode)
+	if p.collection == nil {
+		return nil
+	}
+
+	if _, err := p.collection.DeleteOne(ctx, bson.M{"_id": barcode}); err != nil {
+		return fmt.Errorf("failed to purge cached product: %v", err)
+	}
+	return nil
+}
+
+func (p *CachedProductProvider) lookup(ctx context.Context, barcode string) *productCacheEntry {
+	if entry, ok := p.memory.Get(barcode); ok {
+		return entry
+	}
+	if p.collection == nil {
+		return nil
+	}
+
+	var entry productCacheEntry
+	err := p.collection.FindOne(ctx, bson.M{"_id": barcode}).Decode(&entry)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error reading product cache for %s: %v", barcode, err)
+		}
+		return nil
+	}
+
+	p.memory.Set(barcode, &entry)
+	return &entry
+}
+
+func (p *CachedProductProvider) fetch(ctx context.Context, barcode string) (*utils.ExtractedNutritionData, error) {
+	product, err := p.next.GetProduct(ctx, barcode)
+	if err != nil {
+		if errors.Is(err, ErrProductNotFound) {
+			p.store(barcode, nil)
+		}
+		return nil, err
+	}
+
+	p.store(barcode, product)
+	return product, nil
+}
+
+func (p *CachedProductProvider) store(barcode string, product *utils.ExtractedNutritionData) {
+	now := time.Now()
+	entry := &productCacheEntry{
+		Barcode:   barcode,
+		Product:   product,
+		NotFound:  product == nil,
+		FetchedAt: now,
+		PurgeAt:   now.Add(p.ttl + p.staleTTL),
+	}
+	if entry.NotFound {
+		entry.PurgeAt = now.Add(p.negativeTTL)
+	}
+
+	p.memory.Set(barcode, entry)
+	if p.collection == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := p.collection.ReplaceOne(ctx, bson.M{"_id": barcode}, entry, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("Error writing product cache for %s: %v", barcode, err)
+	}
+}
+
+func (p *CachedProductProvider) refreshInBackground(barcode string) {
+	p.refreshMu.Lock()
+	if p.refreshing[barcode] {
+		p.refreshMu.Unlock()
+		return
+	}
+	p.refreshing[barcode] = true
+	p.refreshMu.Unlock()
+
+	go func() {
+		defer func() {
+			p.refreshMu.Lock()
+			delete(p.refreshing, barcode)
+			p.refreshMu.Unlock()
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		if _, err := p.fetch(ctx, barcode); err != nil && !errors.Is(err, ErrProductNotFound) {
+			log.Printf("Background refresh failed for %s: %v", barcode, err)
+		}
+	}()
+}
+
+func (p *CachedProductProvider) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := p.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "purge_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Failed to create product cache TTL index: %v", err)
+	}
+}
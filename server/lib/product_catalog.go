@@ -0,0 +1,207 @@
+package lib
+
+import (
+	"amobagan/config"
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// catalogSpecificTags is how many of a product's most specific category tags
+// are used to find products in the same category
+const catalogSpecificTags = 2
+
+// productCatalogEntry is a product we have seen, indexed by category
+type productCatalogEntry struct {
+	Barcode      string                        `bson:"_id"`
+	ProductName  string                        `bson:"product_name"`
+	Brand        string                        `bson:"brand,omitempty"`
+	CategoryTags []string                      `bson:"category_tags"`
+	PnnsGroup1   string                        `bson:"pnns_group_1,omitempty"`
+	PnnsGroup2   string                        `bson:"pnns_group_2,omitempty"`
+	Product      *utils.ExtractedNutritionData `bson:"product"`
+	LastSeenAt   time.Time                     `bson:"last_seen_at"`
+	// CustomProductID is set for approved user submissions, so the entry
+	// leaves the catalog when the submission is edited, rejected or deleted
+	CustomProductID *primitive.ObjectID `bson:"custom_product_id,omitempty"`
+}
+
+// ProductCatalog keeps every product any provider has returned so analyses can
+// suggest real, scannable alternatives. Unlike the product cache it never
+// expires entries. It is not the LocalCatalogProvider, which serves saved files.
+type ProductCatalog struct {
+	collection *mongo.Collection
+}
+
+var (
+	productCatalog     *ProductCatalog
+	productCatalogOnce sync.Once
+)
+
+// GetProductCatalog returns the shared catalog, or nil when it is disabled or
+// there is no database
+func GetProductCatalog() *ProductCatalog {
+	productCatalogOnce.Do(func() {
+		if DB == nil || !config.LoadConfig().ProductCatalogEnabled {
+			return
+		}
+		productCatalog = &ProductCatalog{collection: DB.Database("amobagan").Collection("product_catalog")}
+		productCatalog.ensureIndexes()
+	})
+	return productCatalog
+}
+
+// Add inserts or refreshes a product
+func (c *ProductCatalog) Add(ctx context.Context, product *utils.ExtractedNutritionData) error {
+	return c.add(ctx, product, nil)
+}
+
+// AddCustom catalogs an approved user submission
+func (c *ProductCatalog) AddCustom(ctx context.Context, product *models.CustomProduct) error {
+	data, err := CustomProductData(product)
+	if err != nil {
+		return err
+	}
+	return c.add(ctx, data, &product.ID)
+}
+
+// RemoveCustom drops the entries of user submissions that were withdrawn.
+// Entries an upstream provider has refreshed since are kept.
+func (c *ProductCatalog) RemoveCustom(ctx context.Context, customProductIDs ...primitive.ObjectID) error {
+	if len(customProductIDs) == 0 {
+		return nil
+	}
+	_, err := c.collection.DeleteMany(ctx, bson.M{"custom_product_id": bson.M{"$in": customProductIDs}})
+	if err != nil {
+		return fmt.Errorf("failed to remove custom products from catalog: %v", err)
+	}
+	return nil
+}
+
+func (c *ProductCatalog) add(ctx context.Context, product *utils.ExtractedNutritionData, customProductID *primitive.ObjectID) error {
+	id := product.ProductIdentification
+	if id.Barcode == "" {
+		return nil
+	}
+
+	entry := productCatalogEntry{
+		Barcode:      id.Barcode,
+		ProductName:  id.ProductName,
+		Brand:        id.Brand,
+		CategoryTags: product.ProcessingClassification.ProcessingIndicators.CategoryTags,
+		PnnsGroup1:   knownFoodGroup(product.FoodCategorization.FoodGroups.PnnsGroup1),
+		PnnsGroup2:   knownFoodGroup(product.FoodCategorization.FoodGroups.PnnsGroup2),
+		Product:      product,
+		LastSeenAt:   time.Now(),
+
+		CustomProductID: customProductID,
+	}
+	_, err := c.collection.ReplaceOne(ctx, bson.M{"_id": id.Barcode}, entry, options.Replace().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to add product to catalog: %v", err)
+	}
+	return nil
+}
+
+// SameCategory returns up to limit other catalog products that share the
+// product's PNNS group or one of its most specific category tags
+func (c *ProductCatalog) SameCategory(ctx context.Context, product *utils.ExtractedNutritionData, limit int) ([]*utils.ExtractedNutritionData, error) {
+	var or []bson.M
+	if group := knownFoodGroup(product.FoodCategorization.FoodGroups.PnnsGroup2); group != "" {
+		or = append(or, bson.M{"pnns_group_2": group})
+	}
+	tags := product.ProcessingClassification.ProcessingIndicators.CategoryTags
+	if len(tags) > 0 {
+		or = append(or, bson.M{"category_tags": bson.M{"$in": tags[max(0, len(tags)-catalogSpecificTags):]}})
+	}
+	if len(or) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.M{"_id": bson.M{"$ne": product.ProductIdentification.Barcode}, "$or": or}
+	cursor, err := c.collection.Find(ctx, filter, options.Find().
+		SetSort(bson.D{{Key: "last_seen_at", Value: -1}}).
+		SetLimit(int64(limit)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search product catalog: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var entries []productCatalogEntry
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode product catalog: %v", err)
+	}
+
+	products := make([]*utils.ExtractedNutritionData, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Product != nil {
+			products = append(products, entry.Product)
+		}
+	}
+	return products, nil
+}
+
+func (c *ProductCatalog) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := c.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "category_tags", Value: 1}}},
+		{Keys: bson.D{{Key: "pnns_group_2", Value: 1}}},
+		{
+			Keys:    bson.D{{Key: "custom_product_id", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to create product catalog indexes: %v", err)
+	}
+}
+
+// knownFoodGroup drops OpenFoodFacts' placeholder for missing food groups
+func knownFoodGroup(group string) string {
+	if strings.EqualFold(group, "unknown") {
+		return ""
+	}
+	return group
+}
+
+// CatalogingProvider adds every product the wrapped provider returns to the catalog
+type CatalogingProvider struct {
+	next    ProductProvider
+	catalog *ProductCatalog
+}
+
+func NewCatalogingProvider(next ProductProvider, catalog *ProductCatalog) *CatalogingProvider {
+	return &CatalogingProvider{next: next, catalog: catalog}
+}
+
+func (p *CatalogingProvider) Name() string {
+	return p.next.Name()
+}
+
+func (p *CatalogingProvider) GetProduct(ctx context.Context, barcode string) (*utils.ExtractedNutritionData, error) {
+	product, err := p.next.GetProduct(ctx, barcode)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := p.catalog.Add(ctx, product); err != nil {
+			log.Printf("Error cataloging product %s: %v", barcode, err)
+		}
+	}()
+	return product, nil
+}
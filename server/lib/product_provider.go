@@ -0,0 +1,86 @@
+package lib
+
+import (
+	"amobagan/config"
+	"amobagan/utils"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+)
+
+// ErrProductNotFound is returned by a ProductProvider when it has no data for a barcode
+var ErrProductNotFound = errors.New("product not found")
+
+// ProductProvider resolves a barcode into extracted nutrition data
+type ProductProvider interface {
+	Name() string
+	GetProduct(ctx context.Context, barcode string) (*utils.ExtractedNutritionData, error)
+}
+
+const (
+	ProviderOpenFoodFacts = "openfoodfacts"
+	ProviderLocalCatalog  = "local"
+)
+
+var (
+	productProvider     ProductProvider
+	productCache        *CachedProductProvider
+	productProviderOnce sync.Once
+)
+
+// GetProductProvider returns the process-wide provider built from config.Config,
+// feeding the product catalog and wrapped in the product cache unless they are disabled
+func GetProductProvider() ProductProvider {
+	productProviderOnce.Do(func() {
+		cfg := config.LoadConfig()
+		productProvider = NewProductProvider(cfg)
+		// Catalog below the cache so only fresh lookups are recorded
+		if catalog := GetProductCatalog(); catalog != nil {
+			productProvider = NewCatalogingProvider(productProvider, catalog)
+		}
+		if cfg.ProductCacheEnabled {
+			productCache = NewCachedProductProvider(productProvider, cfg)
+			productProvider = productCache
+		}
+		// User submissions answer only when no upstream provider knows the
+		// barcode; they are per user, so they stay out of the shared cache
+		if DB != nil {
+			productProvider = NewChainedProvider(productProvider, NewCustomProductProvider())
+		}
+	})
+	return productProvider
+}
+
+// GetProductCache returns the shared product cache, or nil when caching is disabled
+func GetProductCache() *CachedProductProvider {
+	GetProductProvider()
+	return productCache
+}
+
+// NewProductProvider builds the provider chain listed in cfg.ProductProviders
+func NewProductProvider(cfg *config.Config) ProductProvider {
+	var providers []ProductProvider
+	for _, name := range strings.Split(cfg.ProductProviders, ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case ProviderOpenFoodFacts:
+			providers = append(providers, NewOpenFoodFactsProvider(config.OPEN_FOOD_FACTS_BASE_URL))
+		case ProviderLocalCatalog:
+			providers = append(providers, NewLocalCatalogProvider(cfg.LocalCatalogDir))
+		case "":
+			continue
+		default:
+			log.Printf("Unknown product provider %q, skipping", name)
+		}
+	}
+
+	if len(providers) == 0 {
+		log.Println("No product providers configured, falling back to OpenFoodFacts")
+		return NewOpenFoodFactsProvider(config.OPEN_FOOD_FACTS_BASE_URL)
+	}
+	if len(providers) == 1 {
+		return providers[0]
+	}
+	return NewChainedProvider(providers...)
+}
@@ -0,0 +1,87 @@
+package lib
+
+import (
+	"amobagan/config"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SMS senders selectable with SMS_PROVIDER
+const (
+	SMSProviderConsole = "console"
+	SMSProviderFile    = "file"
+)
+
+// SMSSender delivers a text message to a 10 digit phone number
+type SMSSender interface {
+	Send(ctx context.Context, phoneNo, message string) error
+}
+
+// NewSMSSender builds the sender configured by SMS_PROVIDER, or returns nil
+// when none is set. Only development senders exist so far and they must be
+// chosen explicitly; a gateway implements the same interface.
+func NewSMSSender() (SMSSender, error) {
+	cfg := config.LoadConfig()
+	switch strings.ToLower(strings.TrimSpace(cfg.SMSProvider)) {
+	case "":
+		return nil, nil
+	case SMSProviderConsole:
+		return ConsoleSMSSender{}, nil
+	case SMSProviderFile:
+		return NewFileSMSSender(cfg.SMSOutboxFile), nil
+	default:
+		return nil, fmt.Errorf("unknown SMS provider %q", cfg.SMSProvider)
+	}
+}
+
+// ConsoleSMSSender prints messages to the server log
+type ConsoleSMSSender struct{}
+
+func (ConsoleSMSSender) Send(ctx context.Context, phoneNo, message string) error {
+	log.Printf("📱 SMS to %s: %s", phoneNo, message)
+	return nil
+}
+
+// FileSMSSender appends messages as JSON lines to a file, so scripts and
+// manual testing can read the codes
+type FileSMSSender struct {
+	path string
+	mu   sync.Mutex
+}
+
+type outboxMessage struct {
+	To      string    `json:"to"`
+	Message string    `json:"message"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+func NewFileSMSSender(path string) *FileSMSSender {
+	return &FileSMSSender{path: path}
+}
+
+func (f *FileSMSSender) Send(ctx context.Context, phoneNo, message string) error {
+	line, err := json.Marshal(outboxMessage{To: phoneNo, Message: message, SentAt: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open SMS outbox: %v", err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write SMS outbox: %v", err)
+	}
+	return nil
+}
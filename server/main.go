@@ -1,11 +1,14 @@
 package main
 
 import (
+    "context"
     "log"
 
     "amobagan/config"
     "amobagan/lib"
     "amobagan/routes"
+    "amobagan/services"
+    "amobagan/utils"
 
     "github.com/gin-gonic/gin"
     "github.com/gin-contrib/cors"
@@ -16,6 +19,20 @@ func main() {
 
     lib.ConnectDB(cfg)
 
+    if err := services.RunMigrations(context.Background()); err != nil {
+        log.Fatal("Failed to run migrations:", err)
+    }
+
+    if err := services.PromoteAdmins(context.Background(), cfg.AdminPhoneNumbers); err != nil {
+        log.Printf("Failed to promote configured admins: %v", err)
+    }
+
+    // Accounts past their deletion grace period are purged in the background
+    services.NewAccountService().StartPurger(cfg.AccountPurgeInterval)
+
+    // Access tokens of signed out sessions are refused
+    utils.SetTokenDenylist(services.GetSessionService())
+
     gin.SetMode(cfg.GinMode) // for detailed logging
 
     router := gin.Default()
@@ -24,7 +41,7 @@ func main() {
     router.Use(cors.New(cors.Config{
         AllowOrigins:     []string{"http://localhost:3000"},
         AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-        AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Device-Name"},
         ExposeHeaders:    []string{"Content-Length"},
         AllowCredentials: true,
         MaxAge:           12 * 60 * 60, // 12 hours
@@ -2,6 +2,7 @@ package middleware
 
 import (
 	"amobagan/utils"
+	"errors"
 	"net/http"
 	"strings"
 
@@ -29,10 +30,14 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		token := strings.TrimPrefix(authHeader, "Bearer ")
 
-		claims, err := utils.VerifyJWT(token)
+		claims, err := utils.VerifyAccessToken(c.Request.Context(), token)
 		if err != nil {
+			message := "Invalid or expired token"
+			if errors.Is(err, utils.ErrTokenRevoked) {
+				message = "Session has been signed out"
+			}
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid or expired token",
+				"error": message,
 			})
 			c.Abort()
 			return
@@ -48,6 +53,7 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		c.Set("userID", userID)
+		c.Set("sessionID", claims["sid"])
 		c.Set("fullName", claims["fullName"])
 		c.Set("phoneNo", claims["phoneNo"])
 		c.Set("petraWalletAddress", claims["petraWalletAddress"])
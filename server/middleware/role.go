@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"amobagan/models"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets users with one of the roles through. It must run
+// after AuthMiddleware, which puts the token's role in the context.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := GetRoleFromContext(c)
+		for _, allowed := range roles {
+			if role == allowed {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{
+			"error": "Insufficient role",
+		})
+		c.Abort()
+	}
+}
+
+// RequirePermission only lets users whose role grants the permission through.
+// It must run after AuthMiddleware.
+func RequirePermission(permission models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.RoleHasPermission(GetRoleFromContext(c), permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Insufficient permissions",
+				"permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// GetRoleFromContext returns the authenticated user's role, RoleUser when
+// the token carries none
+func GetRoleFromContext(c *gin.Context) string {
+	return models.NormalizeRole(c.GetString("role"))
+}
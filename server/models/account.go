@@ -0,0 +1,54 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Account audit actions
+const (
+	AuditDataExported      = "data_exported"
+	AuditDeletionRequested = "deletion_requested"
+	AuditDeletionCancelled = "deletion_cancelled"
+	AuditAccountDeleted    = "account_deleted"
+)
+
+// Export formats
+const (
+	ExportFormatJSON = "json"
+	ExportFormatZIP  = "zip"
+)
+
+// AccountAuditEvent records a data-subject request. Events outlive the
+// account and hold no personal data besides the user ID.
+type AccountAuditEvent struct {
+	ID     primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Action string             `json:"action" bson:"action"`
+	// Actor is "user" or "system"
+	Actor string `json:"actor" bson:"actor"`
+	// Deleted counts the documents removed per collection
+	Deleted map[string]int64 `json:"deleted,omitempty" bson:"deleted,omitempty"`
+	At      time.Time        `json:"at" bson:"at"`
+}
+
+// DataExport is everything stored about a user, per collection as MongoDB
+// extended JSON. Password and token hashes are left out.
+type DataExport struct {
+	UserID      string                       `json:"userId"`
+	ExportedAt  time.Time                    `json:"exportedAt"`
+	Collections map[string][]json.RawMessage `json:"collections"`
+}
+
+// DeleteAccountRequest confirms the deletion with the password
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// AccountDeletion tells when the account will be purged
+type AccountDeletion struct {
+	RequestedAt  time.Time `json:"requestedAt"`
+	ScheduledFor time.Time `json:"scheduledFor"`
+}
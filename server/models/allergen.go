@@ -0,0 +1,20 @@
+package models
+
+// AllergenMatch records where a user's allergen was found
+type AllergenMatch struct {
+	Allergen string `json:"allergen" bson:"allergen"`
+	Source   string `json:"source" bson:"source"` // "declared", "traces", "ingredients", "text"
+	Evidence string `json:"evidence" bson:"evidence"`
+}
+
+// AllergenSafety is the allergy verdict attached to an analysis
+type AllergenSafety struct {
+	Safe      bool            `json:"safe"`
+	Allergies []string        `json:"allergies"`
+	Matches   []AllergenMatch `json:"matches"`
+}
+
+// UpdateAllergiesRequest represents the request to replace a user's food allergies
+type UpdateAllergiesRequest struct {
+	FoodAllergies []string `json:"foodAllergies"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Custom product visibility
+const (
+	CustomProductPrivate = "private"
+	CustomProductShared  = "shared"
+)
+
+// Custom product moderation status. Private products are never reviewed.
+const (
+	CustomProductStatusPrivate  = "private"
+	CustomProductStatusPending  = "pending"
+	CustomProductStatusApproved = "approved"
+	CustomProductStatusRejected = "rejected"
+)
+
+// CustomProductNutrients are the label values per 100 g
+type CustomProductNutrients struct {
+	EnergyKcal    float64  `json:"energy_kcal" bson:"energy_kcal" binding:"gte=0,lte=900"`
+	Proteins      float64  `json:"proteins" bson:"proteins" binding:"gte=0,lte=100"`
+	Carbohydrates float64  `json:"carbohydrates" bson:"carbohydrates" binding:"gte=0,lte=100"`
+	Sugars        float64  `json:"sugars" bson:"sugars" binding:"gte=0,lte=100"`
+	FatTotal      float64  `json:"fat_total" bson:"fat_total" binding:"gte=0,lte=100"`
+	SaturatedFat  float64  `json:"saturated_fat" bson:"saturated_fat" binding:"gte=0,lte=100"`
+	Salt          float64  `json:"salt" bson:"salt" binding:"gte=0,lte=100"`
+	Fiber         *float64 `json:"fiber,omitempty" bson:"fiber,omitempty" binding:"omitempty,gte=0,lte=100"`
+}
+
+// CustomProduct is a product a user entered from its label because no
+// provider knew the barcode
+type CustomProduct struct {
+	ID             primitive.ObjectID     `json:"id" bson:"_id,omitempty"`
+	Barcode        string                 `json:"barcode" bson:"barcode"`
+	SubmittedBy    primitive.ObjectID     `json:"submitted_by" bson:"submitted_by"`
+	Name           string                 `json:"name" bson:"name"`
+	Brand          string                 `json:"brand,omitempty" bson:"brand,omitempty"`
+	Quantity       string                 `json:"quantity,omitempty" bson:"quantity,omitempty"`
+	Per100g        CustomProductNutrients `json:"per_100g" bson:"per_100g"`
+	Ingredients    string                 `json:"ingredients,omitempty" bson:"ingredients,omitempty"`
+	FSSAILicense   string                 `json:"fssai_license,omitempty" bson:"fssai_license,omitempty"`
+	Visibility     string                 `json:"visibility" bson:"visibility"`
+	Status         string                 `json:"status" bson:"status"`
+	ModerationNote string                 `json:"moderation_note,omitempty" bson:"moderation_note,omitempty"`
+	ReviewedBy     *primitive.ObjectID    `json:"reviewed_by,omitempty" bson:"reviewed_by,omitempty"`
+	ReviewedAt     *time.Time             `json:"reviewed_at,omitempty" bson:"reviewed_at,omitempty"`
+	CreatedAt      time.Time              `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time              `json:"updated_at" bson:"updated_at"`
+}
+
+// CustomProductRequest creates or replaces a custom product
+type CustomProductRequest struct {
+	Barcode      string                 `json:"barcode" binding:"required"`
+	Name         string                 `json:"name" binding:"required,max=200"`
+	Brand        string                 `json:"brand" binding:"max=100"`
+	Quantity     string                 `json:"quantity" binding:"max=50"`
+	Per100g      CustomProductNutrients `json:"per_100g" binding:"required"`
+	Ingredients  string                 `json:"ingredients" binding:"max=5000"`
+	FSSAILicense string                 `json:"fssai_license"`
+	// Visibility is "private" (default) or "shared", which needs moderation
+	Visibility string `json:"visibility" binding:"omitempty,oneof=private shared"`
+}
+
+// ModerateCustomProductRequest approves or rejects a shared product
+type ModerateCustomProductRequest struct {
+	Status string `json:"status" binding:"required,oneof=approved rejected"`
+	Note   string `json:"note" binding:"max=500"`
+}
@@ -25,6 +25,8 @@ type UserProfile struct {
 	Weight              float64  `json:"weight"`
 	Height              float64  `json:"height"`
 	BMI                 float64  `json:"bmi"`
+	Sex                 string   `json:"sex,omitempty"`
+	ActivityLevel       string   `json:"activity_level,omitempty"`
 	WorkoutFrequency    string   `json:"workout_frequency"`
 	PrimaryGoal         string   `json:"primary_goal"`
 	GoalPace            float64  `json:"goal_pace"`
@@ -35,6 +37,7 @@ type UserProfile struct {
 	CompletedGoals      []string `json:"completed_goals"`
 	RemainingGoals      []string `json:"remaining_goals"`
 	HealthStatus        string   `json:"health_status"`
+	DailyTargets        *NutrientTargets `json:"daily_targets,omitempty"`
 }
 
 // DailyPlan represents a complete day's plan
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// FlexNumber is a number that also accepts numeric strings. Older app
+// versions send age, height and weight as text, and users stored before the
+// typed profile hold strings until the migration converts them.
+type FlexNumber float64
+
+// Float64 returns the number as a float64
+func (n FlexNumber) Float64() float64 {
+	return float64(n)
+}
+
+// Int returns the number rounded to an int
+func (n FlexNumber) Int() int {
+	return int(math.Round(float64(n)))
+}
+
+func (n *FlexNumber) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*n = 0
+		return nil
+	}
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		value, err := parseFlexNumber(s)
+		if err != nil {
+			return err
+		}
+		*n = FlexNumber(value)
+		return nil
+	}
+
+	var value float64
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("expected a number: %v", err)
+	}
+	*n = FlexNumber(value)
+	return nil
+}
+
+func (n *FlexNumber) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bsontype.Double:
+		*n = FlexNumber(raw.Double())
+	case bsontype.Int32:
+		*n = FlexNumber(raw.Int32())
+	case bsontype.Int64:
+		*n = FlexNumber(raw.Int64())
+	case bsontype.String:
+		// Unparsable legacy text reads as unknown rather than failing the whole user
+		value, _ := parseFlexNumber(raw.StringValue())
+		*n = FlexNumber(value)
+	case bsontype.Null, bsontype.Undefined:
+		*n = 0
+	default:
+		return fmt.Errorf("cannot decode %v into a number", t)
+	}
+	return nil
+}
+
+// parseFlexNumber reads a plain number; an empty string means unknown
+func parseFlexNumber(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", s)
+	}
+	return value, nil
+}
@@ -0,0 +1,117 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Food log entry sources
+const (
+	FoodLogSourceBarcode = "barcode"
+	FoodLogSourceMeal    = "meal"
+	FoodLogSourceCustom  = "custom"
+)
+
+// Food log base units: what BaseNutrients is expressed per
+const (
+	FoodLogBasePer100g    = "100g"
+	FoodLogBasePerServing = "serving"
+)
+
+// FoodLogEntry is one item the user ate, with nutrients for the logged portion
+type FoodLogEntry struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID        primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Source        string             `json:"source" bson:"source"` // "barcode", "meal", "custom"
+	Name          string             `json:"name" bson:"name"`
+	Brand         string             `json:"brand,omitempty" bson:"brand,omitempty"`
+	Barcode       string             `json:"barcode,omitempty" bson:"barcode,omitempty"`
+	MealRef       *MealReference     `json:"meal_ref,omitempty" bson:"meal_ref,omitempty"`
+	MealType      string             `json:"meal_type" bson:"meal_type"` // "breakfast", "lunch", "dinner", "snack"
+	PortionGrams  float64            `json:"portion_grams,omitempty" bson:"portion_grams,omitempty"`
+	Servings      float64            `json:"servings,omitempty" bson:"servings,omitempty"`
+	BaseUnit      string             `json:"base_unit" bson:"base_unit"` // "100g" or "serving"
+	BaseNutrients FoodNutrients      `json:"base_nutrients" bson:"base_nutrients"`
+	Nutrients     FoodNutrients      `json:"nutrients" bson:"nutrients"`
+	ConsumedAt    time.Time          `json:"consumed_at" bson:"consumed_at"`
+	Notes         string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// FoodNutrients are the nutrient amounts tracked in the diary
+type FoodNutrients struct {
+	EnergyKcal    float64 `json:"energy_kcal" bson:"energy_kcal"`
+	Proteins      float64 `json:"proteins" bson:"proteins"`
+	Carbohydrates float64 `json:"carbohydrates" bson:"carbohydrates"`
+	Sugars        float64 `json:"sugars" bson:"sugars"`
+	FatTotal      float64 `json:"fat_total" bson:"fat_total"`
+	SaturatedFat  float64 `json:"saturated_fat" bson:"saturated_fat"`
+	Salt          float64 `json:"salt" bson:"salt"`
+	Fiber         float64 `json:"fiber" bson:"fiber"`
+}
+
+// Scale returns the nutrients multiplied by factor
+func (n FoodNutrients) Scale(factor float64) FoodNutrients {
+	return FoodNutrients{
+		EnergyKcal:    n.EnergyKcal * factor,
+		Proteins:      n.Proteins * factor,
+		Carbohydrates: n.Carbohydrates * factor,
+		Sugars:        n.Sugars * factor,
+		FatTotal:      n.FatTotal * factor,
+		SaturatedFat:  n.SaturatedFat * factor,
+		Salt:          n.Salt * factor,
+		Fiber:         n.Fiber * factor,
+	}
+}
+
+// Add returns the sum of two nutrient sets
+func (n FoodNutrients) Add(o FoodNutrients) FoodNutrients {
+	return FoodNutrients{
+		EnergyKcal:    n.EnergyKcal + o.EnergyKcal,
+		Proteins:      n.Proteins + o.Proteins,
+		Carbohydrates: n.Carbohydrates + o.Carbohydrates,
+		Sugars:        n.Sugars + o.Sugars,
+		FatTotal:      n.FatTotal + o.FatTotal,
+		SaturatedFat:  n.SaturatedFat + o.SaturatedFat,
+		Salt:          n.Salt + o.Salt,
+		Fiber:         n.Fiber + o.Fiber,
+	}
+}
+
+// MealReference points at a meal inside a saved diet plan
+type MealReference struct {
+	PlanID     string `json:"plan_id" bson:"plan_id" binding:"required"`
+	Day        string `json:"day" bson:"day" binding:"required"`   // "Monday", "Tuesday", etc.
+	Slot       string `json:"slot" bson:"slot" binding:"required"` // "breakfast", "lunch", "dinner", "snack"
+	SnackIndex int    `json:"snack_index,omitempty" bson:"snack_index,omitempty"`
+}
+
+// CustomFood describes a food that isn't in any product database
+type CustomFood struct {
+	Name    string        `json:"name" binding:"required"`
+	Brand   string        `json:"brand,omitempty"`
+	Per100g FoodNutrients `json:"per_100g"`
+}
+
+// CreateFoodLogRequest logs exactly one of a barcode, a diet-plan meal or a custom food
+type CreateFoodLogRequest struct {
+	Barcode      string         `json:"barcode,omitempty"`
+	MealRef      *MealReference `json:"meal_ref,omitempty"`
+	CustomFood   *CustomFood    `json:"custom_food,omitempty"`
+	MealType     string         `json:"meal_type"`
+	PortionGrams float64        `json:"portion_grams,omitempty"`
+	Servings     float64        `json:"servings,omitempty"`
+	ConsumedAt   *time.Time     `json:"consumed_at,omitempty"`
+	Notes        string         `json:"notes,omitempty"`
+}
+
+// UpdateFoodLogRequest changes the portion or details of a logged entry
+type UpdateFoodLogRequest struct {
+	MealType     *string    `json:"meal_type,omitempty"`
+	PortionGrams *float64   `json:"portion_grams,omitempty"`
+	Servings     *float64   `json:"servings,omitempty"`
+	ConsumedAt   *time.Time `json:"consumed_at,omitempty"`
+	Notes        *string    `json:"notes,omitempty"`
+}
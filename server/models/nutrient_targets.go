@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// NutrientTargets are a user's daily goals and limits
+type NutrientTargets struct {
+	EnergyKcal    float64 `json:"energy_kcal"`
+	Proteins      float64 `json:"proteins"`
+	Carbohydrates float64 `json:"carbohydrates"`
+	FatTotal      float64 `json:"fat_total"`
+	Sugars        float64 `json:"sugars"`        // upper limit
+	SaturatedFat  float64 `json:"saturated_fat"` // upper limit
+	Salt          float64 `json:"salt"`          // upper limit
+	Fiber         float64 `json:"fiber"`         // minimum
+	// Personalized is false when the profile lacks age, weight or height and
+	// the defaults were used instead
+	Personalized bool            `json:"personalized"`
+	Energy       *EnergyEstimate `json:"energy,omitempty"`
+	MacroSplit   MacroSplit      `json:"macro_split"`
+}
+
+// EnergyEstimate explains how the energy target was derived
+type EnergyEstimate struct {
+	Formula        string  `json:"formula"` // "mifflin_st_jeor" or "harris_benedict"
+	BMI            float64 `json:"bmi"`
+	BMR            float64 `json:"bmr"`
+	ActivityFactor float64 `json:"activity_factor"`
+	TDEE           float64 `json:"tdee"`
+	PrimaryGoal    string  `json:"primary_goal"`
+	GoalAdjustment float64 `json:"goal_adjustment"` // kcal added to TDEE, negative for a deficit
+}
+
+// MacroSplit is the share of energy from each macronutrient, in percent
+type MacroSplit struct {
+	ProteinPercent float64 `json:"protein_percent"`
+	CarbsPercent   float64 `json:"carbs_percent"`
+	FatPercent     float64 `json:"fat_percent"`
+}
+
+// Nutrient target kinds
+const (
+	TargetKindGoal    = "goal"    // aim to land near the target
+	TargetKindLimit   = "limit"   // stay below the target
+	TargetKindMinimum = "minimum" // reach at least the target
+)
+
+// NutrientProgress compares one nutrient's intake with its target
+type NutrientProgress struct {
+	Nutrient  string  `json:"nutrient"`
+	Kind      string  `json:"kind"`
+	Consumed  float64 `json:"consumed"`
+	Target    float64 `json:"target"`
+	Remaining float64 `json:"remaining"`
+	Percent   float64 `json:"percent"`
+	Status    string  `json:"status"` // "under", "on_track", "over"
+}
+
+// DiaryPeriodSummary totals the diary over one day or week
+type DiaryPeriodSummary struct {
+	Label      string             `json:"label"` // "2025-01-06" or "2025-W02"
+	Start      time.Time          `json:"start"`
+	End        time.Time          `json:"end"`
+	Days       int                `json:"days"`
+	EntryCount int                `json:"entry_count"`
+	Totals     FoodNutrients      `json:"totals"`
+	Progress   []NutrientProgress `json:"progress"`
+}
+
+// DiarySummary is the response of /api/diary/summary
+type DiarySummary struct {
+	From    time.Time            `json:"from"`
+	To      time.Time            `json:"to"`
+	Targets NutrientTargets      `json:"daily_targets"`
+	Days    []DiaryPeriodSummary `json:"days"`
+	Weeks   []DiaryPeriodSummary `json:"weeks"`
+	Total   DiaryPeriodSummary   `json:"total"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // NutritionAnalysis represents the structured output for personalized nutrition analysis
 type NutritionAnalysis struct {
 	ProductName              string                 `json:"product_name"`
@@ -8,6 +10,19 @@ type NutritionAnalysis struct {
 	SmarterAlternatives      []Alternative          `json:"smarter_alternatives"`
 	PersonalizedCallout      PersonalizedCallout    `json:"personalized_callout"`
 	DetailedNutritionBreakdown *DetailedBreakdown   `json:"detailed_nutrition_breakdown,omitempty"`
+	AllergenSafety           *AllergenSafety        `json:"allergen_safety,omitempty" bson:"allergen_safety,omitempty"`
+	Meta                     *AnalysisMeta          `json:"meta,omitempty" bson:"meta,omitempty"`
+}
+
+// AnalysisMeta describes how an analysis was produced
+type AnalysisMeta struct {
+	Engine          string     `json:"engine"`
+	FallbackReason  string     `json:"fallback_reason,omitempty"`
+	CacheHit        bool       `json:"cache_hit"`
+	Fingerprint     string     `json:"fingerprint,omitempty"`
+	CachedAt        *time.Time `json:"cached_at,omitempty"`
+	TemplateVersion string     `json:"template_version,omitempty"`
+	Model           string     `json:"model,omitempty"`
 }
 
 // InstantHealthRating represents the personalized health rating
@@ -32,6 +47,10 @@ type Alternative struct {
 	Benefits    []string `json:"benefits"`
 	WhyBetter   string   `json:"why_better"`
 	KeyFeatures []string `json:"key_features"`
+	// Set when the alternative is a real product from the catalog
+	Barcode  string `json:"barcode,omitempty"`
+	Brand    string `json:"brand,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
 }
 
 // PersonalizedCallout represents the personalized message to the user
@@ -104,6 +123,7 @@ type UserPreferences struct {
 	HealthGoals        []string `json:"health_goals"`
 	DietaryPreferences []string `json:"dietary_preferences"`
 	NutritionPriorities []string `json:"nutrition_priorities"`
+	FoodAllergies      []string `json:"food_allergies,omitempty"`
 	UserName           string   `json:"user_name,omitempty"`
 }
 
@@ -117,6 +137,7 @@ const (
 	SugarControl    = "sugar_control"
 	PlantBased      = "plant_based"
 	CleanEating     = "clean_eating"
+	GeneralWellness = "general_wellness"
 )
 
 // DietaryPreferences constants
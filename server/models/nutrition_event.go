@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Nutritional status windows
+const (
+	NutritionWindowToday = "today"
+	NutritionWindowWeek  = "week"
+	NutritionWindowMonth = "month"
+	NutritionWindowAll   = "all"
+)
+
+// NutritionalStatusEvent records that the user ate something lacking one of
+// their nutrition priorities
+type NutritionalStatusEvent struct {
+	ID      primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID  primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Element string             `json:"element" bson:"element"`
+	Barcode string             `json:"barcode,omitempty" bson:"barcode,omitempty"`
+	Count   int                `json:"count" bson:"count"`
+	// Baseline events carry the counters from before events were recorded and
+	// only count towards the "all" window
+	Baseline  bool      `json:"baseline,omitempty" bson:"baseline,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
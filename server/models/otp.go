@@ -0,0 +1,77 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// What a one-time code proves
+const (
+	OTPPurposeVerifyPhone   = "verify_phone"
+	OTPPurposePasswordReset = "password_reset"
+)
+
+// OTP is the pending code of one phone number and purpose. Only hashes are
+// stored. A correct code yields a verification token that completes sign-up,
+// phone verification or a password reset once.
+type OTP struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty"`
+	PhoneNo   string             `bson:"phone_no"`
+	Purpose   string             `bson:"purpose"`
+	CodeHash  string             `bson:"code_hash"`
+	Attempts  int                `bson:"attempts"`
+	ExpiresAt time.Time          `bson:"expires_at"`
+	SentAt    time.Time          `bson:"sent_at"`
+	// SendCount codes were sent since WindowStart, for the hourly limit
+	SendCount   int       `bson:"send_count"`
+	WindowStart time.Time `bson:"window_start"`
+
+	VerifiedAt             *time.Time `bson:"verified_at,omitempty"`
+	VerificationTokenHash  string     `bson:"verification_token_hash,omitempty"`
+	VerificationExpiresAt  *time.Time `bson:"verification_expires_at,omitempty"`
+	VerificationConsumedAt *time.Time `bson:"verification_consumed_at,omitempty"`
+}
+
+// OTPRequest asks for a code to be sent
+type OTPRequest struct {
+	PhoneNo string `json:"phoneNo" binding:"required,len=10,numeric"`
+	Purpose string `json:"purpose" binding:"required,oneof=verify_phone password_reset"`
+}
+
+// OTPVerifyRequest checks a received code
+type OTPVerifyRequest struct {
+	PhoneNo string `json:"phoneNo" binding:"required,len=10,numeric"`
+	Purpose string `json:"purpose" binding:"required,oneof=verify_phone password_reset"`
+	Code    string `json:"code" binding:"required,len=6,numeric"`
+}
+
+// OTPSent tells the app how long the code lasts and when it may ask again
+type OTPSent struct {
+	ExpiresIn int64 `json:"expiresIn"`
+	ResendIn  int64 `json:"resendIn"`
+}
+
+// OTPVerified carries the token that proves the code was entered
+type OTPVerified struct {
+	VerificationToken string `json:"verificationToken"`
+	ExpiresIn         int64  `json:"expiresIn"`
+}
+
+// SignupRequest is a new user with the token from verifying the phone number
+type SignupRequest struct {
+	User
+	VerificationToken string `json:"verificationToken"`
+}
+
+// ResetPasswordRequest sets a new password with a password_reset token
+type ResetPasswordRequest struct {
+	PhoneNo           string `json:"phoneNo" binding:"required,len=10,numeric"`
+	VerificationToken string `json:"verificationToken" binding:"required"`
+	NewPassword       string `json:"newPassword" binding:"required,min=6"`
+}
+
+// VerifyPhoneRequest marks a signed-in user's phone verified
+type VerifyPhoneRequest struct {
+	VerificationToken string `json:"verificationToken" binding:"required"`
+}
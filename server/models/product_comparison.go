@@ -0,0 +1,67 @@
+package models
+
+// Product comparison limits
+const (
+	MinComparedProducts = 2
+	MaxComparedProducts = 5
+)
+
+// CompareProductsRequest lists the barcodes to compare side by side
+type CompareProductsRequest struct {
+	Barcodes []string `json:"barcodes" binding:"required"`
+	// Verdict asks the LLM for a short personalized recommendation
+	Verdict bool `json:"verdict"`
+}
+
+// ComparedProduct identifies one product in a comparison
+type ComparedProduct struct {
+	Barcode     string `json:"barcode"`
+	ProductName string `json:"product_name"`
+	Brand       string `json:"brand,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	Quantity    string `json:"quantity,omitempty"`
+	NutriScore  string `json:"nutri_score,omitempty"`
+	NovaGroup   int    `json:"nova_group,omitempty"`
+	Additives   int    `json:"additives_count"`
+	// Allergens lists the user's allergens found in the product
+	Allergens []string `json:"allergens,omitempty"`
+}
+
+// NutrientComparison is one nutrient across all compared products. Values are
+// in the same order as ProductComparison.Products; nil means not reported.
+type NutrientComparison struct {
+	Nutrient      string     `json:"nutrient"`
+	Unit          string     `json:"unit"`
+	Values        []*float64 `json:"values"`
+	LowerIsBetter bool       `json:"lower_is_better"`
+	// Best is the barcode with the most favourable value, empty on a tie
+	Best string `json:"best,omitempty"`
+	// Difference is the spread between the highest and lowest value
+	Difference float64 `json:"difference"`
+}
+
+// ProductRanking places one product in the comparison
+type ProductRanking struct {
+	Rank        int      `json:"rank"`
+	Barcode     string   `json:"barcode"`
+	ProductName string   `json:"product_name"`
+	Score       float64  `json:"score"`
+	Reasons     []string `json:"reasons"`
+}
+
+// ComparisonVerdict is the short personalized recommendation for a comparison
+type ComparisonVerdict struct {
+	Winner  string        `json:"winner_barcode"`
+	Summary string        `json:"summary"`
+	Meta    *AnalysisMeta `json:"meta,omitempty"`
+}
+
+// ProductComparison is the side-by-side view of several products
+type ProductComparison struct {
+	Products   []ComparedProduct    `json:"products"`
+	Per100g    []NutrientComparison `json:"per_100g"`
+	PerServing []NutrientComparison `json:"per_serving"`
+	Priorities []string             `json:"priorities"`
+	Ranking    []ProductRanking     `json:"ranking"`
+	Verdict    *ComparisonVerdict   `json:"verdict,omitempty"`
+}
@@ -0,0 +1,91 @@
+package models
+
+// Sex used to pick the BMR equation; other and unknown average both
+const (
+	SexMale   = "male"
+	SexFemale = "female"
+	SexOther  = "other"
+)
+
+// Activity levels, from desk job without exercise to hard daily training
+const (
+	ActivitySedentary  = "sedentary"
+	ActivityLight      = "light"
+	ActivityModerate   = "moderate"
+	ActivityActive     = "active"
+	ActivityVeryActive = "very_active"
+)
+
+// Measurement systems for height and weight
+const (
+	UnitsMetric   = "metric"
+	UnitsImperial = "imperial"
+)
+
+// Allowed values of the profile's choice fields
+var (
+	HealthGoalOptions = []string{
+		WeightLoss, MuscleGain, HeartHealth, Diabetes, LowSodiumDiet,
+		SugarControl, PlantBased, CleanEating, GeneralWellness,
+	}
+	DietaryPreferenceOptions = []string{
+		Vegetarian, Vegan, Pescatarian, Keto, Ayurvedic, Jain,
+		LowSodium, LowSugar, GlutenLactoseFree,
+	}
+	NutritionPriorityOptions = []string{
+		HighProtein, LowFat, LowSugarPriority, LowSodiumPriority, HighFiber,
+		NoAdditives, NaturalIngredients, FSSAIVerified,
+	}
+	SexOptions              = []string{SexMale, SexFemale, SexOther}
+	ActivityLevelOptions    = []string{ActivitySedentary, ActivityLight, ActivityModerate, ActivityActive, ActivityVeryActive}
+	WorkoutFrequencyOptions = []string{"0-2", "3-5", "6+"}
+)
+
+// Profile is the user's editable profile. Height and Weight are in the
+// user's units; HeightCm and WeightKg are always metric.
+type Profile struct {
+	ID                  string   `json:"id"`
+	FullName            string   `json:"fullName"`
+	PhoneNo             string   `json:"phoneNo"`
+	Role                string   `json:"role"`
+	Age                 int      `json:"age,omitempty"`
+	Sex                 string   `json:"sex,omitempty"`
+	Units               string   `json:"units"`
+	Height              float64  `json:"height,omitempty"`
+	HeightUnit          string   `json:"heightUnit"`
+	Weight              float64  `json:"weight,omitempty"`
+	WeightUnit          string   `json:"weightUnit"`
+	HeightCm            float64  `json:"heightCm,omitempty"`
+	WeightKg            float64  `json:"weightKg,omitempty"`
+	BMI                 float64  `json:"bmi,omitempty"`
+	ActivityLevel       string   `json:"activityLevel,omitempty"`
+	WorkOutsPerWeek     string   `json:"workOutsPerWeek,omitempty"`
+	HealthStatus        string   `json:"healthStatus,omitempty"`
+	HealthGoals         []string `json:"healthGoals"`
+	DietaryPreferences  []string `json:"dietaryPreferences"`
+	NutritionPriorities []string `json:"nutritionPriorities"`
+	FoodAllergies       []string `json:"foodAllergies"`
+	// MissingFields lists what plans and energy targets still need
+	MissingFields []string `json:"missingFields,omitempty"`
+	// LegacyMeasurements is the unreadable text of fields in MissingFields
+	// from before measurements were numbers, for showing next to the input
+	LegacyMeasurements map[string]string `json:"legacyMeasurements,omitempty"`
+}
+
+// UpdateProfileRequest changes the fields that are present. Height and
+// Weight are read in Units, or the stored units when Units is absent.
+type UpdateProfileRequest struct {
+	FullName            *string     `json:"fullName" binding:"omitempty,min=1,max=100"`
+	Age                 *FlexNumber `json:"age"`
+	Sex                 *string     `json:"sex"`
+	Units               *string     `json:"units"`
+	Height              *FlexNumber `json:"height"`
+	Weight              *FlexNumber `json:"weight"`
+	ActivityLevel       *string     `json:"activityLevel"`
+	WorkOutsPerWeek     *string     `json:"workOutsPerWeek"`
+	HealthStatus        *string     `json:"healthStatus" binding:"omitempty,max=200"`
+	HealthGoals         *[]string   `json:"healthGoals"`
+	DietaryPreferences  *[]string   `json:"dietaryPreferences"`
+	NutritionPriorities *[]string   `json:"nutritionPriorities"`
+	FoodAllergies       *[]string   `json:"foodAllergies"`
+}
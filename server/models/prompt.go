@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// PromptTemplate is an LLM prompt template shipped in llm_context. Version is
+// the hash the analysis cache is keyed by, so a changed template shows up as
+// a new version.
+type PromptTemplate struct {
+	Name       string    `json:"name"`
+	UsedBy     []string  `json:"usedBy"`
+	Version    string    `json:"version"`
+	Size       int       `json:"size"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+	Content    string    `json:"content,omitempty"`
+}
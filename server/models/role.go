@@ -0,0 +1,61 @@
+package models
+
+// User roles. Users without a stored role are regular users.
+const (
+	RoleUser      = "user"
+	RoleDietitian = "dietitian"
+	RoleAdmin     = "admin"
+)
+
+// Permission is an action a role may take
+type Permission string
+
+const (
+	PermissionModerateProducts   Permission = "products:moderate"
+	PermissionManageProductCache Permission = "products:cache"
+	PermissionUserSupport        Permission = "users:support"
+	PermissionManageRoles        Permission = "users:roles"
+	PermissionManagePrompts      Permission = "prompts:manage"
+)
+
+// rolePermissions lists what each role may do beyond using the app
+var rolePermissions = map[string][]Permission{
+	RoleUser:      {},
+	RoleDietitian: {PermissionModerateProducts},
+	RoleAdmin: {
+		PermissionModerateProducts,
+		PermissionManageProductCache,
+		PermissionUserSupport,
+		PermissionManageRoles,
+		PermissionManagePrompts,
+	},
+}
+
+// UpdateRoleRequest changes a user's role
+type UpdateRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=user dietitian admin"`
+}
+
+// NormalizeRole maps a missing role to RoleUser
+func NormalizeRole(role string) string {
+	if role == "" {
+		return RoleUser
+	}
+	return role
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleHasPermission reports whether the role grants the permission
+func RoleHasPermission(role string, permission Permission) bool {
+	for _, p := range rolePermissions[NormalizeRole(role)] {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
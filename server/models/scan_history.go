@@ -0,0 +1,72 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Scan history sources: which endpoint last recorded the scan
+const (
+	ScanSourceProduct      = "product"
+	ScanSourceNutrition    = "nutrition"
+	ScanSourcePersonalized = "personalized"
+	ScanSourceStream       = "stream"
+	ScanSourceReanalysis   = "reanalysis"
+)
+
+// ScanHistoryEntry is one product a user has scanned, with the latest verdict
+type ScanHistoryEntry struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID      primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Barcode     string             `json:"barcode" bson:"barcode"`
+	ProductName string             `json:"product_name" bson:"product_name"`
+	Brand       string             `json:"brand,omitempty" bson:"brand,omitempty"`
+	ImageURL    string             `json:"image_url,omitempty" bson:"image_url,omitempty"`
+	Grade       string             `json:"grade,omitempty" bson:"grade,omitempty"`
+	Source      string             `json:"source" bson:"source"`
+	Analysis    *NutritionAnalysis `json:"analysis,omitempty" bson:"analysis,omitempty"`
+	Preferences *UserPreferences   `json:"preferences,omitempty" bson:"preferences,omitempty"`
+	// StreamedText is the markdown of a websocket analysis. Such entries have
+	// no Analysis, and Grade is the one the text gave, if any.
+	StreamedText   string     `json:"streamed_text,omitempty" bson:"streamed_text,omitempty"`
+	Favorite       bool       `json:"favorite" bson:"favorite"`
+	ScanCount      int        `json:"scan_count" bson:"scan_count"`
+	FirstScannedAt time.Time  `json:"first_scanned_at" bson:"first_scanned_at"`
+	LastScannedAt  time.Time  `json:"last_scanned_at" bson:"last_scanned_at"`
+	AnalyzedAt     *time.Time `json:"analyzed_at,omitempty" bson:"analyzed_at,omitempty"`
+}
+
+// ScanHistoryFilter selects and paginates history entries
+type ScanHistoryFilter struct {
+	Grades       []string
+	FavoriteOnly bool
+	Page         int
+	Limit        int
+}
+
+// ScanHistoryPage is one page of history entries
+type ScanHistoryPage struct {
+	Items []ScanHistoryEntry `json:"items"`
+	Page  int                `json:"page"`
+	Limit int                `json:"limit"`
+	Total int64              `json:"total"`
+}
+
+// UpdateFavoriteRequest stars or unstars a history entry
+type UpdateFavoriteRequest struct {
+	Favorite *bool `json:"favorite" binding:"required"`
+}
+
+// ReanalysisResult compares a fresh analysis with the stored one
+type ReanalysisResult struct {
+	Entry                  *ScanHistoryEntry `json:"entry"`
+	PreviousGrade          string            `json:"previous_grade"`
+	CurrentGrade           string            `json:"current_grade"`
+	GradeChanged           bool              `json:"grade_changed"`
+	PreviousAnalyzedAt     *time.Time        `json:"previous_analyzed_at,omitempty"`
+	NewConcerns            []string          `json:"new_concerns"`
+	ResolvedConcerns       []string          `json:"resolved_concerns"`
+	PreviousRecommendation string            `json:"previous_recommendation"`
+	CurrentRecommendation  string            `json:"current_recommendation"`
+}
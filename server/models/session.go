@@ -0,0 +1,66 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reasons a session was revoked
+const (
+	SessionRevokedLogout     = "logout"
+	SessionRevokedByUser     = "revoked_by_user"
+	SessionRevokedReuse      = "refresh_token_reused"
+	SessionRevokedAllDevices = "logout_all_devices"
+	SessionRevokedNoAccount  = "account_not_found"
+	SessionRevokedRoleChange = "role_changed"
+	SessionRevokedBySupport  = "revoked_by_support"
+	SessionRevokedPassword   = "password_reset"
+	SessionRevokedDeleted    = "account_deleted"
+)
+
+// Session is one signed-in device. Its refresh token is only stored hashed;
+// the previous hash is kept to spot a rotated token being replayed.
+type Session struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID            primitive.ObjectID `json:"-" bson:"user_id"`
+	RefreshTokenHash  string             `json:"-" bson:"refresh_token_hash"`
+	PreviousTokenHash string             `json:"-" bson:"previous_token_hash,omitempty"`
+	DeviceName        string             `json:"deviceName,omitempty" bson:"device_name,omitempty"`
+	UserAgent         string             `json:"userAgent,omitempty" bson:"user_agent,omitempty"`
+	IPAddress         string             `json:"ipAddress,omitempty" bson:"ip_address,omitempty"`
+	CreatedAt         time.Time          `json:"createdAt" bson:"created_at"`
+	LastUsedAt        time.Time          `json:"lastUsedAt" bson:"last_used_at"`
+	ExpiresAt         time.Time          `json:"expiresAt" bson:"expires_at"`
+	RevokedAt         *time.Time         `json:"revokedAt,omitempty" bson:"revoked_at,omitempty"`
+	RevokeReason      string             `json:"-" bson:"revoke_reason,omitempty"`
+	// Current marks the session the request was made with
+	Current bool `json:"current" bson:"-"`
+}
+
+// SessionDevice describes the client a session is started or refreshed from
+type SessionDevice struct {
+	Name      string
+	UserAgent string
+	IPAddress string
+}
+
+// TokenPair is what a sign-in or refresh returns. Token is the short-lived
+// access token for the Authorization header.
+type TokenPair struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	// ExpiresIn is the access token lifetime in seconds
+	ExpiresIn int64  `json:"expiresIn"`
+	SessionID string `json:"sessionId"`
+}
+
+// RefreshTokenRequest exchanges a refresh token for a new token pair
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// LogoutRequest ends the current session, or every session of the user
+type LogoutRequest struct {
+	AllDevices bool `json:"allDevices"`
+}
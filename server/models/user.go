@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -9,18 +11,37 @@ type User struct {
 	FullName           string             `json:"fullName" bson:"fullName" binding:"required"`
 	PhoneNo            string             `json:"phoneNo" bson:"phoneNo" binding:"required,min=10,max=10"`
 	Password           string             `json:"password" bson:"password" binding:"required,min=6"`
+	PhoneVerified      bool               `json:"phoneVerified" bson:"phoneVerified,omitempty"`
+	// Role is one of RoleUser, RoleDietitian or RoleAdmin; empty means RoleUser
+	Role               string             `json:"role" bson:"role,omitempty"`
 	HealthStatus       string             `json:"healthStatus" bson:"healthStatus"`
 	HealthGoals        []string  `json:"healthGoals" bson:"healthGoals"`
 	DietaryPreferences []string  `json:"dietaryPreferences" bson:"dietaryPreferences"`
 	NutritionPriorities []string  `json:"nutritionPriorities" bson:"nutritionPriorities"`
+	FoodAllergies       []string  `json:"foodAllergies" bson:"foodAllergies"`
 	WorkOutsPerWeek     string              `json:"workOutsPerWeek" bson:"workOutsPerWeek"`
-	Age                string              `json:"age" bson:"age"`
-	Height             string              `json:"height" bson:"height"`
-	Weight             string              `json:"weight" bson:"weight"`
-	NutritionalStatus  map[string]int      `json:"nutritionalStatus" bson:"nutritionalStatus"`
+	// Age in years, Height in cm and Weight in kg; zero when unknown
+	Age                FlexNumber          `json:"age" bson:"age,omitempty"`
+	Height             FlexNumber          `json:"height" bson:"height,omitempty"`
+	Weight             FlexNumber          `json:"weight" bson:"weight,omitempty"`
+	// LegacyMeasurements keeps the original text of age, height or weight
+	// values the measurement migration couldn't read, until they're re-entered
+	LegacyMeasurements map[string]string   `json:"legacyMeasurements,omitempty" bson:"legacyMeasurements,omitempty"`
+	Sex                string              `json:"sex,omitempty" bson:"sex,omitempty"`
+	ActivityLevel      string              `json:"activityLevel,omitempty" bson:"activityLevel,omitempty"`
+	// Units is how the app shows height and weight: "metric" or "imperial"
+	Units              string              `json:"units,omitempty" bson:"units,omitempty"`
+	// NutritionalStatus holds the legacy lifetime counters, now migrated to
+	// nutritional_status_events and no longer written
+	NutritionalStatus  map[string]int      `json:"nutritionalStatus,omitempty" bson:"nutritionalStatus,omitempty"`
+	// DeletionScheduledFor is when a deleted account gets purged; signing in
+	// before then cancels the deletion
+	DeletionRequestedAt  *time.Time `json:"deletionRequestedAt,omitempty" bson:"deletionRequestedAt,omitempty"`
+	DeletionScheduledFor *time.Time `json:"deletionScheduledFor,omitempty" bson:"deletionScheduledFor,omitempty"`
 }
 
 // NutritionalUpdateRequest represents the request to update nutritional status
 type NutritionalUpdateRequest struct {
 	NutritionalElements []string `json:"nutritionalElements" binding:"required"`
+	Barcode             string   `json:"barcode,omitempty"`
 }
\ No newline at end of file
@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"amobagan/controllers"
+	"amobagan/middleware"
+	"amobagan/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func setupAdminRoutes(api *gin.RouterGroup) {
+	adminController := controllers.NewAdminController()
+	customProductController := controllers.NewCustomProductController()
+
+	// Each group needs a permission of the caller's role
+	admin := api.Group("/admin")
+	admin.Use(middleware.AuthMiddleware())
+	{
+		// Drop a cached product so the next scan refetches it
+		admin.DELETE("/products/:barcode/cache", middleware.RequirePermission(models.PermissionManageProductCache), adminController.PurgeProductCache)
+
+		// Moderate products users shared (admins and dietitians)
+		moderation := admin.Group("/custom-products", middleware.RequirePermission(models.PermissionModerateProducts))
+		moderation.GET("/pending", customProductController.ListPendingProducts)
+		moderation.PUT("/:productId/moderation", customProductController.ModerateProduct)
+
+		// Review the LLM prompt templates; they ship in llm_context and are
+		// changed with a deploy
+		prompts := admin.Group("/prompts", middleware.RequirePermission(models.PermissionManagePrompts))
+		prompts.GET("", adminController.ListPrompts)
+		prompts.GET("/:name", adminController.GetPrompt)
+
+		// User support
+		support := admin.Group("/users", middleware.RequirePermission(models.PermissionUserSupport))
+		support.GET("/:userId", adminController.GetUser)
+		support.DELETE("/:userId/sessions", adminController.RevokeUserSessions)
+		support.PUT("/:userId/role", middleware.RequirePermission(models.PermissionManageRoles), adminController.UpdateUserRole)
+	}
+}
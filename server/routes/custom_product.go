@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"amobagan/controllers"
+	"amobagan/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupCustomProductRoutes sets up the routes for products users enter from the label
+func setupCustomProductRoutes(api *gin.RouterGroup) {
+	customProductController := controllers.NewCustomProductController()
+
+	// Custom product routes group - all protected
+	customGroup := api.Group("/custom-products")
+	customGroup.Use(middleware.AuthMiddleware())
+	{
+		// Submit a product the barcode lookup didn't find
+		customGroup.POST("/", customProductController.CreateProduct)
+
+		// List the user's submissions
+		customGroup.GET("/", customProductController.ListProducts)
+
+		// Get, replace or delete a submission
+		customGroup.GET("/:productId", customProductController.GetProduct)
+		customGroup.PUT("/:productId", customProductController.UpdateProduct)
+		customGroup.DELETE("/:productId", customProductController.DeleteProduct)
+	}
+}
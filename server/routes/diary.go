@@ -0,0 +1,32 @@
+package routes
+
+import (
+	"amobagan/controllers"
+	"amobagan/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupDiaryRoutes sets up the food diary routes
+func setupDiaryRoutes(api *gin.RouterGroup) {
+	foodLogController := controllers.NewFoodLogController()
+
+	// Diary routes group - all protected
+	diaryGroup := api.Group("/diary")
+	diaryGroup.Use(middleware.AuthMiddleware())
+	{
+		// Log a scanned product, diet-plan meal or custom food
+		diaryGroup.POST("/", foodLogController.CreateEntry)
+
+		// List entries between ?from= and ?to= (defaults to today)
+		diaryGroup.GET("/", foodLogController.ListEntries)
+
+		// Daily and weekly totals against the user's targets
+		diaryGroup.GET("/summary", foodLogController.GetSummary)
+
+		// Get, update or delete a single entry
+		diaryGroup.GET("/:entryId", foodLogController.GetEntry)
+		diaryGroup.PUT("/:entryId", foodLogController.UpdateEntry)
+		diaryGroup.DELETE("/:entryId", foodLogController.DeleteEntry)
+	}
+}
@@ -3,6 +3,7 @@ package routes
 import (
 	"amobagan/controllers"
 	"amobagan/middleware"
+	"amobagan/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,9 +19,6 @@ func setupDietPlanRoutes(api *gin.RouterGroup) {
 	dietPlanGroup := api.Group("/diet-plans")
 	dietPlanGroup.Use(middleware.AuthMiddleware())
 	{
-		// Test endpoint to debug user authentication
-		dietPlanGroup.GET("/test-user", dietPlanController.TestUserExists)
-		
 		// Generate new weekly diet plan (GET request - no body needed)
 		dietPlanGroup.GET("/generate", dietPlanController.GenerateDietPlan)
 		
@@ -39,4 +37,9 @@ func setupDietPlanRoutes(api *gin.RouterGroup) {
 		// Get diet plan summaries
 		dietPlanGroup.GET("/summary", dietPlanController.GetDietPlanSummary)
 	}
-} 
\ No newline at end of file
+
+	// Debug endpoint for support to check a user's stored profile
+	debugGroup := api.Group("/admin/debug/diet-plans")
+	debugGroup.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermissionUserSupport))
+	debugGroup.GET("/test-user/:userId", dietPlanController.TestUserExists)
+}
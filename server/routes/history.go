@@ -0,0 +1,31 @@
+package routes
+
+import (
+	"amobagan/controllers"
+	"amobagan/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupHistoryRoutes sets up the scan history routes
+func setupHistoryRoutes(api *gin.RouterGroup) {
+	scanHistoryController := controllers.NewScanHistoryController()
+
+	// History routes group - all protected
+	historyGroup := api.Group("/history")
+	historyGroup.Use(middleware.AuthMiddleware())
+	{
+		// List scanned products (?page=, ?limit=, ?grade=A,B, ?favorite=true)
+		historyGroup.GET("/", scanHistoryController.ListScans)
+
+		// Get or delete a single scan
+		historyGroup.GET("/:scanId", scanHistoryController.GetScan)
+		historyGroup.DELETE("/:scanId", scanHistoryController.DeleteScan)
+
+		// Star or unstar a scanned product
+		historyGroup.PUT("/:scanId/favorite", scanHistoryController.UpdateFavorite)
+
+		// Re-run the analysis with current preferences and compare verdicts
+		historyGroup.POST("/:scanId/reanalyze", scanHistoryController.Reanalyze)
+	}
+}
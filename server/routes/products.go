@@ -11,7 +11,9 @@ func setupProductRoutes(api *gin.RouterGroup) {
 	productController := controllers.NewProductController()
 	protected := api.Group("/products")
 	protected.Use(middleware.AuthMiddleware())
+	protected.POST("/compare", productController.CompareProducts)
 	protected.GET("/:barcode", productController.GetProductDetailsByBarcode)
 	protected.GET("/:barcode/nutrition", productController.GetNutritionAnalysis)
+	protected.GET("/:barcode/alternatives", productController.GetAlternatives)
 	protected.POST("/:barcode/nutrition/personalized", productController.AnalyzeNutritionWithPreferences)
 }
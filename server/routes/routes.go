@@ -21,4 +21,8 @@ func setupApiRoutes(router *gin.Engine) {
 	setupProductRoutes(api)
 	setupDietPlanRoutes(api)
 	setupWeeklyTodoRoutes(api)
+	setupDiaryRoutes(api)
+	setupHistoryRoutes(api)
+	setupCustomProductRoutes(api)
+	setupAdminRoutes(api)
 }
@@ -13,10 +13,28 @@ func setupUserRoutes(api *gin.RouterGroup) {
 	// Public routes (no authentication required)
 	api.POST("/user/create", userController.CreateUser)
 	api.POST("/user/login", userController.LoginUser)
+	api.POST("/user/refresh", userController.RefreshToken)
+	api.POST("/user/otp/request", userController.RequestOTP)
+	api.POST("/user/otp/verify", userController.VerifyOTP)
+	api.POST("/user/password/reset", userController.ResetPassword)
 	
 	// Protected routes (authentication required)
 	protected := api.Group("/user")
 	protected.Use(middleware.AuthMiddleware())
 	protected.PUT("/nutritional-status", userController.UpdateNutritionalStatus)
 	protected.GET("/nutrition-details", userController.GetNutritionDetails)
+	protected.PUT("/allergies", userController.UpdateFoodAllergies)
+	protected.GET("/targets", userController.GetTargets)
+	protected.GET("/profile", userController.GetProfile)
+	protected.PATCH("/profile", userController.UpdateProfile)
+	protected.POST("/phone/verify", userController.VerifyPhone)
+
+	// Data-subject requests
+	protected.GET("/export", userController.ExportData)
+	protected.DELETE("", userController.DeleteAccount)
+
+	// Sessions (signed-in devices)
+	protected.POST("/logout", userController.Logout)
+	protected.GET("/sessions", userController.ListSessions)
+	protected.DELETE("/sessions/:sessionId", userController.RevokeSession)
 }
\ No newline at end of file
@@ -3,6 +3,7 @@ package routes
 import (
 	"amobagan/controllers"
 	"amobagan/middleware"
+	"amobagan/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,9 +19,6 @@ func setupWeeklyTodoRoutes(api *gin.RouterGroup) {
 	weeklyTodoGroup := api.Group("/weekly-todos")
 	weeklyTodoGroup.Use(middleware.AuthMiddleware())
 	{
-		// Test endpoint to debug user authentication
-		weeklyTodoGroup.GET("/test-user", weeklyTodoController.TestUserExists)
-		
 		// Generate new weekly todo list (POST request with body)
 		weeklyTodoGroup.POST("/generate", weeklyTodoController.GenerateWeeklyTodo)
 		
@@ -39,4 +37,9 @@ func setupWeeklyTodoRoutes(api *gin.RouterGroup) {
 		// Update specific todo item (mark as complete/incomplete)
 		weeklyTodoGroup.PUT("/:todoId/items/:itemId", weeklyTodoController.UpdateTodoItem)
 	}
-} 
\ No newline at end of file
+
+	// Debug endpoint for support to check a user's stored profile
+	debugGroup := api.Group("/admin/debug/weekly-todos")
+	debugGroup.Use(middleware.AuthMiddleware(), middleware.RequirePermission(models.PermissionUserSupport))
+	debugGroup.GET("/test-user/:userId", weeklyTodoController.TestUserExists)
+}
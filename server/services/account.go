@@ -0,0 +1,376 @@
+package services
+
+import (
+	"amobagan/config"
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/utils"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrWrongPassword is returned when a deletion isn't confirmed with the right password
+var ErrWrongPassword = errors.New("wrong password")
+
+const accountAuditCollection = "account_audit"
+
+// userDataCollection is a collection holding documents of a user
+type userDataCollection struct {
+	Name string
+	// Field holds the user's ID, or the phone number when ByPhone is set
+	Field   string
+	ByPhone bool
+	// Omit lists secrets left out of exports
+	Omit []string
+	// SkipExport is set for data that only lives minutes
+	SkipExport bool
+	// KeepOnDelete is set for records that must outlive the account
+	KeepOnDelete bool
+}
+
+// userDataCollections lists every collection with user data. Export and
+// deletion walk this list, so new collections holding user data belong here.
+// The users document itself is deleted last.
+var userDataCollections = []userDataCollection{
+	{Name: "users", Field: "_id", Omit: []string{"password"}},
+	{Name: "diet_plans", Field: "user_id"},
+	{Name: "weekly_todos", Field: "user_id"},
+	{Name: nutritionEventsCollection, Field: "user_id"},
+	{Name: "food_log", Field: "user_id"},
+	{Name: "scan_history", Field: "user_id"},
+	{Name: "custom_products", Field: "submitted_by"},
+	{Name: "sessions", Field: "user_id", Omit: []string{"refresh_token_hash", "previous_token_hash"}},
+	{Name: "otps", Field: "phone_no", ByPhone: true, SkipExport: true},
+	{Name: accountAuditCollection, Field: "user_id", KeepOnDelete: true},
+}
+
+// AccountService exports a user's data and deletes accounts after a grace
+// period, recording both in the account audit
+type AccountService struct {
+	db    *mongo.Database
+	audit *mongo.Collection
+	grace time.Duration
+}
+
+func NewAccountService() *AccountService {
+	db := lib.DB.Database("amobagan")
+	service := &AccountService{
+		db:    db,
+		audit: db.Collection(accountAuditCollection),
+		grace: config.LoadConfig().AccountDeletionGrace,
+	}
+	service.ensureIndexes()
+	return service
+}
+
+// Export collects everything stored about the user
+func (s *AccountService) Export(ctx context.Context, userID string) (*models.DataExport, error) {
+	user, err := FindUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &models.DataExport{
+		UserID:      userID,
+		ExportedAt:  time.Now(),
+		Collections: make(map[string][]json.RawMessage),
+	}
+	for _, coll := range userDataCollections {
+		if coll.SkipExport {
+			continue
+		}
+		docs, err := s.exportCollection(ctx, coll, user)
+		if err != nil {
+			return nil, err
+		}
+		export.Collections[coll.Name] = docs
+	}
+
+	s.record(ctx, user.ID, models.AuditDataExported, "user", nil)
+	return export, nil
+}
+
+func (s *AccountService) exportCollection(ctx context.Context, coll userDataCollection, user *models.User) ([]json.RawMessage, error) {
+	cursor, err := s.db.Collection(coll.Name).Find(ctx, userDataFilter(coll, user))
+	if err != nil {
+		return nil, fmt.Errorf("failed to export %s: %v", coll.Name, err)
+	}
+	defer cursor.Close(ctx)
+
+	docs := []json.RawMessage{}
+	for cursor.Next(ctx) {
+		var doc bson.D
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %v", coll.Name, err)
+		}
+		kept := doc[:0]
+		for _, field := range doc {
+			if !contains(coll.Omit, field.Key) {
+				kept = append(kept, field)
+			}
+		}
+		data, err := bson.MarshalExtJSON(kept, false, false)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %v", coll.Name, err)
+		}
+		docs = append(docs, data)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("failed to export %s: %v", coll.Name, err)
+	}
+	return docs, nil
+}
+
+// WriteExportZip writes the export as a ZIP with a manifest and one JSON file
+// per collection
+func WriteExportZip(w io.Writer, export *models.DataExport) error {
+	archive := zip.NewWriter(w)
+
+	names := make([]string, 0, len(export.Collections))
+	for name := range export.Collections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	counts := make(map[string]int, len(names))
+	for _, name := range names {
+		docs := export.Collections[name]
+		counts[name] = len(docs)
+		if err := writeZipJSON(archive, name+".json", docs); err != nil {
+			return err
+		}
+	}
+	manifest := exportManifest{UserID: export.UserID, ExportedAt: export.ExportedAt, Documents: counts}
+	if err := writeZipJSON(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+type exportManifest struct {
+	UserID     string         `json:"userId"`
+	ExportedAt time.Time      `json:"exportedAt"`
+	Documents  map[string]int `json:"documents"`
+}
+
+func writeZipJSON(archive *zip.Writer, name string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %v", name, err)
+	}
+	file, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s: %v", name, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %v", name, err)
+	}
+	return nil
+}
+
+// RequestDeletion schedules the account for deletion after the grace period
+// and signs the user out everywhere. Asking again keeps the first schedule.
+func (s *AccountService) RequestDeletion(ctx context.Context, userID, password string) (*models.AccountDeletion, error) {
+	user, err := FindUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return nil, ErrWrongPassword
+	}
+
+	deletion := &models.AccountDeletion{}
+	if user.DeletionScheduledFor != nil {
+		deletion.ScheduledFor = *user.DeletionScheduledFor
+		if user.DeletionRequestedAt != nil {
+			deletion.RequestedAt = *user.DeletionRequestedAt
+		}
+	} else {
+		now := time.Now()
+		deletion.RequestedAt = now
+		deletion.ScheduledFor = now.Add(s.grace)
+		_, err := s.db.Collection("users").UpdateOne(
+			ctx,
+			bson.M{"_id": user.ID},
+			bson.M{"$set": bson.M{
+				"deletionRequestedAt":  deletion.RequestedAt,
+				"deletionScheduledFor": deletion.ScheduledFor,
+			}},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to schedule deletion: %v", err)
+		}
+		s.record(ctx, user.ID, models.AuditDeletionRequested, "user", nil)
+	}
+
+	if _, err := GetSessionService().RevokeAll(ctx, userID, models.SessionRevokedDeleted); err != nil {
+		log.Printf("Error revoking sessions of %s after deletion request: %v", userID, err)
+	}
+	return deletion, nil
+}
+
+// CancelDeletion keeps an account scheduled for deletion. It reports whether
+// a deletion was pending.
+func (s *AccountService) CancelDeletion(ctx context.Context, userID primitive.ObjectID) (bool, error) {
+	result, err := s.db.Collection("users").UpdateOne(
+		ctx,
+		bson.M{"_id": userID, "deletionScheduledFor": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"deletionRequestedAt": "", "deletionScheduledFor": ""}},
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel deletion: %v", err)
+	}
+	if result.ModifiedCount == 0 {
+		return false, nil
+	}
+	s.record(ctx, userID, models.AuditDeletionCancelled, "user", nil)
+	return true, nil
+}
+
+// PurgeDue deletes every account whose grace period is over and returns how
+// many were deleted
+func (s *AccountService) PurgeDue(ctx context.Context) (int, error) {
+	cursor, err := s.db.Collection("users").Find(
+		ctx,
+		bson.M{"deletionScheduledFor": bson.M{"$lte": time.Now()}},
+		options.Find().SetProjection(bson.M{"_id": 1, "phoneNo": 1, "deletionScheduledFor": 1}),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to find accounts to delete: %v", err)
+	}
+	var users []models.User
+	if err := cursor.All(ctx, &users); err != nil {
+		return 0, fmt.Errorf("failed to decode accounts to delete: %v", err)
+	}
+
+	purged := 0
+	for i := range users {
+		if err := s.purge(ctx, &users[i]); err != nil {
+			log.Printf("Error deleting account %s: %v", users[i].ID.Hex(), err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+// purge removes the user's data from every collection. The users document
+// goes last so a failed purge is retried.
+func (s *AccountService) purge(ctx context.Context, user *models.User) error {
+	// Approved submissions were copied to the product catalog
+	submitted, err := s.db.Collection("custom_products").Distinct(ctx, "_id", bson.M{"submitted_by": user.ID})
+	if err != nil {
+		return fmt.Errorf("failed to find custom products: %v", err)
+	}
+	productIDs := make([]primitive.ObjectID, 0, len(submitted))
+	for _, id := range submitted {
+		if objectID, ok := id.(primitive.ObjectID); ok {
+			productIDs = append(productIDs, objectID)
+		}
+	}
+	if catalog := lib.GetProductCatalog(); catalog != nil {
+		if err := catalog.RemoveCustom(ctx, productIDs...); err != nil {
+			return err
+		}
+	}
+
+	deleted := make(map[string]int64)
+	for _, coll := range userDataCollections {
+		if coll.KeepOnDelete || coll.Name == "users" {
+			continue
+		}
+		result, err := s.db.Collection(coll.Name).DeleteMany(ctx, userDataFilter(coll, user))
+		if err != nil {
+			return fmt.Errorf("failed to delete %s: %v", coll.Name, err)
+		}
+		if result.DeletedCount > 0 {
+			deleted[coll.Name] = result.DeletedCount
+		}
+	}
+
+	result, err := s.db.Collection("users").DeleteOne(ctx, bson.M{"_id": user.ID, "deletionScheduledFor": bson.M{"$exists": true}})
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+	deleted["users"] = result.DeletedCount
+
+	s.record(ctx, user.ID, models.AuditAccountDeleted, "system", deleted)
+	return nil
+}
+
+// StartPurger deletes due accounts now and then every interval
+func (s *AccountService) StartPurger(interval time.Duration) {
+	go func() {
+		for {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+			purged, err := s.PurgeDue(ctx)
+			cancel()
+			if err != nil {
+				log.Printf("Error purging deleted accounts: %v", err)
+			} else if purged > 0 {
+				log.Printf("Purged %d deleted accounts", purged)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// record writes an audit event. Failures are logged so they never block the
+// request itself.
+func (s *AccountService) record(ctx context.Context, userID primitive.ObjectID, action, actor string, deleted map[string]int64) {
+	event := models.AccountAuditEvent{
+		UserID:  userID,
+		Action:  action,
+		Actor:   actor,
+		Deleted: deleted,
+		At:      time.Now(),
+	}
+	if _, err := s.audit.InsertOne(ctx, event); err != nil {
+		log.Printf("Error recording %s for %s: %v", action, userID.Hex(), err)
+	}
+}
+
+func userDataFilter(coll userDataCollection, user *models.User) bson.M {
+	if coll.ByPhone {
+		return bson.M{coll.Field: user.PhoneNo}
+	}
+	return bson.M{coll.Field: user.ID}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *AccountService) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := s.audit.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "at", Value: -1}},
+	}); err != nil {
+		log.Printf("Failed to create account audit indexes: %v", err)
+	}
+	if _, err := s.db.Collection("users").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "deletionScheduledFor", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	}); err != nil {
+		log.Printf("Failed to create account deletion index: %v", err)
+	}
+}
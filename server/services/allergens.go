@@ -0,0 +1,135 @@
+package services
+
+import (
+	"amobagan/models"
+	"amobagan/utils"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrAllergenConflict is returned when the LLM keeps producing meals or todos
+// that contain one of the user's allergens
+var ErrAllergenConflict = errors.New("generated plan contains the user's food allergens")
+
+// maxAllergenRegenerations bounds how often a plan is regenerated after an
+// allergen is found in it
+const maxAllergenRegenerations = 2
+
+// ApplyAllergenSafety attaches an allergy verdict to the analysis and, when the
+// product contains one of the user's allergens, overrides the rating so the
+// product is clearly marked unsafe regardless of its nutrition
+func ApplyAllergenSafety(analysis *models.NutritionAnalysis, product *utils.ExtractedNutritionData, allergies []string) {
+	allergies = utils.NormalizeAllergies(allergies)
+	if len(allergies) == 0 {
+		return
+	}
+
+	matches := utils.MatchProductAllergens(allergies, product)
+	analysis.AllergenSafety = &models.AllergenSafety{
+		Safe:      len(matches) == 0,
+		Allergies: allergies,
+		Matches:   matches,
+	}
+	if len(matches) == 0 {
+		return
+	}
+
+	concerns := make([]models.HealthConcern, 0, len(matches))
+	aspects := make([]string, 0, len(matches))
+	for _, m := range matches {
+		label := strings.ReplaceAll(m.Allergen, "_", " ")
+		explanation := fmt.Sprintf("Found in the ingredient list (%s)", m.Evidence)
+		switch m.Source {
+		case "declared":
+			explanation = "Declared as an allergen on the label"
+		case "traces":
+			explanation = "Label warns it may contain traces"
+		}
+		concerns = append(concerns, models.HealthConcern{
+			Concern:     fmt.Sprintf("Contains your allergen: %s", label),
+			Explanation: explanation,
+			Impact:      "Can trigger an allergic reaction",
+		})
+		aspects = append(aspects, fmt.Sprintf("Contains %s, which you are allergic to", label))
+	}
+
+	rating := &analysis.InstantHealthRating
+	rating.Grade = "E"
+	rating.Recommendation = "Not safe for you: contains " + strings.Join(allergenNames(matches), ", ")
+	rating.NegativeAspects = append(aspects, rating.NegativeAspects...)
+	analysis.KeyHealthConcerns = append(concerns, analysis.KeyHealthConcerns...)
+}
+
+// dietPlanAllergenViolations lists every meal in the plan that mentions an allergen
+func dietPlanAllergenViolations(plan *models.DietPlan, allergies []string) []string {
+	if len(allergies) == 0 {
+		return nil
+	}
+	var violations []string
+	check := func(day, slot string, meal models.Meal) {
+		texts := append([]string{meal.Name, meal.Description}, meal.Ingredients...)
+		if matches := utils.MatchTextAllergens(allergies, texts...); len(matches) > 0 {
+			violations = append(violations, fmt.Sprintf("%s %s %q contains %s", day, slot, meal.Name, describeMatches(matches)))
+		}
+	}
+	for _, daily := range plan.DailyPlans {
+		check(daily.Day, "breakfast", daily.MealPlan.Breakfast)
+		check(daily.Day, "lunch", daily.MealPlan.Lunch)
+		check(daily.Day, "dinner", daily.MealPlan.Dinner)
+		for _, snack := range daily.MealPlan.Snacks {
+			check(daily.Day, "snack", snack)
+		}
+	}
+	return violations
+}
+
+// weeklyTodoAllergenViolations lists every todo item that mentions an allergen
+func weeklyTodoAllergenViolations(todo *models.WeeklyTodo, allergies []string) []string {
+	if len(allergies) == 0 {
+		return nil
+	}
+	var violations []string
+	for _, daily := range todo.DailyTodos {
+		for _, items := range [][]models.TodoItem{daily.MealTodos, daily.WorkoutTodos, daily.HealthTodos, daily.LifestyleTodos} {
+			for _, item := range items {
+				if matches := utils.MatchTextAllergens(allergies, item.Title, item.Description); len(matches) > 0 {
+					violations = append(violations, fmt.Sprintf("%s %s todo %q contains %s", daily.Day, item.Category, item.Title, describeMatches(matches)))
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// allergenRetryInstruction is appended to the prompt when regenerating
+func allergenRetryInstruction(allergies []string, violations []string) string {
+	return fmt.Sprintf(`
+
+IMPORTANT: The user is allergic to: %s.
+Your previous answer included these items, which is not acceptable:
+- %s
+Replace them. No meal, snack, ingredient or task may contain any of these allergens.`,
+		strings.Join(allergies, ", "), strings.Join(violations, "\n- "))
+}
+
+func allergenNames(matches []models.AllergenMatch) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range matches {
+		name := strings.ReplaceAll(m.Allergen, "_", " ")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func describeMatches(matches []models.AllergenMatch) string {
+	parts := make([]string, 0, len(matches))
+	for _, m := range matches {
+		parts = append(parts, fmt.Sprintf("%s (%s)", strings.ReplaceAll(m.Allergen, "_", " "), m.Evidence))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// analysisCacheRetention bounds how long an unused analysis stays stored
+const analysisCacheRetention = 30 * 24 * time.Hour
+
+// analysisCacheEntry is a stored Gemini analysis keyed by its fingerprint
+type analysisCacheEntry struct {
+	Fingerprint     string                   `bson:"_id"`
+	Barcode         string                   `bson:"barcode"`
+	TemplateVersion string                   `bson:"template_version"`
+	Model           string                   `bson:"model"`
+	Analysis        models.NutritionAnalysis `bson:"analysis"`
+	CreatedAt       time.Time                `bson:"created_at"`
+	LastHitAt       time.Time                `bson:"last_hit_at"`
+	HitCount        int                      `bson:"hit_count"`
+}
+
+// AnalysisCache stores personalized analyses so identical requests skip the LLM
+type AnalysisCache struct {
+	collection *mongo.Collection
+
+	mu              sync.Mutex
+	templateVersion string
+}
+
+func NewAnalysisCache() *AnalysisCache {
+	cache := &AnalysisCache{}
+	if lib.DB != nil {
+		cache.collection = lib.DB.Database("amobagan").Collection("analysis_cache")
+		cache.ensureIndexes()
+	}
+	return cache
+}
+
+// Get returns the cached analysis for a fingerprint, if any
+func (c *AnalysisCache) Get(ctx context.Context, fingerprint string) (*models.NutritionAnalysis, *time.Time, bool) {
+	if c == nil || c.collection == nil {
+		return nil, nil, false
+	}
+
+	var entry analysisCacheEntry
+	err := c.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": fingerprint},
+		bson.M{"$set": bson.M{"last_hit_at": time.Now()}, "$inc": bson.M{"hit_count": 1}},
+	).Decode(&entry)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error reading analysis cache: %v", err)
+		}
+		return nil, nil, false
+	}
+
+	return &entry.Analysis, &entry.CreatedAt, true
+}
+
+// Put stores an analysis under its fingerprint
+func (c *AnalysisCache) Put(ctx context.Context, fingerprint, barcode, templateVersion, model string, analysis *models.NutritionAnalysis) {
+	if c == nil || c.collection == nil {
+		return
+	}
+
+	now := time.Now()
+	stored := *analysis
+	stored.Meta = nil
+	entry := analysisCacheEntry{
+		Fingerprint:     fingerprint,
+		Barcode:         barcode,
+		TemplateVersion: templateVersion,
+		Model:           model,
+		Analysis:        stored,
+		CreatedAt:       now,
+		LastHitAt:       now,
+	}
+
+	_, err := c.collection.ReplaceOne(ctx, bson.M{"_id": fingerprint}, entry, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Printf("Error writing analysis cache: %v", err)
+	}
+}
+
+// ObserveTemplateVersion drops every entry produced by another prompt template
+// the first time a new template version is seen
+func (c *AnalysisCache) ObserveTemplateVersion(ctx context.Context, version string) {
+	if c == nil || c.collection == nil {
+		return
+	}
+
+	c.mu.Lock()
+	if c.templateVersion == version {
+		c.mu.Unlock()
+		return
+	}
+	c.templateVersion = version
+	c.mu.Unlock()
+
+	result, err := c.collection.DeleteMany(ctx, bson.M{"template_version": bson.M{"$ne": version}})
+	if err != nil {
+		log.Printf("Error invalidating analysis cache: %v", err)
+		return
+	}
+	if result.DeletedCount > 0 {
+		log.Printf("Prompt template changed, invalidated %d cached analyses", result.DeletedCount)
+	}
+}
+
+func (c *AnalysisCache) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := c.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "last_hit_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(analysisCacheRetention.Seconds())),
+		},
+		{Keys: bson.D{{Key: "template_version", Value: 1}}},
+		{Keys: bson.D{{Key: "barcode", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Failed to create analysis cache indexes: %v", err)
+	}
+}
+
+// TemplateVersion derives a short stable version from the prompt template text
+func TemplateVersion(template string) string {
+	sum := sha256.Sum256([]byte(template))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// AnalysisFingerprint deterministically identifies a personalized analysis request
+func AnalysisFingerprint(
+	product *utils.ExtractedNutritionData,
+	userPrefs *models.UserPreferences,
+	templateVersion string,
+	model string,
+) string {
+	fingerprint := struct {
+		Barcode         string                 `json:"barcode"`
+		ProductHash     string                 `json:"product_hash"`
+		Preferences     models.UserPreferences `json:"preferences"`
+		TemplateVersion string                 `json:"template_version"`
+		Model           string                 `json:"model"`
+	}{
+		Barcode:         product.ProductIdentification.Barcode,
+		ProductHash:     productDataHash(product),
+		Preferences:     normalizePreferences(userPrefs),
+		TemplateVersion: templateVersion,
+		Model:           model,
+	}
+
+	data, _ := json.Marshal(fingerprint)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// productDataHash hashes the product data, ignoring fields stamped at extraction time
+func productDataHash(product *utils.ExtractedNutritionData) string {
+	stable := *product
+	stable.ProductIdentification.LastUpdated = ""
+	stable.ExtractionMetadata.ExtractionTimestamp = ""
+
+	data, _ := json.Marshal(stable)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizePreferences makes logically equal preferences serialize identically
+func normalizePreferences(userPrefs *models.UserPreferences) models.UserPreferences {
+	if userPrefs == nil {
+		return models.UserPreferences{}
+	}
+	return models.UserPreferences{
+		HealthGoals:         normalizeStringSet(userPrefs.HealthGoals),
+		DietaryPreferences:  normalizeStringSet(userPrefs.DietaryPreferences),
+		NutritionPriorities: normalizeStringSet(userPrefs.NutritionPriorities),
+		FoodAllergies:       utils.NormalizeAllergies(userPrefs.FoodAllergies),
+		UserName:            strings.TrimSpace(userPrefs.UserName),
+	}
+}
+
+func normalizeStringSet(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	normalized := make([]string, 0, len(values))
+	for _, value := range values {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		normalized = append(normalized, value)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
@@ -0,0 +1,306 @@
+package services
+
+import (
+	"amobagan/barcode"
+	"amobagan/lib"
+	"amobagan/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrCustomProductNotFound is returned when a submission doesn't exist or belongs to another user
+	ErrCustomProductNotFound = errors.New("custom product not found")
+	// ErrCustomProductExists is returned when the user already submitted the barcode
+	ErrCustomProductExists = errors.New("you already submitted this barcode")
+	// ErrInvalidCustomProduct wraps label data that can't be right
+	ErrInvalidCustomProduct = errors.New("invalid custom product")
+)
+
+// fssaiLicenseLength is the number of digits of an FSSAI license or registration
+const fssaiLicenseLength = 14
+
+// CustomProductService stores products users entered from the label
+type CustomProductService struct {
+	collection *mongo.Collection
+}
+
+func NewCustomProductService() *CustomProductService {
+	service := &CustomProductService{
+		collection: lib.DB.Database("amobagan").Collection("custom_products"),
+	}
+	service.ensureIndexes()
+	return service
+}
+
+// Create stores a new submission. Shared submissions wait for moderation and
+// stay visible to their author in the meantime.
+func (s *CustomProductService) Create(ctx context.Context, userID string, req *models.CustomProductRequest) (*models.CustomProduct, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+	if err := validateCustomProduct(req); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	product := &models.CustomProduct{
+		SubmittedBy: userObjectID,
+		CreatedAt:   now,
+	}
+	applyCustomProductRequest(product, req, now)
+
+	result, err := s.collection.InsertOne(ctx, product)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrCustomProductExists
+		}
+		return nil, fmt.Errorf("failed to save custom product: %v", err)
+	}
+	product.ID = result.InsertedID.(primitive.ObjectID)
+	return product, nil
+}
+
+// ListMine returns the user's submissions, newest first
+func (s *CustomProductService) ListMine(ctx context.Context, userID string) ([]models.CustomProduct, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+	return s.find(ctx, bson.M{"submitted_by": userObjectID})
+}
+
+// Get returns one of the user's submissions
+func (s *CustomProductService) Get(ctx context.Context, userID, productID string) (*models.CustomProduct, error) {
+	filter, err := customProductFilter(userID, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	var product models.CustomProduct
+	if err := s.collection.FindOne(ctx, filter).Decode(&product); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCustomProductNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch custom product: %v", err)
+	}
+	return &product, nil
+}
+
+// Update replaces the label data. Shared products go back to moderation.
+func (s *CustomProductService) Update(ctx context.Context, userID, productID string, req *models.CustomProductRequest) (*models.CustomProduct, error) {
+	product, err := s.Get(ctx, userID, productID)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateCustomProduct(req); err != nil {
+		return nil, err
+	}
+
+	applyCustomProductRequest(product, req, time.Now())
+	product.ModerationNote = ""
+	product.ReviewedBy = nil
+	product.ReviewedAt = nil
+
+	if _, err := s.collection.ReplaceOne(ctx, bson.M{"_id": product.ID}, product); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrCustomProductExists
+		}
+		return nil, fmt.Errorf("failed to update custom product: %v", err)
+	}
+	// Edited data isn't approved yet
+	withdrawFromCatalog(ctx, product.ID)
+	return product, nil
+}
+
+// Delete removes one of the user's submissions
+func (s *CustomProductService) Delete(ctx context.Context, userID, productID string) error {
+	filter, err := customProductFilter(userID, productID)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to delete custom product: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrCustomProductNotFound
+	}
+	withdrawFromCatalog(ctx, filter["_id"].(primitive.ObjectID))
+	return nil
+}
+
+// ListPending returns shared submissions waiting for moderation, oldest first
+func (s *CustomProductService) ListPending(ctx context.Context) ([]models.CustomProduct, error) {
+	return s.find(ctx, bson.M{"status": models.CustomProductStatusPending}, options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}}))
+}
+
+// Moderate approves or rejects a shared submission. Approved products join
+// the catalog so they can be suggested as alternatives.
+func (s *CustomProductService) Moderate(ctx context.Context, productID, reviewerID string, req *models.ModerateCustomProductRequest) (*models.CustomProduct, error) {
+	productObjectID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, ErrCustomProductNotFound
+	}
+
+	now := time.Now()
+	set := bson.M{
+		"status":          req.Status,
+		"moderation_note": strings.TrimSpace(req.Note),
+		"reviewed_at":     now,
+	}
+	if reviewer, err := primitive.ObjectIDFromHex(reviewerID); err == nil {
+		set["reviewed_by"] = reviewer
+	}
+
+	var product models.CustomProduct
+	err = s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": productObjectID, "visibility": models.CustomProductShared},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&product)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCustomProductNotFound
+		}
+		return nil, fmt.Errorf("failed to moderate custom product: %v", err)
+	}
+
+	if product.Status != models.CustomProductStatusApproved {
+		withdrawFromCatalog(ctx, product.ID)
+	} else if catalog := lib.GetProductCatalog(); catalog != nil {
+		if err := catalog.AddCustom(ctx, &product); err != nil {
+			log.Printf("Error cataloging approved custom product %s: %v", product.Barcode, err)
+		}
+	}
+	return &product, nil
+}
+
+// withdrawFromCatalog removes submissions that are no longer approved from the
+// product catalog so alternatives stop suggesting them
+func withdrawFromCatalog(ctx context.Context, productIDs ...primitive.ObjectID) {
+	catalog := lib.GetProductCatalog()
+	if catalog == nil {
+		return
+	}
+	if err := catalog.RemoveCustom(ctx, productIDs...); err != nil {
+		log.Printf("Error removing custom products %v from catalog: %v", productIDs, err)
+	}
+}
+
+func (s *CustomProductService) find(ctx context.Context, filter bson.M, opts ...*options.FindOptions) ([]models.CustomProduct, error) {
+	if len(opts) == 0 {
+		opts = append(opts, options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}))
+	}
+	cursor, err := s.collection.Find(ctx, filter, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch custom products: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	products := []models.CustomProduct{}
+	if err := cursor.All(ctx, &products); err != nil {
+		return nil, fmt.Errorf("failed to decode custom products: %v", err)
+	}
+	return products, nil
+}
+
+func applyCustomProductRequest(product *models.CustomProduct, req *models.CustomProductRequest, now time.Time) {
+	product.Barcode = strings.TrimSpace(req.Barcode)
+	product.Name = strings.TrimSpace(req.Name)
+	product.Brand = strings.TrimSpace(req.Brand)
+	product.Quantity = strings.TrimSpace(req.Quantity)
+	product.Per100g = req.Per100g
+	product.Ingredients = strings.TrimSpace(req.Ingredients)
+	product.FSSAILicense = strings.TrimSpace(req.FSSAILicense)
+	product.Visibility = models.CustomProductPrivate
+	product.Status = models.CustomProductStatusPrivate
+	if req.Visibility == models.CustomProductShared {
+		product.Visibility = models.CustomProductShared
+		product.Status = models.CustomProductStatusPending
+	}
+	product.UpdatedAt = now
+}
+
+// validateCustomProduct rejects label data that can't be right
+func validateCustomProduct(req *models.CustomProductRequest) error {
+	code, err := barcode.Parse(req.Barcode)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCustomProduct, err)
+	}
+	if code.VariableMeasure || !code.Lookupable() {
+		return fmt.Errorf("%w: barcode doesn't identify a product", ErrInvalidCustomProduct)
+	}
+	// Store the code the way lookups will ask for it
+	req.Barcode = code.GTIN
+	if license := strings.TrimSpace(req.FSSAILicense); license != "" && (len(license) != fssaiLicenseLength || !allDigits(license)) {
+		return fmt.Errorf("%w: FSSAI license number must be %d digits", ErrInvalidCustomProduct, fssaiLicenseLength)
+	}
+
+	n := req.Per100g
+	if n.Sugars > n.Carbohydrates {
+		return fmt.Errorf("%w: sugars can't exceed carbohydrates", ErrInvalidCustomProduct)
+	}
+	if n.SaturatedFat > n.FatTotal {
+		return fmt.Errorf("%w: saturated fat can't exceed total fat", ErrInvalidCustomProduct)
+	}
+	total := n.Proteins + n.Carbohydrates + n.FatTotal + n.Salt
+	if n.Fiber != nil {
+		total += *n.Fiber
+	}
+	if total > 100 {
+		return fmt.Errorf("%w: nutrients add up to more than 100 g per 100 g", ErrInvalidCustomProduct)
+	}
+	return nil
+}
+
+func allDigits(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func customProductFilter(userID, productID string) (bson.M, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+	productObjectID, err := primitive.ObjectIDFromHex(productID)
+	if err != nil {
+		return nil, ErrCustomProductNotFound
+	}
+	return bson.M{"_id": productObjectID, "submitted_by": userObjectID}, nil
+}
+
+func (s *CustomProductService) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "submitted_by", Value: 1}, {Key: "barcode", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "barcode", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "updated_at", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Failed to create custom product indexes: %v", err)
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"math"
-	"strconv"
+	"log"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,20 +16,28 @@ import (
 	"google.golang.org/genai"
 )
 
+// dietPlanEnergyTolerance is how far a day's calories may stray from the target
+var dietPlanEnergyTolerance = struct{ min, max float64 }{0.6, 1.4}
+
 type DietPlanService struct {
-	client *genai.Client
+	llm lib.LLM
 }
 
 func NewDietPlanService() (*DietPlanService, error) {
-	client, err := lib.GetGeminiClient()
+	llm, err := lib.NewLLM(lib.LLMFeatureDietPlan)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+		return nil, fmt.Errorf("failed to create LLM: %v", err)
 	}
-	return &DietPlanService{client: client}, nil
+	return NewDietPlanServiceWithLLM(llm), nil
+}
+
+// NewDietPlanServiceWithLLM builds the service around a given LLM, e.g. lib.FakeLLM
+func NewDietPlanServiceWithLLM(llm lib.LLM) *DietPlanService {
+	return &DietPlanService{llm: llm}
 }
 
 // GenerateDietPlan creates a personalized diet plan using structured output
-func (s *DietPlanService) GenerateDietPlan(userID string) (*models.DietPlan, error) {
+func (s *DietPlanService) GenerateDietPlan(ctx context.Context, userID string) (*models.DietPlan, error) {
 	// Get user data from database
 	user, err := GetUserByID(userID)
 	if err != nil {
@@ -37,11 +45,16 @@ func (s *DietPlanService) GenerateDietPlan(userID string) (*models.DietPlan, err
 	}
 
 	// Convert user data to UserProfile
-	userProfile, err := s.convertUserToProfile(user)
+	userProfile, err := BuildUserProfile(user)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert user data: %v", err)
+		return nil, fmt.Errorf("failed to convert user data: %w", err)
 	}
 
+	return s.generateDietPlan(ctx, userID, userProfile)
+}
+
+// generateDietPlan asks the LLM for a plan for the profile and validates it
+func (s *DietPlanService) generateDietPlan(ctx context.Context, userID string, userProfile *models.UserProfile) (*models.DietPlan, error) {
 	// Read prompt template
 	promptTemplate, err := s.readPromptTemplate()
 	if err != nil {
@@ -54,24 +67,33 @@ func (s *DietPlanService) GenerateDietPlan(userID string) (*models.DietPlan, err
 	// Create JSON schema for structured output
 	schema := s.createDietPlanSchema()
 
-	// Generate content with structured output
-	response, err := s.client.Models.GenerateContent(
-		context.Background(),
-		lib.GEMINI_MODEL,
-		genai.Text(prompt),
-		&genai.GenerateContentConfig{
+	// Regenerate when a meal contains one of the user's allergens
+	var dietPlan models.DietPlan
+	for attempt := 0; ; attempt++ {
+		// Generate content with structured output
+		response, err := s.llm.Generate(ctx, prompt, &lib.GenerateOptions{
 			ResponseMIMEType: "application/json",
 			ResponseSchema:   schema,
-		},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate diet plan: %v", err)
-	}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate diet plan: %w", err)
+		}
 
-	// Parse the structured response
-	var dietPlan models.DietPlan
-	if err := json.Unmarshal([]byte(response.Text()), &dietPlan); err != nil {
-		return nil, fmt.Errorf("failed to parse diet plan response: %v", err)
+		// Parse the structured response
+		dietPlan = models.DietPlan{}
+		if err := json.Unmarshal([]byte(response), &dietPlan); err != nil {
+			return nil, fmt.Errorf("failed to parse diet plan response: %v", err)
+		}
+
+		violations := dietPlanAllergenViolations(&dietPlan, userProfile.FoodAllergies)
+		if len(violations) == 0 {
+			break
+		}
+		if attempt == maxAllergenRegenerations {
+			return nil, fmt.Errorf("%w: %s", ErrAllergenConflict, strings.Join(violations, "; "))
+		}
+		log.Printf("Diet plan contained allergens, regenerating: %v", violations)
+		prompt += allergenRetryInstruction(userProfile.FoodAllergies, violations)
 	}
 
 	// Set additional fields
@@ -86,111 +108,15 @@ func (s *DietPlanService) GenerateDietPlan(userID string) (*models.DietPlan, err
 	dietPlan.UserID = userObjectID
 
 	// Validate the diet plan
-	if err := s.validateDietPlan(&dietPlan); err != nil {
+	if err := s.validateDietPlan(&dietPlan, userProfile.DailyTargets); err != nil {
 		return nil, fmt.Errorf("diet plan validation failed: %v", err)
 	}
 
 	return &dietPlan, nil
 }
 
-// convertUserToProfile converts User model to UserProfile
-func (s *DietPlanService) convertUserToProfile(user *models.User) (*models.UserProfile, error) {
-	// Parse age
-	age, err := strconv.Atoi(user.Age)
-	if err != nil {
-		return nil, fmt.Errorf("invalid age format: %v", err)
-	}
-
-	// Parse weight
-	weight, err := strconv.ParseFloat(user.Weight, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid weight format: %v", err)
-	}
 
-	// Parse height
-	height, err := strconv.ParseFloat(user.Height, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid height format: %v", err)
-	}
-
-	// Calculate BMI
-	bmi := s.calculateBMI(weight, height)
-
-	// Determine primary goal from health goals
-	primaryGoal := s.determinePrimaryGoal(user.HealthGoals)
-
-	// Map workout frequency
-	workoutFrequency := s.mapWorkoutFrequency(user.WorkOutsPerWeek)
-
-	// Set default values for missing fields
-	goalPace := 0.5 // Default goal pace
-	timeline := "12 weeks" // Default timeline
-	foodAllergies := []string{} // Default empty allergies
-	completedGoals := []string{} // Default empty completed goals
-	remainingGoals := []string{} // Default empty remaining goals
-
-	userProfile := &models.UserProfile{
-		Name:                user.FullName,
-		Age:                 age,
-		Weight:              weight,
-		Height:              height,
-		BMI:                 bmi,
-		WorkoutFrequency:    workoutFrequency,
-		PrimaryGoal:         primaryGoal,
-		GoalPace:            goalPace,
-		Timeline:            timeline,
-		DietaryPreferences:  user.DietaryPreferences,
-		FoodAllergies:       foodAllergies,
-		NutritionPriorities: user.NutritionPriorities,
-		CompletedGoals:      completedGoals,
-		RemainingGoals:      remainingGoals,
-		HealthStatus:        user.HealthStatus,
-	}
-
-	return userProfile, nil
-}
 
-// determinePrimaryGoal determines the primary goal from health goals
-func (s *DietPlanService) determinePrimaryGoal(healthGoals []string) string {
-	if len(healthGoals) == 0 {
-		return "general_wellness"
-	}
-
-	// Priority order for goals
-	goalPriority := map[string]int{
-		"diabetes":        1,
-		"weight_loss":     2,
-		"muscle_gain":     3,
-		"heart_health":    4,
-		"general_wellness": 5,
-	}
-
-	highestPriority := 999
-	primaryGoal := "general_wellness"
-
-	for _, goal := range healthGoals {
-		if priority, exists := goalPriority[goal]; exists && priority < highestPriority {
-			highestPriority = priority
-			primaryGoal = goal
-		}
-	}
-
-	return primaryGoal
-}
-
-// mapWorkoutFrequency maps workout frequency to descriptive string
-func (s *DietPlanService) mapWorkoutFrequency(workoutsPerWeek string) string {
-	switch workoutsPerWeek {
-	case "0-2":
-		return "1-2 light workouts"
-	case "3-5":
-		return "3-5 moderate workouts"
-	case "6+":
-		return "6+ intense workouts"
-	default:
-		return "1-2 light workouts"
-	}
-}
 
 // readPromptTemplate reads the diet plan prompt template
 func (s *DietPlanService) readPromptTemplate() (string, error) {
@@ -236,6 +162,17 @@ Ensure the plan is:
 Make it a practical weekly todo list that the user can check off each day.
 `, template, string(userProfileJSON), userProfile.PrimaryGoal, userProfile.WorkoutFrequency, userProfile.DietaryPreferences, userProfile.HealthStatus)
 
+	if targets := userProfile.DailyTargets; targets != nil {
+		prompt += fmt.Sprintf(`
+## Daily Nutrient Targets:
+- Energy: %.0f kcal (meals and snacks of each day should add up to roughly this)
+- Protein: %.0f g, Carbohydrates: %.0f g, Fat: %.0f g
+- Keep sugars under %.0f g, saturated fat under %.0f g and salt under %.1f g
+- Aim for at least %.0f g of fiber
+`, targets.EnergyKcal, targets.Proteins, targets.Carbohydrates, targets.FatTotal,
+			targets.Sugars, targets.SaturatedFat, targets.Salt, targets.Fiber)
+	}
+
 	return prompt
 }
 
@@ -461,14 +398,9 @@ func (s *DietPlanService) createMealSchema() *genai.Schema {
 	}
 }
 
-// calculateBMI calculates BMI from weight and height
-func (s *DietPlanService) calculateBMI(weight, height float64) float64 {
-	heightInMeters := height / 100
-	return math.Round((weight / (heightInMeters * heightInMeters)) * 10) / 10
-}
 
 // validateDietPlan validates the generated diet plan
-func (s *DietPlanService) validateDietPlan(plan *models.DietPlan) error {
+func (s *DietPlanService) validateDietPlan(plan *models.DietPlan, targets *models.NutrientTargets) error {
 	// Validate user profile
 	if plan.UserProfile.Name == "" {
 		return fmt.Errorf("user name is required")
@@ -498,6 +430,9 @@ func (s *DietPlanService) validateDietPlan(plan *models.DietPlan) error {
 		if err := s.validateDailyPlan(&dailyPlan, i+1); err != nil {
 			return fmt.Errorf("daily plan %d validation failed: %v", i+1, err)
 		}
+		if err := s.validateDailyEnergy(&dailyPlan, targets); err != nil {
+			return fmt.Errorf("daily plan %d validation failed: %v", i+1, err)
+		}
 	}
 
 	return nil
@@ -522,6 +457,25 @@ func (s *DietPlanService) validateDailyPlan(plan *models.DailyPlan, dayNumber in
 	return nil
 }
 
+// validateDailyEnergy rejects days whose meals are far off the energy target
+func (s *DietPlanService) validateDailyEnergy(plan *models.DailyPlan, targets *models.NutrientTargets) error {
+	if targets == nil || targets.EnergyKcal <= 0 {
+		return nil
+	}
+
+	meals := plan.MealPlan
+	total := meals.Breakfast.Calories + meals.Lunch.Calories + meals.Dinner.Calories
+	for _, snack := range meals.Snacks {
+		total += snack.Calories
+	}
+
+	ratio := float64(total) / targets.EnergyKcal
+	if ratio < dietPlanEnergyTolerance.min || ratio > dietPlanEnergyTolerance.max {
+		return fmt.Errorf("%s totals %d kcal, too far from the %.0f kcal target", plan.Day, total, targets.EnergyKcal)
+	}
+	return nil
+}
+
 // validateMealPlan validates a meal plan
 func (s *DietPlanService) validateMealPlan(mealPlan *models.MealPlan) error {
 	// Validate breakfast
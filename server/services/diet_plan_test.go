@@ -0,0 +1,81 @@
+package services
+
+import (
+	"amobagan/lib"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGenerateDietPlan(t *testing.T) {
+	tests := []struct {
+		name      string
+		llm       lib.LLM
+		allergies []string
+		prompts   int
+		want      error
+	}{
+		{name: "fixture plan", prompts: 1},
+		{name: "allergen in every answer", allergies: []string{"peanut"}, prompts: maxAllergenRegenerations + 1, want: ErrAllergenConflict},
+		{name: "LLM timeout", llm: failingLLM{err: lib.ErrLLMTimeout}, want: lib.ErrLLMTimeout},
+		{name: "LLM unavailable", llm: failingLLM{err: lib.ErrLLMUnavailable}, want: lib.ErrLLMUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeLLM(lib.LLMFeatureDietPlan)
+			llm := tt.llm
+			if llm == nil {
+				llm = fake
+			}
+			user := testUser()
+			user.FoodAllergies = tt.allergies
+			profile, err := BuildUserProfile(user)
+			if err != nil {
+				t.Fatalf("BuildUserProfile error: %v", err)
+			}
+
+			userID := primitive.NewObjectID()
+			plan, err := NewDietPlanServiceWithLLM(llm).generateDietPlan(context.Background(), userID.Hex(), profile)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("generateDietPlan error = %v, want %v", err, tt.want)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("generateDietPlan error: %v", err)
+				}
+				if plan.UserID != userID || plan.Status != "active" || len(plan.DailyPlans) == 0 {
+					t.Errorf("plan for %s is %s with %d days", plan.UserID.Hex(), plan.Status, len(plan.DailyPlans))
+				}
+			}
+
+			if tt.llm != nil {
+				return
+			}
+			prompts := fake.Prompts()
+			if len(prompts) != tt.prompts {
+				t.Fatalf("LLM got %d prompts, want %d", len(prompts), tt.prompts)
+			}
+			// Every retry repeats the allergy warning
+			for i, prompt := range prompts[1:] {
+				if !strings.Contains(prompt, "IMPORTANT: The user is allergic to") {
+					t.Errorf("retry %d doesn't warn about the allergy", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateDietPlanInvalidUserID(t *testing.T) {
+	profile, err := BuildUserProfile(testUser())
+	if err != nil {
+		t.Fatalf("BuildUserProfile error: %v", err)
+	}
+	service := NewDietPlanServiceWithLLM(fakeLLM(lib.LLMFeatureDietPlan))
+	if _, err := service.generateDietPlan(context.Background(), "not-an-id", profile); err == nil {
+		t.Errorf("generateDietPlan accepted an invalid user ID")
+	}
+}
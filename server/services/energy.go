@@ -0,0 +1,176 @@
+package services
+
+import (
+	"amobagan/config"
+	"amobagan/models"
+	"amobagan/utils"
+	"math"
+	"strings"
+	"sync"
+)
+
+// BMR equations supported by the EnergyCalculator
+const (
+	BMRFormulaMifflinStJeor  = "mifflin_st_jeor"
+	BMRFormulaHarrisBenedict = "harris_benedict"
+)
+
+// activityFactors are the classic BMR multipliers for each MapWorkoutFrequency level
+var activityFactors = map[string]float64{
+	"1-2 light workouts":    1.375,
+	"3-5 moderate workouts": 1.55,
+	"6+ intense workouts":   1.725,
+}
+
+// activityLevelFactors are the BMR multipliers of the profile's activity levels
+var activityLevelFactors = map[string]float64{
+	models.ActivitySedentary:  1.2,
+	models.ActivityLight:      1.375,
+	models.ActivityModerate:   1.55,
+	models.ActivityActive:     1.725,
+	models.ActivityVeryActive: 1.9,
+}
+
+// goalEnergyAdjustments are kcal added to TDEE for each DeterminePrimaryGoal result
+var goalEnergyAdjustments = map[string]float64{
+	"weight_loss": -500,
+	"muscle_gain": 300,
+}
+
+// goalMacroSplits are the energy shares per primary goal
+var goalMacroSplits = map[string]models.MacroSplit{
+	"diabetes":         {ProteinPercent: 25, CarbsPercent: 40, FatPercent: 35},
+	"weight_loss":      {ProteinPercent: 30, CarbsPercent: 40, FatPercent: 30},
+	"muscle_gain":      {ProteinPercent: 30, CarbsPercent: 45, FatPercent: 25},
+	"heart_health":     {ProteinPercent: 20, CarbsPercent: 55, FatPercent: 25},
+	"general_wellness": {ProteinPercent: 20, CarbsPercent: 50, FatPercent: 30},
+}
+
+// minimumEnergyKcal keeps a deficit from producing an unsafe target
+const minimumEnergyKcal = 1200
+
+// EnergyCalculator derives BMR, TDEE and daily nutrient targets from a profile
+type EnergyCalculator struct {
+	formula string
+}
+
+var (
+	defaultEnergyCalculator     *EnergyCalculator
+	defaultEnergyCalculatorOnce sync.Once
+)
+
+func NewEnergyCalculator(formula string) *EnergyCalculator {
+	formula = strings.ToLower(strings.TrimSpace(formula))
+	if formula != BMRFormulaHarrisBenedict {
+		formula = BMRFormulaMifflinStJeor
+	}
+	return &EnergyCalculator{formula: formula}
+}
+
+// GetEnergyCalculator returns the calculator configured by ENERGY_FORMULA
+func GetEnergyCalculator() *EnergyCalculator {
+	defaultEnergyCalculatorOnce.Do(func() {
+		defaultEnergyCalculator = NewEnergyCalculator(config.LoadConfig().EnergyFormula)
+	})
+	return defaultEnergyCalculator
+}
+
+// BMR estimates basal metabolic rate in kcal/day. When the sex is unknown or
+// other, the male and female equations are averaged.
+func (e *EnergyCalculator) BMR(age int, weight, height float64, sex string) float64 {
+	a := float64(age)
+	if e.formula == BMRFormulaHarrisBenedict {
+		// Roza & Shizgal revision
+		male := 88.362 + 13.397*weight + 4.799*height - 5.677*a
+		female := 447.593 + 9.247*weight + 3.098*height - 4.330*a
+		return bySex(sex, male, female)
+	}
+	// Mifflin-St Jeor: +5 for men, -161 for women
+	base := 10*weight + 6.25*height - 5*a
+	return bySex(sex, base+5, base-161)
+}
+
+func bySex(sex string, male, female float64) float64 {
+	switch sex {
+	case models.SexMale:
+		return male
+	case models.SexFemale:
+		return female
+	default:
+		return (male + female) / 2
+	}
+}
+
+// ActivityFactor maps the WorkOutsPerWeek answer to a BMR multiplier
+func (e *EnergyCalculator) ActivityFactor(workoutsPerWeek string) float64 {
+	return activityFactors[MapWorkoutFrequency(workoutsPerWeek)]
+}
+
+// Estimate computes BMR, TDEE and the goal adjustment for a parsed profile.
+// A stated activity level wins over the workouts per week answer.
+func (e *EnergyCalculator) Estimate(profile *models.UserProfile, workoutsPerWeek string) *models.EnergyEstimate {
+	bmr := e.BMR(profile.Age, profile.Weight, profile.Height, profile.Sex)
+	factor, ok := activityLevelFactors[profile.ActivityLevel]
+	if !ok {
+		factor = e.ActivityFactor(workoutsPerWeek)
+	}
+	adjustment := goalEnergyAdjustments[profile.PrimaryGoal]
+	if profile.PrimaryGoal == "diabetes" && profile.BMI >= 25 {
+		// Modest weight loss improves glycaemic control
+		adjustment = -250
+	}
+
+	return &models.EnergyEstimate{
+		Formula:        e.formula,
+		BMI:            profile.BMI,
+		BMR:            math.Round(bmr),
+		ActivityFactor: factor,
+		TDEE:           math.Round(bmr * factor),
+		PrimaryGoal:    profile.PrimaryGoal,
+		GoalAdjustment: adjustment,
+	}
+}
+
+// Targets derives the user's daily targets. The WHO-style defaults are scaled
+// to the user's energy needs, or used as-is when age, weight or height are
+// missing.
+func (e *EnergyCalculator) Targets(user *models.User) models.NutrientTargets {
+	primaryGoal := DeterminePrimaryGoal(user.HealthGoals)
+	targets := models.NutrientTargets{
+		EnergyKcal: utils.DefaultDailyEnergyKcal,
+		MacroSplit: MacroSplitForGoal(primaryGoal),
+	}
+
+	if len(missingProfileFields(user)) == 0 {
+		estimate := e.Estimate(planningProfile(user), user.WorkOutsPerWeek)
+		targets.Energy = estimate
+		targets.EnergyKcal = math.Max(estimate.TDEE+estimate.GoalAdjustment, minimumEnergyKcal)
+		targets.Personalized = true
+	}
+
+	energy := targets.EnergyKcal
+	scale := energy / utils.DefaultDailyEnergyKcal
+	salt := utils.DefaultDailySalt
+	if hasHealthGoal(user.HealthGoals, "heart_health") || hasHealthGoal(user.HealthGoals, "diabetes") {
+		// WHO's stricter 5 g salt recommendation
+		salt = 5
+	}
+
+	targets.EnergyKcal = math.Round(energy)
+	targets.Proteins = roundTenth(energy * targets.MacroSplit.ProteinPercent / 100 / 4)
+	targets.Carbohydrates = roundTenth(energy * targets.MacroSplit.CarbsPercent / 100 / 4)
+	targets.FatTotal = roundTenth(energy * targets.MacroSplit.FatPercent / 100 / 9)
+	targets.Sugars = roundTenth(utils.DefaultDailySugars * scale)
+	targets.SaturatedFat = roundTenth(utils.DefaultDailySaturatedFat * scale)
+	targets.Salt = salt
+	targets.Fiber = roundTenth(utils.DefaultDailyFiber * scale)
+	return targets
+}
+
+// MacroSplitForGoal returns the energy shares for a primary goal
+func MacroSplitForGoal(primaryGoal string) models.MacroSplit {
+	if split, ok := goalMacroSplits[primaryGoal]; ok {
+		return split
+	}
+	return goalMacroSplits["general_wellness"]
+}
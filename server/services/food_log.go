@@ -0,0 +1,494 @@
+package services
+
+import (
+	"amobagan/barcode"
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrFoodLogNotFound is returned when an entry doesn't exist or belongs to another user
+	ErrFoodLogNotFound = errors.New("food log entry not found")
+	// ErrInvalidFoodLog is returned for requests that can't be turned into an entry
+	ErrInvalidFoodLog = errors.New("invalid food log entry")
+)
+
+var foodLogMealTypes = map[string]bool{"breakfast": true, "lunch": true, "dinner": true, "snack": true}
+
+// FoodLogService stores what users actually ate, one entry per food
+type FoodLogService struct {
+	collection *mongo.Collection
+	products   lib.ProductProvider
+	dietPlans  *DietPlanService
+}
+
+func NewFoodLogService() *FoodLogService {
+	service := &FoodLogService{
+		products: lib.GetProductProvider(),
+		// Only used to look up saved plans, so no LLM is needed
+		dietPlans: NewDietPlanServiceWithLLM(nil),
+	}
+	if lib.DB != nil {
+		service.collection = lib.DB.Database("amobagan").Collection("food_log")
+		service.ensureIndexes()
+	}
+	return service
+}
+
+// CreateEntry resolves the logged food, computes the nutrients for the portion and stores it
+func (s *FoodLogService) CreateEntry(ctx context.Context, userID string, req *models.CreateFoodLogRequest) (*models.FoodLogEntry, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+
+	sources := 0
+	for _, set := range []bool{req.Barcode != "", req.MealRef != nil, req.CustomFood != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("%w: exactly one of barcode, meal_ref or custom_food is required", ErrInvalidFoodLog)
+	}
+	if req.PortionGrams < 0 || req.Servings < 0 {
+		return nil, fmt.Errorf("%w: portion_grams and servings must not be negative", ErrInvalidFoodLog)
+	}
+
+	now := time.Now()
+	entry := &models.FoodLogEntry{
+		UserID:     userObjectID,
+		ConsumedAt: now,
+		Notes:      strings.TrimSpace(req.Notes),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if req.ConsumedAt != nil {
+		entry.ConsumedAt = *req.ConsumedAt
+	}
+
+	switch {
+	case req.Barcode != "":
+		err = s.fromBarcode(ctx, entry, req)
+	case req.MealRef != nil:
+		err = s.fromMeal(entry, userID, req)
+	default:
+		err = fromCustomFood(entry, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	mealType, err := resolveMealType(req.MealType, entry.MealType, entry.ConsumedAt)
+	if err != nil {
+		return nil, err
+	}
+	entry.MealType = mealType
+	entry.Nutrients = portionNutrients(entry)
+
+	result, err := s.collection.InsertOne(ctx, entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save food log entry: %v", err)
+	}
+	entry.ID = result.InsertedID.(primitive.ObjectID)
+	return entry, nil
+}
+
+// GetEntry returns one of the user's entries
+func (s *FoodLogService) GetEntry(ctx context.Context, userID, entryID string) (*models.FoodLogEntry, error) {
+	filter, err := foodLogEntryFilter(userID, entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry models.FoodLogEntry
+	if err := s.collection.FindOne(ctx, filter).Decode(&entry); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrFoodLogNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch food log entry: %v", err)
+	}
+	return &entry, nil
+}
+
+// ListEntries returns the user's entries consumed in [from, to), oldest first
+func (s *FoodLogService) ListEntries(ctx context.Context, userID string, from, to time.Time) ([]models.FoodLogEntry, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+
+	filter := bson.M{
+		"user_id":     userObjectID,
+		"consumed_at": bson.M{"$gte": from, "$lt": to},
+	}
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "consumed_at", Value: 1}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch food log: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	entries := []models.FoodLogEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode food log: %v", err)
+	}
+	return entries, nil
+}
+
+// UpdateEntry changes an entry's portion or details and recomputes its nutrients
+func (s *FoodLogService) UpdateEntry(ctx context.Context, userID, entryID string, req *models.UpdateFoodLogRequest) (*models.FoodLogEntry, error) {
+	entry, err := s.GetEntry(ctx, userID, entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.PortionGrams != nil {
+		if *req.PortionGrams <= 0 {
+			return nil, fmt.Errorf("%w: portion_grams must be positive", ErrInvalidFoodLog)
+		}
+		if entry.BaseUnit != models.FoodLogBasePer100g {
+			return nil, fmt.Errorf("%w: this entry is logged in servings, not grams", ErrInvalidFoodLog)
+		}
+		entry.PortionGrams = *req.PortionGrams
+	}
+	if req.Servings != nil {
+		if *req.Servings <= 0 {
+			return nil, fmt.Errorf("%w: servings must be positive", ErrInvalidFoodLog)
+		}
+		if entry.BaseUnit != models.FoodLogBasePerServing {
+			return nil, fmt.Errorf("%w: this entry is logged in grams, not servings", ErrInvalidFoodLog)
+		}
+		entry.Servings = *req.Servings
+	}
+	if req.ConsumedAt != nil {
+		entry.ConsumedAt = *req.ConsumedAt
+	}
+	if req.MealType != nil {
+		mealType, err := resolveMealType(*req.MealType, "", entry.ConsumedAt)
+		if err != nil {
+			return nil, err
+		}
+		entry.MealType = mealType
+	}
+	if req.Notes != nil {
+		entry.Notes = strings.TrimSpace(*req.Notes)
+	}
+	entry.Nutrients = portionNutrients(entry)
+	entry.UpdatedAt = time.Now()
+
+	_, err = s.collection.ReplaceOne(ctx, bson.M{"_id": entry.ID, "user_id": entry.UserID}, entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update food log entry: %v", err)
+	}
+	return entry, nil
+}
+
+// DeleteEntry removes one of the user's entries
+func (s *FoodLogService) DeleteEntry(ctx context.Context, userID, entryID string) error {
+	filter, err := foodLogEntryFilter(userID, entryID)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to delete food log entry: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrFoodLogNotFound
+	}
+	return nil
+}
+
+// Summarize totals the diary per day and per ISO week (Monday start) in from's
+// time zone and compares each period with the user's daily targets
+func (s *FoodLogService) Summarize(ctx context.Context, userID string, from, to time.Time) (*models.DiarySummary, error) {
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+	entries, err := s.ListEntries(ctx, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	targets := GetEnergyCalculator().Targets(user)
+	loc := from.Location()
+	summary := &models.DiarySummary{
+		From:    from,
+		To:      to,
+		Targets: targets,
+		Days:    []models.DiaryPeriodSummary{},
+		Weeks:   []models.DiaryPeriodSummary{},
+		Total:   models.DiaryPeriodSummary{Label: "total", Start: from, End: to},
+	}
+
+	dayIndex := map[string]int{}
+	weekIndex := map[string]int{}
+	first := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, loc)
+	for day := first; day.Before(to); day = day.AddDate(0, 0, 1) {
+		start, end := maxTime(day, from), minTime(day.AddDate(0, 0, 1), to)
+		label := day.Format("2006-01-02")
+		dayIndex[label] = len(summary.Days)
+		summary.Days = append(summary.Days, models.DiaryPeriodSummary{Label: label, Start: start, End: end, Days: 1})
+
+		year, week := day.ISOWeek()
+		weekLabel := fmt.Sprintf("%d-W%02d", year, week)
+		if i, ok := weekIndex[weekLabel]; ok {
+			summary.Weeks[i].End = end
+			summary.Weeks[i].Days++
+		} else {
+			weekIndex[weekLabel] = len(summary.Weeks)
+			summary.Weeks = append(summary.Weeks, models.DiaryPeriodSummary{Label: weekLabel, Start: start, End: end, Days: 1})
+		}
+		summary.Total.Days++
+	}
+
+	for _, entry := range entries {
+		local := entry.ConsumedAt.In(loc)
+		year, week := local.ISOWeek()
+		for _, period := range []*models.DiaryPeriodSummary{
+			periodAt(summary.Days, dayIndex, local.Format("2006-01-02")),
+			periodAt(summary.Weeks, weekIndex, fmt.Sprintf("%d-W%02d", year, week)),
+			&summary.Total,
+		} {
+			if period != nil {
+				period.EntryCount++
+				period.Totals = period.Totals.Add(entry.Nutrients)
+			}
+		}
+	}
+
+	for _, periods := range [][]models.DiaryPeriodSummary{summary.Days, summary.Weeks} {
+		for i := range periods {
+			periods[i].Progress = NutrientProgressFor(periods[i].Totals, targets, periods[i].Days)
+		}
+	}
+	summary.Total.Progress = NutrientProgressFor(summary.Total.Totals, targets, summary.Total.Days)
+	return summary, nil
+}
+
+// fromBarcode fills the entry from scanned product data. A gram portion scales
+// the per-100g values; otherwise servings count the product's serving, which
+// is the labelled serving size, then one unit of a multipack, then 100 g.
+func (s *FoodLogService) fromBarcode(ctx context.Context, entry *models.FoodLogEntry, req *models.CreateFoodLogRequest) error {
+	code, err := barcode.Parse(req.Barcode)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFoodLog, err)
+	}
+	product, err := s.products.GetProduct(lib.WithProductUser(ctx, entry.UserID.Hex()), code.GTIN)
+	if err != nil {
+		return err
+	}
+
+	id := product.ProductIdentification
+	nutrition := product.NutritionalInformation
+	entry.Source = models.FoodLogSourceBarcode
+	entry.Barcode = id.Barcode
+	entry.Name = id.ProductName
+	entry.Brand = id.Brand
+	if entry.Name == "" {
+		entry.Name = id.Barcode
+	}
+
+	if req.PortionGrams > 0 {
+		entry.BaseUnit = models.FoodLogBasePer100g
+		entry.BaseNutrients = foodNutrientsFrom(nutrition.Per100g)
+		entry.PortionGrams = req.PortionGrams
+		return nil
+	}
+	entry.BaseUnit = models.FoodLogBasePerServing
+	entry.BaseNutrients = foodNutrientsFrom(nutrition.PerServing)
+	entry.Servings = servingsOrOne(req.Servings)
+	return nil
+}
+
+// fromMeal fills the entry from a meal in one of the user's saved diet plans
+func (s *FoodLogService) fromMeal(entry *models.FoodLogEntry, userID string, req *models.CreateFoodLogRequest) error {
+	ref := *req.MealRef
+	plan, err := s.dietPlans.GetDietPlan(ref.PlanID)
+	if err != nil || plan.UserID.Hex() != userID {
+		return fmt.Errorf("%w: diet plan %s not found", ErrInvalidFoodLog, ref.PlanID)
+	}
+
+	meal, err := findPlanMeal(plan, &ref)
+	if err != nil {
+		return err
+	}
+
+	ref.Slot = strings.ToLower(ref.Slot)
+	entry.Source = models.FoodLogSourceMeal
+	entry.MealRef = &ref
+	entry.Name = meal.Name
+	entry.MealType = ref.Slot
+	entry.BaseUnit = models.FoodLogBasePerServing
+	entry.BaseNutrients = models.FoodNutrients{
+		EnergyKcal:    float64(meal.Calories),
+		Proteins:      meal.Macros.Protein,
+		Carbohydrates: meal.Macros.Carbs,
+		FatTotal:      meal.Macros.Fat,
+		Fiber:         meal.Macros.Fiber,
+	}
+	entry.Servings = servingsOrOne(req.Servings)
+	return nil
+}
+
+// fromCustomFood fills the entry from user-supplied per-100g values
+func fromCustomFood(entry *models.FoodLogEntry, req *models.CreateFoodLogRequest) error {
+	food := req.CustomFood
+	if strings.TrimSpace(food.Name) == "" {
+		return fmt.Errorf("%w: custom_food.name is required", ErrInvalidFoodLog)
+	}
+	if req.PortionGrams <= 0 {
+		return fmt.Errorf("%w: portion_grams is required for a custom food", ErrInvalidFoodLog)
+	}
+
+	entry.Source = models.FoodLogSourceCustom
+	entry.Name = strings.TrimSpace(food.Name)
+	entry.Brand = strings.TrimSpace(food.Brand)
+	entry.BaseUnit = models.FoodLogBasePer100g
+	entry.BaseNutrients = food.Per100g
+	entry.PortionGrams = req.PortionGrams
+	return nil
+}
+
+func findPlanMeal(plan *models.DietPlan, ref *models.MealReference) (*models.Meal, error) {
+	for i := range plan.DailyPlans {
+		daily := &plan.DailyPlans[i]
+		if !strings.EqualFold(daily.Day, ref.Day) {
+			continue
+		}
+		switch strings.ToLower(ref.Slot) {
+		case "breakfast":
+			return &daily.MealPlan.Breakfast, nil
+		case "lunch":
+			return &daily.MealPlan.Lunch, nil
+		case "dinner":
+			return &daily.MealPlan.Dinner, nil
+		case "snack", "snacks":
+			if ref.SnackIndex < 0 || ref.SnackIndex >= len(daily.MealPlan.Snacks) {
+				return nil, fmt.Errorf("%w: %s has no snack %d", ErrInvalidFoodLog, daily.Day, ref.SnackIndex)
+			}
+			return &daily.MealPlan.Snacks[ref.SnackIndex], nil
+		default:
+			return nil, fmt.Errorf("%w: unknown meal slot %q", ErrInvalidFoodLog, ref.Slot)
+		}
+	}
+	return nil, fmt.Errorf("%w: diet plan has no day %q", ErrInvalidFoodLog, ref.Day)
+}
+
+// portionNutrients scales the entry's base nutrients to the logged amount
+func portionNutrients(entry *models.FoodLogEntry) models.FoodNutrients {
+	if entry.BaseUnit == models.FoodLogBasePer100g {
+		return entry.BaseNutrients.Scale(entry.PortionGrams / 100)
+	}
+	return entry.BaseNutrients.Scale(entry.Servings)
+}
+
+func foodNutrientsFrom(values utils.NutrientValues) models.FoodNutrients {
+	nutrients := models.FoodNutrients{
+		EnergyKcal:    values.EnergyKcal,
+		Proteins:      values.Proteins,
+		Carbohydrates: values.Carbohydrates,
+		Sugars:        values.Sugars,
+		FatTotal:      values.FatTotal,
+		SaturatedFat:  values.SaturatedFat,
+		Salt:          values.Salt,
+	}
+	if values.Fiber != nil {
+		nutrients.Fiber = *values.Fiber
+	}
+	return nutrients
+}
+
+// resolveMealType validates the requested meal type, falling back to the
+// entry's own slot and then to the time of day it was eaten
+func resolveMealType(requested, fallback string, consumedAt time.Time) (string, error) {
+	mealType := strings.ToLower(strings.TrimSpace(requested))
+	if mealType == "" {
+		mealType = fallback
+	}
+	if mealType == "snacks" {
+		mealType = "snack"
+	}
+	if mealType == "" {
+		switch hour := consumedAt.Hour(); {
+		case hour >= 5 && hour < 11:
+			mealType = "breakfast"
+		case hour >= 11 && hour < 16:
+			mealType = "lunch"
+		case hour >= 18 && hour < 23:
+			mealType = "dinner"
+		default:
+			mealType = "snack"
+		}
+	}
+	if !foodLogMealTypes[mealType] {
+		return "", fmt.Errorf("%w: meal_type must be breakfast, lunch, dinner or snack", ErrInvalidFoodLog)
+	}
+	return mealType, nil
+}
+
+func periodAt(periods []models.DiaryPeriodSummary, index map[string]int, label string) *models.DiaryPeriodSummary {
+	if i, ok := index[label]; ok {
+		return &periods[i]
+	}
+	return nil
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func servingsOrOne(servings float64) float64 {
+	if servings > 0 {
+		return servings
+	}
+	return 1
+}
+
+func foodLogEntryFilter(userID, entryID string) (bson.M, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+	entryObjectID, err := primitive.ObjectIDFromHex(entryID)
+	if err != nil {
+		return nil, ErrFoodLogNotFound
+	}
+	return bson.M{"_id": entryObjectID, "user_id": userObjectID}, nil
+}
+
+func (s *FoodLogService) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "consumed_at", Value: 1}},
+	})
+	if err != nil {
+		log.Printf("Failed to create food log indexes: %v", err)
+	}
+}
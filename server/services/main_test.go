@@ -0,0 +1,56 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"context"
+	"log"
+	"os"
+	"testing"
+)
+
+// The services read prompt templates relative to the server directory
+func TestMain(m *testing.M) {
+	if err := os.Chdir(".."); err != nil {
+		log.Fatalf("Failed to change to the server directory: %v", err)
+	}
+	os.Exit(m.Run())
+}
+
+const llmFixturesDir = "testdata/llm_fixtures"
+
+func fakeLLM(feature string) *lib.FakeLLM {
+	return lib.NewFakeLLMFromDir(llmFixturesDir, feature, "fake-model")
+}
+
+// failingLLM answers every call with err
+type failingLLM struct {
+	err error
+}
+
+func (f failingLLM) Model() string {
+	return "failing-model"
+}
+
+func (f failingLLM) Generate(ctx context.Context, prompt string, opts *lib.GenerateOptions) (string, error) {
+	return "", f.err
+}
+
+func (f failingLLM) GenerateStream(ctx context.Context, prompt string, onChunk func(text string) error) error {
+	return f.err
+}
+
+// testUser is the profile the diet plan and weekly todo fixtures were recorded for
+func testUser() *models.User {
+	return &models.User{
+		FullName:            "User",
+		Age:                 25,
+		Height:              170,
+		Weight:              70,
+		WorkOutsPerWeek:     "3-5",
+		HealthStatus:        "general_wellness",
+		HealthGoals:         []string{},
+		DietaryPreferences:  []string{"vegetarian"},
+		NutritionPriorities: []string{"high_protein"},
+	}
+}
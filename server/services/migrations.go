@@ -0,0 +1,54 @@
+package services
+
+import (
+	"amobagan/lib"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// migration is a one-off data change applied at startup
+type migration struct {
+	ID  string
+	Run func(ctx context.Context) error
+}
+
+// migrations run in order; append new ones at the end and never rename an ID
+var migrations = []migration{
+	{ID: "2025_01_nutritional_status_events", Run: migrateNutritionalStatusToEvents},
+	{ID: "2025_02_product_catalog_backfill", Run: migrateProductCacheToCatalog},
+	{ID: "2025_03_typed_profile_measurements", Run: migrateProfileMeasurements},
+}
+
+type appliedMigration struct {
+	ID        string    `bson:"_id"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// RunMigrations applies every migration not yet recorded in the migrations collection
+func RunMigrations(ctx context.Context) error {
+	collection := lib.DB.Database("amobagan").Collection("migrations")
+
+	for _, m := range migrations {
+		err := collection.FindOne(ctx, bson.M{"_id": m.ID}).Err()
+		if err == nil {
+			continue
+		}
+		if err != mongo.ErrNoDocuments {
+			return fmt.Errorf("failed to check migration %s: %v", m.ID, err)
+		}
+
+		log.Printf("Running migration %s", m.ID)
+		if err := m.Run(ctx); err != nil {
+			return fmt.Errorf("migration %s failed: %v", m.ID, err)
+		}
+		if _, err := collection.InsertOne(ctx, appliedMigration{ID: m.ID, AppliedAt: time.Now()}); err != nil {
+			return fmt.Errorf("failed to record migration %s: %v", m.ID, err)
+		}
+	}
+	return nil
+}
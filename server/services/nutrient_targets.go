@@ -0,0 +1,68 @@
+package services
+
+import (
+	"amobagan/models"
+	"math"
+	"strings"
+)
+
+// NutrientProgressFor compares totals with targets multiplied by the number of days
+func NutrientProgressFor(totals models.FoodNutrients, targets models.NutrientTargets, days int) []models.NutrientProgress {
+	n := float64(days)
+	return []models.NutrientProgress{
+		nutrientProgress("energy_kcal", models.TargetKindGoal, totals.EnergyKcal, targets.EnergyKcal*n),
+		nutrientProgress("proteins", models.TargetKindGoal, totals.Proteins, targets.Proteins*n),
+		nutrientProgress("carbohydrates", models.TargetKindGoal, totals.Carbohydrates, targets.Carbohydrates*n),
+		nutrientProgress("fat_total", models.TargetKindGoal, totals.FatTotal, targets.FatTotal*n),
+		nutrientProgress("sugars", models.TargetKindLimit, totals.Sugars, targets.Sugars*n),
+		nutrientProgress("saturated_fat", models.TargetKindLimit, totals.SaturatedFat, targets.SaturatedFat*n),
+		nutrientProgress("salt", models.TargetKindLimit, totals.Salt, targets.Salt*n),
+		nutrientProgress("fiber", models.TargetKindMinimum, totals.Fiber, targets.Fiber*n),
+	}
+}
+
+func nutrientProgress(nutrient, kind string, consumed, target float64) models.NutrientProgress {
+	progress := models.NutrientProgress{
+		Nutrient:  nutrient,
+		Kind:      kind,
+		Consumed:  roundTenth(consumed),
+		Target:    roundTenth(target),
+		Remaining: roundTenth(math.Max(target-consumed, 0)),
+		Status:    "on_track",
+	}
+	if target > 0 {
+		progress.Percent = roundTenth(consumed / target * 100)
+	}
+
+	switch kind {
+	case models.TargetKindGoal:
+		// Within 10% of the target counts as on track
+		if progress.Percent < 90 {
+			progress.Status = "under"
+		} else if progress.Percent > 110 {
+			progress.Status = "over"
+		}
+	case models.TargetKindLimit:
+		if progress.Percent > 100 {
+			progress.Status = "over"
+		}
+	case models.TargetKindMinimum:
+		if progress.Percent < 100 {
+			progress.Status = "under"
+		}
+	}
+	return progress
+}
+
+func hasHealthGoal(goals []string, goal string) bool {
+	for _, g := range goals {
+		if strings.EqualFold(strings.TrimSpace(g), goal) {
+			return true
+		}
+	}
+	return false
+}
+
+func roundTenth(value float64) float64 {
+	return math.Round(value*10) / 10
+}
@@ -1,11 +1,13 @@
 package services
 
 import (
+	"amobagan/config"
 	"amobagan/lib"
 	"amobagan/models"
 	"amobagan/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -16,49 +18,175 @@ import (
 )
 
 type NutritionAnalysisService struct {
-	client *genai.Client
+	llm               lib.LLM
+	cache             *AnalysisCache
+	rules             *RuleBasedAnalyzer
+	catalog           *lib.ProductCatalog
+	alternativesLimit int
 }
 
 func NewNutritionAnalysisService() (*NutritionAnalysisService, error) {
-	client, err := lib.GetGeminiClient()
+	llm, err := lib.NewLLM(lib.LLMFeatureNutritionAnalysis)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+		return nil, fmt.Errorf("failed to create LLM: %v", err)
 	}
-	return &NutritionAnalysisService{client: client}, nil
+	return NewNutritionAnalysisServiceWithLLM(llm), nil
 }
 
+// NewNutritionAnalysisServiceWithLLM builds the service around a given LLM, e.g. lib.FakeLLM.
+// A nil LLM leaves only the rule-based engine available.
+func NewNutritionAnalysisServiceWithLLM(llm lib.LLM) *NutritionAnalysisService {
+	return &NutritionAnalysisService{
+		llm:               llm,
+		cache:             NewAnalysisCache(),
+		rules:             NewRuleBasedAnalyzer(),
+		catalog:           lib.GetProductCatalog(),
+		alternativesLimit: config.LoadConfig().AlternativesLimit,
+	}
+}
+
+// AnalyzeNutritionWithPreferences asks the LLM for an analysis and falls back
+// to the rule-based engine when generation fails, so callers always get a result.
+// Either way the user's food allergies are enforced on the final analysis and
+// real products from the catalog replace invented alternatives.
 func (s *NutritionAnalysisService) AnalyzeNutritionWithPreferences(
+	ctx context.Context,
 	product *utils.ExtractedNutritionData,
 	userPrefs *models.UserPreferences,
 ) (*models.NutritionAnalysis, error) {
-	
+	grounded := s.groundedAlternatives(ctx, product, userPrefs)
+	analysis, err := s.analyzeWithLLM(ctx, withAlternativesData(product, grounded), userPrefs, grounded)
+	if err != nil {
+		log.Printf("LLM nutrition analysis failed, falling back to rules: %v", err)
+		analysis = s.analyzeWithRules(product, userPrefs, grounded)
+		analysis.Meta.FallbackReason = fallbackReason(err)
+		return analysis, nil
+	}
+	mergeGroundedAlternatives(analysis, grounded)
+	ApplyAllergenSafety(analysis, product, userPrefs.FoodAllergies)
+	return analysis, nil
+}
+
+// AnalyzeWithRules runs only the deterministic rule-based engine
+func (s *NutritionAnalysisService) AnalyzeWithRules(
+	ctx context.Context,
+	product *utils.ExtractedNutritionData,
+	userPrefs *models.UserPreferences,
+) *models.NutritionAnalysis {
+	return s.analyzeWithRules(product, userPrefs, s.groundedAlternatives(ctx, product, userPrefs))
+}
+
+func (s *NutritionAnalysisService) analyzeWithRules(
+	product *utils.ExtractedNutritionData,
+	userPrefs *models.UserPreferences,
+	grounded []models.Alternative,
+) *models.NutritionAnalysis {
+	analysis := s.rules.Analyze(product, userPrefs)
+	analysis.Meta = &models.AnalysisMeta{Engine: AnalysisEngineRules}
+	mergeGroundedAlternatives(analysis, grounded)
+	if userPrefs != nil {
+		ApplyAllergenSafety(analysis, product, userPrefs.FoodAllergies)
+	}
+	return analysis
+}
+
+// Alternatives returns real products from the catalog that suit the user better
+func (s *NutritionAnalysisService) Alternatives(
+	ctx context.Context,
+	product *utils.ExtractedNutritionData,
+	userPrefs *models.UserPreferences,
+) ([]models.Alternative, error) {
+	if userPrefs == nil {
+		userPrefs = &models.UserPreferences{}
+	}
+	return FindAlternatives(ctx, s.catalog, product, userPrefs, s.alternativesLimit)
+}
+
+// groundedAlternatives looks up better products in the catalog; a failed
+// lookup only costs the analysis its grounded alternatives
+func (s *NutritionAnalysisService) groundedAlternatives(
+	ctx context.Context,
+	product *utils.ExtractedNutritionData,
+	userPrefs *models.UserPreferences,
+) []models.Alternative {
+	alternatives, err := s.Alternatives(ctx, product, userPrefs)
+	if err != nil {
+		log.Printf("Error finding catalog alternatives for %s: %v", product.ProductIdentification.Barcode, err)
+		return nil
+	}
+	return alternatives
+}
+
+func fallbackReason(err error) string {
+	switch {
+	case errors.Is(err, lib.ErrLLMTimeout):
+		return "llm_timeout"
+	case errors.Is(err, lib.ErrLLMUnavailable):
+		return "llm_unavailable"
+	default:
+		return "llm_error"
+	}
+}
+
+func (s *NutritionAnalysisService) analyzeWithLLM(
+	ctx context.Context,
+	product *utils.ExtractedNutritionData,
+	userPrefs *models.UserPreferences,
+	grounded []models.Alternative,
+) (*models.NutritionAnalysis, error) {
+	if s.llm == nil {
+		return nil, errors.New("no LLM configured")
+	}
+
 	promptTemplate, err := s.readPromptTemplate()
 	if err != nil {
 		return nil, fmt.Errorf("failed to read prompt template: %v", err)
 	}
 
-	prompt := s.createAnalysisPrompt(product, userPrefs, promptTemplate)
+	// Identical product, preferences, template and model give an identical answer
+	templateVersion := TemplateVersion(promptTemplate)
+	s.cache.ObserveTemplateVersion(ctx, templateVersion)
+	model := s.llm.Model()
+	fingerprint := AnalysisFingerprint(product, userPrefs, templateVersion, model)
+
+	if cached, cachedAt, ok := s.cache.Get(ctx, fingerprint); ok {
+		cached.Meta = &models.AnalysisMeta{
+			Engine:          AnalysisEngineLLM,
+			CacheHit:        true,
+			Fingerprint:     fingerprint,
+			CachedAt:        cachedAt,
+			TemplateVersion: templateVersion,
+			Model:           model,
+		}
+		return cached, nil
+	}
+
+	prompt := s.createAnalysisPrompt(product, userPrefs, promptTemplate, grounded)
 
 	schema := s.createJSONSchema()
 
-	response, err := s.client.Models.GenerateContent(
-		context.Background(),
-		lib.GEMINI_MODEL,
-		genai.Text(prompt),
-		&genai.GenerateContentConfig{
-			ResponseMIMEType: "application/json",
-			ResponseSchema:   schema,
-		},
-	)
+	response, err := s.llm.Generate(ctx, prompt, &lib.GenerateOptions{
+		ResponseMIMEType: "application/json",
+		ResponseSchema:   schema,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate nutrition analysis: %v", err)
+		return nil, fmt.Errorf("failed to generate nutrition analysis: %w", err)
 	}
 
 	var analysis models.NutritionAnalysis
-	if err := json.Unmarshal([]byte(response.Text()), &analysis); err != nil {
+	if err := json.Unmarshal([]byte(response), &analysis); err != nil {
 		return nil, fmt.Errorf("failed to parse nutrition analysis response: %v", err)
 	}
 
+	s.cache.Put(ctx, fingerprint, product.ProductIdentification.Barcode, templateVersion, model, &analysis)
+	analysis.Meta = &models.AnalysisMeta{
+		Engine:          AnalysisEngineLLM,
+		CacheHit:        false,
+		Fingerprint:     fingerprint,
+		TemplateVersion: templateVersion,
+		Model:           model,
+	}
+
 	return &analysis, nil
 }
 
@@ -74,6 +202,7 @@ func (s *NutritionAnalysisService) createAnalysisPrompt(
 	product *utils.ExtractedNutritionData,
 	userPrefs *models.UserPreferences,
 	template string,
+	grounded []models.Alternative,
 ) string {
 	
 	productJSON, _ := json.MarshalIndent(product, "", "  ")
@@ -91,11 +220,26 @@ USER PREFERENCES:
 
 Please analyze this product according to the user's health goals, dietary preferences, and nutrition priorities. 
 Provide a personalized nutrition analysis in the exact JSON format specified in the schema above.
-`, template, string(productJSON), string(userPrefsJSON))
+%s`, template, string(productJSON), string(userPrefsJSON), catalogAlternativesSection(grounded))
 
 	return prompt
 }
 
+// catalogAlternativesSection lists the real products from the catalog the LLM
+// must pick its alternatives from
+func catalogAlternativesSection(grounded []models.Alternative) string {
+	if len(grounded) == 0 {
+		return ""
+	}
+	alternativesJSON, _ := json.MarshalIndent(grounded, "", "  ")
+	return fmt.Sprintf(`
+CATALOG ALTERNATIVES:
+%s
+
+Only suggest smarter alternatives from the catalog list above and include each one's barcode.
+`, string(alternativesJSON))
+}
+
 func (s *NutritionAnalysisService) createJSONSchema() *genai.Schema {
 	return &genai.Schema{
 		Type: genai.TypeObject,
@@ -171,8 +315,11 @@ func (s *NutritionAnalysisService) createJSONSchema() *genai.Schema {
 								Type: genai.TypeString,
 							},
 						},
+						"barcode": {
+							Type: genai.TypeString,
+						},
 					},
-					PropertyOrdering: []string{"name", "benefits", "why_better", "key_features"},
+					PropertyOrdering: []string{"name", "benefits", "why_better", "key_features", "barcode"},
 				},
 			},
 			"personalized_callout": {
@@ -269,22 +416,52 @@ func (s *NutritionAnalysisService) FormatAnalysisForDisplay(analysis *models.Nut
 		formatted["detailed_nutrition_breakdown"] = analysis.DetailedNutritionBreakdown
 	}
 
+	if analysis.AllergenSafety != nil {
+		formatted["allergen_safety"] = analysis.AllergenSafety
+	}
+
+	if analysis.Meta != nil {
+		formatted["meta"] = analysis.Meta
+	}
+
 	return formatted
 }
 
 func (s *NutritionAnalysisService) StreamNutritionAnalysisWithPreferences(
+	ctx context.Context,
 	conn *websocket.Conn,
 	product *utils.ExtractedNutritionData,
 	userPrefs *models.UserPreferences,
-) error {
+) (string, error) {
 	promptTemplate, err := s.readPromptTemplate()
 	if err != nil {
-		return fmt.Errorf("failed to read prompt template: %v", err)
+		return "", fmt.Errorf("failed to read prompt template: %v", err)
 	}
 
 	log.Println("userPrefs", userPrefs)
 
-	prompt := s.createStreamingPrompt(product, userPrefs, promptTemplate)
+	// Warn before any AI text arrives so an unsafe product is never missed
+	if allergies := utils.NormalizeAllergies(userPrefs.FoodAllergies); len(allergies) > 0 {
+		if matches := utils.MatchProductAllergens(allergies, product); len(matches) > 0 {
+			conn.WriteJSON(map[string]interface{}{
+				"type":    "allergen_warning",
+				"content": "Not safe for you: contains " + strings.Join(allergenNames(matches), ", "),
+				"data": &models.AllergenSafety{
+					Safe:      false,
+					Allergies: allergies,
+					Matches:   matches,
+				},
+			})
+		}
+	}
+
+	// The caller falls back to rules
+	if s.llm == nil {
+		return "", errors.New("no LLM configured")
+	}
+
+	grounded := s.groundedAlternatives(ctx, product, userPrefs)
+	prompt := s.createStreamingPrompt(withAlternativesData(product, grounded), userPrefs, promptTemplate, grounded)
 
 	initialMsg := map[string]interface{}{
 		"type":    "stream_start",
@@ -292,23 +469,11 @@ func (s *NutritionAnalysisService) StreamNutritionAnalysisWithPreferences(
 	}
 	conn.WriteJSON(initialMsg)
 
-	stream := s.client.Models.GenerateContentStream(
-		context.Background(),
-		lib.GEMINI_MODEL,
-		genai.Text(prompt),
-		nil,
-	)
-
 	var fullResponse strings.Builder
 	var currentSection strings.Builder
 	var sectionType string
 
-	for chunk, _ := range stream {
-		if chunk.Candidates == nil || len(chunk.Candidates) == 0 {
-			continue
-		}
-
-		text := chunk.Candidates[0].Content.Parts[0].Text
+	err = s.llm.GenerateStream(ctx, prompt, func(text string) error {
 		fullResponse.WriteString(text)
 		currentSection.WriteString(text)
 
@@ -323,6 +488,10 @@ func (s *NutritionAnalysisService) StreamNutritionAnalysisWithPreferences(
 			currentSection.String(), 
 			sectionType,
 		)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to stream nutrition analysis: %w", err)
 	}
 
 	finalAnalysis := s.formatStreamingResponse(fullResponse.String(), product, userPrefs)
@@ -332,13 +501,14 @@ func (s *NutritionAnalysisService) StreamNutritionAnalysisWithPreferences(
 	}
 	conn.WriteJSON(finalMsg)
 
-	return nil
+	return finalAnalysis, nil
 }
 
 func (s *NutritionAnalysisService) createStreamingPrompt(
 	product *utils.ExtractedNutritionData,
 	userPrefs *models.UserPreferences,
 	template string,
+	grounded []models.Alternative,
 ) string {
 	productJSON, _ := json.MarshalIndent(product, "", "  ")
 	userPrefsJSON, _ := json.MarshalIndent(userPrefs, "", "  ")
@@ -351,7 +521,7 @@ PRODUCT DATA:
 
 USER PREFERENCES:
 %s
-
+%s
 Please analyze this product according to the user's health goals, dietary preferences, and nutrition priorities. 
 Provide a comprehensive nutrition analysis in markdown format with the following sections:
 
@@ -373,7 +543,7 @@ Provide a comprehensive nutrition analysis in markdown format with the following
 [Break down nutrients and their impact]
 
 Please provide this analysis in a conversational, easy-to-understand markdown format that can be streamed to the user.
-`, template, string(productJSON), string(userPrefsJSON), product.ProductIdentification.ProductName)
+`, template, string(productJSON), string(userPrefsJSON), catalogAlternativesSection(grounded), product.ProductIdentification.ProductName)
 
 	return prompt
 }
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const nutritionEventsCollection = "nutritional_status_events"
+
+// NutritionWindows are the windows reported by GetUserNutritionDetails
+var NutritionWindows = []string{models.NutritionWindowToday, models.NutritionWindowWeek, models.NutritionWindowMonth, models.NutritionWindowAll}
+
+var nutritionEventIndexesOnce sync.Once
+
+func nutritionEvents() *mongo.Collection {
+	collection := lib.DB.Database("amobagan").Collection(nutritionEventsCollection)
+	nutritionEventIndexesOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}},
+		})
+		if err != nil {
+			log.Printf("Failed to create nutritional status event indexes: %v", err)
+		}
+	})
+	return collection
+}
+
+// RecordNutritionalEvents stores one timestamped event per element
+func RecordNutritionalEvents(ctx context.Context, userID primitive.ObjectID, elements []string, barcode string) error {
+	if len(elements) == 0 {
+		return nil
+	}
+	now := time.Now()
+	docs := make([]interface{}, 0, len(elements))
+	for _, element := range elements {
+		docs = append(docs, models.NutritionalStatusEvent{
+			UserID:    userID,
+			Element:   element,
+			Barcode:   barcode,
+			Count:     1,
+			CreatedAt: now,
+		})
+	}
+	if _, err := nutritionEvents().InsertMany(ctx, docs); err != nil {
+		return fmt.Errorf("failed to record nutritional status events: %v", err)
+	}
+	return nil
+}
+
+// NutritionWindowStart returns when a window begins relative to now, in now's
+// time zone. Weeks start on Monday. The "all" window has no start.
+func NutritionWindowStart(window string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch window {
+	case models.NutritionWindowToday:
+		return today, nil
+	case models.NutritionWindowWeek:
+		offset := (int(today.Weekday()) + 6) % 7
+		return today.AddDate(0, 0, -offset), nil
+	case models.NutritionWindowMonth:
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()), nil
+	case models.NutritionWindowAll:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, fmt.Errorf("unknown window %q, expected today, week, month or all", window)
+	}
+}
+
+// CountNutritionalEvents sums the user's events per element since the start of
+// the window. Baseline events are only included in the "all" window.
+func CountNutritionalEvents(ctx context.Context, userID primitive.ObjectID, window string, now time.Time) (map[string]int, error) {
+	start, err := NutritionWindowStart(window, now)
+	if err != nil {
+		return nil, err
+	}
+
+	match := bson.M{"user_id": userID}
+	if window != models.NutritionWindowAll {
+		match["created_at"] = bson.M{"$gte": start}
+		match["baseline"] = bson.M{"$ne": true}
+	}
+	cursor, err := nutritionEvents().Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{"_id": "$element", "count": bson.M{"$sum": "$count"}}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to count nutritional status events: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	var rows []struct {
+		Element string `bson:"_id"`
+		Count   int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, fmt.Errorf("failed to decode nutritional status counts: %v", err)
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, row := range rows {
+		counts[row.Element] = row.Count
+	}
+	return counts, nil
+}
+
+// migrateNutritionalStatusToEvents turns every user's legacy counter map into
+// baseline events and removes the map
+func migrateNutritionalStatusToEvents(ctx context.Context) error {
+	users := lib.DB.Database("amobagan").Collection("users")
+	cursor, err := users.Find(ctx, bson.M{"nutritionalStatus": bson.M{"$exists": true}})
+	if err != nil {
+		return fmt.Errorf("failed to find users with nutritional status: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	migrated := 0
+	now := time.Now()
+	for cursor.Next(ctx) {
+		var user models.User
+		if err := cursor.Decode(&user); err != nil {
+			return fmt.Errorf("failed to decode user: %v", err)
+		}
+
+		// A previous run may have inserted the baseline and stopped before
+		// clearing the map; don't insert it twice
+		existing, err := nutritionEvents().CountDocuments(ctx, bson.M{"user_id": user.ID, "baseline": true})
+		if err != nil {
+			return fmt.Errorf("failed to check baseline events for user %s: %v", user.ID.Hex(), err)
+		}
+
+		var docs []interface{}
+		for element, count := range user.NutritionalStatus {
+			if existing > 0 {
+				break
+			}
+			if count <= 0 {
+				continue
+			}
+			docs = append(docs, models.NutritionalStatusEvent{
+				UserID:    user.ID,
+				Element:   element,
+				Count:     count,
+				Baseline:  true,
+				CreatedAt: now,
+			})
+		}
+		if len(docs) > 0 {
+			if _, err := nutritionEvents().InsertMany(ctx, docs); err != nil {
+				return fmt.Errorf("failed to insert baseline events for user %s: %v", user.ID.Hex(), err)
+			}
+		}
+		if _, err := users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$unset": bson.M{"nutritionalStatus": ""}}); err != nil {
+			return fmt.Errorf("failed to clear nutritional status for user %s: %v", user.ID.Hex(), err)
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate users: %v", err)
+	}
+
+	log.Printf("Migrated nutritional status counters of %d users to baseline events", migrated)
+	return nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testProduct(t *testing.T) *utils.ExtractedNutritionData {
+	t.Helper()
+	product, err := utils.ExtractNutritionData(map[string]interface{}{
+		"status": 1.0,
+		"product": map[string]interface{}{
+			"code":             "8901719110016",
+			"product_name":     "Parle-G Original Glucose Biscuits",
+			"categories_tags":  []interface{}{"en:biscuits"},
+			"allergens_tags":   []interface{}{"en:gluten", "en:milk"},
+			"ingredients_text": "Wheat flour (68%), sugar, palm oil, invert sugar syrup, milk solids, salt, raising agents (503(ii), 500(ii))",
+			"nutriments": map[string]interface{}{
+				"energy-kcal_100g":   450.0,
+				"energy-kj_100g":     1883.0,
+				"carbohydrates_100g": 77.0,
+				"sugars_100g":        25.0,
+				"proteins_100g":      7.0,
+				"fat_100g":           13.0,
+				"saturated-fat_100g": 6.0,
+				"salt_100g":          0.6,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ExtractNutritionData error: %v", err)
+	}
+	return product
+}
+
+func TestAnalyzeNutritionWithPreferences(t *testing.T) {
+	tests := []struct {
+		name      string
+		llm       lib.LLM
+		allergies []string
+		engine    string
+		fallback  string
+		grade     string
+		safe      *bool
+	}{
+		{
+			name:   "fixture answer",
+			llm:    fakeLLM(lib.LLMFeatureNutritionAnalysis),
+			engine: AnalysisEngineLLM,
+			grade:  "D",
+		},
+		{
+			name:      "allergen overrides the model",
+			llm:       fakeLLM(lib.LLMFeatureNutritionAnalysis),
+			allergies: []string{"milk"},
+			engine:    AnalysisEngineLLM,
+			safe:      new(bool),
+		},
+		{
+			name:     "timeout falls back to rules",
+			llm:      failingLLM{err: lib.ErrLLMTimeout},
+			engine:   AnalysisEngineRules,
+			fallback: "llm_timeout",
+		},
+		{
+			name:     "open breaker falls back to rules",
+			llm:      failingLLM{err: lib.ErrLLMUnavailable},
+			engine:   AnalysisEngineRules,
+			fallback: "llm_unavailable",
+		},
+		{
+			name:     "missing fixture falls back to rules",
+			llm:      lib.NewFakeLLMFromDir(t.TempDir(), lib.LLMFeatureNutritionAnalysis, "fake-model"),
+			engine:   AnalysisEngineRules,
+			fallback: "llm_error",
+		},
+		{
+			name:     "no LLM falls back to rules",
+			engine:   AnalysisEngineRules,
+			fallback: "llm_error",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewNutritionAnalysisServiceWithLLM(tt.llm)
+			prefs := &models.UserPreferences{
+				HealthGoals:         []string{models.WeightLoss},
+				NutritionPriorities: []string{"low_sugar"},
+				FoodAllergies:       tt.allergies,
+				UserName:            "User",
+			}
+
+			analysis, err := service.AnalyzeNutritionWithPreferences(context.Background(), testProduct(t), prefs)
+			if err != nil {
+				t.Fatalf("AnalyzeNutritionWithPreferences error: %v", err)
+			}
+			if analysis.Meta == nil || analysis.Meta.Engine != tt.engine || analysis.Meta.FallbackReason != tt.fallback {
+				t.Fatalf("meta = %+v, want engine %q fallback %q", analysis.Meta, tt.engine, tt.fallback)
+			}
+			if tt.grade != "" && analysis.InstantHealthRating.Grade != tt.grade {
+				t.Errorf("grade = %q, want %q", analysis.InstantHealthRating.Grade, tt.grade)
+			}
+			if tt.safe != nil {
+				if analysis.AllergenSafety == nil || analysis.AllergenSafety.Safe != *tt.safe {
+					t.Errorf("allergen safety = %+v, want safe %v", analysis.AllergenSafety, *tt.safe)
+				}
+			}
+		})
+	}
+}
+
+func TestAnalyzeNutritionPrompt(t *testing.T) {
+	llm := fakeLLM(lib.LLMFeatureNutritionAnalysis)
+	service := NewNutritionAnalysisServiceWithLLM(llm)
+	prefs := &models.UserPreferences{
+		HealthGoals:         []string{models.HeartHealth},
+		DietaryPreferences:  []string{"vegetarian"},
+		NutritionPriorities: []string{"low_sodium"},
+	}
+
+	analysis, err := service.AnalyzeNutritionWithPreferences(context.Background(), testProduct(t), prefs)
+	if err != nil {
+		t.Fatalf("AnalyzeNutritionWithPreferences error: %v", err)
+	}
+	if analysis.Meta.Model != "fake-model" || analysis.Meta.TemplateVersion == "" || analysis.Meta.Fingerprint == "" {
+		t.Errorf("meta = %+v, want model, template version and fingerprint", analysis.Meta)
+	}
+
+	prompts := llm.Prompts()
+	if len(prompts) != 1 {
+		t.Fatalf("LLM got %d prompts, want 1", len(prompts))
+	}
+	for _, want := range []string{"Parle-G Original Glucose Biscuits", models.HeartHealth, "low_sodium", "vegetarian"} {
+		if !strings.Contains(prompts[0], want) {
+			t.Errorf("prompt doesn't mention %q", want)
+		}
+	}
+}
+
+func TestFallbackReason(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{lib.ErrLLMTimeout, "llm_timeout"},
+		{lib.ErrLLMUnavailable, "llm_unavailable"},
+		{errors.New("boom"), "llm_error"},
+	}
+	for _, tt := range tests {
+		if got := fallbackReason(tt.err); got != tt.want {
+			t.Errorf("fallbackReason(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestStreamNutritionAnalysisWithoutLLM(t *testing.T) {
+	service := NewNutritionAnalysisServiceWithLLM(nil)
+	// No allergies, so nothing is written before the LLM check
+	_, err := service.StreamNutritionAnalysisWithPreferences(context.Background(), nil, testProduct(t), &models.UserPreferences{})
+	if err == nil {
+		t.Errorf("StreamNutritionAnalysisWithPreferences without an LLM succeeded")
+	}
+}
@@ -0,0 +1,357 @@
+package services
+
+import (
+	"amobagan/config"
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/big"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrOTPInvalid is returned for a wrong code or when no code was requested
+	ErrOTPInvalid = errors.New("invalid code")
+	// ErrOTPExpired is returned for a code past its lifetime
+	ErrOTPExpired = errors.New("code expired, request a new one")
+	// ErrOTPTooManyAttempts is returned once a code was guessed wrong too often
+	ErrOTPTooManyAttempts = errors.New("too many wrong attempts, request a new code")
+	// ErrOTPRateLimited is wrapped by OTPRateLimitError
+	ErrOTPRateLimited = errors.New("too many codes requested")
+	// ErrInvalidVerification is returned for unknown, expired or used verification tokens
+	ErrInvalidVerification = errors.New("invalid or expired verification token")
+	// ErrSMSUnavailable is returned when no SMS sender is configured
+	ErrSMSUnavailable = errors.New("SMS sending is not available")
+)
+
+const (
+	otpDigits = 6
+	// verificationTTL is how long a verified code can be used to finish sign-up
+	// or a password reset
+	verificationTTL = 10 * time.Minute
+	// otpSendWindow is the window of the per phone send limit
+	otpSendWindow = time.Hour
+)
+
+// OTPRateLimitError tells when the next code may be requested
+type OTPRateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OTPRateLimitError) Error() string {
+	return fmt.Sprintf("%v, try again in %d seconds", ErrOTPRateLimited, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+func (e *OTPRateLimitError) Unwrap() error {
+	return ErrOTPRateLimited
+}
+
+// OTPService sends one-time codes by SMS and checks them. Codes are stored as
+// keyed hashes and are limited in lifetime, attempts and resends.
+type OTPService struct {
+	collection *mongo.Collection
+	users      *mongo.Collection
+	sender     lib.SMSSender
+	secret     []byte
+
+	ttl             time.Duration
+	maxAttempts     int
+	resendInterval  time.Duration
+	maxSendsPerHour int
+}
+
+func NewOTPService() *OTPService {
+	cfg := config.LoadConfig()
+	sender, err := lib.NewSMSSender()
+	if err != nil {
+		log.Printf("SMS sender unavailable, one-time codes can't be sent: %v", err)
+	} else if sender == nil {
+		log.Printf("No SMS_PROVIDER configured, one-time codes can't be sent")
+	}
+
+	service := &OTPService{
+		collection:      lib.DB.Database("amobagan").Collection("otps"),
+		users:           lib.DB.Database("amobagan").Collection("users"),
+		sender:          sender,
+		secret:          []byte(cfg.JWT_SECRET),
+		ttl:             cfg.OTPTTL,
+		maxAttempts:     cfg.OTPMaxAttempts,
+		resendInterval:  cfg.OTPResendInterval,
+		maxSendsPerHour: cfg.OTPMaxSendsPerHour,
+	}
+	service.ensureIndexes()
+	return service
+}
+
+// Request sends a new code, replacing any earlier one for the phone number and
+// purpose. Password reset codes are only sent to registered numbers, but the
+// answer is the same either way so numbers can't be probed: unregistered
+// numbers get a record without a code, so the same resend limits apply.
+func (s *OTPService) Request(ctx context.Context, phoneNo, purpose string) (*models.OTPSent, error) {
+	if s.sender == nil {
+		return nil, ErrSMSUnavailable
+	}
+	sent := &models.OTPSent{
+		ExpiresIn: int64(s.ttl.Seconds()),
+		ResendIn:  int64(s.resendInterval.Seconds()),
+	}
+
+	registered := true
+	if purpose == models.OTPPurposePasswordReset {
+		count, err := s.users.CountDocuments(ctx, bson.M{"phoneNo": phoneNo}, options.Count().SetLimit(1))
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up phone number: %v", err)
+		}
+		registered = count > 0
+	}
+
+	now := time.Now()
+	var previous models.OTP
+	err := s.collection.FindOne(ctx, bson.M{"phone_no": phoneNo, "purpose": purpose}).Decode(&previous)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("failed to fetch code: %v", err)
+	}
+	exists := err == nil
+
+	otp := models.OTP{
+		PhoneNo:     phoneNo,
+		Purpose:     purpose,
+		SentAt:      now,
+		ExpiresAt:   now.Add(s.ttl),
+		SendCount:   1,
+		WindowStart: now,
+	}
+	if exists {
+		if wait := previous.SentAt.Add(s.resendInterval).Sub(now); wait > 0 {
+			return nil, &OTPRateLimitError{RetryAfter: wait}
+		}
+		if windowEnd := previous.WindowStart.Add(otpSendWindow); now.Before(windowEnd) {
+			if previous.SendCount >= s.maxSendsPerHour {
+				return nil, &OTPRateLimitError{RetryAfter: windowEnd.Sub(now)}
+			}
+			otp.SendCount = previous.SendCount + 1
+			otp.WindowStart = previous.WindowStart
+		}
+	}
+
+	// Unregistered numbers keep an empty hash, which no code matches
+	var code string
+	if registered {
+		code, err = newOTPCode()
+		if err != nil {
+			return nil, err
+		}
+		otp.CodeHash = s.hashCode(phoneNo, purpose, code)
+	}
+
+	if exists {
+		// Matching the previous send time keeps concurrent requests from both sending
+		result, err := s.collection.ReplaceOne(ctx, bson.M{"_id": previous.ID, "sent_at": previous.SentAt}, otp)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save code: %v", err)
+		}
+		if result.MatchedCount == 0 {
+			return nil, &OTPRateLimitError{RetryAfter: s.resendInterval}
+		}
+	} else if _, err := s.collection.InsertOne(ctx, otp); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, &OTPRateLimitError{RetryAfter: s.resendInterval}
+		}
+		return nil, fmt.Errorf("failed to save code: %v", err)
+	}
+
+	if !registered {
+		return sent, nil
+	}
+	message := fmt.Sprintf("%s is your Amobagan code. It expires in %d minutes. Don't share it with anyone.", code, int(s.ttl.Minutes()))
+	if err := s.sender.Send(ctx, phoneNo, message); err != nil {
+		return nil, fmt.Errorf("failed to send code: %v", err)
+	}
+	return sent, nil
+}
+
+// Verify checks a code. Every try counts against the attempt limit; a correct
+// code returns a short lived token that can be used once.
+func (s *OTPService) Verify(ctx context.Context, phoneNo, purpose, code string) (*models.OTPVerified, error) {
+	var otp models.OTP
+	err := s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"phone_no": phoneNo, "purpose": purpose, "verified_at": bson.M{"$exists": false}},
+		bson.M{"$inc": bson.M{"attempts": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&otp)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrOTPInvalid
+		}
+		return nil, fmt.Errorf("failed to fetch code: %v", err)
+	}
+
+	now := time.Now()
+	if !now.Before(otp.ExpiresAt) {
+		return nil, ErrOTPExpired
+	}
+	if otp.Attempts > s.maxAttempts {
+		return nil, ErrOTPTooManyAttempts
+	}
+	if otp.CodeHash == "" || !hmac.Equal([]byte(otp.CodeHash), []byte(s.hashCode(phoneNo, purpose, code))) {
+		return nil, ErrOTPInvalid
+	}
+
+	token, hash, err := newVerificationToken()
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{"_id": otp.ID, "verified_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{
+			"verified_at":             now,
+			"verification_token_hash": hash,
+			"verification_expires_at": now.Add(verificationTTL),
+		}},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save verification: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return nil, ErrOTPInvalid
+	}
+
+	return &models.OTPVerified{
+		VerificationToken: token,
+		ExpiresIn:         int64(verificationTTL.Seconds()),
+	}, nil
+}
+
+// ConsumeVerification accepts a verification token once for the phone number
+// and purpose it was issued for
+func (s *OTPService) ConsumeVerification(ctx context.Context, phoneNo, purpose, token string) error {
+	now := time.Now()
+	result, err := s.collection.UpdateOne(
+		ctx,
+		bson.M{
+			"phone_no":                 phoneNo,
+			"purpose":                  purpose,
+			"verification_token_hash":  hashRefreshToken(token),
+			"verification_expires_at":  bson.M{"$gt": now},
+			"verification_consumed_at": bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"verification_consumed_at": now}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check verification: %v", err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrInvalidVerification
+	}
+	return nil
+}
+
+// ResetPassword sets a new password with a password reset verification and
+// signs the user out everywhere
+func (s *OTPService) ResetPassword(ctx context.Context, req *models.ResetPasswordRequest) error {
+	var user models.User
+	if err := s.users.FindOne(ctx, bson.M{"phoneNo": req.PhoneNo}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return ErrInvalidVerification
+		}
+		return fmt.Errorf("failed to find user: %v", err)
+	}
+	if err := s.ConsumeVerification(ctx, req.PhoneNo, models.OTPPurposePasswordReset, req.VerificationToken); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+	// Receiving the code proves the number, so it counts as verified
+	set := bson.M{"password": hashedPassword, "phoneVerified": true}
+	if _, err := s.users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": set}); err != nil {
+		return fmt.Errorf("failed to update password: %v", err)
+	}
+
+	if _, err := GetSessionService().RevokeAll(ctx, user.ID.Hex(), models.SessionRevokedPassword); err != nil {
+		log.Printf("Error revoking sessions of %s after password reset: %v", user.ID.Hex(), err)
+	}
+	return nil
+}
+
+// VerifyPhone marks a signed-in user's phone number verified
+func (s *OTPService) VerifyPhone(ctx context.Context, userID, token string) error {
+	user, err := FindUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if err := s.ConsumeVerification(ctx, user.PhoneNo, models.OTPPurposeVerifyPhone, token); err != nil {
+		return err
+	}
+
+	if _, err := s.users.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"phoneVerified": true}}); err != nil {
+		return fmt.Errorf("failed to update user: %v", err)
+	}
+	return nil
+}
+
+// hashCode keys the hash with the server secret so the six digits can't be
+// brute forced from a database dump
+func (s *OTPService) hashCode(phoneNo, purpose, code string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(phoneNo + "|" + purpose + "|" + code))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func newOTPCode() (string, error) {
+	limit := big.NewInt(1)
+	for i := 0; i < otpDigits; i++ {
+		limit.Mul(limit, big.NewInt(10))
+	}
+	n, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate code: %v", err)
+	}
+	return fmt.Sprintf("%0*d", otpDigits, n.Int64()), nil
+}
+
+// newVerificationToken returns a random opaque token and the hash that is stored
+func newVerificationToken() (string, string, error) {
+	token, _, err := newRefreshToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate verification token: %v", err)
+	}
+	return token, hashRefreshToken(token), nil
+}
+
+func (s *OTPService) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "phone_no", Value: 1}, {Key: "purpose", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// Kept for the send limit window after the code expired, then removed by MongoDB
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(int32(otpSendWindow.Seconds())),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to create OTP indexes: %v", err)
+	}
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxAlternativeCandidates bounds how many same-category products are scored
+const maxAlternativeCandidates = 200
+
+// AlternativesData values reported in the product's confidence score
+const (
+	AlternativesDataCatalog     = "catalog"
+	AlternativesDataUnavailable = "unavailable"
+)
+
+// distanceScales bring per-100g nutrients to a comparable range, roughly what
+// counts as a noticeable difference for each
+var distanceScales = map[string]float64{
+	"energy_kcal":   100,
+	"proteins":      5,
+	"carbohydrates": 10,
+	"sugars":        5,
+	"fat_total":     5,
+	"saturated_fat": 2,
+	"salt":          0.5,
+	"fiber":         3,
+}
+
+// alternativeCandidate is a catalog product that scores better than the original
+type alternativeCandidate struct {
+	product  *utils.ExtractedNutritionData
+	distance float64
+	benefits []string
+}
+
+// FindAlternatives returns up to limit catalog products in the same category
+// that score better on the user's priorities, the most similar first
+func FindAlternatives(
+	ctx context.Context,
+	catalog *lib.ProductCatalog,
+	product *utils.ExtractedNutritionData,
+	userPrefs *models.UserPreferences,
+	limit int,
+) ([]models.Alternative, error) {
+	if catalog == nil || limit < 1 {
+		return nil, nil
+	}
+
+	candidates, err := catalog.SameCategory(ctx, product, maxAlternativeCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	criteria, weights, priorities := rankingCriteriaFor(userPrefs)
+	allergies := utils.NormalizeAllergies(userPrefs.FoodAllergies)
+
+	var better []alternativeCandidate
+	for _, candidate := range candidates {
+		if len(allergies) > 0 && len(utils.MatchProductAllergens(allergies, candidate)) > 0 {
+			continue
+		}
+		benefits, ok := scoresBetter(product, candidate, criteria, weights, len(priorities) > 0)
+		if !ok {
+			continue
+		}
+		better = append(better, alternativeCandidate{
+			product:  candidate,
+			distance: nutrientDistance(product, candidate),
+			benefits: benefits,
+		})
+	}
+
+	sort.SliceStable(better, func(a, b int) bool { return better[a].distance < better[b].distance })
+	if len(better) > limit {
+		better = better[:limit]
+	}
+
+	alternatives := make([]models.Alternative, 0, len(better))
+	for _, c := range better {
+		alternatives = append(alternatives, catalogAlternative(c))
+	}
+	return alternatives, nil
+}
+
+// scoresBetter compares the candidate with the original on every criterion.
+// It has to come out ahead overall and, when the user has priorities, improve
+// on at least one of them.
+func scoresBetter(
+	original, candidate *utils.ExtractedNutritionData,
+	criteria []rankingCriterion,
+	weights []float64,
+	hasPriorities bool,
+) ([]string, bool) {
+	var benefits []string
+	net := 0.0
+	improvedPriority := false
+	for i, criterion := range criteria {
+		was, okWas := criterion.value(original)
+		now, okNow := criterion.value(candidate)
+		if !okWas || !okNow {
+			continue
+		}
+		was, now = roundTenth(was), roundTenth(now)
+		switch {
+		case isBetter(now, was, criterion.lowerIsBetter):
+			net += weights[i]
+			if weights[i] == priorityCriterionWeight {
+				improvedPriority = true
+			}
+			benefits = append(benefits, improvementBenefit(criterion, was, now))
+		case isBetter(was, now, criterion.lowerIsBetter):
+			net -= weights[i]
+		}
+	}
+	if net <= 0 || (hasPriorities && !improvedPriority) {
+		return nil, false
+	}
+	return benefits, true
+}
+
+func improvementBenefit(criterion rankingCriterion, was, now float64) string {
+	switch criterion.label {
+	case nutriScoreCriterion.label:
+		return fmt.Sprintf("Nutri-Score %c instead of %c", 'A'+int(now), 'A'+int(was))
+	case additivesCriterion.label:
+		return fmt.Sprintf("%d additives instead of %d", int(now), int(was))
+	case processingCriterion.label:
+		return fmt.Sprintf("NOVA %d instead of %d", int(now), int(was))
+	}
+	direction := "More"
+	if criterion.lowerIsBetter {
+		direction = "Less"
+	}
+	return fmt.Sprintf("%s %s (%s vs %s %s)", direction, criterion.label, formatAmount(now), formatAmount(was), criterion.unit)
+}
+
+// nutrientDistance is the scaled euclidean distance between per-100g values;
+// nutrients either product lacks are left out
+func nutrientDistance(a, b *utils.ExtractedNutritionData) float64 {
+	sum := 0.0
+	for _, n := range comparisonNutrients {
+		va := n.read(a, a.NutritionalInformation.Per100g)
+		vb := n.read(b, b.NutritionalInformation.Per100g)
+		if va == nil || vb == nil {
+			continue
+		}
+		d := (*va - *vb) / distanceScales[n.key]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+func catalogAlternative(c alternativeCandidate) models.Alternative {
+	id := c.product.ProductIdentification
+	name := id.ProductName
+	if id.Brand != "" {
+		name = fmt.Sprintf("%s (%s)", id.ProductName, id.Brand)
+	}
+
+	var features []string
+	if grade := strings.ToUpper(c.product.HealthScoring.Nutriscore.Grade); grade != "" {
+		features = append(features, "Nutri-Score "+grade)
+	}
+	if group := productNovaGroup(c.product); group > 0 {
+		features = append(features, "NOVA "+strconv.Itoa(group))
+	}
+	features = append(features, "Barcode "+id.Barcode)
+
+	return models.Alternative{
+		Name:        name,
+		Benefits:    c.benefits,
+		WhyBetter:   "A similar product from the same category that does better on what matters to you",
+		KeyFeatures: features,
+		Barcode:     id.Barcode,
+		Brand:       id.Brand,
+		ImageURL:    c.product.ProductImages.FrontImage.Medium,
+	}
+}
+
+// mergeGroundedAlternatives puts the catalog alternatives in place of invented
+// ones, keeping the LLM's wording for any it picked from the catalog list
+func mergeGroundedAlternatives(analysis *models.NutritionAnalysis, grounded []models.Alternative) {
+	if len(grounded) == 0 {
+		return
+	}
+
+	worded := map[string]models.Alternative{}
+	for _, alt := range analysis.SmarterAlternatives {
+		if alt.Barcode != "" {
+			worded[alt.Barcode] = alt
+		}
+	}
+
+	merged := make([]models.Alternative, 0, len(grounded))
+	for _, alt := range grounded {
+		if llm, ok := worded[alt.Barcode]; ok && llm.WhyBetter != "" {
+			alt.WhyBetter = llm.WhyBetter
+			if len(llm.Benefits) > 0 {
+				alt.Benefits = llm.Benefits
+			}
+		}
+		merged = append(merged, alt)
+	}
+	analysis.SmarterAlternatives = merged
+}
+
+// withAlternativesData returns a copy of the product whose confidence score
+// says whether catalog alternatives were found
+func withAlternativesData(product *utils.ExtractedNutritionData, grounded []models.Alternative) *utils.ExtractedNutritionData {
+	copied := *product
+	copied.ExtractionMetadata.ConfidenceScore.AlternativesData = AlternativesDataUnavailable
+	if len(grounded) > 0 {
+		copied.ExtractionMetadata.ConfidenceScore.AlternativesData = AlternativesDataCatalog
+	}
+	return &copied
+}
+
+func formatAmount(value float64) string {
+	return strconv.FormatFloat(roundTenth(value), 'f', -1, 64)
+}
+
+// migrateProductCacheToCatalog seeds the catalog with every product already in
+// the product cache
+func migrateProductCacheToCatalog(ctx context.Context) error {
+	catalog := lib.GetProductCatalog()
+	if catalog == nil {
+		return nil
+	}
+
+	cache := lib.DB.Database("amobagan").Collection("product_cache")
+	cursor, err := cache.Find(ctx, bson.M{"not_found": false, "product": bson.M{"$ne": nil}})
+	if err != nil {
+		return fmt.Errorf("failed to read product cache: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	added := 0
+	for cursor.Next(ctx) {
+		var entry struct {
+			Product *utils.ExtractedNutritionData `bson:"product"`
+		}
+		if err := cursor.Decode(&entry); err != nil {
+			return fmt.Errorf("failed to decode cached product: %v", err)
+		}
+		if entry.Product == nil {
+			continue
+		}
+
+		if err := catalog.Add(ctx, entry.Product); err != nil {
+			return err
+		}
+		added++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate product cache: %v", err)
+	}
+
+	log.Printf("Added %d cached products to the product catalog", added)
+	return nil
+}
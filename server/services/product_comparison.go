@@ -0,0 +1,431 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/genai"
+)
+
+// comparisonNutrient reads one nutrient from the extracted values
+type comparisonNutrient struct {
+	key           string
+	label         string
+	unit          string
+	lowerIsBetter bool
+	// nutrient is the name used in NutritionalInformation.MissingNutrients
+	nutrient string
+	value    func(v utils.NutrientValues) *float64
+}
+
+var comparisonNutrients = []comparisonNutrient{
+	{"energy_kcal", "energy", "kcal", true, utils.NutrientEnergy, func(v utils.NutrientValues) *float64 { return &v.EnergyKcal }},
+	{"proteins", "protein", "g", false, utils.NutrientProteins, func(v utils.NutrientValues) *float64 { return &v.Proteins }},
+	{"carbohydrates", "carbohydrates", "g", true, utils.NutrientCarbohydrates, func(v utils.NutrientValues) *float64 { return &v.Carbohydrates }},
+	{"sugars", "sugars", "g", true, utils.NutrientSugars, func(v utils.NutrientValues) *float64 { return &v.Sugars }},
+	{"fat_total", "fat", "g", true, utils.NutrientFat, func(v utils.NutrientValues) *float64 { return &v.FatTotal }},
+	{"saturated_fat", "saturated fat", "g", true, utils.NutrientSaturatedFat, func(v utils.NutrientValues) *float64 { return &v.SaturatedFat }},
+	{"salt", "salt", "g", true, utils.NutrientSalt, func(v utils.NutrientValues) *float64 { return &v.Salt }},
+	{"fiber", "fiber", "g", false, utils.NutrientFiber, func(v utils.NutrientValues) *float64 { return v.Fiber }},
+}
+
+// read returns the nutrient of the given values, or nil when the product's
+// data doesn't have it. Absent values are stored as 0 and must not win.
+func (n comparisonNutrient) read(p *utils.ExtractedNutritionData, values utils.NutrientValues) *float64 {
+	if !p.NutritionalInformation.HasNutrient(n.nutrient) {
+		return nil
+	}
+	return n.value(values)
+}
+
+// rankingCriterion scores products on one aspect; missing values count as the worst
+type rankingCriterion struct {
+	label         string
+	unit          string
+	lowerIsBetter bool
+	value         func(p *utils.ExtractedNutritionData) (float64, bool)
+}
+
+func per100gCriterion(key string) rankingCriterion {
+	for _, n := range comparisonNutrients {
+		if n.key == key {
+			nutrient := n
+			return rankingCriterion{
+				label:         n.label,
+				unit:          n.unit + "/100g",
+				lowerIsBetter: n.lowerIsBetter,
+				value: func(p *utils.ExtractedNutritionData) (float64, bool) {
+					v := nutrient.read(p, p.NutritionalInformation.Per100g)
+					if v == nil {
+						return 0, false
+					}
+					return *v, true
+				},
+			}
+		}
+	}
+	panic("unknown comparison nutrient " + key)
+}
+
+var nutriScoreCriterion = rankingCriterion{
+	label:         "Nutri-Score",
+	lowerIsBetter: true,
+	value: func(p *utils.ExtractedNutritionData) (float64, bool) {
+		grade := strings.ToLower(p.HealthScoring.Nutriscore.Grade)
+		if len(grade) != 1 || !strings.Contains("abcde", grade) {
+			return 0, false
+		}
+		return float64(grade[0] - 'a'), true
+	},
+}
+
+var additivesCriterion = rankingCriterion{
+	label:         "additives",
+	lowerIsBetter: true,
+	value: func(p *utils.ExtractedNutritionData) (float64, bool) {
+		return float64(p.IngredientsAndAdditives.Additives.AdditivesCount), true
+	},
+}
+
+var processingCriterion = rankingCriterion{
+	label:         "processing (NOVA)",
+	lowerIsBetter: true,
+	value: func(p *utils.ExtractedNutritionData) (float64, bool) {
+		group := productNovaGroup(p)
+		return float64(group), group > 0
+	},
+}
+
+// priorityCriteria maps each nutrition priority to what it ranks on
+var priorityCriteria = map[string]rankingCriterion{
+	models.HighProtein:        per100gCriterion("proteins"),
+	models.LowFat:             per100gCriterion("fat_total"),
+	models.LowSugarPriority:   per100gCriterion("sugars"),
+	models.LowSodiumPriority:  per100gCriterion("salt"),
+	models.HighFiber:          per100gCriterion("fiber"),
+	models.NoAdditives:        additivesCriterion,
+	models.NaturalIngredients: processingCriterion,
+}
+
+// Weights of the criteria every comparison uses and of the user's priorities
+const (
+	baseCriterionWeight     = 1.0
+	priorityCriterionWeight = 2.0
+)
+
+// CompareProducts lines the products up per 100 g and per serving and ranks
+// them by the user's nutrition priorities. Products containing one of the
+// user's allergens always rank last.
+func CompareProducts(products []*utils.ExtractedNutritionData, userPrefs *models.UserPreferences) *models.ProductComparison {
+	comparison := &models.ProductComparison{
+		Products:   make([]models.ComparedProduct, len(products)),
+		Priorities: []string{},
+	}
+
+	allergies := utils.NormalizeAllergies(userPrefs.FoodAllergies)
+	for i, p := range products {
+		id := p.ProductIdentification
+		comparison.Products[i] = models.ComparedProduct{
+			Barcode:     id.Barcode,
+			ProductName: id.ProductName,
+			Brand:       id.Brand,
+			ImageURL:    p.ProductImages.FrontImage.Medium,
+			Quantity:    id.Quantity,
+			NutriScore:  strings.ToUpper(p.HealthScoring.Nutriscore.Grade),
+			NovaGroup:   productNovaGroup(p),
+			Additives:   p.IngredientsAndAdditives.Additives.AdditivesCount,
+		}
+		if len(allergies) > 0 {
+			comparison.Products[i].Allergens = allergenNames(utils.MatchProductAllergens(allergies, p))
+		}
+	}
+
+	comparison.Per100g = compareNutrients(comparison.Products, products, func(p *utils.ExtractedNutritionData) utils.NutrientValues {
+		return p.NutritionalInformation.Per100g
+	})
+	comparison.PerServing = compareNutrients(comparison.Products, products, func(p *utils.ExtractedNutritionData) utils.NutrientValues {
+		return p.NutritionalInformation.PerServing
+	})
+
+	criteria, weights, priorities := rankingCriteriaFor(userPrefs)
+	comparison.Priorities = append(comparison.Priorities, priorities...)
+	comparison.Ranking = rankProducts(comparison.Products, products, criteria, weights)
+	return comparison
+}
+
+// rankingCriteriaFor returns the criteria every ranking uses followed by those
+// of the user's nutrition priorities, their weights and the priorities used
+func rankingCriteriaFor(userPrefs *models.UserPreferences) ([]rankingCriterion, []float64, []string) {
+	criteria := []rankingCriterion{nutriScoreCriterion, per100gCriterion("sugars"), per100gCriterion("saturated_fat"), per100gCriterion("salt")}
+	weights := []float64{baseCriterionWeight, baseCriterionWeight, baseCriterionWeight, baseCriterionWeight}
+	var priorities []string
+	for _, priority := range userPrefs.NutritionPriorities {
+		criterion, ok := priorityCriteria[priority]
+		if !ok {
+			continue
+		}
+		priorities = append(priorities, priority)
+		criteria = append(criteria, criterion)
+		weights = append(weights, priorityCriterionWeight)
+	}
+	return criteria, weights, priorities
+}
+
+func compareNutrients(
+	compared []models.ComparedProduct,
+	products []*utils.ExtractedNutritionData,
+	values func(p *utils.ExtractedNutritionData) utils.NutrientValues,
+) []models.NutrientComparison {
+	rows := make([]models.NutrientComparison, 0, len(comparisonNutrients))
+	for _, n := range comparisonNutrients {
+		row := models.NutrientComparison{
+			Nutrient:      n.key,
+			Unit:          n.unit,
+			Values:        make([]*float64, len(products)),
+			LowerIsBetter: n.lowerIsBetter,
+		}
+
+		best, lowest, highest := -1, math.Inf(1), math.Inf(-1)
+		tie := false
+		for i, p := range products {
+			v := n.read(p, values(p))
+			if v == nil {
+				continue
+			}
+			rounded := roundTenth(*v)
+			row.Values[i] = &rounded
+			lowest, highest = math.Min(lowest, rounded), math.Max(highest, rounded)
+
+			switch {
+			case best < 0 || isBetter(rounded, *row.Values[best], n.lowerIsBetter):
+				best, tie = i, false
+			case rounded == *row.Values[best]:
+				tie = true
+			}
+		}
+		if best >= 0 {
+			row.Difference = roundTenth(highest - lowest)
+			if !tie && row.Difference > 0 {
+				row.Best = compared[best].Barcode
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func rankProducts(
+	compared []models.ComparedProduct,
+	products []*utils.ExtractedNutritionData,
+	criteria []rankingCriterion,
+	weights []float64,
+) []models.ProductRanking {
+	ranking := make([]models.ProductRanking, len(products))
+	for i := range products {
+		ranking[i] = models.ProductRanking{
+			Barcode:     compared[i].Barcode,
+			ProductName: compared[i].ProductName,
+			Reasons:     []string{},
+		}
+	}
+
+	totalWeight := 0.0
+	for c, criterion := range criteria {
+		values := make([]float64, len(products))
+		known := make([]bool, len(products))
+		lowest, highest := math.Inf(1), math.Inf(-1)
+		for i, p := range products {
+			values[i], known[i] = criterion.value(p)
+			if known[i] {
+				lowest, highest = math.Min(lowest, values[i]), math.Max(highest, values[i])
+			}
+		}
+		// A criterion where every product is equal doesn't tell them apart
+		if math.IsInf(lowest, 1) || highest == lowest {
+			continue
+		}
+
+		totalWeight += weights[c]
+		for i := range products {
+			if !known[i] {
+				continue
+			}
+			normalized := (values[i] - lowest) / (highest - lowest)
+			if criterion.lowerIsBetter {
+				normalized = 1 - normalized
+			}
+			ranking[i].Score += weights[c] * normalized
+			if normalized == 1 {
+				ranking[i].Reasons = append(ranking[i].Reasons, bestReason(criterion, values[i]))
+			}
+		}
+	}
+
+	for i := range ranking {
+		if totalWeight > 0 {
+			ranking[i].Score = roundTenth(ranking[i].Score / totalWeight * 100)
+		}
+		if len(compared[i].Allergens) > 0 {
+			ranking[i].Score = 0
+			ranking[i].Reasons = []string{"Contains your allergen: " + strings.Join(compared[i].Allergens, ", ")}
+		}
+	}
+
+	unsafe := map[string]bool{}
+	for _, p := range compared {
+		unsafe[p.Barcode] = len(p.Allergens) > 0
+	}
+	sort.SliceStable(ranking, func(a, b int) bool {
+		if unsafe[ranking[a].Barcode] != unsafe[ranking[b].Barcode] {
+			return !unsafe[ranking[a].Barcode]
+		}
+		return ranking[a].Score > ranking[b].Score
+	})
+	for i := range ranking {
+		ranking[i].Rank = i + 1
+	}
+	return ranking
+}
+
+func bestReason(criterion rankingCriterion, value float64) string {
+	switch criterion.label {
+	case nutriScoreCriterion.label:
+		return fmt.Sprintf("Best Nutri-Score (%c)", 'A'+int(value))
+	case additivesCriterion.label:
+		return fmt.Sprintf("Fewest additives (%d)", int(value))
+	case processingCriterion.label:
+		return fmt.Sprintf("Least processed (NOVA %d)", int(value))
+	}
+	direction := "Most"
+	if criterion.lowerIsBetter {
+		direction = "Least"
+	}
+	return fmt.Sprintf("%s %s (%s %s)", direction, criterion.label, strconv.FormatFloat(roundTenth(value), 'f', -1, 64), criterion.unit)
+}
+
+func isBetter(value, than float64, lowerIsBetter bool) bool {
+	if lowerIsBetter {
+		return value < than
+	}
+	return value > than
+}
+
+func indexOfBarcode(products []models.ComparedProduct, barcode string) int {
+	for i, p := range products {
+		if p.Barcode == barcode {
+			return i
+		}
+	}
+	return -1
+}
+
+// productNovaGroup prefers the upstream NOVA group and falls back to our own
+func productNovaGroup(p *utils.ExtractedNutritionData) int {
+	if group, err := strconv.Atoi(p.ProcessingClassification.NovaGroup); err == nil && group > 0 {
+		return group
+	}
+	return p.ProcessingClassification.ProcessingIndicators.ComputedNovaGroup
+}
+
+// CompareVerdict asks the LLM for a short personalized recommendation between
+// the compared products and falls back to the top of the ranking when
+// generation fails
+func (s *NutritionAnalysisService) CompareVerdict(
+	ctx context.Context,
+	comparison *models.ProductComparison,
+	userPrefs *models.UserPreferences,
+) *models.ComparisonVerdict {
+	verdict, err := s.compareVerdictWithLLM(ctx, comparison, userPrefs)
+	if err != nil {
+		log.Printf("LLM comparison verdict failed, falling back to ranking: %v", err)
+		verdict = rankingVerdict(comparison)
+		verdict.Meta.FallbackReason = fallbackReason(err)
+	}
+	return verdict
+}
+
+func (s *NutritionAnalysisService) compareVerdictWithLLM(
+	ctx context.Context,
+	comparison *models.ProductComparison,
+	userPrefs *models.UserPreferences,
+) (*models.ComparisonVerdict, error) {
+	if s.llm == nil {
+		return nil, errors.New("no LLM configured")
+	}
+
+	comparisonJSON, _ := json.MarshalIndent(comparison, "", "  ")
+	userPrefsJSON, _ := json.MarshalIndent(userPrefs, "", "  ")
+
+	prompt := fmt.Sprintf(`
+You are a nutrition expert helping a shopper choose between products in a store aisle.
+
+PRODUCT COMPARISON (nutrient values are in the same order as the products):
+%s
+
+USER PREFERENCES:
+%s
+
+Pick the single best product for this user and explain why in at most two short sentences.
+Never pick a product that lists one of the user's allergens.
+Respond with the barcode of the chosen product and the summary.
+`, string(comparisonJSON), string(userPrefsJSON))
+
+	response, err := s.llm.Generate(ctx, prompt, &lib.GenerateOptions{
+		ResponseMIMEType: "application/json",
+		ResponseSchema: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"winner_barcode": {Type: genai.TypeString},
+				"summary":        {Type: genai.TypeString},
+			},
+			Required: []string{"winner_barcode", "summary"},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate comparison verdict: %w", err)
+	}
+
+	var verdict models.ComparisonVerdict
+	if err := json.Unmarshal([]byte(response), &verdict); err != nil {
+		return nil, fmt.Errorf("failed to parse comparison verdict: %v", err)
+	}
+	winner := indexOfBarcode(comparison.Products, verdict.Winner)
+	if winner < 0 {
+		return nil, fmt.Errorf("comparison verdict picked unknown barcode %q", verdict.Winner)
+	}
+	if len(comparison.Products[winner].Allergens) > 0 {
+		return nil, fmt.Errorf("comparison verdict picked a product with the user's allergens")
+	}
+
+	verdict.Meta = &models.AnalysisMeta{Engine: AnalysisEngineLLM, Model: s.llm.Model()}
+	return &verdict, nil
+}
+
+// rankingVerdict recommends the top-ranked product from its ranking reasons
+func rankingVerdict(comparison *models.ProductComparison) *models.ComparisonVerdict {
+	top := comparison.Ranking[0]
+	verdict := &models.ComparisonVerdict{
+		Winner: top.Barcode,
+		Meta:   &models.AnalysisMeta{Engine: AnalysisEngineRules},
+	}
+	switch {
+	case len(comparison.Products[indexOfBarcode(comparison.Products, top.Barcode)].Allergens) > 0:
+		verdict.Winner = ""
+		verdict.Summary = "All of these products contain one of your allergens."
+	case len(top.Reasons) == 0:
+		verdict.Summary = fmt.Sprintf("%s is the best pick, though the products are very similar.", top.ProductName)
+	default:
+		verdict.Summary = fmt.Sprintf("%s is the best pick for you: %s.", top.ProductName, strings.Join(top.Reasons, ", "))
+	}
+	return verdict
+}
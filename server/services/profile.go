@@ -0,0 +1,578 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/units"
+	"amobagan/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrIncompleteProfile is returned when plans need measurements the user hasn't entered
+var ErrIncompleteProfile = errors.New("profile is incomplete")
+
+// BuildUserProfile converts a stored user into the profile sent to the plan
+// and todo generators, including the user's daily nutrient targets
+func BuildUserProfile(user *models.User) (*models.UserProfile, error) {
+	if missing := missingProfileFields(user); len(missing) > 0 {
+		return nil, fmt.Errorf("%w: add %s to your profile", ErrIncompleteProfile, strings.Join(missing, ", "))
+	}
+	profile := planningProfile(user)
+	targets := GetEnergyCalculator().Targets(user)
+	profile.DailyTargets = &targets
+	return profile, nil
+}
+
+// GetUserTargets returns the daily nutrient targets for a user
+func GetUserTargets(userID string) (*models.NutrientTargets, error) {
+	user, err := GetUserByID(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user data: %v", err)
+	}
+	targets := GetEnergyCalculator().Targets(user)
+	return &targets, nil
+}
+
+// planningProfile converts the stored user into the profile the generators use
+func planningProfile(user *models.User) *models.UserProfile {
+	weight := user.Weight.Float64()
+	height := user.Height.Float64()
+
+	return &models.UserProfile{
+		Name:                user.FullName,
+		Age:                 user.Age.Int(),
+		Weight:              weight,
+		Height:              height,
+		BMI:                 CalculateBMI(weight, height),
+		Sex:                 user.Sex,
+		ActivityLevel:       user.ActivityLevel,
+		WorkoutFrequency:    MapWorkoutFrequency(user.WorkOutsPerWeek),
+		PrimaryGoal:         DeterminePrimaryGoal(user.HealthGoals),
+		GoalPace:            0.5,        // Default goal pace
+		Timeline:            "12 weeks", // Default timeline
+		DietaryPreferences:  user.DietaryPreferences,
+		FoodAllergies:       utils.NormalizeAllergies(user.FoodAllergies),
+		NutritionPriorities: user.NutritionPriorities,
+		CompletedGoals:      []string{},
+		RemainingGoals:      []string{},
+		HealthStatus:        user.HealthStatus,
+	}
+}
+
+// missingProfileFields names the measurements energy targets and plans need
+func missingProfileFields(user *models.User) []string {
+	missing := []string{}
+	if user.Age <= 0 {
+		missing = append(missing, "age")
+	}
+	if user.Height <= 0 {
+		missing = append(missing, "height")
+	}
+	if user.Weight <= 0 {
+		missing = append(missing, "weight")
+	}
+	return missing
+}
+
+// CalculateBMI calculates BMI from weight (kg) and height (cm)
+func CalculateBMI(weight, height float64) float64 {
+	if height <= 0 {
+		return 0
+	}
+	heightInMeters := height / 100
+	return math.Round((weight/(heightInMeters*heightInMeters))*10) / 10
+}
+
+// DeterminePrimaryGoal picks the highest-priority goal from the user's health goals
+func DeterminePrimaryGoal(healthGoals []string) string {
+	if len(healthGoals) == 0 {
+		return "general_wellness"
+	}
+
+	// Priority order for goals
+	goalPriority := map[string]int{
+		"diabetes":         1,
+		"weight_loss":      2,
+		"muscle_gain":      3,
+		"heart_health":     4,
+		"general_wellness": 5,
+	}
+
+	highestPriority := 999
+	primaryGoal := "general_wellness"
+
+	for _, goal := range healthGoals {
+		if priority, exists := goalPriority[goal]; exists && priority < highestPriority {
+			highestPriority = priority
+			primaryGoal = goal
+		}
+	}
+
+	return primaryGoal
+}
+
+// MapWorkoutFrequency maps workout frequency to descriptive string
+func MapWorkoutFrequency(workoutsPerWeek string) string {
+	switch workoutsPerWeek {
+	case "0-2":
+		return "1-2 light workouts"
+	case "3-5":
+		return "3-5 moderate workouts"
+	case "6+":
+		return "6+ intense workouts"
+	default:
+		return "1-2 light workouts"
+	}
+}
+
+// ErrInvalidProfile wraps profile values that fail validation
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// Unit conversions for imperial profiles
+const (
+	cmPerInch = 2.54
+	kgPerLb   = 0.45359237
+)
+
+// Plausible ranges for profile measurements, in years, cm and kg
+const (
+	minAge, maxAge           = 13, 120
+	minHeightCm, maxHeightCm = 50, 272
+	minWeightKg, maxWeightKg = 20, 500
+)
+
+// GetProfile returns the user's profile in their units
+func GetProfile(ctx context.Context, userID string) (*models.Profile, error) {
+	user, err := FindUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return profileFromUser(user), nil
+}
+
+// UpdateProfile validates and stores the fields present in the request
+func UpdateProfile(ctx context.Context, userID string, req *models.UpdateProfileRequest) (*models.Profile, error) {
+	user, err := FindUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	set, err := profileChanges(user, req)
+	if err != nil {
+		return nil, err
+	}
+	if len(set) > 0 {
+		update := bson.M{"$set": set}
+		// A measurement entered again replaces its unreadable legacy text
+		unset := bson.M{}
+		for field := range user.LegacyMeasurements {
+			if _, ok := set[field]; ok {
+				unset["legacyMeasurements."+field] = ""
+			}
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		_, err := lib.DB.Database("amobagan").Collection("users").UpdateOne(ctx, bson.M{"_id": user.ID}, update)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update profile: %v", err)
+		}
+	}
+
+	return GetProfile(ctx, userID)
+}
+
+// ValidateSignupProfile checks the profile fields of a new account the way
+// UpdateProfile does and stores the validated values on the user, converting
+// imperial measurements to metric. Empty fields stay empty.
+func ValidateSignupProfile(user *models.User) error {
+	optionalString := func(value string) *string {
+		if value == "" {
+			return nil
+		}
+		return &value
+	}
+	optionalNumber := func(value models.FlexNumber) *models.FlexNumber {
+		if value == 0 {
+			return nil
+		}
+		return &value
+	}
+	optionalList := func(values []string) *[]string {
+		if values == nil {
+			return nil
+		}
+		return &values
+	}
+
+	set, err := profileChanges(&models.User{}, &models.UpdateProfileRequest{
+		FullName:            optionalString(user.FullName),
+		Age:                 optionalNumber(user.Age),
+		Sex:                 optionalString(user.Sex),
+		Units:               optionalString(user.Units),
+		Height:              optionalNumber(user.Height),
+		Weight:              optionalNumber(user.Weight),
+		ActivityLevel:       optionalString(user.ActivityLevel),
+		WorkOutsPerWeek:     optionalString(user.WorkOutsPerWeek),
+		HealthStatus:        optionalString(user.HealthStatus),
+		HealthGoals:         optionalList(user.HealthGoals),
+		DietaryPreferences:  optionalList(user.DietaryPreferences),
+		NutritionPriorities: optionalList(user.NutritionPriorities),
+		FoodAllergies:       optionalList(user.FoodAllergies),
+	})
+	if err != nil {
+		return err
+	}
+
+	// The changes are keyed by bson field names, so decoding them onto the
+	// user replaces only the fields that were given
+	data, err := bson.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("failed to apply profile: %v", err)
+	}
+	if err := bson.Unmarshal(data, user); err != nil {
+		return fmt.Errorf("failed to apply profile: %v", err)
+	}
+	return nil
+}
+
+// profileChanges validates the request and returns the fields to set
+func profileChanges(user *models.User, req *models.UpdateProfileRequest) (bson.M, error) {
+	set := bson.M{}
+
+	system := profileUnits(user.Units)
+	if req.Units != nil {
+		value, err := validateChoice("units", *req.Units, []string{models.UnitsMetric, models.UnitsImperial})
+		if err != nil {
+			return nil, err
+		}
+		system = profileUnits(value)
+		set["units"] = system
+	}
+
+	if req.FullName != nil {
+		name := strings.TrimSpace(*req.FullName)
+		if name == "" {
+			return nil, fmt.Errorf("%w: full name can't be empty", ErrInvalidProfile)
+		}
+		set["fullName"] = name
+	}
+	if req.Age != nil {
+		age := req.Age.Int()
+		if age < minAge || age > maxAge {
+			return nil, fmt.Errorf("%w: age must be between %d and %d", ErrInvalidProfile, minAge, maxAge)
+		}
+		set["age"] = float64(age)
+	}
+	if req.Height != nil {
+		height := req.Height.Float64()
+		if system == models.UnitsImperial {
+			height *= cmPerInch
+		}
+		if height < minHeightCm || height > maxHeightCm {
+			return nil, fmt.Errorf("%w: height must be between %d and %d cm", ErrInvalidProfile, minHeightCm, maxHeightCm)
+		}
+		set["height"] = math.Round(height*10) / 10
+	}
+	if req.Weight != nil {
+		weight := req.Weight.Float64()
+		if system == models.UnitsImperial {
+			weight *= kgPerLb
+		}
+		if weight < minWeightKg || weight > maxWeightKg {
+			return nil, fmt.Errorf("%w: weight must be between %d and %d kg", ErrInvalidProfile, minWeightKg, maxWeightKg)
+		}
+		set["weight"] = math.Round(weight*10) / 10
+	}
+
+	choices := []struct {
+		field   string
+		value   *string
+		options []string
+	}{
+		{"sex", req.Sex, models.SexOptions},
+		{"activityLevel", req.ActivityLevel, models.ActivityLevelOptions},
+		{"workOutsPerWeek", req.WorkOutsPerWeek, models.WorkoutFrequencyOptions},
+	}
+	for _, choice := range choices {
+		if choice.value == nil {
+			continue
+		}
+		value, err := validateChoice(choice.field, *choice.value, choice.options)
+		if err != nil {
+			return nil, err
+		}
+		set[choice.field] = value
+	}
+
+	lists := []struct {
+		field   string
+		values  *[]string
+		options []string
+	}{
+		{"healthGoals", req.HealthGoals, models.HealthGoalOptions},
+		{"dietaryPreferences", req.DietaryPreferences, models.DietaryPreferenceOptions},
+		{"nutritionPriorities", req.NutritionPriorities, models.NutritionPriorityOptions},
+	}
+	for _, list := range lists {
+		if list.values == nil {
+			continue
+		}
+		values, err := validateChoices(list.field, *list.values, list.options)
+		if err != nil {
+			return nil, err
+		}
+		set[list.field] = values
+	}
+
+	if req.HealthStatus != nil {
+		set["healthStatus"] = strings.TrimSpace(*req.HealthStatus)
+	}
+	if req.FoodAllergies != nil {
+		set["foodAllergies"] = utils.NormalizeAllergies(*req.FoodAllergies)
+	}
+	return set, nil
+}
+
+// validateChoice accepts one of the options; an empty value clears the field
+func validateChoice(field, value string, options []string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "", nil
+	}
+	for _, option := range options {
+		if value == option {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s must be one of %s", ErrInvalidProfile, field, strings.Join(options, ", "))
+}
+
+// validateChoices accepts a list of options without duplicates
+func validateChoices(field string, values []string, options []string) ([]string, error) {
+	result := []string{}
+	seen := map[string]bool{}
+	for _, value := range values {
+		value, err := validateChoice(field, value, options)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" && !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result, nil
+}
+
+func profileUnits(units string) string {
+	if units == models.UnitsImperial {
+		return models.UnitsImperial
+	}
+	return models.UnitsMetric
+}
+
+// profileFromUser shows the stored metric measurements in the user's units
+func profileFromUser(user *models.User) *models.Profile {
+	heightCm := user.Height.Float64()
+	weightKg := user.Weight.Float64()
+
+	profile := &models.Profile{
+		ID:                  user.ID.Hex(),
+		FullName:            user.FullName,
+		PhoneNo:             user.PhoneNo,
+		Role:                models.NormalizeRole(user.Role),
+		Age:                 user.Age.Int(),
+		Sex:                 user.Sex,
+		Units:               profileUnits(user.Units),
+		Height:              heightCm,
+		HeightUnit:          "cm",
+		Weight:              weightKg,
+		WeightUnit:          "kg",
+		HeightCm:            heightCm,
+		WeightKg:            weightKg,
+		BMI:                 CalculateBMI(weightKg, heightCm),
+		ActivityLevel:       user.ActivityLevel,
+		WorkOutsPerWeek:     user.WorkOutsPerWeek,
+		HealthStatus:        user.HealthStatus,
+		HealthGoals:         nonNilStrings(user.HealthGoals),
+		DietaryPreferences:  nonNilStrings(user.DietaryPreferences),
+		NutritionPriorities: nonNilStrings(user.NutritionPriorities),
+		FoodAllergies:       nonNilStrings(user.FoodAllergies),
+		MissingFields:       missingProfileFields(user),
+		LegacyMeasurements:  user.LegacyMeasurements,
+	}
+	if profile.Units == models.UnitsImperial {
+		profile.Height = math.Round(heightCm/cmPerInch*10) / 10
+		profile.HeightUnit = "in"
+		profile.Weight = math.Round(weightKg/kgPerLb*10) / 10
+		profile.WeightUnit = "lb"
+	}
+	return profile
+}
+
+func nonNilStrings(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+var (
+	leadingNumber  = regexp.MustCompile(`^\s*(\d+(?:[.,]\d+)?)`)
+	feetAndInches  = regexp.MustCompile(`^\s*(\d+)\s*(?:'|ft|feet|foot)\s*(?:(\d+(?:\.\d+)?)\s*(?:"|''|in|inch|inches)?)?\s*$`)
+	heightWithUnit = regexp.MustCompile(`^\s*(\d+(?:[.,]\d+)?)\s*(cm|cms|m|mtr|in|inch|inches)?\s*$`)
+)
+
+// migrateProfileMeasurements converts age, height and weight stored as text
+// into numbers in years, cm and kg. Values that can't be read are moved to
+// legacyMeasurements so the profile asks for them again without losing the
+// original text.
+func migrateProfileMeasurements(ctx context.Context) error {
+	users := lib.DB.Database("amobagan").Collection("users")
+	cursor, err := users.Find(ctx, bson.M{"$or": []bson.M{
+		{"age": bson.M{"$type": "string"}},
+		{"height": bson.M{"$type": "string"}},
+		{"weight": bson.M{"$type": "string"}},
+	}})
+	if err != nil {
+		return fmt.Errorf("failed to find users with text measurements: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	migrated, kept := 0, 0
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID     primitive.ObjectID `bson:"_id"`
+			Age    interface{}        `bson:"age"`
+			Height interface{}        `bson:"height"`
+			Weight interface{}        `bson:"weight"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to decode user: %v", err)
+		}
+
+		set, unset := bson.M{}, bson.M{}
+		legacy := []struct {
+			field string
+			value interface{}
+			parse func(string) (float64, bool)
+		}{
+			{"age", doc.Age, parseLegacyAge},
+			{"height", doc.Height, parseLegacyHeight},
+			{"weight", doc.Weight, parseLegacyWeight},
+		}
+		for _, m := range legacy {
+			text, ok := m.value.(string)
+			if !ok {
+				continue
+			}
+			if value, ok := m.parse(text); ok {
+				set[m.field] = value
+			} else {
+				unset[m.field] = ""
+				if strings.TrimSpace(text) != "" {
+					set["legacyMeasurements."+m.field] = text
+					kept++
+					log.Printf("Kept unreadable %s %q of user %s in legacyMeasurements", m.field, text, doc.ID.Hex())
+				}
+			}
+		}
+
+		update := bson.M{}
+		if len(set) > 0 {
+			update["$set"] = set
+		}
+		if len(unset) > 0 {
+			update["$unset"] = unset
+		}
+		if _, err := users.UpdateOne(ctx, bson.M{"_id": doc.ID}, update); err != nil {
+			return fmt.Errorf("failed to convert measurements of user %s: %v", doc.ID.Hex(), err)
+		}
+		migrated++
+	}
+	if err := cursor.Err(); err != nil {
+		return fmt.Errorf("failed to iterate users: %v", err)
+	}
+
+	log.Printf("Converted text measurements of %d users, %d unreadable values kept in legacyMeasurements", migrated, kept)
+	return nil
+}
+
+// parseLegacyAge reads "25" or "25 years"
+func parseLegacyAge(text string) (float64, bool) {
+	m := leadingNumber.FindStringSubmatch(text)
+	if m == nil {
+		return 0, false
+	}
+	age, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+	if err != nil || age < minAge || age > maxAge {
+		return 0, false
+	}
+	return math.Round(age), true
+}
+
+// parseLegacyHeight reads centimetres, metres or feet and inches into cm. A
+// bare number is metres below 3 and centimetres otherwise.
+func parseLegacyHeight(text string) (float64, bool) {
+	text = strings.ToLower(text)
+	height := 0.0
+	if m := feetAndInches.FindStringSubmatch(text); m != nil {
+		feet, _ := strconv.ParseFloat(m[1], 64)
+		inches, _ := strconv.ParseFloat(m[2], 64)
+		height = (feet*12 + inches) * cmPerInch
+	} else if m := heightWithUnit.FindStringSubmatch(text); m != nil {
+		value, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+		if err != nil {
+			return 0, false
+		}
+		switch m[2] {
+		case "m", "mtr":
+			height = value * 100
+		case "in", "inch", "inches":
+			height = value * cmPerInch
+		case "":
+			if value < 3 {
+				height = value * 100
+			} else {
+				height = value
+			}
+		default:
+			height = value
+		}
+	} else {
+		return 0, false
+	}
+
+	if height < minHeightCm || height > maxHeightCm {
+		return 0, false
+	}
+	return math.Round(height*10) / 10, true
+}
+
+// parseLegacyWeight reads kilograms or a weight with a unit such as "154 lbs"
+func parseLegacyWeight(text string) (float64, bool) {
+	weight := 0.0
+	if q, err := units.Parse(text); err == nil && q.Dimension == units.Mass {
+		weight = q.Value / 1000
+	} else if value, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(text), ",", ".", 1), 64); err == nil {
+		weight = value
+	} else {
+		return 0, false
+	}
+
+	if weight < minWeightKg || weight > maxWeightKg {
+		return 0, false
+	}
+	return math.Round(weight*10) / 10, true
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"amobagan/models"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestValidateSignupProfile(t *testing.T) {
+	user := &models.User{
+		FullName:            "  User ",
+		PhoneNo:             "9876543210",
+		Password:            "secret1",
+		Age:                 30,
+		Units:               "Imperial",
+		Height:              70,
+		Weight:              154,
+		WorkOutsPerWeek:     "3-5",
+		HealthGoals:         []string{"Weight_Loss", "weight_loss"},
+		DietaryPreferences:  []string{},
+		NutritionPriorities: []string{"high_protein"},
+		FoodAllergies:       []string{"Peanuts"},
+	}
+	if err := ValidateSignupProfile(user); err != nil {
+		t.Fatalf("ValidateSignupProfile error: %v", err)
+	}
+
+	if user.FullName != "User" || user.PhoneNo != "9876543210" || user.Password != "secret1" {
+		t.Errorf("identity = %q %q %q, want it kept", user.FullName, user.PhoneNo, user.Password)
+	}
+	if user.Units != models.UnitsImperial || user.Height != 177.8 || user.Weight != 69.9 || user.Age != 30 {
+		t.Errorf("measurements = %s %v cm %v kg age %v, want imperial 177.8 cm 69.9 kg age 30", user.Units, user.Height, user.Weight, user.Age)
+	}
+	if !reflect.DeepEqual(user.HealthGoals, []string{models.WeightLoss}) {
+		t.Errorf("health goals = %v, want [%s]", user.HealthGoals, models.WeightLoss)
+	}
+	if user.Sex != "" || user.ActivityLevel != "" {
+		t.Errorf("sex %q activity %q, want both left empty", user.Sex, user.ActivityLevel)
+	}
+}
+
+func TestValidateSignupProfileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		user models.User
+	}{
+		{"too young", models.User{FullName: "User", Age: 3}},
+		{"unknown goal", models.User{FullName: "User", HealthGoals: []string{"foo"}}},
+		{"unknown diet", models.User{FullName: "User", DietaryPreferences: []string{"paleo"}}},
+		{"unknown workouts", models.User{FullName: "User", WorkOutsPerWeek: "daily"}},
+		{"too heavy in pounds", models.User{FullName: "User", Units: "imperial", Weight: 1200}},
+		{"blank name", models.User{FullName: "   "}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateSignupProfile(&tt.user); !errors.Is(err, ErrInvalidProfile) {
+				t.Errorf("ValidateSignupProfile error = %v, want ErrInvalidProfile", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"amobagan/models"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const promptTemplateDir = "llm_context"
+
+// ErrPromptNotFound is returned for names that aren't a known prompt template
+var ErrPromptNotFound = errors.New("prompt template not found")
+
+// promptTemplates are the templates the services read, by file name
+var promptTemplates = []struct {
+	name   string
+	usedBy []string
+}{
+	{"output.txt", []string{"nutrition analysis"}},
+	{"diet_plan.txt", []string{"diet plans", "weekly todos"}},
+}
+
+// ListPromptTemplates describes the prompt templates in use, without content
+func ListPromptTemplates() ([]models.PromptTemplate, error) {
+	templates := make([]models.PromptTemplate, 0, len(promptTemplates))
+	for _, t := range promptTemplates {
+		template, err := readPromptTemplate(t.name, t.usedBy)
+		if err != nil {
+			return nil, err
+		}
+		template.Content = ""
+		templates = append(templates, *template)
+	}
+	return templates, nil
+}
+
+// GetPromptTemplate returns a prompt template with its content
+func GetPromptTemplate(name string) (*models.PromptTemplate, error) {
+	for _, t := range promptTemplates {
+		if t.name == name {
+			return readPromptTemplate(t.name, t.usedBy)
+		}
+	}
+	return nil, ErrPromptNotFound
+}
+
+func readPromptTemplate(name string, usedBy []string) (*models.PromptTemplate, error) {
+	path := filepath.Join(promptTemplateDir, name)
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read prompt template %s: %v", name, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat prompt template %s: %v", name, err)
+	}
+	return &models.PromptTemplate{
+		Name:       name,
+		UsedBy:     usedBy,
+		Version:    TemplateVersion(string(content)),
+		Size:       len(content),
+		ModifiedAt: info.ModTime(),
+		Content:    string(content),
+	}, nil
+}
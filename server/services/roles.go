@@ -0,0 +1,105 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrUserNotFound is returned when support looks up a user that doesn't exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrOwnRole is returned when an admin tries to change their own role
+	ErrOwnRole = errors.New("you can't change your own role")
+)
+
+// FindUser returns a stored user without creating a profile for unknown IDs
+func FindUser(ctx context.Context, userID string) (*models.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	var user models.User
+	err = lib.DB.Database("amobagan").Collection("users").FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to find user: %v", err)
+	}
+	user.Role = models.NormalizeRole(user.Role)
+	return &user, nil
+}
+
+// SetUserRole changes a user's role. The user's sessions are revoked so no
+// token with the old role keeps working.
+func SetUserRole(ctx context.Context, actorID, userID, role string) (*models.User, error) {
+	if !models.ValidRole(role) {
+		return nil, fmt.Errorf("unknown role %q", role)
+	}
+	if actorID == userID {
+		return nil, ErrOwnRole
+	}
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	var user models.User
+	err = lib.DB.Database("amobagan").Collection("users").FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": objectID},
+		bson.M{"$set": bson.M{"role": role}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to update role: %v", err)
+	}
+
+	if _, err := GetSessionService().RevokeAll(ctx, userID, models.SessionRevokedRoleChange); err != nil {
+		log.Printf("Error revoking sessions of %s after role change: %v", userID, err)
+	}
+	log.Printf("User %s changed the role of %s to %s", actorID, userID, role)
+	return &user, nil
+}
+
+// PromoteAdmins gives the admin role to the users with the configured phone
+// numbers, so the first admin doesn't need another admin. Only verified
+// numbers count, so nobody can sign up with an admin's number first.
+func PromoteAdmins(ctx context.Context, phoneNumbers string) error {
+	phones := []string{}
+	for _, phone := range strings.Split(phoneNumbers, ",") {
+		if phone = strings.TrimSpace(phone); phone != "" {
+			phones = append(phones, phone)
+		}
+	}
+	if len(phones) == 0 {
+		return nil
+	}
+
+	result, err := lib.DB.Database("amobagan").Collection("users").UpdateMany(
+		ctx,
+		bson.M{"phoneNo": bson.M{"$in": phones}, "phoneVerified": true, "role": bson.M{"$ne": models.RoleAdmin}},
+		bson.M{"$set": bson.M{"role": models.RoleAdmin}},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to promote admins: %v", err)
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Promoted %d configured users to admin", result.ModifiedCount)
+	}
+	return nil
+}
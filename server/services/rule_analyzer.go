@@ -0,0 +1,460 @@
+package services
+
+import (
+	"amobagan/models"
+	"amobagan/utils"
+	"fmt"
+	"strings"
+)
+
+// Analysis engines selectable with ?engine=
+const (
+	AnalysisEngineLLM   = "llm"
+	AnalysisEngineRules = "rules"
+)
+
+// RuleBasedAnalyzer builds a NutritionAnalysis from the signals the extractor
+// already computed (risk levels, nutrient levels, consumption advice) without
+// calling an LLM. The same product and preferences always give the same result.
+type RuleBasedAnalyzer struct{}
+
+func NewRuleBasedAnalyzer() *RuleBasedAnalyzer {
+	return &RuleBasedAnalyzer{}
+}
+
+// ruleFinding is one signal the analyzer picked up, with its score impact
+type ruleFinding struct {
+	penalty     float64
+	aspect      string
+	concern     string
+	explanation string
+	impact      string
+}
+
+func (a *RuleBasedAnalyzer) Analyze(product *utils.ExtractedNutritionData, userPrefs *models.UserPreferences) *models.NutritionAnalysis {
+	if userPrefs == nil {
+		userPrefs = &models.UserPreferences{}
+	}
+	per100g := product.NutritionalInformation.Per100g
+	alerts := product.HealthRiskAssessment.MajorHealthAlerts
+	levels := product.HealthScoring.NutrientLevels
+
+	sugarWeight := goalWeight(userPrefs, models.Diabetes, models.SugarControl, models.LowSugar, models.LowSugarPriority)
+	fatWeight := goalWeight(userPrefs, models.HeartHealth, models.LowFat)
+	saltWeight := goalWeight(userPrefs, models.HeartHealth, models.LowSodiumDiet, models.LowSodium, models.LowSodiumPriority)
+	calorieWeight := goalWeight(userPrefs, models.WeightLoss)
+
+	var negatives []ruleFinding
+	if p := riskPenalty(alerts.DiabetesRisk.Level) * sugarWeight; p > 0 {
+		negatives = append(negatives, ruleFinding{
+			penalty:     p,
+			aspect:      fmt.Sprintf("%s sugar content (%.1fg per 100g)", capitalize(alerts.DiabetesRisk.Level), per100g.Sugars),
+			concern:     "Sugar content",
+			explanation: fmt.Sprintf("Contains %.1fg of sugar per 100g, rated %s for blood sugar impact", per100g.Sugars, alerts.DiabetesRisk.Level),
+			impact:      "Frequent intake can spike blood sugar and add empty calories",
+		})
+	}
+	if p := riskPenalty(alerts.CardiovascularRisk.Level) * fatWeight; p > 0 {
+		negatives = append(negatives, ruleFinding{
+			penalty:     p,
+			aspect:      fmt.Sprintf("%s saturated fat (%.1fg per 100g)", capitalize(alerts.CardiovascularRisk.Level), per100g.SaturatedFat),
+			concern:     "Saturated fat",
+			explanation: fmt.Sprintf("Contains %.1fg of saturated fat per 100g", per100g.SaturatedFat),
+			impact:      "Regular intake can raise LDL cholesterol and cardiovascular risk",
+		})
+	}
+	if p := riskPenalty(alerts.ObesityRisk.Level) * calorieWeight; p > 0 {
+		negatives = append(negatives, ruleFinding{
+			penalty:     p,
+			aspect:      fmt.Sprintf("%s calorie density (%.0f kcal per 100g)", capitalize(alerts.ObesityRisk.Level), per100g.EnergyKcal),
+			concern:     "Calorie density",
+			explanation: fmt.Sprintf("Provides %.0f kcal per 100g", per100g.EnergyKcal),
+			impact:      "Easy to overeat, which makes weight management harder",
+		})
+	}
+	if p := levelPenalty(levels.Salt) * saltWeight; p > 0 {
+		negatives = append(negatives, ruleFinding{
+			penalty:     p,
+			aspect:      fmt.Sprintf("%s salt (%.2fg per 100g)", capitalize(levels.Salt), per100g.Salt),
+			concern:     "Salt content",
+			explanation: fmt.Sprintf("Contains %.2fg of salt per 100g, rated %s", per100g.Salt, levels.Salt),
+			impact:      "High sodium intake is linked to raised blood pressure",
+		})
+	}
+	if product.ProcessingClassification.NovaGroup == "4" {
+		negatives = append(negatives, ruleFinding{
+			penalty:     10 * goalWeight(userPrefs, models.CleanEating, models.NaturalIngredients, models.NoAdditives),
+			aspect:      "Ultra-processed food (NOVA 4)",
+			concern:     "Ultra-processing",
+			explanation: "Classified as NOVA group 4, made largely from industrial ingredients",
+			impact:      "Diets high in ultra-processed foods are associated with poorer health outcomes",
+		})
+	}
+
+	if f, ok := additiveFinding(product, userPrefs); ok {
+		negatives = append(negatives, f)
+	}
+
+	var positives []string
+	score := 100.0
+	for _, f := range negatives {
+		score -= f.penalty
+	}
+
+	if per100g.Fiber != nil && *per100g.Fiber >= 3 {
+		bonus := 5.0
+		if *per100g.Fiber >= 6 {
+			bonus = 10
+		}
+		score += bonus * goalWeight(userPrefs, models.HighFiber)
+		positives = append(positives, fmt.Sprintf("Good source of fiber (%.1fg per 100g)", *per100g.Fiber))
+	}
+	if per100g.Proteins >= 10 {
+		bonus := 5.0
+		if per100g.Proteins >= 20 {
+			bonus = 10
+		}
+		score += bonus * goalWeight(userPrefs, models.MuscleGain, models.HighProtein)
+		positives = append(positives, fmt.Sprintf("Good source of protein (%.1fg per 100g)", per100g.Proteins))
+	}
+	if alerts.DiabetesRisk.Level == "low" {
+		positives = append(positives, "Low in sugar")
+	}
+	if alerts.CardiovascularRisk.Level == "low" {
+		positives = append(positives, "Low in saturated fat")
+	}
+	if levels.Salt == "low" {
+		positives = append(positives, "Low in salt")
+	}
+	if product.IngredientsAndAdditives.Additives.AdditivesStatus == "none_detected" {
+		positives = append(positives, "No additives detected")
+	}
+
+	switch strings.ToLower(product.HealthScoring.Nutriscore.Grade) {
+	case "a":
+		score += 10
+	case "b":
+		score += 5
+	case "d":
+		score -= 5
+	case "e":
+		score -= 10
+	}
+
+	grade := gradeFromScore(score)
+
+	analysis := &models.NutritionAnalysis{
+		ProductName: product.ProductIdentification.ProductName,
+		InstantHealthRating: models.InstantHealthRating{
+			Grade:           grade,
+			Recommendation:  recommendationForGrade(grade, product.ConsumptionRecommendations.FrequencyRecommendation),
+			PositiveAspects: positives,
+			NegativeAspects: make([]string, 0, len(negatives)),
+			FSSAIVerified:   false,
+		},
+		KeyHealthConcerns:   make([]models.HealthConcern, 0, len(negatives)),
+		SmarterAlternatives: ruleAlternatives(negatives),
+		PersonalizedCallout: ruleCallout(userPrefs, grade, negatives),
+		DetailedNutritionBreakdown: &models.DetailedBreakdown{
+			ServingSize:         product.NutritionalInformation.PerServing.ServingSize,
+			Nutrients:           ruleNutrientDetails(product),
+			Additives:           additiveLabels(product),
+			GoalSpecificMetrics: ruleGoalMetrics(product, userPrefs),
+		},
+	}
+	if analysis.InstantHealthRating.PositiveAspects == nil {
+		analysis.InstantHealthRating.PositiveAspects = []string{}
+	}
+	for _, f := range negatives {
+		analysis.InstantHealthRating.NegativeAspects = append(analysis.InstantHealthRating.NegativeAspects, f.aspect)
+		analysis.KeyHealthConcerns = append(analysis.KeyHealthConcerns, models.HealthConcern{
+			Concern:     f.concern,
+			Explanation: f.explanation,
+			Impact:      f.impact,
+		})
+	}
+
+	return analysis
+}
+
+// additiveFinding flags high-risk additives for everyone and any additive at
+// all for users who asked for additive-free food
+func additiveFinding(product *utils.ExtractedNutritionData, userPrefs *models.UserPreferences) (ruleFinding, bool) {
+	detected := product.IngredientsAndAdditives.Additives.DetectedAdditives
+	avoidAll := goalWeight(userPrefs, models.NoAdditives) > 1
+
+	var flagged []string
+	penalty := 0.0
+	for _, a := range detected {
+		switch {
+		case a.RiskTier == utils.AdditiveRiskHigh:
+			penalty += 10
+		case avoidAll && a.RiskTier == utils.AdditiveRiskModerate:
+			penalty += 5
+		case avoidAll:
+			penalty += 2
+		default:
+			continue
+		}
+		flagged = append(flagged, additiveLabel(a))
+	}
+	if len(flagged) == 0 {
+		return ruleFinding{}, false
+	}
+
+	return ruleFinding{
+		penalty:     min(penalty, 25),
+		aspect:      fmt.Sprintf("Contains additives: %s", strings.Join(flagged, ", ")),
+		concern:     "Additives",
+		explanation: fmt.Sprintf("Ingredient list includes %s", strings.Join(flagged, ", ")),
+		impact:      "Some additives are linked to health concerns and signal a highly processed product",
+	}, true
+}
+
+func additiveLabels(product *utils.ExtractedNutritionData) []string {
+	var labels []string
+	for _, a := range product.IngredientsAndAdditives.Additives.DetectedAdditives {
+		labels = append(labels, additiveLabel(a))
+	}
+	return labels
+}
+
+func additiveLabel(a utils.DetectedAdditive) string {
+	if a.Name == "" {
+		return a.Code
+	}
+	return fmt.Sprintf("%s (%s)", a.Name, a.Code)
+}
+
+// goalWeight amplifies a signal when the user cares about any of the given keys
+func goalWeight(userPrefs *models.UserPreferences, keys ...string) float64 {
+	for _, list := range [][]string{userPrefs.HealthGoals, userPrefs.DietaryPreferences, userPrefs.NutritionPriorities} {
+		for _, v := range list {
+			for _, k := range keys {
+				if v == k {
+					return 1.5
+				}
+			}
+		}
+	}
+	return 1
+}
+
+func riskPenalty(level string) float64 {
+	switch level {
+	case "critical":
+		return 30
+	case "high":
+		return 20
+	case "moderate":
+		return 10
+	default:
+		return 0
+	}
+}
+
+func levelPenalty(level string) float64 {
+	switch level {
+	case "high":
+		return 15
+	case "moderate":
+		return 5
+	default:
+		return 0
+	}
+}
+
+func gradeFromScore(score float64) string {
+	switch {
+	case score >= 85:
+		return "A"
+	case score >= 70:
+		return "B"
+	case score >= 55:
+		return "C"
+	case score >= 40:
+		return "D"
+	default:
+		return "E"
+	}
+}
+
+func recommendationForGrade(grade, frequency string) string {
+	var base string
+	switch grade {
+	case "A":
+		base = "A good everyday choice"
+	case "B":
+		base = "A reasonable choice in normal portions"
+	case "C":
+		base = "Fine in moderation"
+	case "D":
+		base = "Enjoy occasionally and in small portions"
+	default:
+		base = "Best avoided or kept for rare treats"
+	}
+	if frequency != "" {
+		base += fmt.Sprintf(" (suggested frequency: %s)", strings.ReplaceAll(frequency, "_", " "))
+	}
+	return base
+}
+
+func ruleAlternatives(negatives []ruleFinding) []models.Alternative {
+	alternatives := []models.Alternative{}
+	for _, f := range negatives {
+		switch f.concern {
+		case "Sugar content":
+			alternatives = append(alternatives, models.Alternative{
+				Name:        "Unsweetened or no-added-sugar version",
+				Benefits:    []string{"Less sugar", "Steadier energy"},
+				WhyBetter:   "Cuts the sugar load without giving up the product type",
+				KeyFeatures: []string{"No added sugar"},
+			})
+		case "Saturated fat":
+			alternatives = append(alternatives, models.Alternative{
+				Name:        "Option made with unsaturated oils",
+				Benefits:    []string{"Less saturated fat", "Better for heart health"},
+				WhyBetter:   "Swaps palm oil or butter for healthier fats",
+				KeyFeatures: []string{"Low saturated fat"},
+			})
+		case "Salt content":
+			alternatives = append(alternatives, models.Alternative{
+				Name:        "Low-sodium version",
+				Benefits:    []string{"Less salt", "Supports healthy blood pressure"},
+				WhyBetter:   "Keeps the flavour with a fraction of the sodium",
+				KeyFeatures: []string{"Reduced salt"},
+			})
+		case "Additives":
+			alternatives = append(alternatives, models.Alternative{
+				Name:        "Additive-free version",
+				Benefits:    []string{"No artificial additives", "Cleaner ingredient list"},
+				WhyBetter:   "Same food without colours, sweeteners or emulsifiers",
+				KeyFeatures: []string{"Short ingredient list"},
+			})
+		case "Ultra-processing":
+			alternatives = append(alternatives, models.Alternative{
+				Name:        "Minimally processed whole-food option",
+				Benefits:    []string{"Fewer additives", "More natural nutrients"},
+				WhyBetter:   "Short ingredient lists made from recognisable foods",
+				KeyFeatures: []string{"Whole ingredients"},
+			})
+		}
+	}
+	return alternatives
+}
+
+func ruleCallout(userPrefs *models.UserPreferences, grade string, negatives []ruleFinding) models.PersonalizedCallout {
+	name := userPrefs.UserName
+	if name == "" {
+		name = "there"
+	}
+
+	explanation := "Nothing in this product stands out as a concern for your goals."
+	if len(negatives) > 0 {
+		concerns := make([]string, 0, len(negatives))
+		for _, f := range negatives {
+			concerns = append(concerns, strings.ToLower(f.concern))
+		}
+		explanation = fmt.Sprintf("The main things to watch here are %s.", strings.Join(concerns, ", "))
+	}
+
+	encouragement := "Keep pairing it with whole foods for a balanced diet."
+	if grade == "D" || grade == "E" {
+		encouragement = "Try one of the alternatives below next time you shop."
+	}
+
+	return models.PersonalizedCallout{
+		Greeting:          fmt.Sprintf("Hi %s!", name),
+		Acknowledgment:    "Thanks for checking before you eat.",
+		Explanation:       explanation,
+		Encouragement:     encouragement,
+		MotivationalClose: "Small swaps add up!",
+	}
+}
+
+func ruleNutrientDetails(product *utils.ExtractedNutritionData) []models.NutrientDetail {
+	per100g := product.NutritionalInformation.Per100g
+	levels := product.HealthScoring.NutrientLevels
+	dv := product.ConsumptionRecommendations.DailyValuePercentages
+
+	nutrients := []models.NutrientDetail{
+		{Nutrient: "Energy", Amount: fmt.Sprintf("%.0f kcal", per100g.EnergyKcal), Assessment: product.HealthRiskAssessment.MajorHealthAlerts.ObesityRisk.Level, DailyValue: dv.CaloriesPerServing},
+		{Nutrient: "Sugars", Amount: fmt.Sprintf("%.1f g", per100g.Sugars), Assessment: levels.Sugars, DailyValue: dv.SugarsPerServing},
+		{Nutrient: "Total Fat", Amount: fmt.Sprintf("%.1f g", per100g.FatTotal), Assessment: levels.Fat},
+		{Nutrient: "Saturated Fat", Amount: fmt.Sprintf("%.1f g", per100g.SaturatedFat), Assessment: levels.SaturatedFat, DailyValue: dv.SaturatedFatPerServing},
+		{Nutrient: "Salt", Amount: fmt.Sprintf("%.2f g", per100g.Salt), Assessment: levels.Salt, DailyValue: dv.SaltPerServing},
+		{Nutrient: "Protein", Amount: fmt.Sprintf("%.1f g", per100g.Proteins)},
+	}
+	if per100g.Fiber != nil {
+		nutrients = append(nutrients, models.NutrientDetail{Nutrient: "Fiber", Amount: fmt.Sprintf("%.1f g", *per100g.Fiber)})
+	}
+	return nutrients
+}
+
+func ruleGoalMetrics(product *utils.ExtractedNutritionData, userPrefs *models.UserPreferences) *models.GoalSpecificMetrics {
+	per100g := product.NutritionalInformation.Per100g
+	alerts := product.HealthRiskAssessment.MajorHealthAlerts
+	warnings := product.HealthRiskAssessment.PopulationSpecificWarnings
+	metrics := &models.GoalSpecificMetrics{}
+	found := false
+
+	for _, goal := range userPrefs.HealthGoals {
+		switch goal {
+		case models.WeightLoss:
+			satiety := "low"
+			if per100g.Proteins >= 10 || (per100g.Fiber != nil && *per100g.Fiber >= 6) {
+				satiety = "high"
+			} else if per100g.Proteins >= 5 || (per100g.Fiber != nil && *per100g.Fiber >= 3) {
+				satiety = "moderate"
+			}
+			metrics.WeightLossMetrics = &models.WeightLossMetrics{
+				CaloricDensity:   alerts.ObesityRisk.Level,
+				SatietyIndex:     satiety,
+				CravingPotential: alerts.DiabetesRisk.Level,
+				PortionControl:   strings.ReplaceAll(warnings.WeightManagement, "_", " "),
+			}
+			found = true
+		case models.MuscleGain:
+			quality := "low"
+			if per100g.Proteins >= 20 {
+				quality = "high"
+			} else if per100g.Proteins >= 10 {
+				quality = "moderate"
+			}
+			metrics.MuscleGainMetrics = &models.MuscleGainMetrics{
+				ProteinQuality:     quality,
+				ProteinAmount:      fmt.Sprintf("%.1fg per 100g", per100g.Proteins),
+				CaloricAdequacy:    alerts.ObesityRisk.Level,
+				TimingOptimization: "pair with a protein-rich meal",
+			}
+			found = true
+		case models.HeartHealth:
+			metrics.HeartHealthMetrics = &models.HeartHealthMetrics{
+				CardiovascularRisk: alerts.CardiovascularRisk.Level,
+				SaturatedFatLevel:  product.HealthScoring.NutrientLevels.SaturatedFat,
+				SodiumImpact:       product.HealthScoring.NutrientLevels.Salt,
+			}
+			found = true
+		case models.Diabetes, models.SugarControl:
+			metrics.DiabetesMetrics = &models.DiabetesMetrics{
+				GlycemicIndex:       "unknown",
+				SugarImpact:         alerts.DiabetesRisk.Level,
+				CarbohydrateCount:   fmt.Sprintf("%.1fg per 100g", per100g.Carbohydrates),
+				BloodSugarStability: strings.ReplaceAll(warnings.Diabetics, "_", " "),
+			}
+			found = true
+		}
+	}
+
+	if !found {
+		return nil
+	}
+	return metrics
+}
+
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrScanNotFound is returned when a history entry doesn't exist or belongs to another user
+var ErrScanNotFound = errors.New("scan history entry not found")
+
+const (
+	defaultScanHistoryLimit = 20
+	maxScanHistoryLimit     = 100
+)
+
+// ScanHistoryService keeps one entry per product a user has scanned
+type ScanHistoryService struct {
+	collection *mongo.Collection
+}
+
+func NewScanHistoryService() *ScanHistoryService {
+	service := &ScanHistoryService{}
+	if lib.DB != nil {
+		service.collection = lib.DB.Database("amobagan").Collection("scan_history")
+		service.ensureIndexes()
+	}
+	return service
+}
+
+// Record upserts the user's entry for the product. A streamed analysis is
+// kept as its markdown and the grade read from it, without a structured
+// analysis. Otherwise a nil analysis only bumps the scan count and product
+// details and keeps the previous verdict.
+func (s *ScanHistoryService) Record(
+	ctx context.Context,
+	userID string,
+	product *utils.ExtractedNutritionData,
+	analysis *models.NutritionAnalysis,
+	prefs *models.UserPreferences,
+	source string,
+	streamedText string,
+) (*models.ScanHistoryEntry, error) {
+	if s.collection == nil {
+		return nil, fmt.Errorf("scan history is not available")
+	}
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+
+	now := time.Now()
+	id := product.ProductIdentification
+	set := bson.M{
+		"product_name":    id.ProductName,
+		"brand":           id.Brand,
+		"image_url":       product.ProductImages.FrontImage.Medium,
+		"source":          source,
+		"last_scanned_at": now,
+	}
+	unset := bson.M{}
+	switch {
+	case streamedText != "":
+		// Only the grade the user read is kept, never a verdict they didn't see
+		if grade := streamedGrade(streamedText); grade != "" {
+			set["grade"] = grade
+		} else {
+			unset["grade"] = ""
+		}
+		unset["analysis"] = ""
+		set["preferences"] = prefs
+		set["streamed_text"] = streamedText
+		set["analyzed_at"] = now
+	case analysis != nil:
+		snapshot := *analysis
+		set["analysis"] = &snapshot
+		set["grade"] = strings.ToUpper(analysis.InstantHealthRating.Grade)
+		set["preferences"] = prefs
+		unset["streamed_text"] = ""
+		set["analyzed_at"] = now
+	}
+	update := bson.M{
+		"$set":         set,
+		"$inc":         bson.M{"scan_count": 1},
+		"$setOnInsert": bson.M{"first_scanned_at": now, "favorite": false},
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var entry models.ScanHistoryEntry
+	err = s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{"user_id": userObjectID, "barcode": id.Barcode},
+		update,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&entry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record scan: %v", err)
+	}
+	return &entry, nil
+}
+
+// RecordAsync records a scan without holding up the response; failures are only logged
+func (s *ScanHistoryService) RecordAsync(
+	userID string,
+	product *utils.ExtractedNutritionData,
+	analysis *models.NutritionAnalysis,
+	prefs *models.UserPreferences,
+	source string,
+	streamedText string,
+) {
+	if userID == "" || product == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if _, err := s.Record(ctx, userID, product, analysis, prefs, source, streamedText); err != nil {
+			log.Printf("Error recording scan history: %v", err)
+		}
+	}()
+}
+
+// List returns a page of the user's entries, most recently scanned first
+func (s *ScanHistoryService) List(ctx context.Context, userID string, filter models.ScanHistoryFilter) (*models.ScanHistoryPage, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.Limit < 1 {
+		filter.Limit = defaultScanHistoryLimit
+	}
+	filter.Limit = min(filter.Limit, maxScanHistoryLimit)
+
+	query := bson.M{"user_id": userObjectID}
+	if len(filter.Grades) > 0 {
+		query["grade"] = bson.M{"$in": filter.Grades}
+	}
+	if filter.FavoriteOnly {
+		query["favorite"] = true
+	}
+
+	total, err := s.collection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count scan history: %v", err)
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "last_scanned_at", Value: -1}}).
+		SetSkip(int64((filter.Page - 1) * filter.Limit)).
+		SetLimit(int64(filter.Limit)).
+		SetProjection(bson.M{"streamed_text": 0})
+	cursor, err := s.collection.Find(ctx, query, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch scan history: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	items := []models.ScanHistoryEntry{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, fmt.Errorf("failed to decode scan history: %v", err)
+	}
+
+	return &models.ScanHistoryPage{Items: items, Page: filter.Page, Limit: filter.Limit, Total: total}, nil
+}
+
+// Get returns one of the user's entries
+func (s *ScanHistoryService) Get(ctx context.Context, userID, entryID string) (*models.ScanHistoryEntry, error) {
+	filter, err := scanEntryFilter(userID, entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry models.ScanHistoryEntry
+	if err := s.collection.FindOne(ctx, filter).Decode(&entry); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrScanNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch scan history entry: %v", err)
+	}
+	return &entry, nil
+}
+
+// SetFavorite stars or unstars an entry
+func (s *ScanHistoryService) SetFavorite(ctx context.Context, userID, entryID string, favorite bool) (*models.ScanHistoryEntry, error) {
+	filter, err := scanEntryFilter(userID, entryID)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry models.ScanHistoryEntry
+	err = s.collection.FindOneAndUpdate(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"favorite": favorite}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&entry)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrScanNotFound
+		}
+		return nil, fmt.Errorf("failed to update favourite: %v", err)
+	}
+	return &entry, nil
+}
+
+// Delete removes an entry
+func (s *ScanHistoryService) Delete(ctx context.Context, userID, entryID string) error {
+	filter, err := scanEntryFilter(userID, entryID)
+	if err != nil {
+		return err
+	}
+
+	result, err := s.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("failed to delete scan history entry: %v", err)
+	}
+	if result.DeletedCount == 0 {
+		return ErrScanNotFound
+	}
+	return nil
+}
+
+// streamedGradePattern finds the grade in a streamed analysis, e.g.
+// "**Grade: D**" or "Grade - **b**"
+var streamedGradePattern = regexp.MustCompile(`(?i)\bgrade\b[\s:*_-]*([a-e])\b`)
+
+// streamedGrade reads the grade a streamed analysis gave, preferring the
+// Instant Health Rating section. It returns "" when there is none.
+func streamedGrade(text string) string {
+	if i := strings.Index(text, "Instant Health Rating"); i >= 0 {
+		text = text[i:]
+	}
+	m := streamedGradePattern.FindStringSubmatch(text)
+	if m == nil {
+		return ""
+	}
+	return strings.ToUpper(m[1])
+}
+
+// CompareAnalyses describes how a fresh analysis differs from the stored entry.
+// Concerns are only compared when the entry has a structured analysis, and the
+// grade only when the entry has one.
+func CompareAnalyses(previous *models.ScanHistoryEntry, current *models.NutritionAnalysis) *models.ReanalysisResult {
+	result := &models.ReanalysisResult{
+		PreviousGrade:         previous.Grade,
+		CurrentGrade:          strings.ToUpper(current.InstantHealthRating.Grade),
+		PreviousAnalyzedAt:    previous.AnalyzedAt,
+		CurrentRecommendation: current.InstantHealthRating.Recommendation,
+		NewConcerns:           []string{},
+		ResolvedConcerns:      []string{},
+	}
+	result.GradeChanged = result.PreviousGrade != "" && result.PreviousGrade != result.CurrentGrade
+
+	if previous.Analysis == nil {
+		return result
+	}
+	result.PreviousRecommendation = previous.Analysis.InstantHealthRating.Recommendation
+	before := map[string]bool{}
+	for _, c := range previous.Analysis.KeyHealthConcerns {
+		before[c.Concern] = true
+	}
+	after := map[string]bool{}
+	for _, c := range current.KeyHealthConcerns {
+		after[c.Concern] = true
+		if !before[c.Concern] {
+			result.NewConcerns = append(result.NewConcerns, c.Concern)
+		}
+	}
+	for _, c := range previous.Analysis.KeyHealthConcerns {
+		if !after[c.Concern] {
+			result.ResolvedConcerns = append(result.ResolvedConcerns, c.Concern)
+		}
+	}
+	return result
+}
+
+// PreferencesFromUser builds analysis preferences from the user's stored profile
+func PreferencesFromUser(user *models.User) *models.UserPreferences {
+	return &models.UserPreferences{
+		HealthGoals:         user.HealthGoals,
+		DietaryPreferences:  user.DietaryPreferences,
+		NutritionPriorities: user.NutritionPriorities,
+		FoodAllergies:       user.FoodAllergies,
+		UserName:            user.FullName,
+	}
+}
+
+func scanEntryFilter(userID, entryID string) (bson.M, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+	entryObjectID, err := primitive.ObjectIDFromHex(entryID)
+	if err != nil {
+		return nil, ErrScanNotFound
+	}
+	return bson.M{"_id": entryObjectID, "user_id": userObjectID}, nil
+}
+
+func (s *ScanHistoryService) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "barcode", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_scanned_at", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("Failed to create scan history indexes: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"amobagan/models"
+	"os"
+	"testing"
+)
+
+func TestStreamedGrade(t *testing.T) {
+	fixture, err := os.ReadFile(llmFixturesDir + "/nutrition_analysis.stream.txt")
+	if err != nil {
+		t.Fatalf("ReadFile error: %v", err)
+	}
+	tests := []struct {
+		text string
+		want string
+	}{
+		{string(fixture), "D"},
+		{"## 🏥 Instant Health Rating\nGrade: **b** - a good pick", "B"},
+		{"Nutri-Score grade E on the pack.\n## 🏥 Instant Health Rating\n**Grade: C**", "C"},
+		{"## 🏥 Instant Health Rating\nA decent snack", ""},
+		{"Upgrade your breakfast", ""},
+	}
+	for _, tt := range tests {
+		if got := streamedGrade(tt.text); got != tt.want {
+			t.Errorf("streamedGrade(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCompareAnalyses(t *testing.T) {
+	current := &models.NutritionAnalysis{
+		InstantHealthRating: models.InstantHealthRating{Grade: "c", Recommendation: "Fine now and then"},
+		KeyHealthConcerns:   []models.HealthConcern{{Concern: "High sugar"}, {Concern: "Low fiber"}},
+	}
+	tests := []struct {
+		name     string
+		previous *models.ScanHistoryEntry
+		changed  bool
+		newOnes  int
+		resolved int
+	}{
+		{
+			name: "structured analysis",
+			previous: &models.ScanHistoryEntry{Grade: "D", Analysis: &models.NutritionAnalysis{
+				KeyHealthConcerns: []models.HealthConcern{{Concern: "High sugar"}, {Concern: "Palm oil"}},
+			}},
+			changed: true, newOnes: 1, resolved: 1,
+		},
+		{
+			name:     "streamed with the same grade",
+			previous: &models.ScanHistoryEntry{Grade: "C", StreamedText: "**Grade: C**"},
+		},
+		{
+			name:     "streamed without a grade",
+			previous: &models.ScanHistoryEntry{StreamedText: "A decent snack"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompareAnalyses(tt.previous, current)
+			if got.CurrentGrade != "C" || got.GradeChanged != tt.changed {
+				t.Errorf("grade %q -> %q changed %v, want changed %v", got.PreviousGrade, got.CurrentGrade, got.GradeChanged, tt.changed)
+			}
+			if len(got.NewConcerns) != tt.newOnes || len(got.ResolvedConcerns) != tt.resolved {
+				t.Errorf("new %v resolved %v, want %d and %d", got.NewConcerns, got.ResolvedConcerns, tt.newOnes, tt.resolved)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package services
+
+import (
+	"amobagan/config"
+	"amobagan/lib"
+	"amobagan/models"
+	"amobagan/utils"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrInvalidRefreshToken is returned for unknown, expired or revoked refresh tokens
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token
+	// comes back; the session is revoked since the token was likely stolen
+	ErrRefreshTokenReused = errors.New("refresh token was already used, session revoked")
+	// ErrSessionNotFound is returned when a session doesn't exist or belongs to another user
+	ErrSessionNotFound = errors.New("session not found")
+)
+
+// sessionCheckInterval is how long an active session is trusted before the
+// revocation check goes back to the database. Revocations made by this
+// instance apply immediately.
+const sessionCheckInterval = 30 * time.Second
+
+// maxSessionStatuses bounds the revocation cache
+const maxSessionStatuses = 10000
+
+type sessionStatus struct {
+	revoked bool
+	until   time.Time
+}
+
+// SessionService issues and rotates refresh tokens and keeps track of which
+// sessions were signed out. It is the token denylist for access tokens.
+type SessionService struct {
+	collection      *mongo.Collection
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+
+	mu       sync.Mutex
+	statuses map[string]sessionStatus
+}
+
+var (
+	sessionService     *SessionService
+	sessionServiceOnce sync.Once
+)
+
+// GetSessionService returns the shared session service so every caller sees
+// the same revocation cache
+func GetSessionService() *SessionService {
+	sessionServiceOnce.Do(func() {
+		cfg := config.LoadConfig()
+		sessionService = &SessionService{
+			collection:      lib.DB.Database("amobagan").Collection("sessions"),
+			accessTokenTTL:  cfg.AccessTokenTTL,
+			refreshTokenTTL: cfg.RefreshTokenTTL,
+			statuses:        make(map[string]sessionStatus),
+		}
+		sessionService.ensureIndexes()
+	})
+	return sessionService
+}
+
+// Start opens a session for a user who just signed in
+func (s *SessionService) Start(ctx context.Context, user models.User, device models.SessionDevice) (*models.TokenPair, error) {
+	refreshToken, hash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		UserID:           user.ID,
+		RefreshTokenHash: hash,
+		DeviceName:       device.Name,
+		UserAgent:        device.UserAgent,
+		IPAddress:        device.IPAddress,
+		CreatedAt:        now,
+		LastUsedAt:       now,
+		ExpiresAt:        now.Add(s.refreshTokenTTL),
+	}
+	result, err := s.collection.InsertOne(ctx, session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %v", err)
+	}
+	session.ID = result.InsertedID.(primitive.ObjectID)
+
+	return s.tokenPair(user, session.ID.Hex(), refreshToken)
+}
+
+// Refresh rotates a refresh token: the old one stops working and a new pair
+// is returned. Replaying a rotated token revokes the whole session.
+func (s *SessionService) Refresh(ctx context.Context, refreshToken string, device models.SessionDevice) (*models.TokenPair, error) {
+	hash := hashRefreshToken(refreshToken)
+	newToken, newHash, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	set := bson.M{
+		"refresh_token_hash":  newHash,
+		"previous_token_hash": hash,
+		"last_used_at":        now,
+		"expires_at":          now.Add(s.refreshTokenTTL),
+		"ip_address":          device.IPAddress,
+	}
+	if device.UserAgent != "" {
+		set["user_agent"] = device.UserAgent
+	}
+	if device.Name != "" {
+		set["device_name"] = device.Name
+	}
+
+	var session models.Session
+	err = s.collection.FindOneAndUpdate(
+		ctx,
+		bson.M{
+			"refresh_token_hash": hash,
+			"revoked_at":         bson.M{"$exists": false},
+			"expires_at":         bson.M{"$gt": now},
+		},
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&session)
+	if err == mongo.ErrNoDocuments {
+		return nil, s.detectReuse(ctx, hash)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to refresh session: %v", err)
+	}
+
+	var user models.User
+	if err := lib.DB.Database("amobagan").Collection("users").FindOne(ctx, bson.M{"_id": session.UserID}).Decode(&user); err != nil {
+		if err == mongo.ErrNoDocuments {
+			s.revoke(ctx, bson.M{"_id": session.ID}, models.SessionRevokedNoAccount)
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to load session user: %v", err)
+	}
+
+	return s.tokenPair(user, session.ID.Hex(), newToken)
+}
+
+// detectReuse revokes the session a rotated refresh token belonged to
+func (s *SessionService) detectReuse(ctx context.Context, hash string) error {
+	revoked, err := s.revoke(ctx, bson.M{"previous_token_hash": hash}, models.SessionRevokedReuse)
+	if err != nil {
+		return fmt.Errorf("failed to check refresh token reuse: %v", err)
+	}
+	if revoked > 0 {
+		log.Printf("Rotated refresh token was replayed, revoked its session")
+		return ErrRefreshTokenReused
+	}
+	return ErrInvalidRefreshToken
+}
+
+// List returns the user's active sessions, most recently used first
+func (s *SessionService) List(ctx context.Context, userID, currentSessionID string) ([]models.Session, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+
+	cursor, err := s.collection.Find(
+		ctx,
+		bson.M{
+			"user_id":    userObjectID,
+			"revoked_at": bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": time.Now()},
+		},
+		options.Find().SetSort(bson.D{{Key: "last_used_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, fmt.Errorf("failed to decode sessions: %v", err)
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID.Hex() == currentSessionID
+	}
+	return sessions, nil
+}
+
+// Revoke signs one of the user's sessions out
+func (s *SessionService) Revoke(ctx context.Context, userID, sessionID, reason string) error {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID: %v", err)
+	}
+	sessionObjectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return ErrSessionNotFound
+	}
+
+	revoked, err := s.revoke(ctx, bson.M{"_id": sessionObjectID, "user_id": userObjectID}, reason)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+	if revoked == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll signs the user out on every device and returns how many sessions ended
+func (s *SessionService) RevokeAll(ctx context.Context, userID, reason string) (int, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return 0, fmt.Errorf("invalid user ID: %v", err)
+	}
+
+	revoked, err := s.revoke(ctx, bson.M{"user_id": userObjectID}, reason)
+	if err != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %v", err)
+	}
+	return revoked, nil
+}
+
+// IsRevoked reports whether access tokens of the session must be refused.
+// Unknown sessions and lookup failures count as revoked.
+func (s *SessionService) IsRevoked(ctx context.Context, sessionID string) bool {
+	now := time.Now()
+	s.mu.Lock()
+	status, ok := s.statuses[sessionID]
+	s.mu.Unlock()
+	if ok && now.Before(status.until) {
+		return status.revoked
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		return true
+	}
+	var session models.Session
+	err = s.collection.FindOne(ctx, bson.M{"_id": objectID}, options.FindOne().SetProjection(bson.M{"revoked_at": 1, "expires_at": 1})).Decode(&session)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Printf("Error checking session %s: %v", sessionID, err)
+			return true
+		}
+		s.remember(sessionID, true, now.Add(s.accessTokenTTL))
+		return true
+	}
+
+	revoked := session.RevokedAt != nil || !session.ExpiresAt.After(now)
+	if revoked {
+		// Access tokens of the session expire within one lifetime
+		s.remember(sessionID, true, now.Add(s.accessTokenTTL))
+	} else {
+		s.remember(sessionID, false, now.Add(sessionCheckInterval))
+	}
+	return revoked
+}
+
+// revoke marks the matching active sessions revoked and denylists them here
+func (s *SessionService) revoke(ctx context.Context, filter bson.M, reason string) (int, error) {
+	filter["revoked_at"] = bson.M{"$exists": false}
+
+	cursor, err := s.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, err
+	}
+	var sessions []models.Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return 0, err
+	}
+	if len(sessions) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]primitive.ObjectID, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	result, err := s.collection.UpdateMany(
+		ctx,
+		bson.M{"_id": bson.M{"$in": ids}, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": time.Now(), "revoke_reason": reason}},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	until := time.Now().Add(s.accessTokenTTL)
+	for _, id := range ids {
+		s.remember(id.Hex(), true, until)
+	}
+	return int(result.ModifiedCount), nil
+}
+
+func (s *SessionService) remember(sessionID string, revoked bool, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.statuses) >= maxSessionStatuses {
+		now := time.Now()
+		for id, status := range s.statuses {
+			if now.After(status.until) {
+				delete(s.statuses, id)
+			}
+		}
+		// Still full of live entries: start over, the database is the source of truth
+		if len(s.statuses) >= maxSessionStatuses {
+			s.statuses = make(map[string]sessionStatus)
+		}
+	}
+	s.statuses[sessionID] = sessionStatus{revoked: revoked, until: until}
+}
+
+func (s *SessionService) tokenPair(user models.User, sessionID, refreshToken string) (*models.TokenPair, error) {
+	token, err := utils.GenerateJWT(user, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %v", err)
+	}
+	return &models.TokenPair{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTokenTTL.Seconds()),
+		SessionID:    sessionID,
+	}, nil
+}
+
+// newRefreshToken returns a random opaque token and the hash that is stored
+func newRefreshToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("failed to generate refresh token: %v", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *SessionService) ensureIndexes() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := s.collection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "refresh_token_hash", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "previous_token_hash", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_used_at", Value: -1}}},
+		{
+			// Expired sessions are removed by MongoDB
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+	if err != nil {
+		log.Printf("Failed to create session indexes: %v", err)
+	}
+}
@@ -3,17 +3,33 @@ package services
 import (
 	"amobagan/lib"
 	"amobagan/models"
+	"amobagan/utils"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"google.golang.org/genai"
 )
 
+var (
+	nutritionFeedbackLLM     lib.LLM
+	nutritionFeedbackLLMErr  error
+	nutritionFeedbackLLMOnce sync.Once
+)
+
+// getNutritionFeedbackLLM lazily builds the LLM used for nutrition feedback
+func getNutritionFeedbackLLM() (lib.LLM, error) {
+	nutritionFeedbackLLMOnce.Do(func() {
+		nutritionFeedbackLLM, nutritionFeedbackLLMErr = lib.NewLLM(lib.LLMFeatureNutritionFeedback)
+	})
+	return nutritionFeedbackLLM, nutritionFeedbackLLMErr
+}
+
 func GetUserByID(userID string) (*models.User, error) {
 	collection := lib.DB.Database("amobagan").Collection("users")
 	
@@ -49,13 +65,18 @@ func GetUserByID(userID string) (*models.User, error) {
 		HealthGoals: user.HealthGoals,
 		DietaryPreferences: user.DietaryPreferences,
 		NutritionPriorities: user.NutritionPriorities,
+		FoodAllergies: user.FoodAllergies,
 		FullName: user.FullName,
 		PhoneNo: user.PhoneNo,
+		Role: user.Role,
 		HealthStatus: user.HealthStatus,
 		WorkOutsPerWeek: user.WorkOutsPerWeek,
 		Age: user.Age,
 		Height: user.Height,
 		Weight: user.Weight,
+		Sex: user.Sex,
+		ActivityLevel: user.ActivityLevel,
+		Units: user.Units,
 		NutritionalStatus: user.NutritionalStatus,
 	}
 
@@ -102,35 +123,27 @@ func GetOrCreateUser(userID string) (*models.User, error) {
 	return &user, nil
 }
 
-// UpdateNutritionalStatus updates the user's nutritional status by incrementing counts
-func UpdateNutritionalStatus(userID string, nutritionalElements []string) error {
+// UpdateNutritionalStatus records a timestamped event for each element that
+// matches the user's nutrition priorities and returns today's counts
+func UpdateNutritionalStatus(ctx context.Context, userID string, nutritionalElements []string, barcode string, now time.Time) (map[string]int, error) {
 	collection := lib.DB.Database("amobagan").Collection("users")
 	
 	objectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
-		return fmt.Errorf("invalid user ID: %v", err)
+		return nil, fmt.Errorf("invalid user ID: %v", err)
 	}
 	
 	// Get existing user from database
 	var user models.User
-	err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user)
+	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
 	if err != nil {
-		return fmt.Errorf("user not found: %v", err)
+		return nil, fmt.Errorf("user not found: %v", err)
 	}
 	
-	log.Printf("Found user: %+v", user)
 	log.Printf("User nutrition priorities: %v", user.NutritionPriorities)
 	log.Printf("Received nutritional elements: %v", nutritionalElements)
 	
-	// Initialize NutritionalStatus if it doesn't exist
-	if user.NutritionalStatus == nil {
-		user.NutritionalStatus = make(map[string]int)
-		log.Printf("Initialized empty nutritionalStatus map")
-	}
-	
-	// Create update operations for each nutritional element
-	// Only include elements that are in the user's nutrition priorities
-	updateOperations := bson.M{}
+	// Only record elements that are in the user's nutrition priorities
 	filteredElements := []string{}
 	
 	for _, element := range nutritionalElements {
@@ -147,7 +160,6 @@ func UpdateNutritionalStatus(userID string, nutritionalElements []string) error
 		}
 		
 		if elementInPriorities {
-			updateOperations[fmt.Sprintf("nutritionalStatus.%s", normalizedElement)] = 1
 			filteredElements = append(filteredElements, normalizedElement)
 			log.Printf("Including element '%s' in update (matches user priorities)", normalizedElement)
 		} else {
@@ -155,29 +167,40 @@ func UpdateNutritionalStatus(userID string, nutritionalElements []string) error
 		}
 	}
 	
-	log.Printf("Filtered elements to update: %v", filteredElements)
-	log.Printf("Update operations: %+v", updateOperations)
-	
-	// Only perform update if there are elements to update
-	if len(updateOperations) == 0 {
+	if len(filteredElements) == 0 {
 		log.Printf("No nutritional elements match user priorities, skipping update")
-		return nil
+	} else if err := RecordNutritionalEvents(ctx, objectID, filteredElements, strings.TrimSpace(barcode)); err != nil {
+		return nil, err
 	}
 	
-	// Use $inc to increment the counts
+	log.Printf("Recorded nutritional status events for user %s with elements: %v", userID, filteredElements)
+	return CountNutritionalEvents(ctx, objectID, models.NutritionWindowToday, now)
+}
+
+// UpdateFoodAllergies replaces the user's stored food allergies with the
+// normalized list and returns it
+func UpdateFoodAllergies(userID string, allergies []string) ([]string, error) {
+	collection := lib.DB.Database("amobagan").Collection("users")
+
+	objectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID: %v", err)
+	}
+
+	normalized := utils.NormalizeAllergies(allergies)
 	result, err := collection.UpdateOne(
 		context.Background(),
 		bson.M{"_id": objectID},
-		bson.M{"$inc": updateOperations},
+		bson.M{"$set": bson.M{"foodAllergies": normalized}},
 	)
-	
 	if err != nil {
-		return fmt.Errorf("failed to update nutritional status: %v", err)
+		return nil, fmt.Errorf("failed to update food allergies: %v", err)
 	}
-	
-	log.Printf("Update result - Matched: %d, Modified: %d", result.MatchedCount, result.ModifiedCount)
-	log.Printf("Updated nutritional status for user %s with elements: %v", userID, filteredElements)
-	return nil
+	if result.MatchedCount == 0 {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	return normalized, nil
 }
 
 // createBasicUserProfile creates a basic user profile with default values
@@ -193,9 +216,9 @@ func createBasicUserProfile(userID string, objectID primitive.ObjectID) (*models
 		DietaryPreferences: []string{"no_restrictions"},
 		NutritionPriorities: []string{"balanced"},
 		WorkOutsPerWeek: "3-5",
-		Age: "25",
-		Height: "170",
-		Weight: "70",
+		Age: 25,
+		Height: 170,
+		Weight: 70,
 		NutritionalStatus: make(map[string]int),
 	}
 	
@@ -204,8 +227,9 @@ func createBasicUserProfile(userID string, objectID primitive.ObjectID) (*models
 	return &basicUser, nil
 }
 
-// GetUserNutritionDetails gets user nutrition details with smart feedback using Gemini
-func GetUserNutritionDetails(userID string) (map[string]interface{}, error) {
+// GetUserNutritionDetails gets user nutrition details with smart feedback using Gemini.
+// Feedback is based on the counts for window; counts for every window are included.
+func GetUserNutritionDetails(ctx context.Context, userID string, window string, now time.Time) (map[string]interface{}, error) {
 	collection := lib.DB.Database("amobagan").Collection("users")
 	
 	objectID, err := primitive.ObjectIDFromHex(userID)
@@ -215,33 +239,49 @@ func GetUserNutritionDetails(userID string) (map[string]interface{}, error) {
 	
 	// Get existing user from database
 	var user models.User
-	err = collection.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user)
+	err = collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
 	if err != nil {
 		return nil, fmt.Errorf("user not found: %v", err)
 	}
 	
-	// Initialize NutritionalStatus if it doesn't exist
-	if user.NutritionalStatus == nil {
-		user.NutritionalStatus = make(map[string]int)
+	windows := make(map[string]map[string]int, len(NutritionWindows))
+	for _, w := range NutritionWindows {
+		counts, err := CountNutritionalEvents(ctx, objectID, w, now)
+		if err != nil {
+			return nil, err
+		}
+		windows[w] = counts
+	}
+	status, ok := windows[window]
+	if !ok {
+		return nil, fmt.Errorf("unknown window %q", window)
 	}
 	
 	// Prepare data for Gemini analysis
 	nutritionData := map[string]interface{}{
 		"nutritionPriorities": user.NutritionPriorities,
-		"nutritionalStatus":   user.NutritionalStatus,
+		"nutritionalStatus":   status,
+		"window":              window,
 	}
 	
 	// Generate feedback using Gemini
-	feedback, err := generateNutritionFeedback(nutritionData)
+	var feedback []map[string]interface{}
+	llm, err := getNutritionFeedbackLLM()
+	if err == nil {
+		feedback, err = generateNutritionFeedback(ctx, llm, nutritionData)
+	}
 	if err != nil {
+		// Timeouts, exhausted retries and an open circuit all land here
 		log.Printf("Error generating feedback with Gemini: %v", err)
 		// Fallback to basic feedback if Gemini fails
-		feedback = generateBasicFeedback(user.NutritionPriorities, user.NutritionalStatus)
+		feedback = generateBasicFeedback(user.NutritionPriorities, status, window)
 	}
 	
 	response := map[string]interface{}{
 		"nutritionPriorities": user.NutritionPriorities,
-		"nutritionalStatus":   user.NutritionalStatus,
+		"nutritionalStatus":   status,
+		"window":              window,
+		"windows":             windows,
 		"feedback":            feedback,
 	}
 	
@@ -249,19 +289,14 @@ func GetUserNutritionDetails(userID string) (map[string]interface{}, error) {
 }
 
 // generateNutritionFeedback uses Gemini to generate smart nutrition feedback
-func generateNutritionFeedback(nutritionData map[string]interface{}) ([]map[string]interface{}, error) {
-	// Create Gemini client
-	client, err := lib.GetGeminiClient()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
-	}
-	
+func generateNutritionFeedback(ctx context.Context, llm lib.LLM, nutritionData map[string]interface{}) ([]map[string]interface{}, error) {
 	// Prepare the prompt for Gemini
 	prompt := fmt.Sprintf(`
 Analyze the user's nutrition data and provide personalized feedback.
 
 User's Nutrition Priorities: %v
 User's Nutritional Status (count of items consumed WITHOUT each priority): %v
+Time window of these counts: %s
 
 IMPORTANT: The nutritional status count represents how many items the user consumed that LACKED each nutrition priority.
 
@@ -285,17 +320,17 @@ Return only a valid JSON array of objects with this structure:
   },
   {
     "priority": "low_sugar",
-    "message": "Great job! You haven't eaten any high-sugar items today. Keep up this healthy habit!",
+    "message": "Great job! You haven't eaten any high-sugar items %s. Keep up this healthy habit!",
     "type": "positive",
     "count": 0
   }
 ]
 
 Only return the JSON array, no additional text.
-`, nutritionData["nutritionPriorities"], nutritionData["nutritionalStatus"])
+`, nutritionData["nutritionPriorities"], nutritionData["nutritionalStatus"], nutritionData["window"], windowPhrase(nutritionData["window"].(string)))
 	
 	// Call Gemini
-	response, err := client.Models.GenerateContent(context.Background(), lib.GEMINI_MODEL, genai.Text(prompt), &genai.GenerateContentConfig{
+	response, err := llm.Generate(ctx, prompt, &lib.GenerateOptions{
 		ResponseMIMEType: "application/json",
 	})
 	if err != nil {
@@ -304,7 +339,7 @@ Only return the JSON array, no additional text.
 	
 	// Parse the response
 	var feedback []map[string]interface{}
-	err = json.Unmarshal([]byte(response.Text()), &feedback)
+	err = json.Unmarshal([]byte(response), &feedback)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse Gemini response: %v", err)
 	}
@@ -313,7 +348,7 @@ Only return the JSON array, no additional text.
 }
 
 // generateBasicFeedback provides fallback feedback when Gemini is unavailable
-func generateBasicFeedback(priorities []string, status map[string]int) []map[string]interface{} {
+func generateBasicFeedback(priorities []string, status map[string]int, window string) []map[string]interface{} {
 	var feedback []map[string]interface{}
 	
 	for _, priority := range priorities {
@@ -335,7 +370,7 @@ func generateBasicFeedback(priorities []string, status map[string]int) []map[str
 			}
 			feedback = append(feedback, map[string]interface{}{
 				"priority": priority,
-				"message":  fmt.Sprintf("Great job! You haven't eaten any %s-poor items today. Keep up this healthy habit!", priority),
+				"message":  fmt.Sprintf("Great job! You haven't eaten any %s-poor items %s. Keep up this healthy habit!", priority, windowPhrase(window)),
 				"type":     "positive",
 				"count":    count,
 			})
@@ -343,4 +378,18 @@ func generateBasicFeedback(priorities []string, status map[string]int) []map[str
 	}
 	
 	return feedback
-}
\ No newline at end of file
+}
+
+// windowPhrase describes a nutritional status window in feedback messages
+func windowPhrase(window string) string {
+	switch window {
+	case models.NutritionWindowWeek:
+		return "this week"
+	case models.NutritionWindowMonth:
+		return "this month"
+	case models.NutritionWindowAll:
+		return "so far"
+	default:
+		return "today"
+	}
+}
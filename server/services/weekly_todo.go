@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -18,27 +19,32 @@ import (
 )
 
 type WeeklyTodoService struct {
-	client *genai.Client
-	db     *mongo.Database
+	llm lib.LLM
+	db  *mongo.Database
 }
 
 func NewWeeklyTodoService() (*WeeklyTodoService, error) {
-	client, err := lib.GetGeminiClient()
+	llm, err := lib.NewLLM(lib.LLMFeatureWeeklyTodo)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create Gemini client: %v", err)
+		return nil, fmt.Errorf("failed to create LLM: %v", err)
 	}
 
 	// Use the correct database access pattern
 	db := lib.DB.Database("amobagan")
 
+	return NewWeeklyTodoServiceWithLLM(llm, db), nil
+}
+
+// NewWeeklyTodoServiceWithLLM builds the service around a given LLM, e.g. lib.FakeLLM
+func NewWeeklyTodoServiceWithLLM(llm lib.LLM, db *mongo.Database) *WeeklyTodoService {
 	return &WeeklyTodoService{
-		client: client,
-		db:     db,
-	}, nil
+		llm: llm,
+		db:  db,
+	}
 }
 
 // GenerateWeeklyTodo creates a personalized weekly todo list
-func (s *WeeklyTodoService) GenerateWeeklyTodo(userID string, generateNewWeek bool) (*models.WeeklyTodo, error) {
+func (s *WeeklyTodoService) GenerateWeeklyTodo(ctx context.Context, userID string, generateNewWeek bool) (*models.WeeklyTodo, error) {
 	// Get user data from database
 	user, err := GetUserByID(userID)
 	if err != nil {
@@ -46,9 +52,9 @@ func (s *WeeklyTodoService) GenerateWeeklyTodo(userID string, generateNewWeek bo
 	}
 
 	// Convert user data to UserProfile
-	userProfile, err := s.convertUserToProfile(user)
+	userProfile, err := BuildUserProfile(user)
 	if err != nil {
-		return nil, fmt.Errorf("failed to convert user data: %v", err)
+		return nil, fmt.Errorf("failed to convert user data: %w", err)
 	}
 
 	// Get previous week's data if generating new week
@@ -60,6 +66,12 @@ func (s *WeeklyTodoService) GenerateWeeklyTodo(userID string, generateNewWeek bo
 		}
 	}
 
+	return s.generateWeeklyTodo(ctx, userID, userProfile, previousWeek, generateNewWeek)
+}
+
+// generateWeeklyTodo asks the LLM for a week of todos for the profile and
+// validates them
+func (s *WeeklyTodoService) generateWeeklyTodo(ctx context.Context, userID string, userProfile *models.UserProfile, previousWeek *models.WeeklyTodo, generateNewWeek bool) (*models.WeeklyTodo, error) {
 	// Read prompt template
 	promptTemplate, err := s.readPromptTemplate()
 	if err != nil {
@@ -72,24 +84,33 @@ func (s *WeeklyTodoService) GenerateWeeklyTodo(userID string, generateNewWeek bo
 	// Create JSON schema for structured output
 	schema := s.createWeeklyTodoSchema()
 
-	// Generate content with structured output
-	response, err := s.client.Models.GenerateContent(
-		context.Background(),
-		lib.GEMINI_MODEL,
-		genai.Text(prompt),
-		&genai.GenerateContentConfig{
+	// Regenerate when a todo contains one of the user's allergens
+	var weeklyTodo models.WeeklyTodo
+	for attempt := 0; ; attempt++ {
+		// Generate content with structured output
+		response, err := s.llm.Generate(ctx, prompt, &lib.GenerateOptions{
 			ResponseMIMEType: "application/json",
 			ResponseSchema:   schema,
-		},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate weekly todo: %v", err)
-	}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate weekly todo: %w", err)
+		}
 
-	// Parse the structured response
-	var weeklyTodo models.WeeklyTodo
-	if err := json.Unmarshal([]byte(response.Text()), &weeklyTodo); err != nil {
-		return nil, fmt.Errorf("failed to parse weekly todo response: %v", err)
+		// Parse the structured response
+		weeklyTodo = models.WeeklyTodo{}
+		if err := json.Unmarshal([]byte(response), &weeklyTodo); err != nil {
+			return nil, fmt.Errorf("failed to parse weekly todo response: %v", err)
+		}
+
+		violations := weeklyTodoAllergenViolations(&weeklyTodo, userProfile.FoodAllergies)
+		if len(violations) == 0 {
+			break
+		}
+		if attempt == maxAllergenRegenerations {
+			return nil, fmt.Errorf("%w: %s", ErrAllergenConflict, strings.Join(violations, "; "))
+		}
+		log.Printf("Weekly todo contained allergens, regenerating: %v", violations)
+		prompt += allergenRetryInstruction(userProfile.FoodAllergies, violations)
 	}
 
 	// Set additional fields
@@ -122,104 +143,8 @@ func (s *WeeklyTodoService) GenerateWeeklyTodo(userID string, generateNewWeek bo
 	return &weeklyTodo, nil
 }
 
-// convertUserToProfile converts User model to UserProfile
-func (s *WeeklyTodoService) convertUserToProfile(user *models.User) (*models.UserProfile, error) {
-	// Parse age
-	age, err := strconv.Atoi(user.Age)
-	if err != nil {
-		return nil, fmt.Errorf("invalid age format: %v", err)
-	}
 
-	// Parse weight
-	weight, err := strconv.ParseFloat(user.Weight, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid weight format: %v", err)
-	}
-
-	// Parse height
-	height, err := strconv.ParseFloat(user.Height, 64)
-	if err != nil {
-		return nil, fmt.Errorf("invalid height format: %v", err)
-	}
-
-	// Calculate BMI
-	bmi := s.calculateBMI(weight, height)
-
-	// Determine primary goal from health goals
-	primaryGoal := s.determinePrimaryGoal(user.HealthGoals)
-
-	// Map workout frequency
-	workoutFrequency := s.mapWorkoutFrequency(user.WorkOutsPerWeek)
-
-	// Set default values for missing fields
-	goalPace := 0.5 // Default goal pace
-	timeline := "12 weeks" // Default timeline
-	foodAllergies := []string{} // Default empty allergies
-	completedGoals := []string{} // Default empty completed goals
-	remainingGoals := []string{} // Default empty remaining goals
-
-	userProfile := &models.UserProfile{
-		Name:                user.FullName,
-		Age:                 age,
-		Weight:              weight,
-		Height:              height,
-		BMI:                 bmi,
-		WorkoutFrequency:    workoutFrequency,
-		PrimaryGoal:         primaryGoal,
-		GoalPace:            goalPace,
-		Timeline:            timeline,
-		DietaryPreferences:  user.DietaryPreferences,
-		FoodAllergies:       foodAllergies,
-		NutritionPriorities: user.NutritionPriorities,
-		CompletedGoals:      completedGoals,
-		RemainingGoals:      remainingGoals,
-		HealthStatus:        user.HealthStatus,
-	}
-
-	return userProfile, nil
-}
-
-// determinePrimaryGoal determines the primary goal from health goals
-func (s *WeeklyTodoService) determinePrimaryGoal(healthGoals []string) string {
-	if len(healthGoals) == 0 {
-		return "general_wellness"
-	}
-
-	// Priority order for goals
-	goalPriority := map[string]int{
-		"diabetes":        1,
-		"weight_loss":     2,
-		"muscle_gain":     3,
-		"heart_health":    4,
-		"general_wellness": 5,
-	}
-
-	highestPriority := 999
-	primaryGoal := "general_wellness"
 
-	for _, goal := range healthGoals {
-		if priority, exists := goalPriority[goal]; exists && priority < highestPriority {
-			highestPriority = priority
-			primaryGoal = goal
-		}
-	}
-
-	return primaryGoal
-}
-
-// mapWorkoutFrequency maps workout frequency to descriptive string
-func (s *WeeklyTodoService) mapWorkoutFrequency(workoutsPerWeek string) string {
-	switch workoutsPerWeek {
-	case "0-2":
-		return "1-2 light workouts"
-	case "3-5":
-		return "3-5 moderate workouts"
-	case "6+":
-		return "6+ intense workouts"
-	default:
-		return "1-2 light workouts"
-	}
-}
 
 // readPromptTemplate reads the weekly todo prompt template
 func (s *WeeklyTodoService) readPromptTemplate() (string, error) {
@@ -283,12 +208,10 @@ func (s *WeeklyTodoService) createWeeklyTodoSchema() *genai.Schema {
 				Items: &genai.Schema{
 					Type: "object",
 					Properties: map[string]*genai.Schema{
+						// Dates are set from the week start, see initializeCompletionRates
 						"day": {
 							Type: "string",
 						},
-						"date": {
-							Type: "string",
-						},
 						"meal_todos": {
 							Type: "array",
 							Items: s.createTodoItemSchema(),
@@ -389,11 +312,6 @@ func (s *WeeklyTodoService) initializeTodoItems(todos *[]models.TodoItem) {
 	}
 }
 
-// calculateBMI calculates BMI from weight and height
-func (s *WeeklyTodoService) calculateBMI(weight, height float64) float64 {
-	heightInMeters := height / 100
-	return weight / (heightInMeters * heightInMeters)
-}
 
 // validateWeeklyTodo validates the generated weekly todo
 func (s *WeeklyTodoService) validateWeeklyTodo(weeklyTodo *models.WeeklyTodo) error {
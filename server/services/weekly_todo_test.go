@@ -0,0 +1,96 @@
+package services
+
+import (
+	"amobagan/lib"
+	"amobagan/models"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestGenerateWeeklyTodo(t *testing.T) {
+	tests := []struct {
+		name      string
+		llm       lib.LLM
+		allergies []string
+		prompts   int
+		want      error
+	}{
+		{name: "fixture week", prompts: 1},
+		{name: "allergen in every answer", allergies: []string{"wheat"}, prompts: maxAllergenRegenerations + 1, want: ErrAllergenConflict},
+		{name: "LLM timeout", llm: failingLLM{err: lib.ErrLLMTimeout}, want: lib.ErrLLMTimeout},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := fakeLLM(lib.LLMFeatureWeeklyTodo)
+			llm := tt.llm
+			if llm == nil {
+				llm = fake
+			}
+			user := testUser()
+			user.FoodAllergies = tt.allergies
+			profile, err := BuildUserProfile(user)
+			if err != nil {
+				t.Fatalf("BuildUserProfile error: %v", err)
+			}
+
+			userID := primitive.NewObjectID()
+			service := NewWeeklyTodoServiceWithLLM(llm, nil)
+			todo, err := service.generateWeeklyTodo(context.Background(), userID.Hex(), profile, nil, false)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("generateWeeklyTodo error = %v, want %v", err, tt.want)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("generateWeeklyTodo error: %v", err)
+				}
+				if todo.UserID != userID || len(todo.DailyTodos) != 7 || todo.WeekStartDate.IsZero() {
+					t.Errorf("week for %s has %d days starting %v", todo.UserID.Hex(), len(todo.DailyTodos), todo.WeekStartDate)
+				}
+				for _, daily := range todo.DailyTodos {
+					for _, todos := range [][]models.TodoItem{daily.MealTodos, daily.WorkoutTodos, daily.HealthTodos, daily.LifestyleTodos} {
+						for _, item := range todos {
+							if item.ID.IsZero() {
+								t.Errorf("%s has a todo without an ID: %q", daily.Day, item.Title)
+							}
+						}
+					}
+				}
+			}
+
+			if tt.llm != nil {
+				return
+			}
+			prompts := fake.Prompts()
+			if len(prompts) != tt.prompts {
+				t.Fatalf("LLM got %d prompts, want %d", len(prompts), tt.prompts)
+			}
+			for i, prompt := range prompts[1:] {
+				if !strings.Contains(prompt, "IMPORTANT: The user is allergic to") {
+					t.Errorf("retry %d doesn't warn about the allergy", i+1)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateWeeklyTodoNextWeek(t *testing.T) {
+	profile, err := BuildUserProfile(testUser())
+	if err != nil {
+		t.Fatalf("BuildUserProfile error: %v", err)
+	}
+	previous := &models.WeeklyTodo{ID: primitive.NewObjectID(), WeekNumber: 3}
+
+	service := NewWeeklyTodoServiceWithLLM(fakeLLM(lib.LLMFeatureWeeklyTodo), nil)
+	todo, err := service.generateWeeklyTodo(context.Background(), primitive.NewObjectID().Hex(), profile, previous, true)
+	if err != nil {
+		t.Fatalf("generateWeeklyTodo error: %v", err)
+	}
+	if todo.PreviousWeekID == nil || *todo.PreviousWeekID != previous.ID {
+		t.Errorf("previous week = %v, want %s", todo.PreviousWeekID, previous.ID.Hex())
+	}
+}
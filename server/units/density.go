@@ -0,0 +1,68 @@
+package units
+
+import "strings"
+
+// DefaultDensity is used for volumes when nothing better is known, as for water
+const DefaultDensity = 1.0
+
+type densityRule struct {
+	keyword string
+	density float64
+}
+
+// densities are typical g/ml by category keyword. More specific keywords come
+// first so "ice-creams" isn't read as cream.
+var densities = []densityRule{
+	{"ice-creams", 0.55},
+	{"ice-cream", 0.55},
+	{"frozen-desserts", 0.6},
+	{"honeys", 1.42},
+	{"honey", 1.42},
+	{"condensed-milks", 1.3},
+	{"syrups", 1.33},
+	{"syrup", 1.33},
+	{"molasses", 1.4},
+	{"ketchup", 1.15},
+	{"sauces", 1.1},
+	{"yogurts", 1.05},
+	{"yoghurts", 1.05},
+	{"curds", 1.05},
+	{"creams", 1.0},
+	{"milks", 1.03},
+	{"milk", 1.03},
+	{"buttermilks", 1.02},
+	{"juices", 1.05},
+	{"nectars", 1.05},
+	{"sodas", 1.04},
+	{"soft-drinks", 1.04},
+	{"energy-drinks", 1.05},
+	{"beers", 1.01},
+	{"wines", 0.99},
+	{"spirits", 0.95},
+	{"vinegars", 1.01},
+	{"oils", 0.92},
+	{"oil", 0.92},
+	{"ghee", 0.91},
+	{"waters", 1.0},
+}
+
+// Density returns the g/ml of a food from its category tags, e.g.
+// "en:sunflower-oils", or DefaultDensity when no category is known
+func Density(categories []string) float64 {
+	for _, rule := range densities {
+		for _, category := range categories {
+			if hasWord(category, rule.keyword) {
+				return rule.density
+			}
+		}
+	}
+	return DefaultDensity
+}
+
+// hasWord reports whether keyword appears in the tag as whole hyphen
+// separated words, so "oils" matches "en:olive-oils" but not "en:boiled-eggs"
+func hasWord(tag, keyword string) bool {
+	tag = "-" + strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), ":", "-") + "-"
+	tag = strings.ReplaceAll(tag, " ", "-")
+	return strings.Contains(tag, "-"+keyword+"-")
+}
@@ -0,0 +1,263 @@
+// Package units parses food quantities the way they are printed on labels and
+// in product databases, and converts them to grams or millilitres.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dimension is what a quantity measures
+type Dimension string
+
+const (
+	Mass   Dimension = "mass"
+	Volume Dimension = "volume"
+)
+
+var (
+	// ErrInvalid is wrapped by every parse error
+	ErrInvalid = errors.New("invalid quantity")
+
+	ErrEmpty       = fmt.Errorf("%w: quantity is empty", ErrInvalid)
+	ErrNoAmount    = fmt.Errorf("%w: no amount with a mass or volume unit", ErrInvalid)
+	ErrUnknownUnit = fmt.Errorf("%w: unknown unit", ErrInvalid)
+	ErrNotPositive = fmt.Errorf("%w: amount must be positive", ErrInvalid)
+	ErrOutOfRange  = fmt.Errorf("%w: amount is out of range", ErrInvalid)
+)
+
+// Quantity is a parsed amount. Values are in grams for mass and millilitres
+// for volume.
+type Quantity struct {
+	// Raw is the text that was parsed
+	Raw       string    `json:"raw"`
+	Dimension Dimension `json:"dimension"`
+	// Value is the total amount, all units of a multipack together
+	Value float64 `json:"value"`
+	// Count is the number of units in a multipack, 1 otherwise
+	Count int `json:"count"`
+	// PerUnit is the amount of one unit of a multipack
+	PerUnit float64 `json:"per_unit"`
+	// Label is the text around the amount, e.g. "2 biscuits" in "30g (2 biscuits)"
+	Label string `json:"label,omitempty"`
+}
+
+// BaseUnit returns "g" or "ml"
+func (q Quantity) BaseUnit() string {
+	if q.Dimension == Volume {
+		return "ml"
+	}
+	return "g"
+}
+
+// Grams returns the total amount in grams, converting volumes with the
+// density in g/ml
+func (q Quantity) Grams(density float64) float64 {
+	return toGrams(q.Value, q.Dimension, density)
+}
+
+// UnitGrams returns the amount of one multipack unit in grams
+func (q Quantity) UnitGrams(density float64) float64 {
+	return toGrams(q.PerUnit, q.Dimension, density)
+}
+
+// Multipack reports whether the quantity counts several units
+func (q Quantity) Multipack() bool {
+	return q.Count > 1
+}
+
+// String formats the quantity in its base unit, e.g. "2 x 50 g"
+func (q Quantity) String() string {
+	if q.Multipack() {
+		return fmt.Sprintf("%d x %s %s", q.Count, FormatAmount(q.PerUnit), q.BaseUnit())
+	}
+	return fmt.Sprintf("%s %s", FormatAmount(q.Value), q.BaseUnit())
+}
+
+func toGrams(value float64, dimension Dimension, density float64) float64 {
+	if dimension != Volume {
+		return value
+	}
+	if density <= 0 {
+		density = DefaultDensity
+	}
+	return value * density
+}
+
+type unit struct {
+	dimension Dimension
+	factor    float64
+}
+
+// unitsByName maps every accepted spelling to its dimension and its factor to
+// grams or millilitres
+var unitsByName = map[string]unit{
+	"mg": {Mass, 0.001}, "milligram": {Mass, 0.001}, "milligrams": {Mass, 0.001},
+	"g": {Mass, 1}, "gr": {Mass, 1}, "grs": {Mass, 1}, "gm": {Mass, 1}, "gms": {Mass, 1},
+	"gram": {Mass, 1}, "grams": {Mass, 1}, "gramme": {Mass, 1}, "grammes": {Mass, 1},
+	"kg": {Mass, 1000}, "kgs": {Mass, 1000}, "kilo": {Mass, 1000}, "kilos": {Mass, 1000},
+	"kilogram": {Mass, 1000}, "kilograms": {Mass, 1000},
+	"oz": {Mass, 28.349523125}, "ounce": {Mass, 28.349523125}, "ounces": {Mass, 28.349523125},
+	"lb": {Mass, 453.59237}, "lbs": {Mass, 453.59237}, "pound": {Mass, 453.59237}, "pounds": {Mass, 453.59237},
+	"ml": {Volume, 1}, "millilitre": {Volume, 1}, "millilitres": {Volume, 1}, "milliliter": {Volume, 1}, "milliliters": {Volume, 1},
+	"cl": {Volume, 10}, "centilitre": {Volume, 10}, "centilitres": {Volume, 10}, "centiliter": {Volume, 10}, "centiliters": {Volume, 10},
+	"dl": {Volume, 100}, "decilitre": {Volume, 100}, "decilitres": {Volume, 100}, "deciliter": {Volume, 100}, "deciliters": {Volume, 100},
+	"l": {Volume, 1000}, "lt": {Volume, 1000}, "ltr": {Volume, 1000}, "ltrs": {Volume, 1000},
+	"litre": {Volume, 1000}, "litres": {Volume, 1000}, "liter": {Volume, 1000}, "liters": {Volume, 1000},
+	"floz": {Volume, 29.5735295625}, "fluidounce": {Volume, 29.5735295625}, "fluidounces": {Volume, 29.5735295625},
+}
+
+// amountPattern finds an amount with its unit, optionally as a multipack
+// written either "2 x 50 g" or "50 g x 2". Exponents are matched so "1e309 g"
+// isn't read as 309 g.
+var amountPattern = regexp.MustCompile(
+	`(?:(\d+)\s*[x×*]\s*)?(\d+(?:\.\d+)?(?:e[-+]?\d+)?)\s*` +
+		`(fl\.?\s*oz|fluid\s+ounces?|[a-z]+)\.?` +
+		`(?:\s*[x×*]\s*(\d+)\b)?`,
+)
+
+var (
+	thousandsSep = regexp.MustCompile(`(\d+)((?:,\d{3})+)(\s*[a-z]*)(\D|$)`)
+	decimalComma = regexp.MustCompile(`(\d),(\d)`)
+	spaces       = regexp.MustCompile(`\s+`)
+)
+
+// Parse reads a quantity such as "500 ML", "1,5 l", "2 x 50 g", "12 fl oz" or
+// "30g (2 biscuits)". The first amount with a known unit wins; the remaining
+// text becomes the label.
+func Parse(s string) (Quantity, error) {
+	raw := strings.TrimSpace(s)
+	if raw == "" {
+		return Quantity{}, ErrEmpty
+	}
+
+	text := normalize(raw)
+	for _, m := range amountPattern.FindAllStringSubmatchIndex(text, -1) {
+		name := strings.Map(func(r rune) rune {
+			if r == ' ' || r == '.' {
+				return -1
+			}
+			return r
+		}, text[m[6]:m[7]])
+		u, ok := unitsByName[name]
+		if !ok {
+			continue
+		}
+
+		amount, err := strconv.ParseFloat(text[m[4]:m[5]], 64)
+		if err != nil {
+			return Quantity{}, ErrOutOfRange
+		}
+		count := 1
+		if m[2] >= 0 {
+			count, _ = strconv.Atoi(text[m[2]:m[3]])
+		} else if m[8] >= 0 {
+			count, _ = strconv.Atoi(text[m[8]:m[9]])
+		}
+		if amount <= 0 || count <= 0 || negative(text, m[0]) {
+			return Quantity{}, ErrNotPositive
+		}
+
+		perUnit := amount * u.factor
+		if math.IsInf(perUnit*float64(count), 0) {
+			return Quantity{}, ErrOutOfRange
+		}
+		return Quantity{
+			Raw:       raw,
+			Dimension: u.dimension,
+			Value:     perUnit * float64(count),
+			Count:     count,
+			PerUnit:   perUnit,
+			Label:     label(text[:m[0]] + " " + text[m[1]:]),
+		}, nil
+	}
+	return Quantity{}, ErrNoAmount
+}
+
+// negative reports whether the amount starting at i has a minus sign, as in
+// "-5 g", and not a hyphen joining it to a word or a range like "250-500 g"
+func negative(text string, i int) bool {
+	if i == 0 || text[i-1] != '-' {
+		return false
+	}
+	if i == 1 {
+		return true
+	}
+	before := text[i-2]
+	return !(before >= '0' && before <= '9' || before >= 'a' && before <= 'z')
+}
+
+// FromValue builds a quantity from a number and a unit, as product databases
+// store serving sizes. An empty unit means grams.
+func FromValue(value float64, unitName string) (Quantity, error) {
+	name := strings.ToLower(strings.Join(strings.Fields(unitName), ""))
+	name = strings.ReplaceAll(name, ".", "")
+	if name == "" {
+		name = "g"
+	}
+	u, ok := unitsByName[name]
+	if !ok {
+		return Quantity{}, fmt.Errorf("%w %q", ErrUnknownUnit, unitName)
+	}
+	if value <= 0 {
+		return Quantity{}, ErrNotPositive
+	}
+	if math.IsInf(value*u.factor, 0) {
+		return Quantity{}, ErrOutOfRange
+	}
+
+	amount := value * u.factor
+	return Quantity{
+		Raw:       strings.TrimSpace(FormatAmount(value) + " " + unitName),
+		Dimension: u.dimension,
+		Value:     amount,
+		Count:     1,
+		PerUnit:   amount,
+	}, nil
+}
+
+// FormatAmount prints an amount without trailing zeros, e.g. 50, 12.5 or 0.25
+func FormatAmount(v float64) string {
+	return strconv.FormatFloat(math.Round(v*100)/100, 'f', -1, 64)
+}
+
+// normalize lowercases the text, drops the estimated sign and turns decimal
+// commas into points after dropping thousands separators
+func normalize(s string) string {
+	s = strings.ToLower(s)
+	s = strings.NewReplacer("℮", " ", "\u00a0", " ").Replace(s)
+	s = thousandsSep.ReplaceAllStringFunc(s, dropThousandsSeps)
+	s = decimalComma.ReplaceAllString(s, "$1.$2")
+	return strings.TrimSpace(spaces.ReplaceAllString(s, " "))
+}
+
+// dropThousandsSeps removes the commas from a thousandsSep match unless they
+// are more likely decimal commas: "0,330 l" is a third of a litre, and
+// "1,500 kg" is a kilo and a half rather than a ton and a half
+func dropThousandsSeps(match string) string {
+	m := thousandsSep.FindStringSubmatch(match)
+	whole, groups, unitName := m[1], m[2], strings.TrimSpace(m[3])
+	if whole == "0" {
+		return match
+	}
+	if u, ok := unitsByName[unitName]; ok && u.factor >= 1000 && strings.Count(groups, ",") == 1 {
+		return match
+	}
+	return whole + strings.ReplaceAll(groups, ",", "") + m[3] + m[4]
+}
+
+// label keeps the words around the amount, without brackets and separators
+func label(rest string) string {
+	rest = strings.NewReplacer("(", " ", ")", " ", "[", " ", "]", " ").Replace(rest)
+	rest = strings.TrimSpace(spaces.ReplaceAllString(rest, " "))
+	rest = strings.Trim(rest, " ,;:-/")
+	// A lone "e" is the estimated sign typed as a letter
+	if rest == "e" {
+		return ""
+	}
+	return rest
+}
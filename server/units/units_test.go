@@ -0,0 +1,84 @@
+package units
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in        string
+		dimension Dimension
+		value     float64
+		count     int
+		label     string
+	}{
+		{"500 ML", Volume, 500, 1, ""},
+		{"1,5 l", Volume, 1500, 1, ""},
+		{"1,000 g", Mass, 1000, 1, ""},
+		{"1,000,000 mg", Mass, 1000, 1, ""},
+		{"0,330 l", Volume, 330, 1, ""},
+		{"0,5 kg", Mass, 500, 1, ""},
+		{"1,500 kg", Mass, 1500, 1, ""},
+		{"2,000 ml", Volume, 2000, 1, ""},
+		{"2 x 50 g", Mass, 100, 2, ""},
+		{"50 g x 2", Mass, 100, 2, ""},
+		{"12 fl oz", Volume, 12 * 29.5735295625, 1, ""},
+		{"30g (2 biscuits)", Mass, 30, 1, "2 biscuits"},
+		{"℮ 250 g", Mass, 250, 1, ""},
+		{"1 kg", Mass, 1000, 1, ""},
+		{"1e3 g", Mass, 1000, 1, ""},
+		{"Pack of 250-500 g", Mass, 500, 1, "pack of 250"},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.in, err)
+			continue
+		}
+		if q.Dimension != tt.dimension || q.Value != tt.value || q.Count != tt.count || q.Label != tt.label {
+			t.Errorf("Parse(%q) = %s %v x%d label %q, want %s %v x%d label %q",
+				tt.in, q.Dimension, q.Value, q.Count, q.Label, tt.dimension, tt.value, tt.count, tt.label)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		in   string
+		want error
+	}{
+		{"", ErrEmpty},
+		{"   ", ErrEmpty},
+		{"a bag", ErrNoAmount},
+		{"12 pieces", ErrNoAmount},
+		{"0 g", ErrNotPositive},
+		{"-5 g", ErrNotPositive},
+		{"(-5 g)", ErrNotPositive},
+		{"0 x 50 g", ErrNotPositive},
+		{"1e309 g", ErrOutOfRange},
+		{"1e308 kg", ErrOutOfRange},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.in)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("Parse(%q) = %v, %v, want error %v", tt.in, q, err, tt.want)
+		}
+		if err != nil && !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) error %v doesn't wrap ErrInvalid", tt.in, err)
+		}
+	}
+}
+
+func TestFromValue(t *testing.T) {
+	q, err := FromValue(2, "kg")
+	if err != nil || q.Value != 2000 || q.Dimension != Mass {
+		t.Errorf("FromValue(2, kg) = %v, %v, want 2000 g", q, err)
+	}
+	if _, err := FromValue(-1, "g"); !errors.Is(err, ErrNotPositive) {
+		t.Errorf("FromValue(-1, g) error = %v, want ErrNotPositive", err)
+	}
+	if _, err := FromValue(1, "cups"); !errors.Is(err, ErrUnknownUnit) {
+		t.Errorf("FromValue(1, cups) error = %v, want ErrUnknownUnit", err)
+	}
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+)
+
+// AdditiveInfo is one entry of the embedded additive knowledge base
+type AdditiveInfo struct {
+	Code          string `json:"code"`
+	Name          string `json:"name"`
+	FunctionClass string `json:"function_class"`
+	RiskTier      string `json:"risk_tier"`
+	Notes         string `json:"notes,omitempty"`
+}
+
+// Additive risk tiers
+const (
+	AdditiveRiskLow      = "low"
+	AdditiveRiskModerate = "moderate"
+	AdditiveRiskHigh     = "high"
+)
+
+//go:embed data/additives.json
+var additivesJSON []byte
+
+var (
+	additiveDB       map[string]AdditiveInfo
+	additiveDBByName map[string]AdditiveInfo
+	additiveDBOnce   sync.Once
+)
+
+func loadAdditiveDB() {
+	var entries []AdditiveInfo
+	if err := json.Unmarshal(additivesJSON, &entries); err != nil {
+		log.Printf("Failed to load additive database: %v", err)
+	}
+	additiveDB = make(map[string]AdditiveInfo, len(entries))
+	additiveDBByName = make(map[string]AdditiveInfo, len(entries))
+	for _, e := range entries {
+		additiveDB[e.Code] = e
+		additiveDBByName[strings.ToLower(e.Name)] = e
+	}
+}
+
+// LookupAdditive finds an additive by any code spelling ("INS 322", "e150d").
+// Unknown sub-letters fall back to the base code and a bare family code such as
+// E150 matches its first listed variant.
+func LookupAdditive(code string) (AdditiveInfo, bool) {
+	additiveDBOnce.Do(loadAdditiveDB)
+	normalized := NormalizeAdditiveCode(code)
+	if normalized == "" {
+		return AdditiveInfo{}, false
+	}
+	if info, ok := additiveDB[normalized]; ok {
+		return info, true
+	}
+	base := strings.TrimRight(normalized, "abcdef")
+	if info, ok := additiveDB[base]; ok {
+		return info, true
+	}
+	for _, letter := range "abcdef" {
+		if info, ok := additiveDB[base+string(letter)]; ok {
+			return info, true
+		}
+	}
+	return AdditiveInfo{}, false
+}
+
+// LookupAdditiveByName matches ingredients listed by name instead of code,
+// e.g. "Citric acid" or "Aspartame"
+func LookupAdditiveByName(name string) (AdditiveInfo, bool) {
+	additiveDBOnce.Do(loadAdditiveDB)
+	info, ok := additiveDBByName[strings.ToLower(strings.TrimSpace(name))]
+	return info, ok
+}
+
+// DetectAdditives collects every additive named or coded in the parsed
+// ingredients plus any upstream additive tags, deduplicated by code
+func DetectAdditives(ingredients []ParsedIngredient, upstreamTags []string) []DetectedAdditive {
+	detected := []DetectedAdditive{}
+	seen := map[string]bool{}
+	add := func(code, source string) {
+		info, known := LookupAdditive(code)
+		if known {
+			code = info.Code
+		}
+		if code == "" || seen[code] {
+			return
+		}
+		seen[code] = true
+		detected = append(detected, DetectedAdditive{
+			Code:          code,
+			Name:          info.Name,
+			FunctionClass: info.FunctionClass,
+			RiskTier:      info.RiskTier,
+			Known:         known,
+			SourceText:    source,
+		})
+	}
+
+	for _, ing := range FlattenIngredients(ingredients) {
+		for _, code := range ing.AdditiveCodes {
+			add(NormalizeAdditiveCode(code), ing.Name)
+		}
+		if len(ing.AdditiveCodes) == 0 {
+			if info, ok := LookupAdditiveByName(ing.Name); ok {
+				add(info.Code, ing.Name)
+			}
+		}
+	}
+	for _, tag := range upstreamTags {
+		add(NormalizeAdditiveCode(tag), tag)
+	}
+	return detected
+}
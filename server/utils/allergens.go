@@ -0,0 +1,236 @@
+package utils
+
+import (
+	"amobagan/models"
+	"sort"
+	"strings"
+)
+
+// Canonical allergen keys, modelled on the EU/FSSAI major allergen lists
+const (
+	AllergenGluten    = "gluten"
+	AllergenMilk      = "milk"
+	AllergenEgg       = "egg"
+	AllergenPeanut    = "peanut"
+	AllergenTreeNut   = "tree_nut"
+	AllergenSoy       = "soy"
+	AllergenFish      = "fish"
+	AllergenShellfish = "shellfish"
+	AllergenSesame    = "sesame"
+	AllergenMustard   = "mustard"
+	AllergenCelery    = "celery"
+	AllergenLupin     = "lupin"
+	AllergenSulphite  = "sulphite"
+)
+
+type allergenDefinition struct {
+	// aliases are what users and OpenFoodFacts tags call the allergen
+	aliases []string
+	// keywords indicate the allergen inside ingredient or meal text
+	keywords []string
+	// exclusions are phrases that contain a keyword but not the allergen
+	exclusions []string
+}
+
+var allergenCatalog = map[string]allergenDefinition{
+	AllergenGluten: {
+		aliases:    []string{"gluten", "wheat", "cereals-containing-gluten", "celiac", "coeliac"},
+		keywords:   []string{"wheat", "atta", "maida", "sooji", "suji", "semolina", "rava", "barley", "rye", "oats", "gluten", "seitan", "dalia", "bread", "roti", "chapati", "naan", "paratha", "pasta", "noodles", "couscous", "spelt"},
+		exclusions: []string{"gluten free", "gluten-free", "buckwheat"},
+	},
+	AllergenMilk: {
+		aliases:    []string{"milk", "dairy", "lactose", "casein", "whey"},
+		keywords:   []string{"milk", "dairy", "paneer", "ghee", "curd", "dahi", "yogurt", "yoghurt", "butter", "cream", "cheese", "whey", "casein", "lactose", "khoa", "khoya", "malai", "buttermilk", "lassi", "raita", "kheer"},
+		exclusions: []string{"cocoa butter", "peanut butter", "shea butter", "nut butter", "almond butter", "coconut milk", "coconut cream", "almond milk", "soy milk", "soya milk", "oat milk", "rice milk", "cashew milk", "dairy free", "dairy-free", "lactose free", "lactose-free", "cream of tartar", "milk thistle"},
+	},
+	AllergenEgg: {
+		aliases:    []string{"egg", "eggs"},
+		keywords:   []string{"egg", "albumin", "albumen", "mayonnaise", "omelette", "omelet", "meringue", "anda"},
+		exclusions: []string{"eggplant", "egg-free", "egg free", "eggless"},
+	},
+	AllergenPeanut: {
+		aliases:  []string{"peanut", "peanuts", "groundnut", "groundnuts"},
+		keywords: []string{"peanut", "groundnut", "moongphali", "mungfali", "arachis"},
+	},
+	AllergenTreeNut: {
+		aliases:    []string{"tree_nut", "tree nut", "tree nuts", "nuts", "nut"},
+		keywords:   []string{"almond", "badam", "cashew", "kaju", "walnut", "akhrot", "pistachio", "pista", "hazelnut", "pecan", "macadamia", "brazil nut", "pine nut", "chilgoza", "chironji"},
+		exclusions: []string{"nutmeg", "water chestnut"},
+	},
+	AllergenSoy: {
+		aliases:  []string{"soy", "soya", "soybean", "soybeans"},
+		keywords: []string{"soy", "soya", "soybean", "tofu", "edamame", "tempeh", "miso"},
+	},
+	AllergenFish: {
+		aliases:  []string{"fish"},
+		keywords: []string{"fish", "salmon", "tuna", "mackerel", "sardine", "anchovy", "cod", "tilapia", "rohu", "pomfret", "surmai", "hilsa", "bangda", "katla"},
+	},
+	AllergenShellfish: {
+		aliases:  []string{"shellfish", "crustaceans", "molluscs", "mollusks", "seafood"},
+		keywords: []string{"shrimp", "prawn", "crab", "lobster", "jhinga", "squid", "oyster", "mussel", "clam", "scallop", "octopus", "calamari", "krill"},
+	},
+	AllergenSesame: {
+		aliases:  []string{"sesame", "sesame-seeds", "til"},
+		keywords: []string{"sesame", "til", "tahini", "gingelly"},
+	},
+	AllergenMustard: {
+		aliases:    []string{"mustard"},
+		keywords:   []string{"mustard", "sarson", "rai"},
+		exclusions: []string{"raisin"},
+	},
+	AllergenCelery: {
+		aliases:  []string{"celery", "celeriac"},
+		keywords: []string{"celery", "celeriac"},
+	},
+	AllergenLupin: {
+		aliases:  []string{"lupin", "lupine"},
+		keywords: []string{"lupin", "lupine"},
+	},
+	AllergenSulphite: {
+		aliases:  []string{"sulphite", "sulphites", "sulfite", "sulfites", "sulphur-dioxide-and-sulphites", "sulphur dioxide"},
+		keywords: []string{"sulphite", "sulfite", "metabisulphite", "metabisulfite", "sulphur dioxide", "sulfur dioxide", "bisulphite"},
+	},
+}
+
+// sulphiteAdditiveCodes are the E-numbers that declare sulphites
+var sulphiteAdditiveCodes = map[string]bool{"E220": true, "E221": true, "E222": true, "E223": true, "E224": true, "E225": true, "E226": true, "E227": true, "E228": true}
+
+// NormalizeAllergen maps user input or an OpenFoodFacts tag ("en:milk",
+// "Dairy", "groundnuts") to a canonical allergen key, or "" if unknown
+func NormalizeAllergen(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if i := strings.Index(value, ":"); i >= 0 {
+		value = value[i+1:]
+	}
+	value = strings.ReplaceAll(value, "_", " ")
+	for key, def := range allergenCatalog {
+		if value == strings.ReplaceAll(key, "_", " ") {
+			return key
+		}
+		for _, alias := range def.aliases {
+			if value == strings.ReplaceAll(alias, "_", " ") {
+				return key
+			}
+		}
+	}
+	return ""
+}
+
+// NormalizeAllergies canonicalizes, deduplicates and sorts a list of allergies.
+// Unknown entries are kept lower-cased so they can still be matched as keywords.
+func NormalizeAllergies(allergies []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, a := range allergies {
+		key := NormalizeAllergen(a)
+		if key == "" {
+			key = strings.ToLower(strings.TrimSpace(a))
+		}
+		if key != "" && !seen[key] {
+			seen[key] = true
+			result = append(result, key)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// DetectProductAllergens lists every canonical allergen a product declares,
+// carries as traces, or reveals through its ingredient list
+func DetectProductAllergens(product *ExtractedNutritionData) []models.AllergenMatch {
+	all := make([]string, 0, len(allergenCatalog))
+	for key := range allergenCatalog {
+		all = append(all, key)
+	}
+	return MatchProductAllergens(all, product)
+}
+
+// MatchProductAllergens checks a product against the given allergies
+func MatchProductAllergens(allergies []string, product *ExtractedNutritionData) []models.AllergenMatch {
+	allergies = NormalizeAllergies(allergies)
+	if len(allergies) == 0 || product == nil {
+		return []models.AllergenMatch{}
+	}
+	info := product.IngredientsAndAdditives
+	matches := []models.AllergenMatch{}
+	found := map[string]bool{}
+	add := func(m models.AllergenMatch) {
+		if !found[m.Allergen+"|"+m.Source] {
+			found[m.Allergen+"|"+m.Source] = true
+			matches = append(matches, m)
+		}
+	}
+
+	for _, allergy := range allergies {
+		for _, declared := range info.Allergens.DeclaredAllergens {
+			if allergenMatches(allergy, declared) {
+				add(models.AllergenMatch{Allergen: allergy, Source: "declared", Evidence: declared})
+			}
+		}
+		for _, trace := range info.Traces.DeclaredTraces {
+			if allergenMatches(allergy, trace) {
+				add(models.AllergenMatch{Allergen: allergy, Source: "traces", Evidence: trace})
+			}
+		}
+		for _, ing := range FlattenIngredients(info.ParsedIngredients) {
+			if evidence, ok := textContainsAllergen(allergy, ing.Name); ok {
+				add(models.AllergenMatch{Allergen: allergy, Source: "ingredients", Evidence: evidence})
+			}
+			if allergy == AllergenSulphite {
+				for _, code := range ing.AdditiveCodes {
+					if sulphiteAdditiveCodes[code] {
+						add(models.AllergenMatch{Allergen: allergy, Source: "ingredients", Evidence: code})
+					}
+				}
+			}
+		}
+	}
+	return matches
+}
+
+// MatchTextAllergens scans free text such as a meal name, description or
+// ingredient list for the given allergies
+func MatchTextAllergens(allergies []string, texts ...string) []models.AllergenMatch {
+	matches := []models.AllergenMatch{}
+	for _, allergy := range NormalizeAllergies(allergies) {
+		for _, text := range texts {
+			if evidence, ok := textContainsAllergen(allergy, text); ok {
+				matches = append(matches, models.AllergenMatch{Allergen: allergy, Source: "text", Evidence: evidence})
+				break
+			}
+		}
+	}
+	return matches
+}
+
+// allergenMatches compares an allergy with a declared allergen or trace entry
+func allergenMatches(allergy, declared string) bool {
+	if key := NormalizeAllergen(declared); key != "" {
+		return key == allergy
+	}
+	_, ok := textContainsAllergen(allergy, declared)
+	return ok
+}
+
+// textContainsAllergen looks for any keyword of the allergy in text, after
+// blanking out exclusion phrases such as "cocoa butter" for milk
+func textContainsAllergen(allergy, text string) (string, bool) {
+	text = strings.ToLower(text)
+	def, known := allergenCatalog[allergy]
+	if !known {
+		// Free-form allergies ("kiwi") are matched literally
+		if allergy != "" && containsWord(text, allergy) {
+			return allergy, true
+		}
+		return "", false
+	}
+	for _, exclusion := range def.exclusions {
+		text = strings.ReplaceAll(text, exclusion, strings.Repeat(" ", len(exclusion)))
+	}
+	for _, keyword := range def.keywords {
+		if containsWord(text, keyword) {
+			return keyword, true
+		}
+	}
+	return "", false
+}
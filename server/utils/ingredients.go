@@ -0,0 +1,196 @@
+package utils
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ParsedIngredient is one entry of an ingredient list, with any nested
+// ingredients from parentheses or brackets as children
+type ParsedIngredient struct {
+	Name           string             `json:"name"`
+	Percent        *float64           `json:"percent,omitempty"`
+	AdditiveCodes  []string           `json:"additive_codes,omitempty"`
+	SubIngredients []ParsedIngredient `json:"sub_ingredients,omitempty"`
+}
+
+var (
+	percentPattern     = regexp.MustCompile(`(\d+(?:[.,]\d+)?)\s*%`)
+	additiveCodeRegexp = regexp.MustCompile(`(?i)\b(?:e|ins)\s*-?\s*(\d{3,4}[a-f]?)\b`)
+	bareCodePattern    = regexp.MustCompile(`^(\d{3,4}[a-f]?)(?:\s*\(?[ivx]+\)?)?$`)
+	romanOnlyPattern   = regexp.MustCompile(`^[ivx]+$`)
+)
+
+// additiveClassNames are the label headings under which Indian and EU labels
+// list additives by bare number, e.g. "Emulsifiers [322(i), 471]"
+var additiveClassNames = []string{
+	"emulsifier", "stabiliser", "stabilizer", "thickener", "raising agent", "leavening agent",
+	"acidity regulator", "acidulant", "preservative", "antioxidant", "colour", "color",
+	"flavour enhancer", "flavor enhancer", "sweetener", "humectant", "anticaking agent",
+	"anti-caking agent", "glazing agent", "dough conditioner", "improver", "gelling agent",
+	"firming agent", "bulking agent", "carrier", "sequestrant", "foaming agent",
+}
+
+// ingredientsPrefix is the heading labels put before the list, in any case
+const ingredientsPrefix = "ingredients:"
+
+// ParseIngredients splits a raw ingredients_text into a tree of ingredients,
+// pulling out percentages and E/INS additive codes along the way
+func ParseIngredients(text string) []ParsedIngredient {
+	text = strings.TrimSpace(text)
+	if len(text) >= len(ingredientsPrefix) && strings.EqualFold(text[:len(ingredientsPrefix)], ingredientsPrefix) {
+		text = text[len(ingredientsPrefix):]
+	}
+	p := &ingredientParser{input: []rune(text)}
+	return p.parseList(0, false)
+}
+
+// FlattenIngredients walks the tree depth-first, parents before children
+func FlattenIngredients(ingredients []ParsedIngredient) []ParsedIngredient {
+	var flat []ParsedIngredient
+	for _, ing := range ingredients {
+		flat = append(flat, ing)
+		flat = append(flat, FlattenIngredients(ing.SubIngredients)...)
+	}
+	return flat
+}
+
+type ingredientParser struct {
+	input []rune
+	pos   int
+}
+
+// parseList reads comma-separated ingredients until the matching closing
+// bracket (when nested) or the end of input
+func (p *ingredientParser) parseList(depth int, isAdditiveClass bool) []ParsedIngredient {
+	var items []ParsedIngredient
+	for p.pos < len(p.input) {
+		item, closed := p.parseItem(depth, isAdditiveClass)
+		if item.Name != "" || len(item.SubIngredients) > 0 {
+			items = append(items, item)
+		}
+		if closed {
+			break
+		}
+	}
+	return items
+}
+
+// parseItem reads one ingredient and reports whether it hit a closing bracket
+func (p *ingredientParser) parseItem(depth int, inAdditiveClass bool) (ParsedIngredient, bool) {
+	var name strings.Builder
+	var item ParsedIngredient
+	closed := false
+
+loop:
+	for p.pos < len(p.input) {
+		r := p.input[p.pos]
+		switch r {
+		case ',', ';':
+			p.pos++
+			break loop
+		case ')', ']', '}':
+			p.pos++
+			if depth > 0 {
+				closed = true
+				break loop
+			}
+		case '(', '[', '{':
+			p.pos++
+			start := p.pos
+			isClass := isAdditiveClassName(name.String())
+			children := p.parseList(depth+1, isClass)
+			raw := strings.TrimSpace(string(p.input[start:max(start, p.pos-1)]))
+			switch {
+			case romanOnlyPattern.MatchString(strings.ToLower(raw)):
+				// "503(ii)" style sub-numbers belong to the code itself
+				name.WriteString("(" + raw + ")")
+			case isPercentOnly(raw):
+				item.Percent = parsePercent(raw)
+			default:
+				item.SubIngredients = append(item.SubIngredients, children...)
+			}
+		default:
+			name.WriteRune(r)
+			p.pos++
+		}
+	}
+
+	item.Name = cleanIngredientName(name.String())
+	if item.Percent == nil {
+		if m := percentPattern.FindStringSubmatch(item.Name); m != nil {
+			item.Percent = parsePercent(m[0])
+			item.Name = cleanIngredientName(percentPattern.ReplaceAllString(item.Name, ""))
+		}
+	}
+	item.AdditiveCodes = extractAdditiveCodes(item.Name, inAdditiveClass)
+	return item, closed
+}
+
+func extractAdditiveCodes(name string, inAdditiveClass bool) []string {
+	var codes []string
+	for _, m := range additiveCodeRegexp.FindAllStringSubmatch(name, -1) {
+		codes = append(codes, NormalizeAdditiveCode(m[1]))
+	}
+	if len(codes) == 0 && inAdditiveClass {
+		if m := bareCodePattern.FindStringSubmatch(strings.ToLower(name)); m != nil {
+			codes = append(codes, NormalizeAdditiveCode(m[1]))
+		}
+	}
+	return codes
+}
+
+// NormalizeAdditiveCode turns "ins 322", "322(i)", "e150d" or "en:e471" into
+// the canonical "E322", "E150d", "E471" form used by the additive database
+func NormalizeAdditiveCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.TrimPrefix(code, "en:")
+	code = strings.TrimPrefix(code, "ins")
+	code = strings.TrimPrefix(code, "e")
+	code = strings.TrimSpace(strings.TrimPrefix(code, "-"))
+	end := 0
+	for end < len(code) && code[end] >= '0' && code[end] <= '9' {
+		end++
+	}
+	if end == 0 {
+		return ""
+	}
+	suffix := ""
+	if end < len(code) && code[end] >= 'a' && code[end] <= 'f' && (end+1 == len(code) || !isWordChar(code[end+1])) {
+		suffix = code[end : end+1]
+	}
+	return "E" + code[:end] + suffix
+}
+
+func isAdditiveClassName(name string) bool {
+	name = strings.ToLower(name)
+	for _, class := range additiveClassNames {
+		if strings.Contains(name, class) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPercentOnly(s string) bool {
+	m := percentPattern.FindString(s)
+	return m != "" && strings.TrimSpace(strings.Replace(s, m, "", 1)) == ""
+}
+
+func parsePercent(s string) *float64 {
+	m := percentPattern.FindStringSubmatch(s)
+	if m == nil {
+		return nil
+	}
+	v, err := strconv.ParseFloat(strings.Replace(m[1], ",", ".", 1), 64)
+	if err != nil {
+		return nil
+	}
+	return &v
+}
+
+func cleanIngredientName(name string) string {
+	name = strings.Join(strings.Fields(name), " ")
+	return strings.Trim(name, ".:*_ ")
+}
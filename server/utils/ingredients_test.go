@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseIngredients(t *testing.T) {
+	got := ParseIngredients("Ingredients: Wheat flour (62%), sugar, edible vegetable oil (palm oil), " +
+		"emulsifiers [322(i), 471], raising agent (503(ii)), salt 1.5%, cocoa solids {cocoa mass, cocoa butter}.")
+
+	want := []ParsedIngredient{
+		{Name: "Wheat flour", Percent: float(62)},
+		{Name: "sugar"},
+		{Name: "edible vegetable oil", SubIngredients: []ParsedIngredient{{Name: "palm oil"}}},
+		{Name: "emulsifiers", SubIngredients: []ParsedIngredient{
+			{Name: "322(i)", AdditiveCodes: []string{"E322"}},
+			{Name: "471", AdditiveCodes: []string{"E471"}},
+		}},
+		{Name: "raising agent", SubIngredients: []ParsedIngredient{
+			{Name: "503(ii)", AdditiveCodes: []string{"E503"}},
+		}},
+		{Name: "salt", Percent: float(1.5)},
+		{Name: "cocoa solids", SubIngredients: []ParsedIngredient{{Name: "cocoa mass"}, {Name: "cocoa butter"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseIngredients:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestParseIngredientsAdditiveCodes(t *testing.T) {
+	tests := []struct {
+		text  string
+		codes []string
+	}{
+		// Coded additives are found anywhere
+		{"Acidity regulator INS 330", []string{"E330"}},
+		{"colour E150d", []string{"E150d"}},
+		{"preservative (E-211)", []string{"E211"}},
+		// Bare numbers are only codes under an additive class heading
+		{"Emulsifier (471)", []string{"E471"}},
+		{"Vitamins (300, 101)", nil},
+	}
+	for _, tt := range tests {
+		var codes []string
+		for _, ing := range FlattenIngredients(ParseIngredients(tt.text)) {
+			codes = append(codes, ing.AdditiveCodes...)
+		}
+		if !reflect.DeepEqual(codes, tt.codes) {
+			t.Errorf("ParseIngredients(%q) codes = %v, want %v", tt.text, codes, tt.codes)
+		}
+	}
+}
+
+func TestParseIngredientsEmpty(t *testing.T) {
+	for _, text := range []string{"", "   ", "Ingredients:", "ingredients:", ", ;"} {
+		if got := ParseIngredients(text); len(got) != 0 {
+			t.Errorf("ParseIngredients(%q) = %+v, want none", text, got)
+		}
+	}
+}
+
+func TestFlattenIngredients(t *testing.T) {
+	flat := FlattenIngredients(ParseIngredients("a (b (c), d), e"))
+	var names []string
+	for _, ing := range flat {
+		names = append(names, ing.Name)
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("FlattenIngredients = %v, want %v", names, want)
+	}
+}
+
+func TestNormalizeAdditiveCode(t *testing.T) {
+	tests := map[string]string{
+		"ins 322":  "E322",
+		"INS-330":  "E330",
+		"322(i)":   "E322",
+		"e150d":    "E150d",
+		"E150D":    "E150d",
+		"en:e471":  "E471",
+		" E 1422 ": "E1422",
+		"e160a(i)": "E160a",
+		"lecithin": "",
+		"":         "",
+	}
+	for in, want := range tests {
+		if got := NormalizeAdditiveCode(in); got != want {
+			t.Errorf("NormalizeAdditiveCode(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestLookupAdditive(t *testing.T) {
+	info, ok := LookupAdditive("INS 322(i)")
+	if !ok || info.Code != "E322" {
+		t.Errorf("LookupAdditive(INS 322(i)) = %+v, %v, want E322", info, ok)
+	}
+	if _, ok := LookupAdditive("E9999"); ok {
+		t.Errorf("LookupAdditive(E9999) found an unknown additive")
+	}
+}
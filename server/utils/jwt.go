@@ -3,6 +3,8 @@ package utils
 import (
 	"amobagan/config"
 	"amobagan/models"
+	"context"
+	"errors"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -11,7 +13,23 @@ import (
 
 var cfg = config.LoadConfig()
 
-func GenerateJWT(user models.User) (string, error) {
+// ErrTokenRevoked is returned for access tokens of a signed out or revoked session
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// TokenDenylist reports whether the tokens of a session were revoked
+type TokenDenylist interface {
+	IsRevoked(ctx context.Context, sessionID string) bool
+}
+
+var tokenDenylist TokenDenylist
+
+// SetTokenDenylist installs the check VerifyAccessToken runs on every token
+func SetTokenDenylist(denylist TokenDenylist) {
+	tokenDenylist = denylist
+}
+
+// GenerateJWT issues a short-lived access token bound to a session
+func GenerateJWT(user models.User, sessionID string) (string, error) {
 	claims := jwt.MapClaims{
 		"userId": user.ID.Hex(),
 		"fullName": user.FullName,
@@ -20,7 +38,9 @@ func GenerateJWT(user models.User) (string, error) {
 		"age": user.Age,
 		"height": user.Height,
 		"weight": user.Weight,
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
+		"role": models.NormalizeRole(user.Role),
+		"sid": sessionID,
+		"exp": time.Now().Add(cfg.AccessTokenTTL).Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
@@ -38,6 +58,25 @@ func VerifyJWT(token string) (jwt.MapClaims, error) {
 	return claims, nil
 }
 
+// VerifyAccessToken verifies an access token and checks that its session
+// hasn't been revoked
+func VerifyAccessToken(ctx context.Context, token string) (jwt.MapClaims, error) {
+	claims, err := VerifyJWT(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens issued before sessions existed can't be revoked, so they're refused
+	sessionID, ok := claims["sid"].(string)
+	if !ok || sessionID == "" {
+		return nil, jwt.ErrTokenInvalidClaims
+	}
+	if tokenDenylist != nil && tokenDenylist.IsRevoked(ctx, sessionID) {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
 func GetUserIDFromToken(token string) (string, error) {
 	claims, err := VerifyJWT(token)
 	if err != nil {
@@ -60,7 +99,7 @@ func VerifyTokenFromQuery(c *gin.Context) (jwt.MapClaims, string, error) {
 		return nil, "", jwt.ErrSignatureInvalid
 	}
 
-	claims, err := VerifyJWT(token)
+	claims, err := VerifyAccessToken(c.Request.Context(), token)
 	if err != nil {
 		return nil, "", err
 	}
@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"strings"
+)
+
+// NovaEvidence is one ingredient that pushed the classification to its group
+type NovaEvidence struct {
+	Ingredient string `json:"ingredient"`
+	Marker     string `json:"marker"`
+	Group      int    `json:"group"`
+}
+
+// NovaClassification is the locally computed NOVA group with its reasons
+type NovaClassification struct {
+	Group    int            `json:"group"`
+	Evidence []NovaEvidence `json:"evidence"`
+}
+
+type novaMarker struct {
+	name     string
+	group    int
+	patterns []string
+}
+
+// novaMarkers are matched against lower-cased ingredient names. Group 4 lists
+// the industrial ingredients and cosmetic additives that define ultra-processing,
+// group 3 the preservatives used in plain processed foods and group 2 the
+// culinary ingredients themselves. Coded additives are classified through the
+// additive database instead, see novaAdditiveGroups.
+var novaMarkers = []novaMarker{
+	{"emulsifier", 4, []string{"emulsifier", "lecithin", "mono- and diglycerides", "mono and diglycerides", "polysorbate"}},
+	{"flavouring", 4, []string{"flavour", "flavor", "flavouring", "flavoring"}},
+	{"modified_starch", 4, []string{"modified starch", "modified corn starch", "modified maize starch"}},
+	{"sweetener", 4, []string{"sweetener", "aspartame", "sucralose", "acesulfame", "saccharin", "steviol", "sorbitol", "maltitol", "xylitol"}},
+	{"flavour_enhancer", 4, []string{"flavour enhancer", "flavor enhancer", "monosodium glutamate", "msg", "disodium inosinate", "disodium guanylate"}},
+	{"colour", 4, []string{"colour", "color", "tartrazine", "sunset yellow", "caramel"}},
+	{"industrial_sugar", 4, []string{"glucose syrup", "corn syrup", "high fructose", "invert sugar", "invert syrup", "maltodextrin", "dextrose", "liquid glucose"}},
+	{"industrial_oil", 4, []string{"hydrogenated", "interesterified"}},
+	{"protein_isolate", 4, []string{"protein isolate", "hydrolysed protein", "hydrolyzed protein", "soy protein concentrate", "whey protein concentrate"}},
+	{"texturiser", 4, []string{"thickener", "stabiliser", "stabilizer", "carrageenan", "xanthan", "gelling agent", "humectant", "anticaking", "anti-caking", "glazing agent"}},
+	{"preservative", 3, []string{"preservative", "sodium benzoate", "potassium sorbate", "citric acid", "ascorbic acid", "acidity regulator"}},
+	{"culinary_ingredient", 2, []string{"sugar", "salt", "oil", "butter", "ghee", "jaggery", "honey", "vinegar", "starch", "maida", "refined wheat flour"}},
+}
+
+// novaAdditiveGroups maps additive function classes to the NOVA group they imply
+var novaAdditiveGroups = map[string]int{
+	"colour":            4,
+	"emulsifier":        4,
+	"sweetener":         4,
+	"flavour_enhancer":  4,
+	"thickener":         4,
+	"stabiliser":        4,
+	"modified_starch":   4,
+	"glazing_agent":     4,
+	"humectant":         4,
+	"improver":          4,
+	"preservative":      3,
+	"antioxidant":       3,
+	"acidity_regulator": 3,
+	"raising_agent":     3,
+	"anticaking_agent":  3,
+}
+
+// ClassifyNova assigns a NOVA group from a raw ingredients_text. It returns
+// group 0 when there is no ingredient list to classify.
+func ClassifyNova(ingredientsText string) NovaClassification {
+	ingredients := FlattenIngredients(ParseIngredients(strings.ToLower(ingredientsText)))
+	if len(ingredients) == 0 {
+		return NovaClassification{Evidence: []NovaEvidence{}}
+	}
+
+	evidence := []NovaEvidence{}
+	hasCulinary := false
+	hasOther := false
+	maxGroup := 1
+	for _, ingredient := range ingredients {
+		if groupEvidence, ok := novaFromAdditiveCodes(ingredient); ok {
+			hasOther = true
+			evidence = append(evidence, groupEvidence...)
+			for _, e := range groupEvidence {
+				maxGroup = max(maxGroup, e.Group)
+			}
+			continue
+		}
+
+		marker, ok := matchNovaMarker(ingredient.Name)
+		if !ok {
+			hasOther = true
+			continue
+		}
+		if marker.group == 2 {
+			hasCulinary = true
+		} else {
+			hasOther = true
+		}
+		evidence = append(evidence, NovaEvidence{Ingredient: ingredient.Name, Marker: marker.name, Group: marker.group})
+		if marker.group > maxGroup {
+			maxGroup = marker.group
+		}
+	}
+
+	// Culinary ingredients on their own are group 2; mixed into other foods
+	// they make a processed (group 3) product
+	group := maxGroup
+	if maxGroup == 2 && hasOther {
+		group = 3
+	}
+	if maxGroup < 2 && hasCulinary {
+		group = 2
+	}
+
+	// Only keep the evidence that explains the final group
+	relevant := evidence[:0]
+	for _, e := range evidence {
+		if e.Group == group || (group == 3 && e.Group == 2) {
+			relevant = append(relevant, e)
+		}
+	}
+
+	return NovaClassification{Group: group, Evidence: relevant}
+}
+
+// NovaProcessingLevel names a NOVA group the way ProcessingIndicators does
+func NovaProcessingLevel(group int) string {
+	switch group {
+	case 1:
+		return "unprocessed_or_minimally_processed"
+	case 2:
+		return "processed_culinary_ingredient"
+	case 3:
+		return "processed"
+	case 4:
+		return "ultra_processed"
+	default:
+		return "unknown"
+	}
+}
+
+func matchNovaMarker(ingredient string) (novaMarker, bool) {
+	for _, marker := range novaMarkers {
+		for _, pattern := range marker.patterns {
+			if containsWord(ingredient, pattern) {
+				return marker, true
+			}
+		}
+	}
+	return novaMarker{}, false
+}
+
+// wordSuffixes are the plural and -ing endings containsWord accepts
+var wordSuffixes = []string{"", "s", "es", "ing"}
+
+// containsWord reports whether pattern occurs in s on word boundaries, so
+// "oil" doesn't match "boiled" or "oilseed" and "msg" doesn't match inside
+// other words. Plural and -ing forms such as "starches" still match.
+func containsWord(s, pattern string) bool {
+	for start := 0; ; {
+		i := strings.Index(s[start:], pattern)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(pattern)
+		if i == 0 || !isWordChar(s[i-1]) {
+			for _, suffix := range wordSuffixes {
+				if !strings.HasPrefix(s[end:], suffix) {
+					continue
+				}
+				if after := end + len(suffix); after == len(s) || !isWordChar(s[after]) {
+					return true
+				}
+			}
+		}
+		start = i + 1
+	}
+}
+
+func isWordChar(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+}
+
+// novaFromAdditiveCodes classifies an ingredient carrying E/INS codes by the
+// function class of each additive it names
+func novaFromAdditiveCodes(ingredient ParsedIngredient) ([]NovaEvidence, bool) {
+	var evidence []NovaEvidence
+	for _, code := range ingredient.AdditiveCodes {
+		info, ok := LookupAdditive(code)
+		if !ok {
+			continue
+		}
+		if group, ok := novaAdditiveGroups[info.FunctionClass]; ok {
+			evidence = append(evidence, NovaEvidence{
+				Ingredient: ingredient.Name,
+				Marker:     info.FunctionClass + " " + info.Code,
+				Group:      group,
+			})
+		}
+	}
+	return evidence, len(evidence) > 0
+}
@@ -0,0 +1,118 @@
+package utils
+
+import "testing"
+
+func TestClassifyNova(t *testing.T) {
+	tests := []struct {
+		ingredients string
+		group       int
+		markers     []string
+	}{
+		{"", 0, nil},
+		{"Whole wheat", 1, nil},
+		{"Boiled potatoes", 1, nil},
+		{"Sugar", 2, []string{"culinary_ingredient"}},
+		{"Sunflower oil", 2, []string{"culinary_ingredient"}},
+		{"Chickpeas, water, salt", 3, []string{"culinary_ingredient"}},
+		{"Tomatoes, salt, citric acid", 3, []string{"culinary_ingredient", "preservative"}},
+		{"Peanuts, salt, E211", 3, []string{"culinary_ingredient", "preservative E211"}},
+		{"Milk, INS 330", 3, []string{"acidity_regulator E330"}},
+		{"Apples, glucose syrup", 4, []string{"industrial_sugar"}},
+		{"Rice, natural flavourings", 4, []string{"flavouring"}},
+		{"Oilseeds", 1, nil},
+		{"Water, sugar, colour (150d)", 4, []string{"colour", "colour E150d"}},
+		{
+			"Refined wheat flour (maida), palm oil, sugar, emulsifier (ins 322), flavour", 4,
+			[]string{"emulsifier", "emulsifier E322", "flavouring"},
+		},
+	}
+	for _, tt := range tests {
+		got := ClassifyNova(tt.ingredients)
+		if got.Group != tt.group {
+			t.Errorf("ClassifyNova(%q) group = %d, want %d", tt.ingredients, got.Group, tt.group)
+			continue
+		}
+		if len(got.Evidence) != len(tt.markers) {
+			t.Errorf("ClassifyNova(%q) evidence = %+v, want markers %v", tt.ingredients, got.Evidence, tt.markers)
+			continue
+		}
+		for i, e := range got.Evidence {
+			if e.Marker != tt.markers[i] {
+				t.Errorf("ClassifyNova(%q) evidence %d = %q, want %q", tt.ingredients, i, e.Marker, tt.markers[i])
+			}
+		}
+	}
+}
+
+func TestContainsWord(t *testing.T) {
+	tests := []struct {
+		s, pattern string
+		want       bool
+	}{
+		{"palm oil", "oil", true},
+		{"vegetable oils", "oil", true},
+		{"boiled potatoes", "oil", false},
+		{"natural flavouring", "flavour", true},
+		{"msg", "msg", true},
+		{"msgx", "msg", false},
+		{"oilseed rape", "oil", false},
+		{"milkshake powder", "milk", false},
+		{"modified starches", "starch", true},
+		{"natural flavourings", "flavour", false},
+		{"sugar-free", "sugar", true},
+	}
+	for _, tt := range tests {
+		if got := containsWord(tt.s, tt.pattern); got != tt.want {
+			t.Errorf("containsWord(%q, %q) = %v, want %v", tt.s, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestNovaProcessingLevel(t *testing.T) {
+	tests := map[int]string{
+		0: "unknown",
+		1: "unprocessed_or_minimally_processed",
+		2: "processed_culinary_ingredient",
+		3: "processed",
+		4: "ultra_processed",
+	}
+	for group, want := range tests {
+		if got := NovaProcessingLevel(group); got != want {
+			t.Errorf("NovaProcessingLevel(%d) = %q, want %q", group, got, want)
+		}
+	}
+}
+
+func TestExtractProcessingClassification(t *testing.T) {
+	tests := []struct {
+		name   string
+		nova   interface{}
+		group  string
+		source string
+		level  string
+	}{
+		{"upstream group wins", "3", "3", "openfoodfacts", "processed"},
+		{"numeric upstream group", 1.0, "1", "openfoodfacts", "unprocessed_or_minimally_processed"},
+		{"computed without upstream", nil, "4", "computed", "ultra_processed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			product := map[string]interface{}{
+				"ingredients_text": "Ingredients: Wheat flour, sugar, emulsifier (lecithin)",
+			}
+			if tt.nova != nil {
+				product["nova_group"] = tt.nova
+			}
+			got := extractProcessingClassification(product)
+			if got.NovaGroup != tt.group || got.NovaGroupSource != tt.source {
+				t.Errorf("group %q from %q, want %q from %q", got.NovaGroup, got.NovaGroupSource, tt.group, tt.source)
+			}
+			if level := got.ProcessingIndicators.LikelyProcessingLevel; level != tt.level {
+				t.Errorf("level = %q, want %q", level, tt.level)
+			}
+			if got.ProcessingIndicators.ComputedNovaGroup != 4 {
+				t.Errorf("computed group = %d, want 4", got.ProcessingIndicators.ComputedNovaGroup)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package utils
+
+import (
+	"strings"
+)
+
+// Nutri-Score 2023 categories, each with its own point tables and grade cut-offs
+const (
+	NutriScoreCategoryGeneral  = "general"
+	NutriScoreCategoryBeverage = "beverage"
+	NutriScoreCategoryFat      = "fat_oil_nut_seed"
+	NutriScoreCategoryCheese   = "cheese"
+	NutriScoreCategoryWater    = "water"
+)
+
+// NutriScoreInput holds everything the 2023 algorithm needs for one product
+type NutriScoreInput struct {
+	Category string
+	Per100g  NutrientValues
+	// MissingNutrients names values absent from the source, see
+	// NutritionalInformation.MissingNutrients
+	MissingNutrients               []string
+	FruitsVegetablesLegumesPercent float64
+	NonNutritiveSweeteners         bool
+	RedMeat                        bool
+}
+
+// NutriScoreResult is the computed score with its point breakdown
+type NutriScoreResult struct {
+	Category           string         `json:"category"`
+	Grade              string         `json:"grade"`
+	Score              int            `json:"score"`
+	NegativePoints     int            `json:"negative_points"`
+	PositivePoints     int            `json:"positive_points"`
+	NegativeComponents map[string]int `json:"negative_components"`
+	PositiveComponents map[string]int `json:"positive_components"`
+	ProteinsCounted    bool           `json:"proteins_counted"`
+	// InsufficientData is set, and Grade left empty, when a required
+	// nutrient is missing
+	InsufficientData bool     `json:"insufficient_data,omitempty"`
+	MissingNutrients []string `json:"missing_nutrients,omitempty"`
+}
+
+// nutriScoreRequired are the nutrients without which no grade is given; fat
+// products also need total fat for the saturated fat ratio
+var nutriScoreRequired = []string{NutrientEnergy, NutrientSugars, NutrientSaturatedFat, NutrientSalt}
+
+// Point thresholds: a value strictly above thresholds[i] earns i+1 points
+var (
+	generalEnergyKjThresholds  = []float64{335, 670, 1005, 1340, 1675, 2010, 2345, 2680, 3015, 3350}
+	generalSugarsThresholds    = []float64{3.4, 6.8, 10, 14, 17, 20, 24, 27, 31, 34, 37, 41, 44, 48, 51}
+	saturatedFatThresholds     = []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	saltThresholds             = []float64{0.2, 0.4, 0.6, 0.8, 1, 1.2, 1.4, 1.6, 1.8, 2, 2.2, 2.4, 2.6, 2.8, 3, 3.2, 3.4, 3.6, 3.8, 4}
+	generalProteinThresholds   = []float64{2.4, 4.8, 7.2, 9.6, 12, 14, 17}
+	fiberThresholds            = []float64{3.0, 4.1, 5.2, 6.3, 7.4}
+	fatEnergySatFatThresholds  = []float64{120, 240, 360, 480, 600, 720, 840, 960, 1080, 1200}
+	fatSatFatRatioThresholds   = []float64{10, 16, 22, 28, 34, 40, 46, 52, 58, 64}
+	beverageEnergyKjThresholds = []float64{30, 90, 150, 210, 240, 270, 300, 330, 360, 390}
+	beverageSugarsThresholds   = []float64{0.5, 2, 3.5, 5, 6, 7, 8, 9, 10, 11}
+	beverageProteinThresholds  = []float64{1.2, 1.5, 1.8, 2.1, 2.4, 2.7, 3.0}
+)
+
+// ComputeNutriScore applies the Nutri-Score 2023 algorithm to per-100g values
+func ComputeNutriScore(input NutriScoreInput) NutriScoreResult {
+	per100g := input.Per100g
+	category := input.Category
+	if category == "" {
+		category = NutriScoreCategoryGeneral
+	}
+
+	result := NutriScoreResult{
+		Category:           category,
+		NegativeComponents: map[string]int{},
+		PositiveComponents: map[string]int{},
+	}
+
+	if category == NutriScoreCategoryWater {
+		result.Grade = "a"
+		return result
+	}
+
+	required := nutriScoreRequired
+	if category == NutriScoreCategoryFat {
+		required = append([]string{NutrientFat}, required...)
+	}
+	for _, nutrient := range required {
+		for _, missing := range input.MissingNutrients {
+			if missing == nutrient {
+				result.MissingNutrients = append(result.MissingNutrients, nutrient)
+			}
+		}
+	}
+	if len(result.MissingNutrients) > 0 {
+		result.InsufficientData = true
+		return result
+	}
+
+	energyKj := per100g.EnergyKj
+	if energyKj == 0 {
+		energyKj = per100g.EnergyKcal * 4.184
+	}
+	salt := per100g.Salt
+	if salt == 0 && per100g.Sodium > 0 {
+		salt = per100g.Sodium * 2.5
+	}
+	fiber := 0.0
+	if per100g.Fiber != nil {
+		fiber = *per100g.Fiber
+	}
+
+	neg := result.NegativeComponents
+	pos := result.PositiveComponents
+
+	switch category {
+	case NutriScoreCategoryBeverage:
+		neg["energy"] = pointsAbove(energyKj, beverageEnergyKjThresholds)
+		neg["sugars"] = pointsAbove(per100g.Sugars, beverageSugarsThresholds)
+		neg["saturated_fat"] = pointsAbove(per100g.SaturatedFat, saturatedFatThresholds)
+		neg["salt"] = pointsAbove(salt, saltThresholds)
+		if input.NonNutritiveSweeteners {
+			neg["non_nutritive_sweeteners"] = 4
+		}
+		pos["proteins"] = pointsAbove(per100g.Proteins, beverageProteinThresholds)
+		pos["fiber"] = pointsAbove(fiber, fiberThresholds)
+		pos["fruits_vegetables_legumes"] = beverageFVLPoints(input.FruitsVegetablesLegumesPercent)
+	case NutriScoreCategoryFat:
+		satFatRatio := 0.0
+		if per100g.FatTotal > 0 {
+			satFatRatio = per100g.SaturatedFat / per100g.FatTotal * 100
+		}
+		neg["energy_from_saturated_fat"] = pointsAbove(per100g.SaturatedFat*37, fatEnergySatFatThresholds)
+		neg["sugars"] = pointsAbove(per100g.Sugars, generalSugarsThresholds)
+		neg["saturated_fat_ratio"] = pointsAbove(satFatRatio, fatSatFatRatioThresholds)
+		neg["salt"] = pointsAbove(salt, saltThresholds)
+		pos["proteins"] = pointsAbove(per100g.Proteins, generalProteinThresholds)
+		pos["fiber"] = pointsAbove(fiber, fiberThresholds)
+		pos["fruits_vegetables_legumes"] = generalFVLPoints(input.FruitsVegetablesLegumesPercent)
+	default:
+		neg["energy"] = pointsAbove(energyKj, generalEnergyKjThresholds)
+		neg["sugars"] = pointsAbove(per100g.Sugars, generalSugarsThresholds)
+		neg["saturated_fat"] = pointsAbove(per100g.SaturatedFat, saturatedFatThresholds)
+		neg["salt"] = pointsAbove(salt, saltThresholds)
+		pos["proteins"] = pointsAbove(per100g.Proteins, generalProteinThresholds)
+		pos["fiber"] = pointsAbove(fiber, fiberThresholds)
+		pos["fruits_vegetables_legumes"] = generalFVLPoints(input.FruitsVegetablesLegumesPercent)
+	}
+
+	if input.RedMeat && pos["proteins"] > 2 {
+		pos["proteins"] = 2
+	}
+
+	for _, p := range neg {
+		result.NegativePoints += p
+	}
+
+	// Proteins only count for products that aren't already heavily penalised,
+	// with cheese and beverages exempt
+	proteinCap := 11
+	if category == NutriScoreCategoryFat {
+		proteinCap = 7
+	}
+	result.ProteinsCounted = category == NutriScoreCategoryCheese ||
+		category == NutriScoreCategoryBeverage ||
+		result.NegativePoints < proteinCap
+	for name, p := range pos {
+		if name == "proteins" && !result.ProteinsCounted {
+			continue
+		}
+		result.PositivePoints += p
+	}
+
+	result.Score = result.NegativePoints - result.PositivePoints
+	result.Grade = nutriScoreGrade(category, result.Score)
+	return result
+}
+
+// DetectNutriScoreCategory picks the 2023 category from OpenFoodFacts category tags
+func DetectNutriScoreCategory(categoryTags []string) (category string, redMeat bool) {
+	category = NutriScoreCategoryGeneral
+	for _, tag := range categoryTags {
+		tag = strings.TrimPrefix(strings.ToLower(tag), "en:")
+		switch {
+		case tag == "waters" || tag == "mineral-waters" || tag == "spring-waters":
+			return NutriScoreCategoryWater, false
+		case strings.Contains(tag, "cheese"):
+			category = NutriScoreCategoryCheese
+		case tag == "fats" || tag == "vegetable-oils" || tag == "olive-oils" || tag == "butters" ||
+			tag == "nuts" || tag == "seeds" || tag == "ghee" || tag == "margarines":
+			if category == NutriScoreCategoryGeneral {
+				category = NutriScoreCategoryFat
+			}
+		case tag == "beverages" || tag == "drinks":
+			if category == NutriScoreCategoryGeneral {
+				category = NutriScoreCategoryBeverage
+			}
+		case tag == "red-meats" || tag == "beef" || tag == "pork" || tag == "lamb" || tag == "mutton":
+			redMeat = true
+		}
+	}
+	// Dairy drinks and plant milks are still beverages, but milk itself is a food
+	if category == NutriScoreCategoryBeverage {
+		for _, tag := range categoryTags {
+			if strings.TrimPrefix(strings.ToLower(tag), "en:") == "milks" {
+				return NutriScoreCategoryGeneral, redMeat
+			}
+		}
+	}
+	return category, redMeat
+}
+
+func pointsAbove(value float64, thresholds []float64) int {
+	points := 0
+	for _, t := range thresholds {
+		if value > t {
+			points++
+		}
+	}
+	return points
+}
+
+func generalFVLPoints(percent float64) int {
+	switch {
+	case percent > 80:
+		return 5
+	case percent > 60:
+		return 2
+	case percent > 40:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func beverageFVLPoints(percent float64) int {
+	switch {
+	case percent > 80:
+		return 6
+	case percent > 60:
+		return 4
+	case percent > 40:
+		return 2
+	default:
+		return 0
+	}
+}
+
+func nutriScoreGrade(category string, score int) string {
+	switch category {
+	case NutriScoreCategoryBeverage:
+		switch {
+		case score <= 2:
+			return "b"
+		case score <= 6:
+			return "c"
+		case score <= 9:
+			return "d"
+		default:
+			return "e"
+		}
+	case NutriScoreCategoryFat:
+		switch {
+		case score <= -6:
+			return "a"
+		case score <= 2:
+			return "b"
+		case score <= 10:
+			return "c"
+		case score <= 18:
+			return "d"
+		default:
+			return "e"
+		}
+	default:
+		switch {
+		case score <= 0:
+			return "a"
+		case score <= 2:
+			return "b"
+		case score <= 10:
+			return "c"
+		case score <= 18:
+			return "d"
+		default:
+			return "e"
+		}
+	}
+}
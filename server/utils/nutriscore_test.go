@@ -0,0 +1,209 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func float(v float64) *float64 {
+	return &v
+}
+
+// Worked examples with points taken from the 2023 tables
+func TestComputeNutriScore(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    NutriScoreInput
+		negative int
+		positive int
+		score    int
+		grade    string
+	}{
+		{
+			// energy 5, sugars 7, saturated fat 9, salt 2; 23 negative
+			// points so the 2 protein points don't count
+			name: "general: sweet biscuit",
+			input: NutriScoreInput{
+				Category: NutriScoreCategoryGeneral,
+				Per100g:  NutrientValues{EnergyKj: 2000, Sugars: 25, SaturatedFat: 10, Salt: 0.5, Proteins: 6, Fiber: float(2)},
+			},
+			negative: 23, positive: 0, score: 23, grade: "e",
+		},
+		{
+			// energy 4, saturated fat 1; proteins 5, fiber 5
+			name: "general: oat flakes",
+			input: NutriScoreInput{
+				Category: NutriScoreCategoryGeneral,
+				Per100g:  NutrientValues{EnergyKj: 1500, Sugars: 1, SaturatedFat: 1.2, Salt: 0.01, Proteins: 13, Fiber: float(10)},
+			},
+			negative: 5, positive: 10, score: -5, grade: "a",
+		},
+		{
+			// salt comes from sodium: 0.4 g sodium is 1 g salt, 4 points
+			name: "general: salt from sodium",
+			input: NutriScoreInput{
+				Per100g: NutrientValues{EnergyKcal: 100, Sugars: 2, SaturatedFat: 0.5, Sodium: 0.4, Proteins: 3},
+			},
+			negative: 5, positive: 1, score: 4, grade: "c",
+		},
+		{
+			// energy 2, saturated fat 5; proteins 7 capped at 2 for red meat
+			name: "general: beef mince",
+			input: NutriScoreInput{
+				Category: NutriScoreCategoryGeneral,
+				Per100g:  NutrientValues{EnergyKj: 1000, SaturatedFat: 6, Salt: 0.2, Proteins: 20},
+				RedMeat:  true,
+			},
+			negative: 7, positive: 2, score: 5, grade: "c",
+		},
+		{
+			// energy 5, saturated fat 10, salt 8; proteins always count
+			name: "cheese: cheddar",
+			input: NutriScoreInput{
+				Category: NutriScoreCategoryCheese,
+				Per100g:  NutrientValues{EnergyKj: 1700, Sugars: 0.1, SaturatedFat: 21, Salt: 1.8, Proteins: 25},
+			},
+			negative: 23, positive: 7, score: 16, grade: "d",
+		},
+		{
+			// energy 3, sugars 9
+			name: "beverage: cola",
+			input: NutriScoreInput{
+				Category: NutriScoreCategoryBeverage,
+				Per100g:  NutrientValues{EnergyKj: 180, Sugars: 10.6},
+			},
+			negative: 12, positive: 0, score: 12, grade: "e",
+		},
+		{
+			// 4 points for non-nutritive sweeteners
+			name: "beverage: diet cola",
+			input: NutriScoreInput{
+				Category:               NutriScoreCategoryBeverage,
+				Per100g:                NutrientValues{EnergyKj: 1},
+				NonNutritiveSweeteners: true,
+			},
+			negative: 4, positive: 0, score: 4, grade: "c",
+		},
+		{
+			// energy 3, sugars 7; fruit 6
+			name: "beverage: orange juice",
+			input: NutriScoreInput{
+				Category:                       NutriScoreCategoryBeverage,
+				Per100g:                        NutrientValues{EnergyKj: 190, Sugars: 9, Proteins: 0.7},
+				FruitsVegetablesLegumesPercent: 100,
+			},
+			negative: 10, positive: 6, score: 4, grade: "c",
+		},
+		{
+			// energy from saturated fat 4 (518 kJ), saturated fat ratio 1; fruit 5
+			name: "fat: olive oil",
+			input: NutriScoreInput{
+				Category:                       NutriScoreCategoryFat,
+				Per100g:                        NutrientValues{EnergyKj: 3700, FatTotal: 100, SaturatedFat: 14},
+				FruitsVegetablesLegumesPercent: 100,
+			},
+			negative: 5, positive: 5, score: 0, grade: "b",
+		},
+		{
+			// energy from saturated fat 10 (1887 kJ), saturated fat ratio 9 (63%)
+			name: "fat: butter",
+			input: NutriScoreInput{
+				Category: NutriScoreCategoryFat,
+				Per100g:  NutrientValues{EnergyKj: 3000, FatTotal: 81, SaturatedFat: 51, Sugars: 0.6, Salt: 0.02, Proteins: 0.7},
+			},
+			negative: 19, positive: 0, score: 19, grade: "e",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeNutriScore(tt.input)
+			if got.InsufficientData {
+				t.Fatalf("unexpected insufficient data, missing %v", got.MissingNutrients)
+			}
+			if got.NegativePoints != tt.negative || got.PositivePoints != tt.positive || got.Score != tt.score || got.Grade != tt.grade {
+				t.Errorf("got -%d +%d = %d (%s), want -%d +%d = %d (%s); components %v %v",
+					got.NegativePoints, got.PositivePoints, got.Score, got.Grade,
+					tt.negative, tt.positive, tt.score, tt.grade,
+					got.NegativeComponents, got.PositiveComponents)
+			}
+		})
+	}
+}
+
+func TestComputeNutriScoreWater(t *testing.T) {
+	got := ComputeNutriScore(NutriScoreInput{Category: NutriScoreCategoryWater})
+	if got.Grade != "a" || got.InsufficientData {
+		t.Errorf("water = %q (insufficient %v), want a", got.Grade, got.InsufficientData)
+	}
+}
+
+func TestComputeNutriScoreMissingNutrients(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   NutriScoreInput
+		missing []string
+	}{
+		{
+			name:    "general without salt",
+			input:   NutriScoreInput{MissingNutrients: []string{NutrientSalt, NutrientFiber}},
+			missing: []string{NutrientSalt},
+		},
+		{
+			name:    "fat without total fat",
+			input:   NutriScoreInput{Category: NutriScoreCategoryFat, MissingNutrients: []string{NutrientFat}},
+			missing: []string{NutrientFat},
+		},
+		{
+			name: "nothing known",
+			input: NutriScoreInput{MissingNutrients: []string{
+				NutrientEnergy, NutrientCarbohydrates, NutrientSugars, NutrientProteins,
+				NutrientFat, NutrientSaturatedFat, NutrientSalt, NutrientFiber,
+			}},
+			missing: []string{NutrientEnergy, NutrientSugars, NutrientSaturatedFat, NutrientSalt},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ComputeNutriScore(tt.input)
+			if !got.InsufficientData || got.Grade != "" {
+				t.Errorf("got grade %q, insufficient %v; want no grade", got.Grade, got.InsufficientData)
+			}
+			if !reflect.DeepEqual(got.MissingNutrients, tt.missing) {
+				t.Errorf("missing = %v, want %v", got.MissingNutrients, tt.missing)
+			}
+		})
+	}
+
+	// Fiber isn't required
+	got := ComputeNutriScore(NutriScoreInput{MissingNutrients: []string{NutrientFiber}})
+	if got.InsufficientData {
+		t.Errorf("missing fiber gave insufficient data")
+	}
+}
+
+func TestExtractNutritionDataEmptyNutriments(t *testing.T) {
+	extracted, err := ExtractNutritionData(map[string]interface{}{
+		"status": 1.0,
+		"product": map[string]interface{}{
+			"code":         "8901234567890",
+			"product_name": "Unlabelled snack",
+			"nutriments":   map[string]interface{}{},
+		},
+	})
+	if err != nil {
+		t.Fatalf("ExtractNutritionData error: %v", err)
+	}
+
+	nutriscore := extracted.HealthScoring.Nutriscore
+	if nutriscore.Grade != "" || nutriscore.Source != "unavailable" {
+		t.Errorf("nutriscore = %q from %q, want no grade from unavailable", nutriscore.Grade, nutriscore.Source)
+	}
+	details := extracted.HealthScoring.NutritionScoreDetails
+	want := []string{NutrientEnergy, NutrientSugars, NutrientSaturatedFat, NutrientSalt}
+	if !details.InsufficientData || !reflect.DeepEqual(details.MissingNutrients, want) {
+		t.Errorf("details insufficient %v missing %v, want true %v", details.InsufficientData, details.MissingNutrients, want)
+	}
+	if extracted.NutritionalInformation.NutritionDataQuality != NutritionDataMissing {
+		t.Errorf("quality = %q, want %q", extracted.NutritionalInformation.NutritionDataQuality, NutritionDataMissing)
+	}
+}
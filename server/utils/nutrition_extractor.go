@@ -1,7 +1,10 @@
 package utils
 
 import (
+	"amobagan/barcode"
+	"amobagan/units"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -32,6 +35,8 @@ type ProductIdentification struct {
 	ProductType        string `json:"product_type"`
 	LastUpdated        string `json:"last_updated"`
 	DataFreshnessScore string `json:"data_freshness_score"`
+	// FSSAILicense is only known for products users entered from the label
+	FSSAILicense string `json:"fssai_license,omitempty"`
 }
 
 // Nutritional information structures
@@ -40,6 +45,76 @@ type NutritionalInformation struct {
 	PerServing           NutrientValues `json:"per_serving"`
 	NutritionDataQuality string         `json:"nutrition_data_quality"`
 	NutritionDataPer     string         `json:"nutrition_data_per"`
+	ServingBasis         ServingBasis   `json:"serving_basis"`
+	// MissingNutrients names the values the source doesn't have; they read as
+	// 0 in Per100g and PerServing
+	MissingNutrients []string `json:"missing_nutrients,omitempty"`
+}
+
+// Nutrients tracked in MissingNutrients
+const (
+	NutrientEnergy        = "energy"
+	NutrientCarbohydrates = "carbohydrates"
+	NutrientSugars        = "sugars"
+	NutrientProteins      = "proteins"
+	NutrientFat           = "fat"
+	NutrientSaturatedFat  = "saturated_fat"
+	NutrientSalt          = "salt"
+	NutrientFiber         = "fiber"
+)
+
+// Values of NutritionalInformation.NutritionDataQuality
+const (
+	NutritionDataComplete = "complete"
+	NutritionDataPartial  = "partial"
+	NutritionDataMissing  = "missing"
+)
+
+// nutrimentKeys are the OpenFoodFacts keys any of which provides a nutrient
+var nutrimentKeys = []struct {
+	nutrient string
+	keys     []string
+}{
+	{NutrientEnergy, []string{"energy-kcal_100g", "energy-kj_100g", "energy_100g"}},
+	{NutrientCarbohydrates, []string{"carbohydrates_100g"}},
+	{NutrientSugars, []string{"sugars_100g"}},
+	{NutrientProteins, []string{"proteins_100g"}},
+	{NutrientFat, []string{"fat_100g"}},
+	{NutrientSaturatedFat, []string{"saturated-fat_100g"}},
+	{NutrientSalt, []string{"salt_100g", "sodium_100g"}},
+	{NutrientFiber, []string{"fiber_100g"}},
+}
+
+// HasNutrient reports whether the source data has a value for the nutrient
+func (n NutritionalInformation) HasNutrient(nutrient string) bool {
+	for _, missing := range n.MissingNutrients {
+		if missing == nutrient {
+			return false
+		}
+	}
+	return true
+}
+
+// Where the serving used for per-serving values came from
+const (
+	ServingSourceServingQuantity = "serving_quantity"
+	ServingSourceServingSize     = "serving_size"
+	ServingSourcePackage         = "package_quantity"
+	ServingSourceDefault         = "default"
+)
+
+// ServingBasis says which value per-serving numbers were computed from
+type ServingBasis struct {
+	Source string `json:"source"`
+	// Value is the text the serving was read from
+	Value string  `json:"value,omitempty"`
+	Grams float64 `json:"grams"`
+	// Millilitres is set when the serving was a volume converted with Density
+	Millilitres float64 `json:"millilitres,omitempty"`
+	Density     float64 `json:"density,omitempty"`
+	// PackUnits is the number of units when one unit of a multipack was used
+	PackUnits int    `json:"pack_units,omitempty"`
+	Label     string `json:"label,omitempty"`
 }
 
 type NutrientValues struct {
@@ -70,6 +145,7 @@ type NutriScore struct {
 	Score            int    `json:"score"`
 	Version          string `json:"version"`
 	GradeDescription string `json:"grade_description"`
+	Source           string `json:"source"`
 }
 
 type NutrientLevels struct {
@@ -80,22 +156,35 @@ type NutrientLevels struct {
 }
 
 type NutritionScoreDetails struct {
-	NegativePoints int `json:"negative_points"`
-	PositivePoints int `json:"positive_points"`
-	FinalScore     int `json:"final_score"`
+	NegativePoints     int            `json:"negative_points"`
+	PositivePoints     int            `json:"positive_points"`
+	FinalScore         int            `json:"final_score"`
+	Category           string         `json:"category"`
+	NegativeComponents map[string]int `json:"negative_components"`
+	PositiveComponents map[string]int `json:"positive_components"`
+	ComputedGrade      string         `json:"computed_grade"`
+	UpstreamMismatch   bool           `json:"upstream_mismatch"`
+	// InsufficientData is set when required nutrients are missing and no
+	// grade was computed
+	InsufficientData bool     `json:"insufficient_data"`
+	MissingNutrients []string `json:"missing_nutrients,omitempty"`
 }
 
 // Processing classification structures
 type ProcessingClassification struct {
 	NovaGroup            string               `json:"nova_group"`
 	NovaGroupError       string               `json:"nova_group_error"`
+	NovaGroupSource      string               `json:"nova_group_source"`
 	ProcessingIndicators ProcessingIndicators `json:"processing_indicators"`
 }
 
 type ProcessingIndicators struct {
-	CategoriesSuggestProcessed bool     `json:"categories_suggest_processed"`
-	CategoryTags               []string `json:"category_tags"`
-	LikelyProcessingLevel      string   `json:"likely_processing_level"`
+	CategoriesSuggestProcessed bool           `json:"categories_suggest_processed"`
+	CategoryTags               []string       `json:"category_tags"`
+	LikelyProcessingLevel      string         `json:"likely_processing_level"`
+	ComputedNovaGroup          int            `json:"computed_nova_group"`
+	Evidence                   []NovaEvidence `json:"evidence"`
+	Reasons                    []string       `json:"reasons"`
 }
 
 // Food categorization structures
@@ -143,8 +232,10 @@ type PopulationSpecificWarnings struct {
 
 // Other structures
 type IngredientsAndAdditives struct {
-	IngredientsAvailable bool      `json:"ingredients_available"`
-	IngredientsStatus    string    `json:"ingredients_status"`
+	IngredientsAvailable bool               `json:"ingredients_available"`
+	IngredientsStatus    string             `json:"ingredients_status"`
+	IngredientsText      string             `json:"ingredients_text,omitempty"`
+	ParsedIngredients    []ParsedIngredient `json:"parsed_ingredients,omitempty"`
 	Allergens            Allergens `json:"allergens"`
 	Additives            Additives `json:"additives"`
 	Traces               Traces    `json:"traces"`
@@ -154,11 +245,23 @@ type Allergens struct {
 	DeclaredAllergens        []string `json:"declared_allergens"`
 	AllergensFromIngredients string   `json:"allergens_from_ingredients"`
 	AllergensStatus          string   `json:"allergens_status"`
+	DetectedAllergens        []string `json:"detected_allergens"`
 }
 
 type Additives struct {
-	AdditivesDetected bool   `json:"additives_detected"`
-	AdditivesStatus   string `json:"additives_status"`
+	AdditivesDetected bool               `json:"additives_detected"`
+	AdditivesStatus   string             `json:"additives_status"`
+	AdditivesCount    int                `json:"additives_count"`
+	DetectedAdditives []DetectedAdditive `json:"detected_additives"`
+}
+
+type DetectedAdditive struct {
+	Code          string `json:"code"`
+	Name          string `json:"name,omitempty"`
+	FunctionClass string `json:"function_class,omitempty"`
+	RiskTier      string `json:"risk_tier,omitempty"`
+	Known         bool   `json:"known"`
+	SourceText    string `json:"source_text"`
 }
 
 type Traces struct {
@@ -195,6 +298,11 @@ type DailyValuePercentages struct {
 type MarketInformation struct {
 	CountriesSold     []string          `json:"countries_sold"`
 	PopularityMetrics PopularityMetrics `json:"popularity_metrics"`
+	// Decoded from the barcode; the GS1 country is where the brand registered
+	BarcodeFormat string `json:"barcode_format,omitempty"`
+	GS1Prefix     string `json:"gs1_prefix,omitempty"`
+	GS1Country    string `json:"gs1_country,omitempty"`
+	BarcodeUsage  string `json:"barcode_usage,omitempty"`
 }
 
 type PopularityMetrics struct {
@@ -285,12 +393,19 @@ func ExtractNutritionData(rawData interface{}) (*ExtractedNutritionData, error)
 		return nil, fmt.Errorf("failed to extract nutritional information: %w", err)
 	}
 	extracted.NutritionalInformation = nutritionInfo
+	switch nutritionInfo.NutritionDataQuality {
+	case NutritionDataMissing:
+		extracted.ExtractionMetadata.ConfidenceScore.NutritionData = "low"
+	case NutritionDataPartial:
+		extracted.ExtractionMetadata.ConfidenceScore.NutritionData = "medium"
+	}
 
-	extracted.HealthScoring = extractHealthScoring(product)
+	extracted.HealthScoring = extractHealthScoring(product, nutritionInfo)
 	extracted.ProcessingClassification = extractProcessingClassification(product)
 	extracted.FoodCategorization = extractFoodCategorization(product)
 	extracted.HealthRiskAssessment = generateHealthRiskAssessment(nutritionInfo, extracted.HealthScoring)
 	extracted.IngredientsAndAdditives = extractIngredientsAndAdditives(product)
+	classifyAllergens(extracted)
 	extracted.ProductImages = extractProductImages(product)
 	extracted.ConsumptionRecommendations = generateConsumptionRecommendations(nutritionInfo)
 	extracted.MarketInformation = extractMarketInformation(product)
@@ -346,33 +461,150 @@ func extractNutritionalInformation(product map[string]interface{}) (NutritionalI
 	}
 
 	// Calculate per serving values
-	quantity := getStringValue(product, "quantity")
-	servingSize := extractServingSize(quantity)
+	basis := resolveServing(product)
 
-	perServing := calculatePerServing(per100g, servingSize)
-	perServing.ServingSize = quantity
-	perServing.ServingDescription = fmt.Sprintf("1 portion (%s)", quantity)
+	perServing := calculatePerServing(per100g, basis.Grams)
+	perServing.ServingSize = servingAmount(basis)
+	perServing.ServingDescription = servingDescription(basis)
+
+	missing := missingNutrients(nutrimentsMap)
+	quality := NutritionDataComplete
+	switch {
+	case len(missing) == len(nutrimentKeys):
+		quality = NutritionDataMissing
+	case len(missing) > 0:
+		quality = NutritionDataPartial
+	}
 
 	return NutritionalInformation{
 		Per100g:              per100g,
 		PerServing:           perServing,
-		NutritionDataQuality: "complete",
+		MissingNutrients:     missing,
+		NutritionDataQuality: quality,
 		NutritionDataPer:     "100g",
+		ServingBasis:         basis,
 	}, nil
 }
 
-func extractHealthScoring(product map[string]interface{}) HealthScoring {
+// resolveServing picks the serving per-serving values are computed for: the
+// database's serving_quantity, then the printed serving_size, then one unit of
+// the package, then 100 g. Volumes are converted with the category's density.
+func resolveServing(product map[string]interface{}) ServingBasis {
+	density := units.Density(productCategoryTags(product))
+	servingSize := getStringValue(product, "serving_size")
+
+	if amount := getFloatValue(product, "serving_quantity"); amount > 0 {
+		if q, err := units.FromValue(amount, getStringValue(product, "serving_quantity_unit")); err == nil {
+			value := servingSize
+			if value == "" {
+				value = q.Raw
+			} else if printed, err := units.Parse(servingSize); err == nil {
+				q.Label = printed.Label
+			} else {
+				q.Label = servingSize
+			}
+			return servingBasis(ServingSourceServingQuantity, value, q, q.Value, density)
+		}
+	}
+	if q, err := units.Parse(servingSize); err == nil {
+		return servingBasis(ServingSourceServingSize, servingSize, q, q.Value, density)
+	}
+	if quantity := getStringValue(product, "quantity"); quantity != "" {
+		if q, err := units.Parse(quantity); err == nil {
+			basis := servingBasis(ServingSourcePackage, quantity, q, q.PerUnit, density)
+			if q.Multipack() {
+				basis.PackUnits = q.Count
+			}
+			return basis
+		}
+	}
+	return ServingBasis{Source: ServingSourceDefault, Grams: 100}
+}
+
+func servingBasis(source, value string, q units.Quantity, amount, density float64) ServingBasis {
+	basis := ServingBasis{
+		Source: source,
+		Value:  value,
+		Grams:  amount,
+		Label:  q.Label,
+	}
+	if q.Dimension == units.Volume {
+		basis.Millilitres = amount
+		basis.Density = density
+		basis.Grams = math.Round(amount*density*100) / 100
+	}
+	return basis
+}
+
+// servingAmount prints the serving as it was given, in grams or millilitres
+func servingAmount(basis ServingBasis) string {
+	if basis.Millilitres > 0 {
+		return fmt.Sprintf("%sml", units.FormatAmount(basis.Millilitres))
+	}
+	return fmt.Sprintf("%sg", units.FormatAmount(basis.Grams))
+}
+
+func servingDescription(basis ServingBasis) string {
+	amount := servingAmount(basis)
+
+	switch basis.Source {
+	case ServingSourceServingQuantity, ServingSourceServingSize:
+		if basis.Label != "" {
+			return fmt.Sprintf("1 serving (%s, %s)", amount, basis.Label)
+		}
+		return fmt.Sprintf("1 serving (%s)", amount)
+	case ServingSourcePackage:
+		if basis.PackUnits > 1 {
+			return fmt.Sprintf("1 of %d units (%s)", basis.PackUnits, amount)
+		}
+		return fmt.Sprintf("1 portion (%s)", amount)
+	default:
+		return "100g (no serving size known)"
+	}
+}
+
+// productCategoryTags returns the product's category tags, falling back to
+// its free text categories
+func productCategoryTags(product map[string]interface{}) []string {
+	if tags := getStringSliceValue(product, "categories_tags"); len(tags) > 0 {
+		return tags
+	}
+	return extractCategoryTags(getStringValue(product, "categories"))
+}
+
+func extractHealthScoring(product map[string]interface{}, nutrition NutritionalInformation) HealthScoring {
 	nutriscore := NutriScore{
 		Grade:            getStringValue(product, "nutriscore_grade"),
 		Score:            int(getFloatValue(product, "nutriscore_score")),
 		Version:          getStringValue(product, "nutriscore_version"),
 		GradeDescription: getNutriScoreDescription(getStringValue(product, "nutriscore_grade")),
+		Source:           "openfoodfacts",
 	}
 
 	if nutriscore.Version == "" {
 		nutriscore.Version = "2023" // Default to latest version
 	}
 
+	computed := ComputeNutriScore(nutriScoreInputFromProduct(product, nutrition))
+
+	// Upstream grades are often missing for Indian products; use our own then,
+	// otherwise keep upstream and flag when the two disagree
+	upstreamGrade := strings.ToLower(nutriscore.Grade)
+	hasUpstream := len(upstreamGrade) == 1 && strings.Contains("abcde", upstreamGrade)
+	if !hasUpstream {
+		nutriscore = NutriScore{
+			Grade:            computed.Grade,
+			Score:            computed.Score,
+			Version:          "2023",
+			GradeDescription: getNutriScoreDescription(computed.Grade),
+			Source:           "computed",
+		}
+		// Without the required nutrients there is no grade rather than a made up one
+		if computed.InsufficientData {
+			nutriscore.Source = "unavailable"
+		}
+	}
+
 	nutrientLevels := NutrientLevels{
 		Fat:          getNestedStringValue(product, "nutrient_levels", "fat"),
 		SaturatedFat: getNestedStringValue(product, "nutrient_levels", "saturated-fat"),
@@ -384,26 +616,107 @@ func extractHealthScoring(product map[string]interface{}) HealthScoring {
 		Nutriscore:     nutriscore,
 		NutrientLevels: nutrientLevels,
 		NutritionScoreDetails: NutritionScoreDetails{
-			NegativePoints: int(getFloatValue(product, "nutriscore_score")),
-			PositivePoints: 0,
-			FinalScore:     int(getFloatValue(product, "nutriscore_score")),
+			NegativePoints:     computed.NegativePoints,
+			PositivePoints:     computed.PositivePoints,
+			FinalScore:         computed.Score,
+			Category:           computed.Category,
+			NegativeComponents: computed.NegativeComponents,
+			PositiveComponents: computed.PositiveComponents,
+			ComputedGrade:      computed.Grade,
+			UpstreamMismatch:   hasUpstream && !computed.InsufficientData && upstreamGrade != computed.Grade,
+			InsufficientData:   computed.InsufficientData,
+			MissingNutrients:   computed.MissingNutrients,
 		},
 	}
 }
 
+// nonNutritiveSweeteners are the additive tags that add beverage penalty points
+var nonNutritiveSweeteners = []string{"en:e950", "en:e951", "en:e952", "en:e954", "en:e955", "en:e957", "en:e959", "en:e960", "en:e961", "en:e962", "en:e969"}
+
+func nutriScoreInputFromProduct(product map[string]interface{}, nutrition NutritionalInformation) NutriScoreInput {
+	categoryTags := getStringSliceValue(product, "categories_tags")
+	if len(categoryTags) == 0 {
+		categoryTags = extractCategoryTags(getStringValue(product, "categories"))
+	}
+	category, redMeat := DetectNutriScoreCategory(categoryTags)
+
+	var fvl float64
+	if nutriments, ok := product["nutriments"].(map[string]interface{}); ok {
+		fvl = getFloatValue(nutriments, "fruits-vegetables-legumes-estimate-from-ingredients_100g")
+		if fvl == 0 {
+			fvl = getFloatValue(nutriments, "fruits-vegetables-nuts-estimate-from-ingredients_100g")
+		}
+	}
+
+	sweetened := false
+	for _, tag := range getStringSliceValue(product, "additives_tags") {
+		for _, s := range nonNutritiveSweeteners {
+			if tag == s {
+				sweetened = true
+			}
+		}
+	}
+
+	return NutriScoreInput{
+		Category:                       category,
+		Per100g:                        nutrition.Per100g,
+		MissingNutrients:               nutrition.MissingNutrients,
+		FruitsVegetablesLegumesPercent: fvl,
+		NonNutritiveSweeteners:         sweetened,
+		RedMeat:                        redMeat,
+	}
+}
+
 func extractProcessingClassification(product map[string]interface{}) ProcessingClassification {
 	categories := getStringValue(product, "categories")
 	categoryTags := extractCategoryTags(categories)
+	nova := ClassifyNova(getStringValue(product, "ingredients_text"))
 
-	return ProcessingClassification{
-		NovaGroup:      getStringValue(product, "nova_group"),
-		NovaGroupError: getStringValue(product, "nova_group_error"),
+	classification := ProcessingClassification{
+		NovaGroup:       getStringValue(product, "nova_group"),
+		NovaGroupError:  getStringValue(product, "nova_group_error"),
+		NovaGroupSource: "openfoodfacts",
 		ProcessingIndicators: ProcessingIndicators{
 			CategoriesSuggestProcessed: isProcessedFood(categories),
 			CategoryTags:               categoryTags,
 			LikelyProcessingLevel:      determineLikelyProcessingLevel(categories),
+			ComputedNovaGroup:          nova.Group,
+			Evidence:                   nova.Evidence,
+			Reasons:                    novaReasons(nova),
 		},
 	}
+
+	// OpenFoodFacts sometimes returns nova_group as a number
+	if classification.NovaGroup == "" {
+		if group := getFloatValue(product, "nova_group"); group > 0 {
+			classification.NovaGroup = strconv.Itoa(int(group))
+		}
+	}
+
+	if classification.NovaGroup == "" {
+		if nova.Group > 0 {
+			classification.NovaGroup = strconv.Itoa(nova.Group)
+			classification.NovaGroupSource = "computed"
+		} else {
+			classification.NovaGroupSource = ""
+		}
+	}
+
+	// The reported group, upstream or computed from ingredients, beats a
+	// guess from category names
+	if group, err := strconv.Atoi(classification.NovaGroup); err == nil && group >= 1 && group <= 4 {
+		classification.ProcessingIndicators.LikelyProcessingLevel = NovaProcessingLevel(group)
+	}
+
+	return classification
+}
+
+func novaReasons(nova NovaClassification) []string {
+	reasons := make([]string, 0, len(nova.Evidence))
+	for _, e := range nova.Evidence {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", strings.ReplaceAll(e.Marker, "_", " "), e.Ingredient))
+	}
+	return reasons
 }
 
 func extractFoodCategorization(product map[string]interface{}) FoodCategorization {
@@ -452,18 +765,33 @@ func generateHealthRiskAssessment(nutrition NutritionalInformation, scoring Heal
 
 func extractIngredientsAndAdditives(product map[string]interface{}) IngredientsAndAdditives {
 	ingredients := getStringValue(product, "ingredients_text")
+	parsed := ParseIngredients(ingredients)
+	additiveTags := getStringSliceValue(product, "additives_tags")
+	detected := DetectAdditives(parsed, additiveTags)
+
+	additivesStatus := "cannot_determine_without_ingredients"
+	switch {
+	case len(detected) > 0:
+		additivesStatus = "detected"
+	case ingredients != "" || additiveTags != nil:
+		additivesStatus = "none_detected"
+	}
 
 	return IngredientsAndAdditives{
 		IngredientsAvailable: ingredients != "",
 		IngredientsStatus:    getIngredientsStatus(ingredients),
+		IngredientsText:      ingredients,
+		ParsedIngredients:    parsed,
 		Allergens: Allergens{
 			DeclaredAllergens:        extractAllergens(product),
 			AllergensFromIngredients: getStringValue(product, "allergens_from_ingredients"),
 			AllergensStatus:          "incomplete",
 		},
 		Additives: Additives{
-			AdditivesDetected: false,
-			AdditivesStatus:   "cannot_determine_without_ingredients",
+			AdditivesDetected: len(detected) > 0,
+			AdditivesStatus:   additivesStatus,
+			AdditivesCount:    len(detected),
+			DetectedAdditives: detected,
 		},
 		Traces: Traces{
 			DeclaredTraces: extractTraces(product),
@@ -472,6 +800,31 @@ func extractIngredientsAndAdditives(product map[string]interface{}) IngredientsA
 	}
 }
 
+// classifyAllergens fills DetectedAllergens from declarations, traces and the
+// parsed ingredient list, and replaces the placeholder status
+func classifyAllergens(extracted *ExtractedNutritionData) {
+	allergens := &extracted.IngredientsAndAdditives.Allergens
+	allergens.DetectedAllergens = []string{}
+	seen := map[string]bool{}
+	for _, m := range DetectProductAllergens(extracted) {
+		if !seen[m.Allergen] {
+			seen[m.Allergen] = true
+			allergens.DetectedAllergens = append(allergens.DetectedAllergens, m.Allergen)
+		}
+	}
+
+	switch {
+	case len(allergens.DeclaredAllergens) > 0:
+		allergens.AllergensStatus = "declared"
+	case len(allergens.DetectedAllergens) > 0:
+		allergens.AllergensStatus = "detected_from_ingredients"
+	case extracted.IngredientsAndAdditives.IngredientsAvailable:
+		allergens.AllergensStatus = "none_detected"
+	default:
+		allergens.AllergensStatus = "incomplete"
+	}
+}
+
 func extractProductImages(product map[string]interface{}) ProductImages {
 	return ProductImages{
 		FrontImage: ImageSet{
@@ -487,21 +840,31 @@ func extractProductImages(product map[string]interface{}) ProductImages {
 	}
 }
 
+// WHO-style daily reference values for an average adult, used when nothing is
+// known about the user
+const (
+	DefaultDailyEnergyKcal   = 2000.0
+	DefaultDailySugars       = 25.0 // grams, 5% of energy
+	DefaultDailySaturatedFat = 20.0 // grams, under 10% of energy
+	DefaultDailySalt         = 6.0  // grams
+	DefaultDailyFiber        = 28.0 // grams, 14 g per 1000 kcal
+)
+
 func generateConsumptionRecommendations(nutrition NutritionalInformation) ConsumptionRecommendations {
 	perServing := nutrition.PerServing
 
-	safeServingSize := calculateSafeServingSize(perServing.Sugars, perServing.ServingSize)
+	safeServingGrams := calculateSafeServingSize(perServing.Sugars, nutrition.ServingBasis.Grams)
 
 	return ConsumptionRecommendations{
-		SafeServingSize:         safeServingSize,
+		SafeServingSize:         fmt.Sprintf("%.0fg", safeServingGrams),
 		SafeServingReasoning:    "based_on_sugar_content_analysis",
 		FrequencyRecommendation: determineFrequencyRecommendation(perServing.Sugars),
-		MaxWeeklyConsumption:    calculateMaxWeeklyConsumption(safeServingSize),
+		MaxWeeklyConsumption:    calculateMaxWeeklyConsumption(safeServingGrams),
 		DailyValuePercentages: DailyValuePercentages{
-			CaloriesPerServing:     fmt.Sprintf("%.1f%%", (perServing.EnergyKcal/2000)*100),
-			SugarsPerServing:       fmt.Sprintf("%.1f%%", (perServing.Sugars/25)*100),
-			SaturatedFatPerServing: fmt.Sprintf("%.1f%%", (perServing.SaturatedFat/20)*100),
-			SaltPerServing:         fmt.Sprintf("%.1f%%", (perServing.Salt/6)*100),
+			CaloriesPerServing:     fmt.Sprintf("%.1f%%", (perServing.EnergyKcal/DefaultDailyEnergyKcal)*100),
+			SugarsPerServing:       fmt.Sprintf("%.1f%%", (perServing.Sugars/DefaultDailySugars)*100),
+			SaturatedFatPerServing: fmt.Sprintf("%.1f%%", (perServing.SaturatedFat/DefaultDailySaturatedFat)*100),
+			SaltPerServing:         fmt.Sprintf("%.1f%%", (perServing.Salt/DefaultDailySalt)*100),
 		},
 	}
 }
@@ -509,7 +872,7 @@ func generateConsumptionRecommendations(nutrition NutritionalInformation) Consum
 func extractMarketInformation(product map[string]interface{}) MarketInformation {
 	countries := extractCountries(product)
 
-	return MarketInformation{
+	market := MarketInformation{
 		CountriesSold: countries,
 		PopularityMetrics: PopularityMetrics{
 			ScansCount:        int(getFloatValue(product, "scans_n")),
@@ -517,6 +880,13 @@ func extractMarketInformation(product map[string]interface{}) MarketInformation
 			PopularityRanking: "unknown",
 		},
 	}
+	if code, err := barcode.Parse(getStringValue(product, "code")); err == nil {
+		market.BarcodeFormat = string(code.Format)
+		market.GS1Prefix = code.Prefix
+		market.GS1Country = code.Country
+		market.BarcodeUsage = string(code.Usage)
+	}
+	return market
 }
 
 func extractDataQualityIndicators(product map[string]interface{}) DataQualityIndicators {
@@ -583,6 +953,35 @@ func getStringValue(data map[string]interface{}, key string) string {
 	return ""
 }
 
+// missingNutrients lists the tracked nutrients without a readable value
+func missingNutrients(nutriments map[string]interface{}) []string {
+	var missing []string
+	for _, n := range nutrimentKeys {
+		found := false
+		for _, key := range n.keys {
+			if hasFloatValue(nutriments, key) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, n.nutrient)
+		}
+	}
+	return missing
+}
+
+func hasFloatValue(data map[string]interface{}, key string) bool {
+	switch v := data[key].(type) {
+	case float64, int:
+		return true
+	case string:
+		_, err := strconv.ParseFloat(v, 64)
+		return err == nil
+	}
+	return false
+}
+
 func getFloatValue(data map[string]interface{}, key string) float64 {
 	if val, exists := data[key]; exists {
 		switch v := val.(type) {
@@ -599,6 +998,20 @@ func getFloatValue(data map[string]interface{}, key string) float64 {
 	return 0
 }
 
+func getStringSliceValue(data map[string]interface{}, key string) []string {
+	values, ok := data[key].([]interface{})
+	if !ok {
+		return nil
+	}
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		if str, ok := v.(string); ok {
+			result = append(result, str)
+		}
+	}
+	return result
+}
+
 func getNestedStringValue(data map[string]interface{}, parentKey, childKey string) string {
 	if parent, exists := data[parentKey]; exists {
 		if parentMap, ok := parent.(map[string]interface{}); ok {
@@ -608,21 +1021,6 @@ func getNestedStringValue(data map[string]interface{}, parentKey, childKey strin
 	return ""
 }
 
-func extractServingSize(quantity string) float64 {
-	if quantity == "" {
-		return 100 // Default to 100g
-	}
-	
-	// Remove common units and extract number
-	numStr := strings.TrimSuffix(strings.TrimSuffix(quantity, "g"), "ml")
-	numStr = strings.TrimSpace(numStr)
-	
-	if val, err := strconv.ParseFloat(numStr, 64); err == nil {
-		return val
-	}
-	return 100 // Default if parsing fails
-}
-
 func calculatePerServing(per100g NutrientValues, servingSize float64) NutrientValues {
 	ratio := servingSize / 100.0
 
@@ -801,21 +1199,17 @@ func assessWeightManagementRisk(calories float64) string {
 
 // Consumption recommendation functions
 
-func calculateSafeServingSize(sugars float64, currentServing string) string {
-	servingVal := extractServingSize(currentServing)
-	
+func calculateSafeServingSize(sugars float64, servingGrams float64) float64 {
 	// Reduce serving size based on sugar content
 	if sugars > 15 {
 		// Very high sugar - recommend 1/4 serving
-		safeSize := servingVal / 4
-		return fmt.Sprintf("%.0fg", safeSize)
+		return servingGrams / 4
 	} else if sugars > 10 {
 		// High sugar - recommend 1/2 serving
-		safeSize := servingVal / 2
-		return fmt.Sprintf("%.0fg", safeSize)
+		return servingGrams / 2
 	}
 	
-	return currentServing
+	return servingGrams
 }
 
 func determineFrequencyRecommendation(sugars float64) string {
@@ -833,9 +1227,8 @@ func determineFrequencyRecommendation(sugars float64) string {
 	}
 }
 
-func calculateMaxWeeklyConsumption(safeServingSize string) string {
-	servingVal := extractServingSize(safeServingSize)
-	maxWeekly := servingVal * 2 // Maximum 2 safe servings per week
+func calculateMaxWeeklyConsumption(safeServingGrams float64) string {
+	maxWeekly := safeServingGrams * 2 // Maximum 2 safe servings per week
 	return fmt.Sprintf("%.0fg", maxWeekly)
 }
 
@@ -953,9 +1346,8 @@ func extractDataQualityWarnings(product map[string]interface{}) []string {
 
 	// Check serving size vs product quantity
 	quantity := getStringValue(product, "quantity")
-	if quantity != "" {
-		servingSize := extractServingSize(quantity)
-		if servingSize < 50 { // Very small serving size
+	if q, err := units.Parse(quantity); err == nil {
+		if q.PerUnit < 50 { // Very small serving size
 			warnings = append(warnings, "serving-quantity-very-small")
 		}
 	}
@@ -53,6 +53,12 @@ func getErrorCode(statusCode int) string {
 		return "INTERNAL_SERVER_ERROR"
 	case http.StatusConflict:
 		return "CONFLICT"
+	case http.StatusTooManyRequests:
+		return "TOO_MANY_REQUESTS"
+	case http.StatusServiceUnavailable:
+		return "SERVICE_UNAVAILABLE"
+	case http.StatusGatewayTimeout:
+		return "GATEWAY_TIMEOUT"
 	default:
 		return "UNKNOWN_ERROR"
 	}
@@ -140,4 +146,16 @@ func InternalServerError(c *gin.Context, message string, details interface{}) {
 
 func ConflictError(c *gin.Context, message string, details interface{}) {
 	ErrorResponse(c, http.StatusConflict, "CONFLICT", message, details)
-} 
\ No newline at end of file
+}
+
+func TooManyRequests(c *gin.Context, message string, details interface{}) {
+	ErrorResponse(c, http.StatusTooManyRequests, "TOO_MANY_REQUESTS", message, details)
+}
+
+func ServiceUnavailable(c *gin.Context, message string, details interface{}) {
+	ErrorResponse(c, http.StatusServiceUnavailable, "SERVICE_UNAVAILABLE", message, details)
+}
+
+func GatewayTimeout(c *gin.Context, message string, details interface{}) {
+	ErrorResponse(c, http.StatusGatewayTimeout, "GATEWAY_TIMEOUT", message, details)
+}